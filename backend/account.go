@@ -0,0 +1,320 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Purposes of single-use tokens sent by email
+const (
+	tokenPurposePasswordReset = "password_reset"
+	tokenPurposeEmailVerify   = "email_verify"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	emailVerifyTTL   = 48 * time.Hour
+)
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// dummyPasswordHash is compared against when a login names an unknown
+// account so the response time does not reveal whether it exists. It is
+// computed on first use, as the server binary also starts every sandbox.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("algovault-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// normalizeEmail returns an email in the form it is stored and looked up in
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// findUserByEmail looks a user up by email, ignoring case and surrounding
+// whitespace. The lookup uses idx_users_email_lower. It returns nil if no
+// user has that email.
+func (d *Database) findUserByEmail(email string) (*User, error) {
+	query := d.convertPlaceholders("SELECT " + userColumns + ", password FROM users WHERE LOWER(email) = ?")
+	var password string
+	user, err := scanUser(d.DB.QueryRow(query, normalizeEmail(email)), &password)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.Password = password
+	return &user, nil
+}
+
+// createUserToken issues a single-use token for purpose. Earlier unused
+// tokens with the same purpose stop working.
+func (d *Database) createUserToken(userID, purpose string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	query := d.convertPlaceholders("UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL")
+	if _, err := d.DB.Exec(query, now, userID, purpose); err != nil {
+		return "", err
+	}
+
+	token := generateID() + generateID()
+	query = d.convertPlaceholders("INSERT INTO user_tokens (id, user_id, purpose, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)")
+	if _, err := d.DB.Exec(query, generateID(), userID, purpose, hashToken(token), now.Add(ttl), now); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeUserToken marks a token as used and returns the user it was issued to
+func (d *Database) consumeUserToken(token, purpose string) (string, error) {
+	var id, userID string
+	var expiresAt time.Time
+	var usedAt sql.NullTime
+	query := d.convertPlaceholders("SELECT id, user_id, expires_at, used_at FROM user_tokens WHERE token_hash = ? AND purpose = ?")
+	err := d.DB.QueryRow(query, hashToken(token), purpose).Scan(&id, &userID, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return "", errInvalidUserToken
+	}
+	if err != nil {
+		return "", err
+	}
+	if usedAt.Valid || time.Now().After(expiresAt) {
+		return "", errInvalidUserToken
+	}
+
+	query = d.convertPlaceholders("UPDATE user_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL")
+	result, err := d.DB.Exec(query, time.Now(), id)
+	if err != nil {
+		return "", err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return "", errInvalidUserToken
+	}
+	return userID, nil
+}
+
+// sendVerificationEmail emails a user a link to verify their address
+func (h *Handlers) sendVerificationEmail(userID, email, name string) error {
+	token, err := h.DB.createUserToken(userID, tokenPurposeEmailVerify, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", h.AppURL, token)
+	body := fmt.Sprintf("Hi %s,\n\nPlease confirm your email address for AlgoVault by opening this link:\n\n%s\n\nThe link expires in %d hours.\n",
+		name, link, int(emailVerifyTTL/time.Hour))
+	return h.Mailer.Send(email, "Verify your AlgoVault email", body)
+}
+
+// sendPasswordResetEmail emails a user a link to choose a new password
+func (h *Handlers) sendPasswordResetEmail(userID, email, name string) error {
+	token, err := h.DB.createUserToken(userID, tokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.AppURL, token)
+	body := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset your AlgoVault password. Open this link to choose a new one:\n\n%s\n\n"+
+		"The link expires in %d minutes. If you did not ask for this you can ignore this email.\n",
+		name, link, int(passwordResetTTL/time.Minute))
+	return h.Mailer.Send(email, "Reset your AlgoVault password", body)
+}
+
+// sendAccountExistsEmail tells the owner of an account that someone tried to
+// register with their address
+func (h *Handlers) sendAccountExistsEmail(email, name string) error {
+	body := fmt.Sprintf("Hi %s,\n\nSomeone tried to create an AlgoVault account with this email address, which already has one. "+
+		"If it was you, sign in at the link below, where \"Forgot password\" lets you choose a new password:\n\n%s\n\nOtherwise you can ignore this email.\n",
+		name, h.AppURL)
+	return h.Mailer.Send(email, "You already have an AlgoVault account", body)
+}
+
+// ChangePassword sets a new password for the signed in user. All other
+// sessions are revoked and a fresh token pair is returned.
+func (h *Handlers) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		respondWithError(w, http.StatusBadRequest, "Current and new password are required")
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		respondWithError(w, http.StatusBadRequest, "New password must be different from the current password")
+		return
+	}
+
+	userID := getUserID(r)
+
+	var storedHash string
+	query := h.DB.convertPlaceholders("SELECT password FROM users WHERE id = ?")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&storedHash); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(req.CurrentPassword)); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Current password is incorrect")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error hashing password")
+		return
+	}
+
+	query = h.DB.convertPlaceholders("UPDATE users SET password = ?, must_change_password = 0 WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, string(hashedPassword), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating password")
+		return
+	}
+	if err := h.DB.revokeAllSessions(userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking sessions")
+		return
+	}
+
+	tokens, err := h.issueTokens(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the address belongs to an account.
+func (h *Handlers) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		respondWithError(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	user, err := h.DB.findUserByEmail(req.Email)
+	if err != nil {
+		log.Printf("Error looking up user for password reset: %v", err)
+	} else if user != nil && user.DisabledAt == nil {
+		if err := h.sendPasswordResetEmail(user.ID, user.Email, user.Name); err != nil {
+			log.Printf("Error sending password reset email to %s: %v", user.Email, err)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password using an emailed reset token and signs
+// the user out everywhere
+func (h *Handlers) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Token == "" || req.NewPassword == "" {
+		respondWithError(w, http.StatusBadRequest, "Token and new password are required")
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error hashing password")
+		return
+	}
+
+	userID, err := h.DB.consumeUserToken(req.Token, tokenPurposePasswordReset)
+	if err == errInvalidUserToken {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	// Receiving the reset email also proves ownership of the address
+	query := h.DB.convertPlaceholders("UPDATE users SET password = ?, must_change_password = 0, email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, string(hashedPassword), time.Now(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating password")
+		return
+	}
+	if err := h.DB.revokeAllSessions(userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking sessions")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Password has been reset. Please sign in with your new password."})
+}
+
+// VerifyEmail marks a user's email as verified using an emailed token
+func (h *Handlers) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	userID, err := h.DB.consumeUserToken(req.Token, tokenPurposeEmailVerify)
+	if err == errInvalidUserToken {
+		respondWithError(w, http.StatusBadRequest, "Invalid or expired verification token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, time.Now(), userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error verifying email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Email verified"})
+}
+
+// ResendVerificationEmail sends a new verification link to the signed in user
+func (h *Handlers) ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	var email, name string
+	var verifiedAt sql.NullTime
+	query := h.DB.convertPlaceholders("SELECT email, name, email_verified_at FROM users WHERE id = ?")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&email, &name, &verifiedAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if verifiedAt.Valid {
+		respondWithError(w, http.StatusBadRequest, "Email is already verified")
+		return
+	}
+
+	if err := h.sendVerificationEmail(userID, email, name); err != nil {
+		log.Printf("Error sending verification email to %s: %v", email, err)
+		respondWithError(w, http.StatusInternalServerError, "Error sending verification email")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Verification email sent"})
+}
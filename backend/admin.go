@@ -0,0 +1,539 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const userColumns = "id, email, name, COALESCE(role, ''), disabled_at, must_change_password, email_verified_at, totp_enabled_at IS NOT NULL, created_at"
+
+// scanUser reads a row selected with userColumns followed by any extra columns
+func scanUser(scanner interface{ Scan(...interface{}) error }, extra ...interface{}) (User, error) {
+	var user User
+	var disabledAt, emailVerifiedAt sql.NullTime
+	var mustChangePassword int
+	dest := []interface{}{&user.ID, &user.Email, &user.Name, &user.Role, &disabledAt, &mustChangePassword, &emailVerifiedAt, &user.TwoFactorEnabled, &user.CreatedAt}
+	err := scanner.Scan(append(dest, extra...)...)
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+	user.MustChangePassword = mustChangePassword == 1
+	return user, err
+}
+
+// getUserByID loads a user for the admin API, returning nil if it does not exist
+func (h *Handlers) getUserByID(userID string) (*User, error) {
+	query := h.DB.convertPlaceholders("SELECT " + userColumns + " FROM users WHERE id = ?")
+	user, err := scanUser(h.DB.DB.QueryRow(query, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// countActiveAdmins returns how many enabled admin accounts exist
+func (h *Handlers) countActiveAdmins() (int, error) {
+	var count int
+	err := h.DB.DB.QueryRow("SELECT COUNT(*) FROM users WHERE role = 'admin' AND disabled_at IS NULL").Scan(&count)
+	return count, err
+}
+
+// isLastActiveAdmin reports whether user is the only enabled admin left
+func (h *Handlers) isLastActiveAdmin(user *User) (bool, error) {
+	if user.Role != "admin" || user.DisabledAt != nil {
+		return false, nil
+	}
+	count, err := h.countActiveAdmins()
+	return count <= 1, err
+}
+
+// AdminGetUsers lists all users. The optional q parameter filters by email or name.
+func (h *Handlers) AdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	search := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+
+	query := "SELECT " + userColumns + " FROM users"
+	args := []interface{}{}
+	if search != "" {
+		query += " WHERE LOWER(email) LIKE ? OR LOWER(name) LIKE ?"
+		args = append(args, "%"+search+"%", "%"+search+"%")
+	}
+	query += " ORDER BY created_at"
+
+	rows, err := h.DB.DB.Query(h.DB.convertPlaceholders(query), args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning user")
+			return
+		}
+		users = append(users, user)
+	}
+
+	respondWithJSON(w, http.StatusOK, users)
+}
+
+// AdminGetUser returns a single user
+func (h *Handlers) AdminGetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUserByID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// AdminUpdateUserRole changes a user's global role
+func (h *Handlers) AdminUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	exists, err := h.DB.roleExists(req.Role)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusBadRequest, "Unknown role: "+req.Role)
+		return
+	}
+
+	user, err := h.getUserByID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if req.Role != "admin" {
+		last, err := h.isLastActiveAdmin(user)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if last {
+			respondWithError(w, http.StatusBadRequest, "At least one active admin is required")
+			return
+		}
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE users SET role = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, req.Role, user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating role")
+		return
+	}
+	h.audit(r, AuditUserRoleChange, "user", user.ID, "", map[string]string{"role": user.Role}, map[string]string{"role": req.Role})
+
+	user.Role = req.Role
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// AdminDisableUser disables an account and signs it out everywhere
+func (h *Handlers) AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if userID == getUserID(r) {
+		respondWithError(w, http.StatusBadRequest, "You cannot disable your own account")
+		return
+	}
+
+	user, err := h.getUserByID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if user.DisabledAt != nil {
+		respondWithJSON(w, http.StatusOK, user)
+		return
+	}
+
+	last, err := h.isLastActiveAdmin(user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if last {
+		respondWithError(w, http.StatusBadRequest, "At least one active admin is required")
+		return
+	}
+
+	now := time.Now()
+	query := h.DB.convertPlaceholders("UPDATE users SET disabled_at = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, now, user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error disabling user")
+		return
+	}
+	if err := h.DB.revokeAllSessions(user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking sessions")
+		return
+	}
+
+	h.audit(r, AuditUserDisable, "user", user.ID, "", map[string]bool{"disabled": false}, map[string]bool{"disabled": true})
+
+	user.DisabledAt = &now
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// AdminEnableUser re-enables a disabled account
+func (h *Handlers) AdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUserByID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE users SET disabled_at = NULL WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enabling user")
+		return
+	}
+	h.audit(r, AuditUserEnable, "user", user.ID, "", map[string]bool{"disabled": user.DisabledAt != nil}, map[string]bool{"disabled": false})
+
+	user.DisabledAt = nil
+	respondWithJSON(w, http.StatusOK, user)
+}
+
+// AdminResetUserPassword replaces a user's password with a temporary one.
+// The user is signed out and has to choose a new password on next login.
+func (h *Handlers) AdminResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUserByID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	temporaryPassword := generateID()[:16]
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(temporaryPassword), bcrypt.DefaultCost)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error hashing password")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE users SET password = ?, must_change_password = 1 WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, string(hashedPassword), user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting password")
+		return
+	}
+	if err := h.DB.revokeAllSessions(user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking sessions")
+		return
+	}
+	h.audit(r, AuditUserPasswordReset, "user", user.ID, "", map[string]bool{"mustChangePassword": user.MustChangePassword}, map[string]bool{"mustChangePassword": true})
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"message":           "Password reset. The user must change it on next login.",
+		"temporaryPassword": temporaryPassword,
+	})
+}
+
+// AdminDeleteUser deletes a user together with their sessions and memberships.
+// Workspaces left without members are deleted with their content, and
+// workspaces left without an owner are handed to their oldest member.
+func (h *Handlers) AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+	if userID == getUserID(r) {
+		respondWithError(w, http.StatusBadRequest, "You cannot delete your own account")
+		return
+	}
+
+	user, err := h.getUserByID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	last, err := h.isLastActiveAdmin(user)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if last {
+		respondWithError(w, http.StatusBadRequest, "At least one active admin is required")
+		return
+	}
+
+	// Collect memberships first; rows must be closed before running other queries
+	query := h.DB.convertPlaceholders("SELECT workspace_id FROM workspace_members WHERE user_id = ?")
+	rows, err := h.DB.DB.Query(query, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	var workspaceIDs []string
+	for rows.Next() {
+		var workspaceID string
+		if err := rows.Scan(&workspaceID); err != nil {
+			rows.Close()
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		workspaceIDs = append(workspaceIDs, workspaceID)
+	}
+	rows.Close()
+
+	query = h.DB.convertPlaceholders("DELETE FROM workspace_members WHERE user_id = ?")
+	if _, err := h.DB.DB.Exec(query, user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error removing memberships")
+		return
+	}
+
+	for _, workspaceID := range workspaceIDs {
+		if err := h.DB.settleWorkspaceAfterLeave(workspaceID); err != nil {
+			log.Printf("Error cleaning up workspace %s: %v", workspaceID, err)
+			respondWithError(w, http.StatusInternalServerError, "Error cleaning up workspaces")
+			return
+		}
+	}
+
+	// Remove the account's mock interviews
+	for _, table := range []string{"interview_submissions", "interview_problems"} {
+		query = h.DB.convertPlaceholders(fmt.Sprintf("DELETE FROM %s WHERE session_id IN (SELECT id FROM interview_sessions WHERE user_id = ?)", table))
+		if _, err := h.DB.DB.Exec(query, user.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error removing interviews")
+			return
+		}
+	}
+	query = h.DB.convertPlaceholders("DELETE FROM problem_list_items WHERE list_id IN (SELECT id FROM problem_lists WHERE user_id = ?)")
+	if _, err := h.DB.DB.Exec(query, user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error removing lists")
+		return
+	}
+
+	// Remove everything else tied to the account
+	for _, table := range []string{"refresh_tokens", "user_tokens", "recovery_codes", "api_keys", "user_identities", "problem_progress", "problem_attempts", "interview_sessions", "problem_lists"} {
+		query = h.DB.convertPlaceholders(fmt.Sprintf("DELETE FROM %s WHERE user_id = ?", table))
+		if _, err := h.DB.DB.Exec(query, user.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error removing sessions")
+			return
+		}
+	}
+
+	query = h.DB.convertPlaceholders("DELETE FROM users WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting user")
+		return
+	}
+	h.audit(r, AuditUserDelete, "user", user.ID, "", user, nil)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "User deleted"})
+}
+
+// settleWorkspaceAfterLeave deletes a workspace nobody belongs to any more or
+// promotes its oldest member when no owner is left
+func (d *Database) settleWorkspaceAfterLeave(workspaceID string) error {
+	var members, owners int
+	query := d.convertPlaceholders("SELECT COUNT(*), COALESCE(SUM(CASE WHEN role = ? THEN 1 ELSE 0 END), 0) FROM workspace_members WHERE workspace_id = ?")
+	if err := d.DB.QueryRow(query, WorkspaceRoleOwner, workspaceID).Scan(&members, &owners); err != nil {
+		return err
+	}
+
+	if members == 0 {
+		if _, err := d.clearWorkspaceData(workspaceID); err != nil {
+			return err
+		}
+		query = d.convertPlaceholders("UPDATE users SET active_workspace_id = '' WHERE active_workspace_id = ?")
+		if _, err := d.DB.Exec(query, workspaceID); err != nil {
+			return err
+		}
+		_, err := d.DB.Exec(d.convertPlaceholders("DELETE FROM workspaces WHERE id = ?"), workspaceID)
+		return err
+	}
+
+	if owners > 0 {
+		return nil
+	}
+
+	var newOwnerID string
+	query = d.convertPlaceholders("SELECT user_id FROM workspace_members WHERE workspace_id = ? ORDER BY created_at LIMIT 1")
+	if err := d.DB.QueryRow(query, workspaceID).Scan(&newOwnerID); err != nil {
+		return err
+	}
+
+	query = d.convertPlaceholders("UPDATE workspace_members SET role = ? WHERE workspace_id = ? AND user_id = ?")
+	if _, err := d.DB.Exec(query, WorkspaceRoleOwner, workspaceID, newOwnerID); err != nil {
+		return err
+	}
+	query = d.convertPlaceholders("UPDATE workspaces SET owner_id = ?, updated_at = ? WHERE id = ?")
+	_, err := d.DB.Exec(query, newOwnerID, time.Now(), workspaceID)
+	return err
+}
+
+// RolePolicy describes a role, its permissions and its security policy
+type RolePolicy struct {
+	Role        string   `json:"role"`
+	Permissions []string `json:"permissions"`
+	Require2FA  bool     `json:"require2fa"`
+}
+
+// AdminGetRoles lists every role with its permissions and whether it requires 2FA
+func (h *Handlers) AdminGetRoles(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.DB.Query(`
+		SELECT rp.role, rp.permission, COALESCE(p.require_2fa, 0)
+		FROM role_permissions rp
+		LEFT JOIN role_policies p ON p.role = rp.role
+		ORDER BY rp.role, rp.permission
+	`)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	roles := []*RolePolicy{}
+	var current *RolePolicy
+	for rows.Next() {
+		var role, permission string
+		var require2FA int
+		if err := rows.Scan(&role, &permission, &require2FA); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning role")
+			return
+		}
+		if current == nil || current.Role != role {
+			current = &RolePolicy{Role: role, Require2FA: require2FA == 1}
+			roles = append(roles, current)
+		}
+		current.Permissions = append(current.Permissions, permission)
+	}
+
+	respondWithJSON(w, http.StatusOK, roles)
+}
+
+// AdminSetRoleTwoFactor makes 2FA mandatory, or optional again, for a role.
+// Only roles that can clear data or import external data qualify.
+func (h *Handlers) AdminSetRoleTwoFactor(w http.ResponseWriter, r *http.Request) {
+	role := mux.Vars(r)["role"]
+
+	var req struct {
+		Required bool `json:"required"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	exists, err := h.DB.roleExists(role)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Role not found")
+		return
+	}
+
+	if req.Required {
+		eligible := false
+		for _, permission := range twoFactorEnforceablePermissions {
+			granted, err := h.DB.hasPermission(role, permission)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Database error")
+				return
+			}
+			eligible = eligible || granted
+		}
+		if !eligible {
+			respondWithError(w, http.StatusBadRequest, "Two-factor authentication can only be required for roles with "+strings.Join(twoFactorEnforceablePermissions, " or "))
+			return
+		}
+	}
+
+	wasRequired, err := h.DB.roleRequiresTwoFactor(role)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	required := 0
+	if req.Required {
+		required = 1
+	}
+	query := h.DB.convertPlaceholders("DELETE FROM role_policies WHERE role = ?")
+	if _, err := h.DB.DB.Exec(query, role); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating role policy")
+		return
+	}
+	query = h.DB.convertPlaceholders("INSERT INTO role_policies (role, require_2fa) VALUES (?, ?)")
+	if _, err := h.DB.DB.Exec(query, role, required); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating role policy")
+		return
+	}
+	h.audit(r, AuditRolePolicyChange, "role", role, "", map[string]bool{"require2fa": wasRequired}, map[string]bool{"require2fa": req.Required})
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"role": role, "require2fa": req.Required})
+}
+
+// AdminResetUserTwoFactor removes a user's 2FA enrollment, for example after
+// they lost their authenticator and recovery codes, and signs them out
+func (h *Handlers) AdminResetUserTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, err := h.getUserByID(mux.Vars(r)["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user == nil {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if err := h.DB.clearTwoFactor(user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error resetting two-factor authentication")
+		return
+	}
+	if err := h.DB.revokeAllSessions(user.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking sessions")
+		return
+	}
+
+	h.audit(r, AuditUserTwoFactorReset, "user", user.ID, "", map[string]bool{"twoFactorEnabled": user.TwoFactorEnabled}, map[string]bool{"twoFactorEnabled": false})
+
+	user.TwoFactorEnabled = false
+	respondWithJSON(w, http.StatusOK, user)
+}
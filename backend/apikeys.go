@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// apiKeyPrefix starts every API key so keys are easy to recognise in headers and secret scanners
+const apiKeyPrefix = "av_"
+
+// apiKeyLastUsedInterval limits how often last_used_at is written for a busy key
+const apiKeyLastUsedInterval = time.Minute
+
+// APIKey is a personal access token for scripts. The key itself is only
+// returned once, when it is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // First characters of the key, to tell keys apart
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Key        string     `json:"key,omitempty"`
+	UserID     string     `json:"-"`
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// splitScopes parses the comma separated scopes column
+func splitScopes(scopes string) []string {
+	result := []string{}
+	for _, scope := range strings.Split(scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			result = append(result, scope)
+		}
+	}
+	return result
+}
+
+// authenticateAPIKey returns the active key matching a raw key, or nil if
+// there is none or it was revoked or has expired
+func (d *Database) authenticateAPIKey(rawKey string) (*APIKey, error) {
+	var key APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	query := d.convertPlaceholders("SELECT id, user_id, scopes, expires_at, last_used_at, revoked_at FROM api_keys WHERE key_hash = ?")
+	err := d.DB.QueryRow(query, hashToken(rawKey)).Scan(&key.ID, &key.UserID, &scopes, &expiresAt, &lastUsedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if revokedAt.Valid || (expiresAt.Valid && now.After(expiresAt.Time)) {
+		return nil, nil
+	}
+	key.Scopes = splitScopes(scopes)
+
+	if !lastUsedAt.Valid || now.Sub(lastUsedAt.Time) > apiKeyLastUsedInterval {
+		query = d.convertPlaceholders("UPDATE api_keys SET last_used_at = ? WHERE id = ?")
+		if _, err := d.DB.Exec(query, now, key.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// GetAPIKeys lists the caller's API keys, including revoked and expired ones
+func (h *Handlers) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.convertPlaceholders(`
+		SELECT id, name, prefix, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_keys WHERE user_id = ? ORDER BY created_at DESC
+	`)
+	rows, err := h.DB.DB.Query(query, getUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var scopes string
+		var expiresAt, lastUsedAt, revokedAt sql.NullTime
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &expiresAt, &lastUsedAt, &revokedAt, &key.CreatedAt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning API key")
+			return
+		}
+		key.Scopes = splitScopes(scopes)
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+		keys = append(keys, key)
+	}
+
+	respondWithJSON(w, http.StatusOK, keys)
+}
+
+// CreateAPIKey creates a key limited to the given scopes. Scopes are
+// permission names the caller's role grants; a key can never do more than
+// its owner's current role allows.
+func (h *Handlers) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays int      `json:"expiresInDays"` // 0 means the key does not expire
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	if len(req.Scopes) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one scope is required")
+		return
+	}
+	if req.ExpiresInDays < 0 {
+		respondWithError(w, http.StatusBadRequest, "expiresInDays cannot be negative")
+		return
+	}
+
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		scope = strings.TrimSpace(scope)
+		if containsString(scopes, scope) {
+			continue
+		}
+		granted, err := h.DB.hasPermission(getUserRole(r), scope)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error checking permissions")
+			return
+		}
+		if !granted {
+			respondWithError(w, http.StatusBadRequest, "Your role does not grant scope: "+scope)
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	now := time.Now()
+	key := APIKey{
+		ID:        generateID(),
+		Name:      req.Name,
+		Scopes:    scopes,
+		CreatedAt: now,
+		Key:       apiKeyPrefix + generateID() + generateID(),
+	}
+	key.Prefix = key.Key[:len(apiKeyPrefix)+8]
+	var expiresAt interface{}
+	if req.ExpiresInDays > 0 {
+		expiry := now.Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+		key.ExpiresAt = &expiry
+		expiresAt = expiry
+	}
+
+	query := h.DB.convertPlaceholders("INSERT INTO api_keys (id, user_id, name, prefix, key_hash, scopes, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, key.ID, getUserID(r), key.Name, key.Prefix, hashToken(key.Key), strings.Join(scopes, ","), expiresAt, now); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating API key")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, key)
+}
+
+// RevokeAPIKey revokes one of the caller's API keys
+func (h *Handlers) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	query := h.DB.convertPlaceholders("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND user_id = ? AND revoked_at IS NULL")
+	result, err := h.DB.DB.Exec(query, time.Now(), mux.Vars(r)["id"], getUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking API key")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "API key not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "API key revoked"})
+}
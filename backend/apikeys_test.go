@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createTestAPIKey creates an API key for userID with the given scopes
+func createTestAPIKey(t *testing.T, h *Handlers, userID string, scopes ...string) APIKey {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"name": "script", "scopes": scopes})
+	w := serveRoute(testRouter(h), bearer(t, h, userID), "POST", "/api/api-keys", string(body))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create API key: status %d, body %s", w.Code, w.Body)
+	}
+	var key APIKey
+	if err := json.NewDecoder(w.Body).Decode(&key); err != nil || !strings.HasPrefix(key.Key, apiKeyPrefix) {
+		t.Fatalf("create API key returned %q, err = %v", key.Key, err)
+	}
+	return key
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	h := newTestHandlers(t)
+	router := testRouter(h)
+	userID := createTestAccountWithRole(t, h, "scripts@example.com", "user")
+	readOnly := "Bearer " + createTestAPIKey(t, h, userID, PermContentRead).Key
+	readWrite := "Bearer " + createTestAPIKey(t, h, userID, PermContentRead, PermCategoryWrite).Key
+
+	tests := []struct {
+		name, authorization, method, path, body string
+		want                                    int
+	}{
+		{"read with a read key", readOnly, "GET", "/api/categories", "", http.StatusOK},
+		{"write with a read key", readOnly, "POST", "/api/categories", `{"name": "Arrays"}`, http.StatusForbidden},
+		{"clear with a read key", readOnly, "POST", "/api/external/clear-all", "", http.StatusForbidden},
+		{"write with a write key", readWrite, "POST", "/api/categories", `{"name": "Arrays"}`, http.StatusCreated},
+		{"account route with a key", readWrite, "GET", "/api/api-keys", "", http.StatusForbidden},
+		{"unknown key", "Bearer " + apiKeyPrefix + "unknown", "GET", "/api/categories", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if w := serveRoute(router, tt.authorization, tt.method, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, w.Code, tt.want, strings.TrimSpace(w.Body.String()))
+		}
+	}
+
+	// Keys also work in the X-API-Key header
+	r := httptest.NewRequest("GET", "/api/categories", nil)
+	r.Header.Set("X-API-Key", strings.TrimPrefix(readOnly, "Bearer "))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("read with a key in X-API-Key: status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	// A key can do no more than its owner's current role
+	query := h.DB.convertPlaceholders("UPDATE users SET role = 'demo' WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, userID); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveRoute(router, readWrite, "POST", "/api/categories", `{"name": "Arrays"}`); w.Code != http.StatusForbidden {
+		t.Errorf("write with a write key after the role lost the permission: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestAPIKeyCannotReachOtherUsersContent(t *testing.T) {
+	h := newTestHandlers(t)
+	router := testRouter(h)
+	owner := createTestAccountWithRole(t, h, "owner@example.com", "user")
+	other := createTestAccountWithRole(t, h, "other@example.com", "user")
+	_, _, problemID := createTestContent(t, h, owner)
+
+	key := "Bearer " + createTestAPIKey(t, h, other, PermContentRead).Key
+	if w := serveRoute(router, key, "GET", "/api/problems/"+problemID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("reading another user's problem with a key: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	key = "Bearer " + createTestAPIKey(t, h, owner, PermContentRead).Key
+	if w := serveRoute(router, key, "GET", "/api/problems/"+problemID, ""); w.Code != http.StatusOK {
+		t.Errorf("reading the owner's problem with their key: status %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRevokedAndExpiredAPIKeysAreRejected(t *testing.T) {
+	h := newTestHandlers(t)
+	router := testRouter(h)
+	userID := createTestAccountWithRole(t, h, "keys@example.com", "user")
+
+	revoked := createTestAPIKey(t, h, userID, PermContentRead)
+	if w := serveRoute(router, bearer(t, h, userID), "DELETE", "/api/api-keys/"+revoked.ID, ""); w.Code != http.StatusOK {
+		t.Fatalf("revoke API key: status %d, body %s", w.Code, w.Body)
+	}
+	if w := serveRoute(router, "Bearer "+revoked.Key, "GET", "/api/categories", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	expired := createTestAPIKey(t, h, userID, PermContentRead)
+	query := h.DB.convertPlaceholders("UPDATE api_keys SET expires_at = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, time.Now().Add(-time.Minute), expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	if w := serveRoute(router, "Bearer "+expired.Key, "GET", "/api/categories", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired key: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
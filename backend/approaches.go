@@ -0,0 +1,444 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ApproachSolution is an approach's code in one language
+type ApproachSolution struct {
+	ID         string    `json:"id"`
+	ApproachID string    `json:"approachId"`
+	Language   string    `json:"language"` // cpp, go, python, java, javascript
+	Code       string    `json:"code"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// ApproachInput is the editable part of an approach. Only the language and
+// code of each solution are read.
+type ApproachInput struct {
+	Name            string             `json:"name"`
+	Intuition       string             `json:"intuition"`       // Markdown
+	TimeComplexity  string             `json:"timeComplexity"`  // As claimed by the author, such as O(n log n)
+	SpaceComplexity string             `json:"spaceComplexity"` // As claimed by the author
+	Solutions       []ApproachSolution `json:"solutions"`       // At most one per language
+}
+
+// Approach is one named way of solving a problem, such as a brute force or
+// an optimal two-pointer solution, with code in any number of languages
+type Approach struct {
+	ID        string `json:"id"`
+	ProblemID string `json:"problemId"`
+	Position  int    `json:"position"`
+	ApproachInput
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// validate checks that an approach is named and has code in distinct,
+// supported languages
+func (a *ApproachInput) validate() error {
+	a.Name = strings.TrimSpace(a.Name)
+	if a.Name == "" {
+		return errors.New("name is required")
+	}
+	seen := map[string]bool{}
+	for _, sol := range a.Solutions {
+		if !isSupportedLanguage(sol.Language) {
+			return fmt.Errorf("unsupported language %q", sol.Language)
+		}
+		if seen[sol.Language] {
+			return fmt.Errorf("language %s is listed more than once", sol.Language)
+		}
+		seen[sol.Language] = true
+	}
+	return nil
+}
+
+// getApproaches returns a problem's approaches in order, each with its solutions
+func (h *Handlers) getApproaches(problemID string) ([]Approach, error) {
+	query := h.DB.convertPlaceholders(`
+		SELECT id, problem_id, position, name, intuition, time_complexity, space_complexity, created_at, updated_at
+		FROM problem_approaches WHERE problem_id = ? ORDER BY position ASC, created_at ASC
+	`)
+	rows, err := h.DB.DB.Query(query, problemID)
+	if err != nil {
+		return nil, err
+	}
+
+	approaches := []Approach{}
+	index := map[string]int{}
+	for rows.Next() {
+		var a Approach
+		if err := rows.Scan(&a.ID, &a.ProblemID, &a.Position, &a.Name, &a.Intuition, &a.TimeComplexity, &a.SpaceComplexity, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a.Solutions = []ApproachSolution{}
+		index[a.ID] = len(approaches)
+		approaches = append(approaches, a)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	// Rows must be closed before loading solutions
+	rows.Close()
+
+	query = h.DB.convertPlaceholders(`
+		SELECT s.id, s.approach_id, s.language, s.code, s.created_at, s.updated_at
+		FROM approach_solutions s JOIN problem_approaches a ON a.id = s.approach_id
+		WHERE a.problem_id = ? ORDER BY s.language ASC
+	`)
+	rows, err = h.DB.DB.Query(query, problemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var sol ApproachSolution
+		if err := rows.Scan(&sol.ID, &sol.ApproachID, &sol.Language, &sol.Code, &sol.CreatedAt, &sol.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[sol.ApproachID]; ok {
+			approaches[i].Solutions = append(approaches[i].Solutions, sol)
+		}
+	}
+	return approaches, rows.Err()
+}
+
+// loadApproach returns one approach of a problem with its solutions, or nil if there is none
+func (h *Handlers) loadApproach(id, problemID string) (*Approach, error) {
+	approaches, err := h.getApproaches(problemID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range approaches {
+		if approaches[i].ID == id {
+			return &approaches[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// insertApproaches appends approaches to a problem after any it already has
+func (h *Handlers) insertApproaches(workspaceID, problemID string, inputs []ApproachInput, authorID string) ([]Approach, error) {
+	var position int
+	query := h.DB.convertPlaceholders("SELECT COALESCE(MAX(position), -1) + 1 FROM problem_approaches WHERE problem_id = ?")
+	if err := h.DB.DB.QueryRow(query, problemID).Scan(&position); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	created := make([]Approach, 0, len(inputs))
+	insertQuery := h.DB.convertPlaceholders(`INSERT INTO problem_approaches (id, problem_id, position, name, intuition, time_complexity, space_complexity, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	for i, input := range inputs {
+		a := Approach{
+			ID:            generateID(),
+			ProblemID:     problemID,
+			Position:      position + i,
+			ApproachInput: input,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if _, err := h.DB.DB.Exec(insertQuery, a.ID, a.ProblemID, a.Position, a.Name, a.Intuition, a.TimeComplexity, a.SpaceComplexity, a.CreatedAt, a.UpdatedAt); err != nil {
+			return nil, err
+		}
+		solutions, err := h.saveApproachSolutions(workspaceID, a.ID, nil, input.Solutions, authorID, now)
+		if err != nil {
+			return nil, err
+		}
+		a.Solutions = solutions
+		created = append(created, a)
+	}
+	return created, nil
+}
+
+// saveApproachSolutions makes an approach's code match wanted, keeping a
+// revision of each language that changed. Languages that are kept keep their
+// IDs and creation times; languages left out are removed.
+func (h *Handlers) saveApproachSolutions(workspaceID, approachID string, existing, wanted []ApproachSolution, authorID string, now time.Time) ([]ApproachSolution, error) {
+	byLanguage := map[string]ApproachSolution{}
+	for _, sol := range existing {
+		byLanguage[sol.Language] = sol
+	}
+
+	saved := make([]ApproachSolution, 0, len(wanted))
+	for _, want := range wanted {
+		sol, found := byLanguage[want.Language]
+		delete(byLanguage, want.Language)
+		if found && sol.Code == want.Code {
+			saved = append(saved, sol)
+			continue
+		}
+
+		var err error
+		previous := sol.Code
+		if found {
+			sol.Code, sol.UpdatedAt = want.Code, now
+			query := h.DB.convertPlaceholders("UPDATE approach_solutions SET code = ?, updated_at = ? WHERE id = ?")
+			_, err = h.DB.DB.Exec(query, sol.Code, sol.UpdatedAt, sol.ID)
+		} else {
+			sol = ApproachSolution{ID: generateID(), ApproachID: approachID, Language: want.Language, Code: want.Code, CreatedAt: now, UpdatedAt: now}
+			query := h.DB.convertPlaceholders("INSERT INTO approach_solutions (id, approach_id, language, code, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)")
+			_, err = h.DB.DB.Exec(query, sol.ID, sol.ApproachID, sol.Language, sol.Code, sol.CreatedAt, sol.UpdatedAt)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := h.recordRevision(workspaceID, RevisionApproach, approachID, sol.Language, previous, sol.Code, authorID, 0); err != nil {
+			return nil, err
+		}
+		saved = append(saved, sol)
+	}
+
+	for _, sol := range byLanguage {
+		query := h.DB.convertPlaceholders("DELETE FROM approach_solutions WHERE id = ?")
+		if _, err := h.DB.DB.Exec(query, sol.ID); err != nil {
+			return nil, err
+		}
+		// An empty revision records that the language was removed
+		if err := h.recordRevision(workspaceID, RevisionApproach, approachID, sol.Language, sol.Code, "", authorID, 0); err != nil {
+			return nil, err
+		}
+	}
+	return saved, nil
+}
+
+// GetApproaches lists a problem's approaches in order
+func (h *Handlers) GetApproaches(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	approaches, err := h.getApproaches(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, approaches)
+}
+
+// CreateApproach appends an approach to a problem
+func (h *Handlers) CreateApproach(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	workspaceID, ok := h.requireEditableProblem(w, r, problemID)
+	if !ok {
+		return
+	}
+
+	var req ApproachInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := req.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.insertApproaches(workspaceID, problemID, []ApproachInput{req}, getUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating approach")
+		return
+	}
+	a := created[0]
+	h.audit(r, AuditApproachCreate, "approach", a.ID, workspaceID, nil, a)
+
+	respondWithJSON(w, http.StatusCreated, a)
+}
+
+// UpdateApproach replaces an approach's name, intuition, complexities and
+// code. Languages missing from solutions are removed from the approach.
+func (h *Handlers) UpdateApproach(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID, ok := h.requireEditableProblem(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	var req ApproachInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := req.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	before, err := h.loadApproach(vars["approachId"], vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Approach not found")
+		return
+	}
+
+	a := *before
+	a.ApproachInput = req
+	a.UpdatedAt = time.Now()
+	query := h.DB.convertPlaceholders(`UPDATE problem_approaches SET name = ?, intuition = ?, time_complexity = ?, space_complexity = ?, updated_at = ? WHERE id = ? AND problem_id = ?`)
+	if _, err := h.DB.DB.Exec(query, a.Name, a.Intuition, a.TimeComplexity, a.SpaceComplexity, a.UpdatedAt, a.ID, a.ProblemID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating approach")
+		return
+	}
+	if a.Solutions, err = h.saveApproachSolutions(workspaceID, a.ID, before.Solutions, req.Solutions, getUserID(r), a.UpdatedAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving approach solutions")
+		return
+	}
+	h.audit(r, AuditApproachUpdate, "approach", a.ID, workspaceID, before, a)
+
+	respondWithJSON(w, http.StatusOK, a)
+}
+
+// DeleteApproach removes an approach and its code from a problem
+func (h *Handlers) DeleteApproach(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID, ok := h.requireEditableProblem(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	before, err := h.loadApproach(vars["approachId"], vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Approach not found")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("DELETE FROM approach_solutions WHERE approach_id = ?")
+	if _, err := h.DB.DB.Exec(query, before.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting approach")
+		return
+	}
+	query = h.DB.convertPlaceholders("DELETE FROM problem_approaches WHERE id = ? AND problem_id = ?")
+	if _, err := h.DB.DB.Exec(query, before.ID, before.ProblemID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting approach")
+		return
+	}
+	if err := h.deleteRevisions(before.ID, RevisionApproach); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting approach history")
+		return
+	}
+	h.audit(r, AuditApproachDelete, "approach", before.ID, workspaceID, before, nil)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Approach deleted"})
+}
+
+// ReorderApproaches sets the order of a problem's approaches. approachIds
+// must name every approach of the problem exactly once.
+func (h *Handlers) ReorderApproaches(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	workspaceID, ok := h.requireEditableProblem(w, r, problemID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ApproachIDs []string `json:"approachIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	approaches, err := h.getApproaches(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	before := make([]string, len(approaches))
+	inProblem := map[string]bool{}
+	for i, a := range approaches {
+		before[i] = a.ID
+		inProblem[a.ID] = true
+	}
+	if len(req.ApproachIDs) != len(inProblem) {
+		respondWithError(w, http.StatusBadRequest, "approachIds must list every approach of the problem exactly once")
+		return
+	}
+	for _, id := range req.ApproachIDs {
+		if !inProblem[id] {
+			respondWithError(w, http.StatusBadRequest, "approachIds must list every approach of the problem exactly once")
+			return
+		}
+		delete(inProblem, id)
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE problem_approaches SET position = ? WHERE id = ? AND problem_id = ?")
+	for i, id := range req.ApproachIDs {
+		if _, err := h.DB.DB.Exec(query, i, id, problemID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error reordering approaches")
+			return
+		}
+	}
+	h.audit(r, AuditApproachReorder, "problem", problemID, workspaceID,
+		map[string][]string{"approachIds": before}, map[string][]string{"approachIds": req.ApproachIDs})
+
+	approaches, err = h.getApproaches(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, approaches)
+}
+
+// approachFallbackSolutions returns, for each language, the code of the
+// first approach that has it, as a stored solution would be listed
+func (h *Handlers) approachFallbackSolutions(problemID string) ([]Solution, error) {
+	query := h.DB.convertPlaceholders(`
+		SELECT s.id, a.problem_id, s.language, s.code, s.created_at, s.updated_at
+		FROM approach_solutions s JOIN problem_approaches a ON a.id = s.approach_id
+		WHERE a.problem_id = ? ORDER BY a.position ASC, a.created_at ASC
+	`)
+	rows, err := h.DB.DB.Query(query, problemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var solutions []Solution
+	seen := map[string]bool{}
+	for rows.Next() {
+		var sol Solution
+		if err := rows.Scan(&sol.ID, &sol.ProblemID, &sol.Language, &sol.Code, &sol.CreatedAt, &sol.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if !seen[sol.Language] {
+			seen[sol.Language] = true
+			solutions = append(solutions, sol)
+		}
+	}
+	return solutions, rows.Err()
+}
+
+// loadApproachCode returns the code of the first approach of a problem with
+// code in a language, or false if there is none
+func (h *Handlers) loadApproachCode(problemID, language string) (string, bool, error) {
+	var code string
+	query := h.DB.convertPlaceholders(`
+		SELECT s.code FROM approach_solutions s JOIN problem_approaches a ON a.id = s.approach_id
+		WHERE a.problem_id = ? AND s.language = ? ORDER BY a.position ASC, a.created_at ASC LIMIT 1
+	`)
+	err := h.DB.DB.QueryRow(query, problemID, language).Scan(&code)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return code, err == nil, err
+}
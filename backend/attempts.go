@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Attempt outcomes
+const (
+	AttemptSolved  = "solved"
+	AttemptPartial = "partial" // Some test cases or ideas worked
+	AttemptFailed  = "failed"
+	AttemptGaveUp  = "gave_up"
+)
+
+// maxAttemptCodeBytes limits the code stored with a single attempt
+const maxAttemptCodeBytes = 256 * 1024
+
+// isValidAttemptOutcome checks if an outcome can be recorded for an attempt
+func isValidAttemptOutcome(outcome string) bool {
+	switch outcome {
+	case AttemptSolved, AttemptPartial, AttemptFailed, AttemptGaveUp:
+		return true
+	}
+	return false
+}
+
+// Attempt is one timed try at a problem by a user. Attempts are kept apart
+// from the reference solutions in the solutions table.
+type Attempt struct {
+	ID              string    `json:"id"`
+	ProblemID       string    `json:"problemId"`
+	UserID          string    `json:"userId"`
+	Language        string    `json:"language"`
+	Code            string    `json:"code"`
+	Outcome         string    `json:"outcome"` // solved, partial, failed, gave_up
+	Reflection      string    `json:"reflection"`
+	StartedAt       time.Time `json:"startedAt"`
+	EndedAt         time.Time `json:"endedAt"`
+	DurationSeconds int       `json:"durationSeconds"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// GetProblemAttempts returns the caller's attempts at a problem, newest first
+func (h *Handlers) GetProblemAttempts(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	query := h.DB.convertPlaceholders(`
+		SELECT id, problem_id, user_id, language, code, outcome, reflection, started_at, ended_at, duration_seconds, created_at
+		FROM problem_attempts
+		WHERE problem_id = ? AND user_id = ?
+		ORDER BY started_at DESC
+	`)
+	rows, err := h.DB.DB.Query(query, problemID, getUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	attempts := []Attempt{}
+	for rows.Next() {
+		var attempt Attempt
+		err := rows.Scan(&attempt.ID, &attempt.ProblemID, &attempt.UserID, &attempt.Language, &attempt.Code, &attempt.Outcome,
+			&attempt.Reflection, &attempt.StartedAt, &attempt.EndedAt, &attempt.DurationSeconds, &attempt.CreatedAt)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning attempt")
+			return
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	respondWithJSON(w, http.StatusOK, attempts)
+}
+
+// CreateProblemAttempt records an attempt at a problem by the caller and
+// counts it towards their progress. endedAt defaults to now.
+func (h *Handlers) CreateProblemAttempt(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	var req struct {
+		Language   string     `json:"language"`
+		Code       string     `json:"code"`
+		Outcome    string     `json:"outcome"`
+		Reflection string     `json:"reflection"`
+		StartedAt  *time.Time `json:"startedAt"`
+		EndedAt    *time.Time `json:"endedAt"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if !isValidAttemptOutcome(req.Outcome) {
+		respondWithError(w, http.StatusBadRequest, "Outcome must be solved, partial, failed or gave_up")
+		return
+	}
+	if req.StartedAt == nil {
+		respondWithError(w, http.StatusBadRequest, "startedAt is required")
+		return
+	}
+	now := time.Now()
+	if req.EndedAt == nil {
+		req.EndedAt = &now
+	}
+	if req.EndedAt.Before(*req.StartedAt) {
+		respondWithError(w, http.StatusBadRequest, "endedAt cannot be before startedAt")
+		return
+	}
+	if req.EndedAt.After(now.Add(time.Minute)) {
+		respondWithError(w, http.StatusBadRequest, "endedAt cannot be in the future")
+		return
+	}
+	if len(req.Code) > maxAttemptCodeBytes {
+		respondWithError(w, http.StatusBadRequest, "Code is too large")
+		return
+	}
+
+	attempt := Attempt{
+		ID:              generateID(),
+		ProblemID:       problemID,
+		UserID:          getUserID(r),
+		Language:        strings.ToLower(strings.TrimSpace(req.Language)),
+		Code:            req.Code,
+		Outcome:         req.Outcome,
+		Reflection:      req.Reflection,
+		StartedAt:       *req.StartedAt,
+		EndedAt:         *req.EndedAt,
+		DurationSeconds: int(req.EndedAt.Sub(*req.StartedAt).Seconds()),
+		CreatedAt:       now,
+	}
+
+	query := h.DB.convertPlaceholders(`
+		INSERT INTO problem_attempts (id, problem_id, user_id, language, code, outcome, reflection, started_at, ended_at, duration_seconds, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	_, err := h.DB.DB.Exec(query, attempt.ID, attempt.ProblemID, attempt.UserID, attempt.Language, attempt.Code, attempt.Outcome,
+		attempt.Reflection, attempt.StartedAt, attempt.EndedAt, attempt.DurationSeconds, attempt.CreatedAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving attempt")
+		return
+	}
+
+	progress, err := h.DB.recordAttempt(attempt.UserID, problemID, attempt.Outcome == AttemptSolved, attempt.EndedAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving progress")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
+		"attempt":  attempt,
+		"progress": progress,
+	})
+}
+
+// DeleteProblemAttempt removes one of the caller's attempts. Progress
+// already counted for it is left unchanged.
+func (h *Handlers) DeleteProblemAttempt(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, ok := h.requireProblemInWorkspace(w, r, vars["id"]); !ok {
+		return
+	}
+
+	query := h.DB.convertPlaceholders("DELETE FROM problem_attempts WHERE id = ? AND problem_id = ? AND user_id = ?")
+	result, err := h.DB.DB.Exec(query, vars["attemptId"], vars["id"], getUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting attempt")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Attempt not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Attempt deleted"})
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditLogin               = "auth.login"
+	AuditLoginFailed         = "auth.login_failed"
+	AuditUserRoleChange      = "user.role_change"
+	AuditUserDisable         = "user.disable"
+	AuditUserEnable          = "user.enable"
+	AuditUserPasswordReset   = "user.password_reset"
+	AuditUserTwoFactorReset  = "user.2fa_reset"
+	AuditUserDelete          = "user.delete"
+	AuditRolePolicyChange    = "role.policy_change"
+	AuditWorkspaceRoleChange = "workspace.member_role_change"
+	AuditWorkspaceInvite     = "workspace.invite"
+	AuditInviteRevoke        = "workspace.invite_revoke"
+	AuditInviteAccept        = "workspace.invite_accept"
+	AuditInviteDecline       = "workspace.invite_decline"
+	AuditMemberRemove        = "workspace.member_remove"
+	AuditDataClear           = "data.clear"
+	AuditDataClearFailed     = "data.clear_failed"
+	AuditExternalImport      = "data.external_import"
+	AuditExternalImportFail  = "data.external_import_failed"
+	AuditCategoryCreate      = "category.create"
+	AuditCategoryUpdate      = "category.update"
+	AuditCategoryDelete      = "category.delete"
+	AuditPatternCreate       = "pattern.create"
+	AuditPatternUpdate       = "pattern.update"
+	AuditPatternDelete       = "pattern.delete"
+	AuditProblemCreate       = "problem.create"
+	AuditProblemUpdate       = "problem.update"
+	AuditProblemDelete       = "problem.delete"
+	AuditTestCaseCreate      = "test_case.create"
+	AuditTestCaseUpdate      = "test_case.update"
+	AuditTestCaseDelete      = "test_case.delete"
+	AuditCheckerUpdate       = "problem.checker_update"
+	AuditStressConfigUpdate  = "problem.stress_config_update"
+	AuditApproachCreate      = "approach.create"
+	AuditApproachUpdate      = "approach.update"
+	AuditApproachDelete      = "approach.delete"
+	AuditApproachReorder     = "problem.approach_reorder"
+	AuditRevisionRestore     = "revision.restore"
+	AuditSolutionCreate      = "solution.create"
+	AuditSolutionUpdate      = "solution.update"
+	AuditSolutionDelete      = "solution.delete"
+)
+
+// Page sizes for the audit log query endpoint
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// AuditChange is the value of one field before and after an action
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditEntry is one row of the append-only audit log
+type AuditEntry struct {
+	ID          string                 `json:"id"`
+	ActorID     string                 `json:"actorId"`
+	ActorEmail  string                 `json:"actorEmail"`
+	IP          string                 `json:"ip"`
+	Action      string                 `json:"action"`
+	TargetType  string                 `json:"targetType"`
+	TargetID    string                 `json:"targetId"`
+	WorkspaceID string                 `json:"workspaceId"`
+	Changes     map[string]AuditChange `json:"changes"`
+	CreatedAt   time.Time              `json:"createdAt"`
+}
+
+// auditDiff returns the fields that differ between the JSON forms of before
+// and after. Either side may be nil, for creates and deletes.
+func auditDiff(before, after interface{}) (map[string]AuditChange, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]AuditChange{}
+	for key, value := range beforeFields {
+		if !reflect.DeepEqual(value, afterFields[key]) {
+			changes[key] = AuditChange{Before: value, After: afterFields[key]}
+		}
+	}
+	for key, value := range afterFields {
+		if _, ok := beforeFields[key]; !ok {
+			changes[key] = AuditChange{After: value}
+		}
+	}
+	return changes, nil
+}
+
+// auditFields flattens a value to its top level JSON fields
+func auditFields(value interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return fields, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// audit records an action by the authenticated caller
+func (h *Handlers) audit(r *http.Request, action, targetType, targetID, workspaceID string, before, after interface{}) {
+	h.auditAs(r, getUserID(r), "", action, targetType, targetID, workspaceID, before, after)
+}
+
+// auditAs records an action for an explicit actor, for requests that are not
+// authenticated yet such as logins. actorEmail is looked up when empty.
+// Failures are logged and never fail the request that triggered them.
+func (h *Handlers) auditAs(r *http.Request, actorID, actorEmail, action, targetType, targetID, workspaceID string, before, after interface{}) {
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		log.Printf("Error building audit diff for %s: %v", action, err)
+		return
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		log.Printf("Error encoding audit diff for %s: %v", action, err)
+		return
+	}
+
+	// The email is kept on the entry so it stays readable after the user is deleted
+	if actorEmail == "" && actorID != "" {
+		query := h.DB.convertPlaceholders("SELECT email FROM users WHERE id = ?")
+		if err := h.DB.DB.QueryRow(query, actorID).Scan(&actorEmail); err != nil {
+			log.Printf("Error looking up audit actor %s: %v", actorID, err)
+		}
+	}
+
+	query := h.DB.convertPlaceholders(`
+		INSERT INTO audit_log (id, actor_id, actor_email, ip, action, target_type, target_id, workspace_id, changes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	_, err = h.DB.DB.Exec(query, generateID(), actorID, actorEmail, h.Limiter.clientIP(r), action, targetType, targetID, workspaceID, string(changesJSON), time.Now())
+	if err != nil {
+		log.Printf("Error writing audit entry for %s: %v", action, err)
+	}
+}
+
+// countWorkspaceContent returns how many categories, patterns and problems a
+// workspace holds, used to audit bulk changes
+func (d *Database) countWorkspaceContent(workspaceID string) (map[string]int, error) {
+	counts := map[string]int{}
+	for _, table := range []string{"categories", "patterns", "problems"} {
+		var count int
+		query := d.convertPlaceholders("SELECT COUNT(*) FROM " + table + " WHERE workspace_id = ?")
+		if err := d.DB.QueryRow(query, workspaceID).Scan(&count); err != nil {
+			return nil, err
+		}
+		counts[table] = count
+	}
+	return counts, nil
+}
+
+// contentAuditState is the after side of a bulk change audit entry: the
+// workspace's content counts as they are now, plus details of the change
+func (d *Database) contentAuditState(workspaceID string, details map[string]interface{}) map[string]interface{} {
+	state := map[string]interface{}{}
+	if counts, err := d.countWorkspaceContent(workspaceID); err == nil {
+		for table, count := range counts {
+			state[table] = count
+		}
+	}
+	for key, value := range details {
+		state[key] = value
+	}
+	return state
+}
+
+// AdminGetAuditLog lists audit entries, newest first. Optional filters are
+// actor (id or email), action, targetType, targetId, workspaceId and the
+// RFC 3339 timestamps since and until. Results are paged with limit and offset.
+func (h *Handlers) AdminGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	conditions := []string{}
+	args := []interface{}{}
+	if actor := strings.TrimSpace(params.Get("actor")); actor != "" {
+		conditions = append(conditions, "(actor_id = ? OR LOWER(actor_email) = ?)")
+		args = append(args, actor, strings.ToLower(actor))
+	}
+	filters := []struct{ param, column string }{
+		{"action", "action"},
+		{"targetType", "target_type"},
+		{"targetId", "target_id"},
+		{"workspaceId", "workspace_id"},
+	}
+	for _, filter := range filters {
+		if value := strings.TrimSpace(params.Get(filter.param)); value != "" {
+			conditions = append(conditions, filter.column+" = ?")
+			args = append(args, value)
+		}
+	}
+	for _, bound := range []struct{ param, operator string }{{"since", ">="}, {"until", "<="}} {
+		value := params.Get(bound.param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, bound.param+" must be an RFC 3339 timestamp")
+			return
+		}
+		conditions = append(conditions, "created_at "+bound.operator+" ?")
+		args = append(args, t.Local())
+	}
+
+	limit := defaultAuditPageSize
+	if value := params.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxAuditPageSize {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxAuditPageSize))
+			return
+		}
+		limit = n
+	}
+	offset := 0
+	if value := params.Get("offset"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			respondWithError(w, http.StatusBadRequest, "offset cannot be negative")
+			return
+		}
+		offset = n
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := h.DB.DB.QueryRow(h.DB.convertPlaceholders("SELECT COUNT(*) FROM audit_log"+where), args...).Scan(&total); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	query := h.DB.convertPlaceholders(`
+		SELECT id, actor_id, actor_email, ip, action, target_type, target_id, workspace_id, changes, created_at
+		FROM audit_log` + where + `
+		ORDER BY created_at DESC, id
+		LIMIT ? OFFSET ?
+	`)
+	rows, err := h.DB.DB.Query(query, append(args, limit, offset)...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var changes string
+		err := rows.Scan(&entry.ID, &entry.ActorID, &entry.ActorEmail, &entry.IP, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.WorkspaceID, &changes, &entry.CreatedAt)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning audit entry")
+			return
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error decoding audit entry")
+			return
+		}
+		entries = append(entries, entry)
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"entries": entries,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
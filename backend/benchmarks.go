@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Benchmark job statuses
+const (
+	BenchmarkRunning   = "running"
+	BenchmarkCompleted = "completed"
+	BenchmarkFailed    = "failed"
+)
+
+// Limits of a benchmark request
+const (
+	defaultBenchmarkMinSize = 1000
+	defaultBenchmarkMaxSize = 64000
+	defaultBenchmarkRepeats = 3
+	maxBenchmarkRepeats     = 10
+	minBenchmarkPoints      = 4  // Fewer sizes cannot tell the curves apart
+	maxBenchmarkPoints      = 20 // Sizes double from minSize, so this bounds maxSize / minSize
+	benchmarkTimeout        = 15 * time.Minute
+	benchmarkSeed           = 1
+	constantSpreadMs        = 2   // Times within this of each other count as constant...
+	constantSpreadRatio     = 0.1 // ...as do times within this fraction of their mean
+	constantSpreadKB        = 512
+)
+
+// complexityClass is a growth curve a benchmark can be fitted to
+type complexityClass struct {
+	Name string
+	f    func(n float64) float64
+	// maxSize is the largest size the curve can be evaluated at, 0 for any
+	maxSize int
+}
+
+// complexityClasses are tried in order of growth, O(1) first
+var complexityClasses = []complexityClass{
+	{Name: "O(1)", f: func(n float64) float64 { return 0 }},
+	{Name: "O(log n)", f: func(n float64) float64 { return math.Log2(n) }},
+	{Name: "O(n)", f: func(n float64) float64 { return n }},
+	{Name: "O(n log n)", f: func(n float64) float64 { return n * math.Log2(n) }},
+	{Name: "O(n^2)", f: func(n float64) float64 { return n * n }},
+	{Name: "O(n^2 log n)", f: func(n float64) float64 { return n * n * math.Log2(n) }},
+	{Name: "O(n^3)", f: func(n float64) float64 { return n * n * n }},
+	{Name: "O(2^n)", f: func(n float64) float64 { return math.Exp2(n) }, maxSize: 64},
+}
+
+// BenchmarkPoint is the measurement at one input size. Time is the fastest
+// and memory the median of the repeated runs.
+type BenchmarkPoint struct {
+	Size      int    `json:"size"`
+	Status    string `json:"status"` // Run status; sizes after the first failure are not run
+	TimeMs    int64  `json:"timeMs"`
+	CPUTimeMs int64  `json:"cpuTimeMs"`
+	MemoryKB  int64  `json:"memoryKb"`
+}
+
+// SolutionBenchmark is a job that measures a solution at growing input sizes
+// and fits its time and space complexity
+type SolutionBenchmark struct {
+	ID              string           `json:"id"`
+	ProblemID       string           `json:"problemId"`
+	Language        string           `json:"language"`
+	UserID          string           `json:"userId"` // Who started it
+	Status          string           `json:"status"`
+	MinSize         int              `json:"minSize"`
+	MaxSize         int              `json:"maxSize"`
+	Repeats         int              `json:"repeats"`
+	Points          []BenchmarkPoint `json:"points"`
+	TimeComplexity  string           `json:"timeComplexity,omitempty"`
+	SpaceComplexity string           `json:"spaceComplexity,omitempty"`
+	Error           string           `json:"error,omitempty"`
+	StartedAt       time.Time        `json:"startedAt"`
+	FinishedAt      *time.Time       `json:"finishedAt,omitempty"`
+}
+
+// benchmarkSizes doubles from minSize up to maxSize
+func benchmarkSizes(minSize, maxSize int) []int {
+	sizes := []int{}
+	for size := minSize; size <= maxSize && len(sizes) < maxBenchmarkPoints; size *= 2 {
+		sizes = append(sizes, size)
+	}
+	return sizes
+}
+
+// fitComplexity returns the complexity class whose curve a + b*f(n) fits
+// the measurements best. Errors are relative to the measured values, so the
+// small sizes count as much as the large ones, and curves that need a
+// negative constant cost are rejected as implausible. Measurements that
+// barely change are constant, since noise would otherwise pick any curve.
+func fitComplexity(sizes []int, values []float64, constantSpread float64) string {
+	minValue, maxValue, mean := values[0], values[0], 0.0
+	for _, value := range values {
+		minValue = math.Min(minValue, value)
+		maxValue = math.Max(maxValue, value)
+		mean += value / float64(len(values))
+	}
+	if maxValue-minValue <= math.Max(constantSpread, constantSpreadRatio*mean) {
+		return complexityClasses[0].Name
+	}
+
+	weights := make([]float64, len(values))
+	totalWeight := 0.0
+	for i, value := range values {
+		weights[i] = 1 / math.Pow(math.Max(value, 1), 2)
+		totalWeight += weights[i]
+	}
+
+	best, bestError := "", math.Inf(1)
+	for _, class := range complexityClasses[1:] {
+		if class.maxSize > 0 && sizes[len(sizes)-1] > class.maxSize {
+			continue
+		}
+		xs := make([]float64, len(sizes))
+		var meanX, meanY float64
+		for i, size := range sizes {
+			xs[i] = class.f(float64(size))
+			meanX += weights[i] * xs[i] / totalWeight
+			meanY += weights[i] * values[i] / totalWeight
+		}
+		var covariance, variance float64
+		for i := range xs {
+			covariance += weights[i] * (xs[i] - meanX) * (values[i] - meanY)
+			variance += weights[i] * (xs[i] - meanX) * (xs[i] - meanX)
+		}
+		if variance == 0 {
+			continue
+		}
+		slope := covariance / variance
+		intercept := meanY - slope*meanX
+		if slope < 0 || intercept < -constantSpread {
+			continue
+		}
+		fitError := 0.0
+		for i := range xs {
+			residual := values[i] - (intercept + slope*xs[i])
+			fitError += weights[i] * residual * residual
+		}
+		if fitError < bestError {
+			best, bestError = class.Name, fitError
+		}
+	}
+	if best == "" {
+		return complexityClasses[0].Name
+	}
+	return best
+}
+
+const benchmarkColumns = "id, problem_id, language, user_id, status, min_size, max_size, repeats, points, time_complexity, space_complexity, error, started_at, finished_at"
+
+// scanBenchmark reads a solution_benchmarks row selected with benchmarkColumns
+func scanBenchmark(scan func(dest ...interface{}) error) (*SolutionBenchmark, error) {
+	var b SolutionBenchmark
+	var points string
+	var finishedAt sql.NullTime
+	err := scan(&b.ID, &b.ProblemID, &b.Language, &b.UserID, &b.Status, &b.MinSize, &b.MaxSize, &b.Repeats,
+		&points, &b.TimeComplexity, &b.SpaceComplexity, &b.Error, &b.StartedAt, &finishedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(points), &b.Points); err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		b.FinishedAt = &finishedAt.Time
+	}
+	return &b, nil
+}
+
+// failInterruptedBenchmarks marks benchmarks that were running when the
+// server stopped as failed, since nothing will finish them
+func (d *Database) failInterruptedBenchmarks() error {
+	query := d.convertPlaceholders("UPDATE solution_benchmarks SET status = ?, error = ?, finished_at = ? WHERE status = ?")
+	_, err := d.DB.Exec(query, BenchmarkFailed, "Interrupted by a server restart", time.Now(), BenchmarkRunning)
+	return err
+}
+
+// saveBenchmark stores a benchmark's progress or outcome
+func (h *Handlers) saveBenchmark(b *SolutionBenchmark) error {
+	points, err := json.Marshal(b.Points)
+	if err != nil {
+		return err
+	}
+	query := h.DB.convertPlaceholders("UPDATE solution_benchmarks SET status = ?, points = ?, time_complexity = ?, space_complexity = ?, error = ?, finished_at = ? WHERE id = ?")
+	_, err = h.DB.DB.Exec(query, b.Status, string(points), b.TimeComplexity, b.SpaceComplexity, b.Error, timePtrValue(b.FinishedAt), b.ID)
+	return err
+}
+
+// BenchmarkSolution starts a job that runs a stored solution on generated
+// inputs of doubling sizes and fits its time and space complexity. The
+// fitted complexities are stored on the solution when the job completes.
+func (h *Handlers) BenchmarkSolution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, ok := h.requireEditableProblem(w, r, vars["id"]); !ok {
+		return
+	}
+
+	var req struct {
+		MinSize       int `json:"minSize"`
+		MaxSize       int `json:"maxSize"`
+		Repeats       int `json:"repeats"`
+		TimeLimitMs   int `json:"timeLimitMs"`
+		MemoryLimitMB int `json:"memoryLimitMb"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.MinSize == 0 {
+		req.MinSize = defaultBenchmarkMinSize
+	}
+	if req.MaxSize == 0 {
+		req.MaxSize = max(defaultBenchmarkMaxSize, req.MinSize*(1<<(minBenchmarkPoints-1)))
+	}
+	if req.Repeats == 0 {
+		req.Repeats = defaultBenchmarkRepeats
+	}
+	if req.MinSize < 1 {
+		respondWithError(w, http.StatusBadRequest, "minSize must be positive")
+		return
+	}
+	sizes := benchmarkSizes(req.MinSize, req.MaxSize)
+	if len(sizes) < minBenchmarkPoints {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("maxSize must be at least %d times minSize", 1<<(minBenchmarkPoints-1)))
+		return
+	}
+	if req.Repeats < 1 || req.Repeats > maxBenchmarkRepeats {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("repeats must be between 1 and %d", maxBenchmarkRepeats))
+		return
+	}
+	limits, err := h.runLimits(req.TimeLimitMs, req.MemoryLimitMB)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	config, err := h.loadStressConfig(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if config == nil {
+		respondWithError(w, http.StatusBadRequest, "Problem has no input generator")
+		return
+	}
+	// Results are stored on the solution, so approach code cannot stand in for it
+	code, found, err := h.loadStoredSolutionCode(vars["id"], vars["language"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Solution not found")
+		return
+	}
+	if err := h.Runner.Available(vars["language"]); err != nil {
+		status, message := runnerErrorStatus(err)
+		respondWithError(w, status, message)
+		return
+	}
+
+	var running bool
+	query := h.DB.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM solution_benchmarks WHERE problem_id = ? AND language = ? AND status = ?)")
+	if err := h.DB.DB.QueryRow(query, vars["id"], vars["language"], BenchmarkRunning).Scan(&running); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if running {
+		respondWithError(w, http.StatusConflict, "A benchmark of this solution is already running")
+		return
+	}
+
+	benchmark := &SolutionBenchmark{
+		ID:        generateID(),
+		ProblemID: vars["id"],
+		Language:  vars["language"],
+		UserID:    getUserID(r),
+		Status:    BenchmarkRunning,
+		MinSize:   req.MinSize,
+		MaxSize:   sizes[len(sizes)-1],
+		Repeats:   req.Repeats,
+		Points:    []BenchmarkPoint{},
+		StartedAt: time.Now(),
+	}
+	query = h.DB.convertPlaceholders(`INSERT INTO solution_benchmarks (id, problem_id, language, user_id, status, min_size, max_size, repeats, points, started_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	_, err = h.DB.DB.Exec(query, benchmark.ID, benchmark.ProblemID, benchmark.Language, benchmark.UserID, benchmark.Status,
+		benchmark.MinSize, benchmark.MaxSize, benchmark.Repeats, "[]", benchmark.StartedAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating benchmark")
+		return
+	}
+
+	// The job outlives the request, so it gets a context of its own
+	job := *benchmark
+	go h.runBenchmark(&job, config, code, sizes, limits)
+
+	respondWithJSON(w, http.StatusAccepted, benchmark)
+}
+
+// runBenchmark runs a benchmark job to completion and stores its outcome
+func (h *Handlers) runBenchmark(b *SolutionBenchmark, config *StressConfig, code string, sizes []int, limits RunLimits) {
+	ctx, cancel := context.WithTimeout(context.Background(), benchmarkTimeout)
+	defer cancel()
+
+	if err := h.measureBenchmark(ctx, b, config, code, sizes, limits); err != nil {
+		b.Status = BenchmarkFailed
+		b.Error = err.Error()
+	} else {
+		b.Status = BenchmarkCompleted
+	}
+	now := time.Now()
+	b.FinishedAt = &now
+	if err := h.saveBenchmark(b); err != nil {
+		log.Printf("Error saving benchmark %s: %v", b.ID, err)
+		return
+	}
+
+	if b.Status == BenchmarkCompleted {
+		// Only code that has not changed since the benchmark started gets its results
+		query := h.DB.convertPlaceholders("UPDATE solutions SET measured_time_complexity = ?, measured_space_complexity = ?, benchmarked_at = ? WHERE problem_id = ? AND language = ? AND code = ?")
+		if _, err := h.DB.DB.Exec(query, b.TimeComplexity, b.SpaceComplexity, now, b.ProblemID, b.Language, code); err != nil {
+			log.Printf("Error storing complexity of benchmark %s: %v", b.ID, err)
+		}
+	}
+}
+
+// measureBenchmark compiles the generator and solution, measures every size
+// and fits the curves. Sizes after the first failed run are skipped, and the
+// sizes before it are fitted if there are enough of them.
+func (h *Handlers) measureBenchmark(ctx context.Context, b *SolutionBenchmark, config *StressConfig, code string, sizes []int, limits RunLimits) error {
+	generator, compileResult, err := h.Runner.Compile(ctx, config.GeneratorLanguage, config.GeneratorCode)
+	if err != nil {
+		return fmt.Errorf("generator: %v", err)
+	}
+	if compileResult != nil {
+		return fmt.Errorf("generator does not compile: %s", compileResult.Stderr)
+	}
+	defer generator.Close()
+
+	solution, compileResult, err := h.Runner.Compile(ctx, b.Language, code)
+	if err != nil {
+		return err
+	}
+	if compileResult != nil {
+		return fmt.Errorf("solution does not compile: %s", compileResult.Stderr)
+	}
+	defer solution.Close()
+
+	for _, size := range sizes {
+		generated, err := generator.Run(ctx, fmt.Sprintf("%d %d\n", benchmarkSeed, size), RunLimits{OutputBytes: maxRunStdinBytes})
+		if err != nil {
+			return err
+		}
+		if generated.Status != RunOK || generated.OutputTruncated {
+			b.Error = fmt.Sprintf("Generator failed at size %d: %s", size, generated.Status)
+			if generated.OutputTruncated {
+				b.Error = fmt.Sprintf("Generator output at size %d is over %d bytes", size, maxRunStdinBytes)
+			}
+			break
+		}
+
+		point := BenchmarkPoint{Size: size, Status: RunOK}
+		memories := []int64{}
+		for i := 0; i < b.Repeats && point.Status == RunOK; i++ {
+			run, err := solution.Run(ctx, generated.Stdout, limits)
+			if err != nil {
+				return err
+			}
+			point.Status = run.Status
+			if i == 0 || run.CPUTimeMs < point.CPUTimeMs {
+				point.TimeMs, point.CPUTimeMs = run.TimeMs, run.CPUTimeMs
+			}
+			memories = append(memories, run.MemoryKB)
+		}
+		// A single reading can miss a short-lived peak or catch a stale one
+		sort.Slice(memories, func(i, j int) bool { return memories[i] < memories[j] })
+		point.MemoryKB = memories[len(memories)/2]
+		b.Points = append(b.Points, point)
+		if point.Status != RunOK {
+			b.Error = fmt.Sprintf("Solution stopped at size %d: %s", size, point.Status)
+			break
+		}
+		// Progress is visible while the job runs
+		if err := h.saveBenchmark(b); err != nil {
+			return err
+		}
+	}
+
+	measured := []int{}
+	times, memories := []float64{}, []float64{}
+	for _, point := range b.Points {
+		if point.Status == RunOK {
+			measured = append(measured, point.Size)
+			times = append(times, float64(point.CPUTimeMs))
+			memories = append(memories, float64(point.MemoryKB))
+		}
+	}
+	if len(measured) < minBenchmarkPoints {
+		if b.Error == "" {
+			b.Error = "Too few sizes were measured"
+		}
+		return fmt.Errorf("%s; at least %d sizes are needed to fit a curve", b.Error, minBenchmarkPoints)
+	}
+	b.TimeComplexity = fitComplexity(measured, times, constantSpreadMs)
+	b.SpaceComplexity = fitComplexity(measured, memories, constantSpreadKB)
+	return nil
+}
+
+// GetBenchmarks lists a problem's benchmarks, newest first, optionally for one language
+func (h *Handlers) GetBenchmarks(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	query := "SELECT " + benchmarkColumns + " FROM solution_benchmarks WHERE problem_id = ?"
+	args := []interface{}{problemID}
+	if language := r.URL.Query().Get("language"); language != "" {
+		query += " AND language = ?"
+		args = append(args, language)
+	}
+	rows, err := h.DB.DB.Query(h.DB.convertPlaceholders(query+" ORDER BY started_at DESC"), args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	benchmarks := []SolutionBenchmark{}
+	for rows.Next() {
+		benchmark, err := scanBenchmark(rows.Scan)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		benchmarks = append(benchmarks, *benchmark)
+	}
+	if err := rows.Err(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, benchmarks)
+}
+
+// GetBenchmark returns one benchmark, which can be polled while it runs
+func (h *Handlers) GetBenchmark(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, ok := h.requireProblemInWorkspace(w, r, vars["id"]); !ok {
+		return
+	}
+
+	query := h.DB.convertPlaceholders("SELECT " + benchmarkColumns + " FROM solution_benchmarks WHERE id = ? AND problem_id = ?")
+	benchmark, err := scanBenchmark(h.DB.DB.QueryRow(query, vars["benchmarkId"], vars["id"]).Scan)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusNotFound, "Benchmark not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, benchmark)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBenchmarkSizes(t *testing.T) {
+	tests := []struct {
+		minSize, maxSize int
+		want             []int
+	}{
+		{1000, 8000, []int{1000, 2000, 4000, 8000}},
+		{1000, 10000, []int{1000, 2000, 4000, 8000}},
+		{5, 5, []int{5}},
+	}
+	for _, tt := range tests {
+		if got := benchmarkSizes(tt.minSize, tt.maxSize); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("benchmarkSizes(%d, %d) = %v, want %v", tt.minSize, tt.maxSize, got, tt.want)
+		}
+	}
+	if got := benchmarkSizes(1, math.MaxInt32); len(got) != maxBenchmarkPoints {
+		t.Errorf("benchmarkSizes(1, MaxInt32) has %d sizes, want %d", len(got), maxBenchmarkPoints)
+	}
+}
+
+func TestFitComplexityPicksGeneratingCurve(t *testing.T) {
+	sizes := benchmarkSizes(defaultBenchmarkMinSize, defaultBenchmarkMaxSize)
+	smallSizes := benchmarkSizes(4, 64)
+	// Each curve gets a small constant cost and a little noise, as real timings do
+	noise := []float64{1.02, 0.97, 1.01, 0.99, 1.03, 0.98, 1.0}
+	tests := []struct {
+		want  string
+		sizes []int
+		f     func(n float64) float64
+	}{
+		{"O(log n)", sizes, func(n float64) float64 { return 20 * math.Log2(n) }},
+		{"O(n)", sizes, func(n float64) float64 { return n / 100 }},
+		{"O(n log n)", sizes, func(n float64) float64 { return n * math.Log2(n) / 1000 }},
+		{"O(n^2)", sizes, func(n float64) float64 { return n * n / 1e6 }},
+		{"O(n^2 log n)", sizes, func(n float64) float64 { return n * n * math.Log2(n) / 1e7 }},
+		{"O(n^3)", sizes, func(n float64) float64 { return n * n * n / 1e9 }},
+		{"O(2^n)", smallSizes, func(n float64) float64 { return math.Exp2(n) / 1e15 }},
+	}
+	for _, tt := range tests {
+		values := make([]float64, len(tt.sizes))
+		for i, size := range tt.sizes {
+			values[i] = (5 + tt.f(float64(size))) * noise[i%len(noise)]
+		}
+		if got := fitComplexity(tt.sizes, values, constantSpreadMs); got != tt.want {
+			t.Errorf("fitComplexity(%v) = %s, want %s", values, got, tt.want)
+		}
+	}
+}
+
+func TestFitComplexityConstant(t *testing.T) {
+	sizes := benchmarkSizes(defaultBenchmarkMinSize, defaultBenchmarkMaxSize)
+	tests := []struct {
+		name   string
+		values []float64
+	}{
+		{"within the absolute spread", []float64{3, 4, 2, 3, 4, 3, 2}},
+		{"within the relative spread", []float64{500, 520, 490, 510, 530, 505, 495}},
+		{"only decreasing curves", []float64{90, 70, 50, 40, 30, 20, 10}},
+	}
+	for _, tt := range tests {
+		if got := fitComplexity(sizes, tt.values, constantSpreadMs); got != "O(1)" {
+			t.Errorf("%s: fitComplexity(%v) = %s, want O(1)", tt.name, tt.values, got)
+		}
+	}
+}
+
+func TestFitComplexitySkipsExponentialForLargeSizes(t *testing.T) {
+	sizes := benchmarkSizes(16, 128)
+	values := make([]float64, len(sizes))
+	for i, size := range sizes {
+		values[i] = math.Exp2(float64(size)) / 1e30
+	}
+	if got := fitComplexity(sizes, values, constantSpreadMs); got == "O(2^n)" {
+		t.Errorf("fitComplexity chose O(2^n) for sizes up to %d", sizes[len(sizes)-1])
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Checker modes decide when a program's output matches the expected output
+const (
+	CheckerExact      = "exact"      // Equal apart from trailing whitespace on each line and trailing blank lines
+	CheckerWhitespace = "whitespace" // Same whitespace-separated tokens in the same order
+	CheckerUnordered  = "unordered"  // Same whitespace-separated tokens in any order
+	CheckerFloat      = "float"      // Same tokens, with numbers equal within an absolute or relative epsilon
+	CheckerCustom     = "custom"     // A checker program decides
+)
+
+var validCheckerModes = map[string]bool{
+	CheckerExact:      true,
+	CheckerWhitespace: true,
+	CheckerUnordered:  true,
+	CheckerFloat:      true,
+	CheckerCustom:     true,
+}
+
+const (
+	defaultCheckerEpsilon  = 1e-6
+	maxCheckerMessageBytes = 1024
+)
+
+// Files a custom checker finds in its working directory
+const (
+	checkerInputFile    = "input.txt"
+	checkerExpectedFile = "expected.txt"
+	checkerOutputFile   = "output.txt"
+)
+
+// ProblemChecker is how a problem's judge compares outputs. A custom checker
+// is a program like a solution that is run once per test case with the input,
+// expected output and actual output in checkerInputFile, checkerExpectedFile
+// and checkerOutputFile. It exits with 0 to accept and 1 to reject, and may
+// print a short message explaining why.
+type ProblemChecker struct {
+	ProblemID string     `json:"problemId"`
+	Mode      string     `json:"mode"`
+	Epsilon   float64    `json:"epsilon,omitempty"`   // float mode only
+	Language  string     `json:"language,omitempty"`  // custom mode only
+	Code      string     `json:"code,omitempty"`      // custom mode only
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"` // Unset until a checker is configured
+}
+
+// loadChecker returns a problem's checker, which is exact until one is configured
+func (h *Handlers) loadChecker(problemID string) (*ProblemChecker, error) {
+	checker := ProblemChecker{ProblemID: problemID}
+	var updatedAt time.Time
+	query := h.DB.convertPlaceholders("SELECT mode, epsilon, language, code, updated_at FROM problem_checkers WHERE problem_id = ?")
+	err := h.DB.DB.QueryRow(query, problemID).Scan(&checker.Mode, &checker.Epsilon, &checker.Language, &checker.Code, &updatedAt)
+	if err == sql.ErrNoRows {
+		checker.Mode = CheckerExact
+		return &checker, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	checker.UpdatedAt = &updatedAt
+	return &checker, nil
+}
+
+// GetChecker returns a problem's checker
+func (h *Handlers) GetChecker(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	checker, err := h.loadChecker(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, checker)
+}
+
+// UpdateChecker sets a problem's checker mode, with the epsilon of float mode
+// or the program of custom mode
+func (h *Handlers) UpdateChecker(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	workspaceID, ok := h.requireEditableProblem(w, r, problemID)
+	if !ok {
+		return
+	}
+
+	var req ProblemChecker
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !validCheckerModes[req.Mode] {
+		respondWithError(w, http.StatusBadRequest, "mode must be exact, whitespace, unordered, float or custom")
+		return
+	}
+	checker := ProblemChecker{ProblemID: problemID, Mode: req.Mode}
+	switch req.Mode {
+	case CheckerFloat:
+		checker.Epsilon = req.Epsilon
+		if checker.Epsilon == 0 {
+			checker.Epsilon = defaultCheckerEpsilon
+		}
+		if checker.Epsilon < 0 || math.IsNaN(checker.Epsilon) || math.IsInf(checker.Epsilon, 0) {
+			respondWithError(w, http.StatusBadRequest, "epsilon must be a positive number")
+			return
+		}
+	case CheckerCustom:
+		if _, ok := runnerLanguages[req.Language]; !ok {
+			respondWithError(w, http.StatusBadRequest, "Unsupported checker language")
+			return
+		}
+		if strings.TrimSpace(req.Code) == "" {
+			respondWithError(w, http.StatusBadRequest, "Checker code is required")
+			return
+		}
+		checker.Language = req.Language
+		checker.Code = req.Code
+	}
+
+	before, err := h.loadChecker(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	now := time.Now()
+	checker.UpdatedAt = &now
+	values := []interface{}{checker.Mode, checker.Epsilon, checker.Language, checker.Code, now, problemID}
+	query := h.DB.convertPlaceholders("UPDATE problem_checkers SET mode = ?, epsilon = ?, language = ?, code = ?, updated_at = ? WHERE problem_id = ?")
+	if before.UpdatedAt == nil {
+		query = h.DB.convertPlaceholders("INSERT INTO problem_checkers (mode, epsilon, language, code, updated_at, problem_id) VALUES (?, ?, ?, ?, ?, ?)")
+	}
+	if _, err := h.DB.DB.Exec(query, values...); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving checker")
+		return
+	}
+	h.audit(r, AuditCheckerUpdate, "problem", problemID, workspaceID, before, checker)
+
+	respondWithJSON(w, http.StatusOK, checker)
+}
+
+// outputChecker compares outputs for one judge run. Custom checkers are
+// compiled once by newOutputChecker and must be closed.
+type outputChecker struct {
+	config  *ProblemChecker
+	program *Program
+}
+
+// newOutputChecker prepares a checker. A custom checker that does not compile
+// is returned as a compile result with no checker.
+func (h *Handlers) newOutputChecker(ctx context.Context, config *ProblemChecker) (*outputChecker, *RunResult, error) {
+	checker := &outputChecker{config: config}
+	if config.Mode != CheckerCustom {
+		return checker, nil, nil
+	}
+	program, compileResult, err := h.Runner.Compile(ctx, config.Language, config.Code)
+	if err != nil || compileResult != nil {
+		return nil, compileResult, err
+	}
+	checker.program = program
+	return checker, nil, nil
+}
+
+func (c *outputChecker) Close() {
+	if c.program != nil {
+		c.program.Close()
+	}
+}
+
+// check returns the verdict for a run that ended normally, AC, WA or CF when
+// a custom checker failed, along with any message from a custom checker
+func (c *outputChecker) check(ctx context.Context, input, expected, actual string) (string, string, error) {
+	switch c.config.Mode {
+	case CheckerWhitespace:
+		return verdictFor(equalTokens(strings.Fields(expected), strings.Fields(actual))), "", nil
+	case CheckerUnordered:
+		expectedTokens, actualTokens := strings.Fields(expected), strings.Fields(actual)
+		sort.Strings(expectedTokens)
+		sort.Strings(actualTokens)
+		return verdictFor(equalTokens(expectedTokens, actualTokens)), "", nil
+	case CheckerFloat:
+		return verdictFor(floatTokensMatch(strings.Fields(expected), strings.Fields(actual), c.config.Epsilon)), "", nil
+	case CheckerCustom:
+		return c.runCustom(ctx, input, expected, actual)
+	}
+	return verdictFor(outputsMatch(expected, actual)), "", nil
+}
+
+// runCustom runs the checker program on one test case
+func (c *outputChecker) runCustom(ctx context.Context, input, expected, actual string) (string, string, error) {
+	files := map[string]string{
+		checkerInputFile:    input,
+		checkerExpectedFile: expected,
+		checkerOutputFile:   actual,
+	}
+	for name, content := range files {
+		if err := c.program.WriteFile(name, content); err != nil {
+			return "", "", err
+		}
+	}
+
+	result, err := c.program.Run(ctx, "", RunLimits{})
+	if err != nil {
+		return "", "", err
+	}
+	message := strings.TrimSpace(result.Stdout)
+	verdict := VerdictCheckerFailed
+	switch {
+	case result.Status == RunOK:
+		verdict = VerdictAccepted
+	case result.Status == RunRuntimeError && result.ExitCode == 1:
+		verdict = VerdictWrongAnswer
+	case message == "":
+		message = fmt.Sprintf("Checker ended with %s (exit code %d)", result.Status, result.ExitCode)
+		if stderr := strings.TrimSpace(result.Stderr); stderr != "" {
+			message += ": " + stderr
+		}
+	}
+	if len(message) > maxCheckerMessageBytes {
+		message = message[:maxCheckerMessageBytes]
+	}
+	return verdict, message, nil
+}
+
+func verdictFor(match bool) string {
+	if match {
+		return VerdictAccepted
+	}
+	return VerdictWrongAnswer
+}
+
+// outputsMatch compares a program's output with the expected output,
+// ignoring trailing whitespace on each line and trailing blank lines
+func outputsMatch(expected, actual string) bool {
+	return normalizeOutput(expected) == normalizeOutput(actual)
+}
+
+func normalizeOutput(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func equalTokens(expected, actual []string) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// floatTokensMatch compares tokens in order. Tokens that both parse as
+// numbers match when they differ by at most epsilon, absolutely or relative
+// to the expected value; other tokens must be equal.
+func floatTokensMatch(expected, actual []string, epsilon float64) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i := range expected {
+		if expected[i] == actual[i] {
+			continue
+		}
+		want, err := strconv.ParseFloat(expected[i], 64)
+		if err != nil {
+			return false
+		}
+		got, err := strconv.ParseFloat(actual[i], 64)
+		if err != nil || math.IsNaN(got) {
+			return false
+		}
+		if diff := math.Abs(want - got); diff > epsilon && diff > epsilon*math.Abs(want) {
+			return false
+		}
+	}
+	return true
+}
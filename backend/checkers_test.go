@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOutputCheckerModes(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected string
+		actual   string
+		want     string
+	}{
+		{CheckerExact, "1 2\n3\n", "1 2\n3\n", VerdictAccepted},
+		{CheckerExact, "1 2\n3\n", "1 2  \r\n3\n\n\n", VerdictAccepted},
+		{CheckerExact, "1 2\n3\n", "1 2\n3", VerdictAccepted},
+		{CheckerExact, "1 2\n3\n", "1  2\n3\n", VerdictWrongAnswer},
+		{CheckerExact, "1 2\n3\n", " 1 2\n3\n", VerdictWrongAnswer},
+		{CheckerExact, "1\n\n2\n", "1\n2\n", VerdictWrongAnswer},
+
+		{CheckerWhitespace, "1 2\n3\n", "1\n2   3", VerdictAccepted},
+		{CheckerWhitespace, "1 2\n3\n", "1 3 2", VerdictWrongAnswer},
+		{CheckerWhitespace, "1 2\n3\n", "1 2", VerdictWrongAnswer},
+
+		{CheckerUnordered, "1 2\n3\n", "3 1\n2", VerdictAccepted},
+		{CheckerUnordered, "1 1 2", "1 2 2", VerdictWrongAnswer},
+		{CheckerUnordered, "1 2", "1 2 3", VerdictWrongAnswer},
+
+		{CheckerFloat, "0.3333333 yes", "0.33333335 yes", VerdictAccepted},
+		{CheckerFloat, "1000000", "1000000.5", VerdictAccepted}, // Within the relative epsilon
+		{CheckerFloat, "0.5", "0.5001", VerdictWrongAnswer},
+		{CheckerFloat, "1.0 yes", "1.0 no", VerdictWrongAnswer},
+		{CheckerFloat, "1.0", "abc", VerdictWrongAnswer},
+		{CheckerFloat, "NaN", "NaN", VerdictAccepted},
+		{CheckerFloat, "1.0", "NaN", VerdictWrongAnswer},
+		{CheckerFloat, "1.0 2.0", "1.0", VerdictWrongAnswer},
+	}
+	for _, tt := range tests {
+		checker := &outputChecker{config: &ProblemChecker{Mode: tt.mode, Epsilon: defaultCheckerEpsilon}}
+		verdict, message, err := checker.check(context.Background(), "", tt.expected, tt.actual)
+		if err != nil {
+			t.Errorf("%s %q vs %q: %v", tt.mode, tt.expected, tt.actual, err)
+			continue
+		}
+		if verdict != tt.want || message != "" {
+			t.Errorf("%s %q vs %q: verdict %s, message %q; want %s", tt.mode, tt.expected, tt.actual, verdict, message, tt.want)
+		}
+	}
+}
+
+func TestFloatTokensMatchEpsilon(t *testing.T) {
+	tests := []struct {
+		expected, actual string
+		epsilon          float64
+		want             bool
+	}{
+		{"1.0", "1.05", 0.1, true},
+		{"1.0", "1.2", 0.1, false},
+		{"100", "109", 0.1, true}, // 10% of the expected value
+		{"100", "111", 0.1, false},
+		{"-2.5", "-2.5000001", 1e-6, true},
+		{"1e9", "1.000001e9", 1e-6, true},
+		{"1", "1.0000001", 0, false},
+	}
+	for _, tt := range tests {
+		if got := floatTokensMatch([]string{tt.expected}, []string{tt.actual}, tt.epsilon); got != tt.want {
+			t.Errorf("floatTokensMatch(%s, %s, %g) = %v, want %v", tt.expected, tt.actual, tt.epsilon, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeOutput(t *testing.T) {
+	tests := map[string]string{
+		"":                  "",
+		"\n\n":              "",
+		"a \t\r\nb\r\n\r\n": "a\nb",
+		"  a\n\nb":          "  a\n\nb",
+	}
+	for input, want := range tests {
+		if got := normalizeOutput(input); got != want {
+			t.Errorf("normalizeOutput(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
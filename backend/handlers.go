@@ -7,13 +7,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/mux"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -22,6 +22,14 @@ type Handlers struct {
 	DB        *Database
 	JWTSecret string
 	AIAPIKey  string
+	// BootstrapAdminEmail registers as admin while no enabled admin exists.
+	// Empty disables the bootstrap.
+	BootstrapAdminEmail string
+	Mailer              Mailer
+	AppURL              string // Frontend base URL used in emailed links
+	Limiter             *AuthLimiter
+	OIDC                *OIDCProvider // nil when single sign-on is not configured
+	Runner              *Runner
 }
 
 // Auth handlers
@@ -72,7 +80,8 @@ type ThitaBulkResponse struct {
 	} `json:"categories"`
 }
 
-// Login handles user authentication
+// Login handles user authentication. Unknown emails and wrong passwords get
+// the same response so callers cannot tell which accounts exist.
 func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -86,105 +95,96 @@ func (h *Handlers) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user User
-	var role sql.NullString
-	// Normalize email for comparison (trim and lowercase)
 	normalizedEmail := strings.TrimSpace(strings.ToLower(req.Email))
-	trimmedEmail := strings.TrimSpace(req.Email)
-
-	// Use COALESCE to handle NULL role values (default to 'admin')
-	// Try multiple query strategies to find the user
-	var err error
-
-	// Strategy 1: Exact match (case-sensitive, trimmed)
-	query1 := h.DB.convertPlaceholders("SELECT id, email, name, password, COALESCE(role, 'admin') as role FROM users WHERE email = ?")
-	err = h.DB.DB.QueryRow(query1, trimmedEmail).Scan(&user.ID, &user.Email, &user.Name, &user.Password, &role)
-
-	// Strategy 2: Case-insensitive match
-	if err == sql.ErrNoRows {
-		query2 := h.DB.convertPlaceholders("SELECT id, email, name, password, COALESCE(role, 'admin') as role FROM users WHERE LOWER(email) = ?")
-		err = h.DB.DB.QueryRow(query2, normalizedEmail).Scan(&user.ID, &user.Email, &user.Name, &user.Password, &role)
+	if wait := h.Limiter.loginBlocked(r, normalizedEmail); wait > 0 {
+		respondTooManyRequests(w, wait, "Too many failed login attempts. Please try again later.")
+		return
 	}
 
-	// Strategy 3: Query all users and find match manually (fallback for edge cases)
-	if err == sql.ErrNoRows {
-		rows, queryErr := h.DB.DB.Query("SELECT id, email, name, password, COALESCE(role, 'admin') as role FROM users")
-		if queryErr == nil {
-			defer rows.Close()
-			for rows.Next() {
-				var tempUser User
-				var tempRole sql.NullString
-				if scanErr := rows.Scan(&tempUser.ID, &tempUser.Email, &tempUser.Name, &tempUser.Password, &tempRole); scanErr == nil {
-					// Compare normalized emails
-					if strings.TrimSpace(strings.ToLower(tempUser.Email)) == normalizedEmail {
-						user = tempUser
-						role = tempRole
-						err = nil
-						break
-					}
-				}
-			}
-		}
+	user, err := h.DB.findUserByEmail(normalizedEmail)
+	if err != nil {
+		log.Printf("Error looking up user for login: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
 	}
 
-	if err == sql.ErrNoRows {
-		// Return detailed error message to help debug
-		respondWithError(w, http.StatusUnauthorized, fmt.Sprintf("User not found. Email tried: '%s'. Please check your email or register first.", req.Email))
-		return
+	// Compare against a dummy hash when the user does not exist so both
+	// cases take about as long
+	passwordHash := dummyPasswordHash()
+	if user != nil && user.Password != "" {
+		passwordHash = []byte(user.Password)
 	}
-	if err != nil {
-		// Return the actual database error to help debug
-		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(req.Password)); err != nil || user == nil || user.Password == "" {
+		h.Limiter.loginFailed(r, normalizedEmail)
+		actorID := ""
+		if user != nil {
+			actorID = user.ID
+		}
+		h.auditAs(r, actorID, normalizedEmail, AuditLoginFailed, "user", actorID, "", nil, map[string]string{"reason": "invalid credentials"})
+		respondWithError(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
+	h.Limiter.loginSucceeded(normalizedEmail)
 
-	// Handle role
-	if role.Valid && role.String != "" {
-		user.Role = role.String
-	} else {
-		user.Role = "admin"
-		// Update the user in database to have a role if it was NULL
-		updateQuery := h.DB.convertPlaceholders("UPDATE users SET role = 'admin' WHERE id = ? AND (role IS NULL OR role = '')")
-		h.DB.DB.Exec(updateQuery, user.ID)
-	}
+	h.completeLogin(w, r, user, "password")
+}
 
-	// Compare password - check if password hash is valid first
-	if len(user.Password) == 0 {
-		respondWithError(w, http.StatusInternalServerError, "User account error: password hash is empty")
+// completeLogin signs in a user whose primary credentials were verified by
+// method. Accounts with 2FA get a challenge that must be completed at /api/login/2fa.
+func (h *Handlers) completeLogin(w http.ResponseWriter, r *http.Request, user *User, method string) {
+	// Reject accounts disabled by an admin
+	if user.DisabledAt != nil {
+		h.auditAs(r, user.ID, user.Email, AuditLoginFailed, "user", user.ID, "", nil, map[string]string{"reason": "account disabled", "method": method})
+		respondWithError(w, http.StatusForbidden, "Account is disabled")
 		return
 	}
 
-	// Compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		// Return more specific error (but don't reveal too much for security)
-		respondWithError(w, http.StatusUnauthorized, "Invalid password. Please check your password and try again.")
+	if user.TwoFactorEnabled {
+		challenge, err := h.issueTwoFactorChallenge(user.ID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error generating token")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"twoFactorRequired": true,
+			"challengeToken":    challenge,
+			"expiresIn":         int64(twoFactorChallengeTTL / time.Second),
+		})
 		return
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": user.ID,
-		"exp":    time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
-	})
-
-	tokenString, err := token.SignedString([]byte(h.JWTSecret))
+	// Generate access and refresh tokens
+	tokens, err := h.issueTokens(user.ID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error generating token")
 		return
 	}
+	h.auditAs(r, user.ID, user.Email, AuditLogin, "user", user.ID, "", nil, map[string]string{"method": method})
 
-	respondWithJSON(w, http.StatusOK, map[string]interface{}{
-		"token": tokenString,
+	respondWithJSON(w, http.StatusOK, loginResponse(tokens, user))
+}
+
+// loginResponse is the body returned once a user is fully signed in
+func loginResponse(tokens *TokenPair, user *User) map[string]interface{} {
+	return map[string]interface{}{
+		"token":        tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
 		"user": map[string]interface{}{
-			"id":    user.ID,
-			"email": user.Email,
-			"name":  user.Name,
-			"role":  user.Role,
+			"id":                 user.ID,
+			"email":              user.Email,
+			"name":               user.Name,
+			"role":               user.Role,
+			"mustChangePassword": user.MustChangePassword,
+			"emailVerified":      user.EmailVerifiedAt != nil,
+			"twoFactorEnabled":   user.TwoFactorEnabled,
 		},
-	})
+	}
 }
 
-// Register handles user registration
+// Register handles user registration. The response is the same whether or
+// not the email already belongs to an account, which is told by email
+// instead, so registration cannot be used to find out who has one.
 func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -192,80 +192,123 @@ func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Emails are stored normalized so lookups match exactly one account
+	req.Email = normalizeEmail(req.Email)
+
 	// Validate input
 	if req.Email == "" || req.Password == "" || req.Name == "" {
 		respondWithError(w, http.StatusBadRequest, "Email, password, and name are required")
 		return
 	}
 
-	// Check if user already exists
-	var existingID string
-	query := h.DB.convertPlaceholders("SELECT id FROM users WHERE email = ? OR LOWER(email) = LOWER(?)")
-	err := h.DB.DB.QueryRow(query, req.Email, req.Email).Scan(&existingID)
-	if err == nil {
-		respondWithError(w, http.StatusConflict, "User with this email already exists")
-		return
-	}
-	if err != sql.ErrNoRows {
-		respondWithError(w, http.StatusInternalServerError, "Database error: "+err.Error())
+	// Hash password before the lookup so both outcomes take as long
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error hashing password")
 		return
 	}
 
-	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	// Check if user already exists
+	existing, err := h.DB.findUserByEmail(req.Email)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error hashing password")
+		log.Printf("Error looking up user for registration: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if existing != nil {
+		if err := h.sendAccountExistsEmail(existing.Email, existing.Name); err != nil {
+			log.Printf("Error sending account exists email to %s: %v", existing.Email, err)
+		}
+		respondWithRegistered(w)
 		return
 	}
 
 	// Generate user ID
 	userID := generateID()
 
-	// Insert user (default role is 'admin' as per schema)
-	query = h.DB.convertPlaceholders("INSERT INTO users (id, email, name, password, role) VALUES (?, ?, ?, ?, ?)")
-	_, err = h.DB.DB.Exec(
+	// New accounts get the regular user role. So that a fresh installation
+	// can be administered, the operator may name one email that registers as
+	// an admin while there is no enabled admin. Emails are unique, so only
+	// one registration can claim it.
+	role := "user"
+	if h.BootstrapAdminEmail != "" && req.Email == normalizeEmail(h.BootstrapAdminEmail) {
+		admins, err := h.countActiveAdmins()
+		if err != nil {
+			log.Printf("Error counting admins for registration: %v", err)
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if admins == 0 {
+			role = "admin"
+		}
+	}
+
+	// The user and their personal workspace are created together or not at all
+	tx, err := h.DB.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	// Insert user
+	query := h.DB.convertPlaceholders("INSERT INTO users (id, email, name, password, role) VALUES (?, ?, ?, ?, ?)")
+	_, err = tx.Exec(
 		query,
-		userID, req.Email, req.Name, string(hashedPassword), "admin",
+		userID, req.Email, req.Name, string(hashedPassword), role,
 	)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating user: "+err.Error())
+		log.Printf("Error creating user: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error creating user")
 		return
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userID": userID,
-		"exp":    time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
-	})
-
-	tokenString, err := token.SignedString([]byte(h.JWTSecret))
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error generating token")
+	if _, err := h.DB.createPersonalWorkspaceWith(tx, userID, req.Name); err != nil {
+		log.Printf("Error creating workspace for new user %s: %v", userID, err)
+		respondWithError(w, http.StatusInternalServerError, "Error creating workspace")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Error creating user: %v", err)
+		respondWithError(w, http.StatusInternalServerError, "Error creating user")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, map[string]interface{}{
-		"token": tokenString,
-		"user": map[string]interface{}{
-			"id":    userID,
-			"email": req.Email,
-			"name":  req.Name,
-			"role":  "admin",
-		},
-	})
+	// A failed email does not fail registration; the user can ask for another one
+	if err := h.sendVerificationEmail(userID, req.Email, req.Name); err != nil {
+		log.Printf("Error sending verification email to %s: %v", req.Email, err)
+	}
+
+	respondWithRegistered(w)
+}
+
+// respondWithRegistered is the answer to every successful registration request
+func respondWithRegistered(w http.ResponseWriter) {
+	respondWithJSON(w, http.StatusCreated, map[string]string{"message": "Check your email to verify your address, then sign in"})
 }
 
 // Category handlers
 
 func (h *Handlers) GetCategories(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.DB.DB.Query(`
-		SELECT c.id, c.name, c.icon, c.description, c.created_at, c.updated_at,
-		       COUNT(DISTINCT p.id) as pattern_count
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	query := h.DB.convertPlaceholders(`
+		SELECT c.id, c.workspace_id, c.owner_id, c.name, c.icon, c.description, c.created_at, c.updated_at,
+		       COUNT(DISTINCT p.id) as pattern_count,
+		       COUNT(DISTINCT pr.id) as problem_count,
+		       COUNT(DISTINCT CASE WHEN pp.status IN ` + solvedStatusesSQL + ` THEN pr.id END) as solved_count
 		FROM categories c
 		LEFT JOIN patterns p ON p.category_id = c.id
-		GROUP BY c.id, c.name, c.icon, c.description, c.created_at, c.updated_at
+		LEFT JOIN problems pr ON pr.pattern_id = p.id
+		LEFT JOIN problem_progress pp ON pp.problem_id = pr.id AND pp.user_id = ?
+		WHERE c.workspace_id = ?
+		GROUP BY c.id, c.workspace_id, c.owner_id, c.name, c.icon, c.description, c.created_at, c.updated_at
 		ORDER BY c.created_at ASC
 	`)
+	rows, err := h.DB.DB.Query(query, getUserID(r), workspaceID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Database error")
 		return
@@ -275,7 +318,7 @@ func (h *Handlers) GetCategories(w http.ResponseWriter, r *http.Request) {
 	var categories []Category
 	for rows.Next() {
 		var cat Category
-		err := rows.Scan(&cat.ID, &cat.Name, &cat.Icon, &cat.Description, &cat.CreatedAt, &cat.UpdatedAt, &cat.PatternCount)
+		err := rows.Scan(&cat.ID, &cat.WorkspaceID, &cat.OwnerID, &cat.Name, &cat.Icon, &cat.Description, &cat.CreatedAt, &cat.UpdatedAt, &cat.PatternCount, &cat.ProblemCount, &cat.SolvedCount)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Error scanning category")
 			return
@@ -287,8 +330,8 @@ func (h *Handlers) GetCategories(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) CreateCategory(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot create categories")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	var cat Category
@@ -298,23 +341,26 @@ func (h *Handlers) CreateCategory(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cat.ID = generateID()
+	cat.WorkspaceID = workspaceID
+	cat.OwnerID = getUserID(r)
 	cat.PatternCount = 0
 	cat.CreatedAt = time.Now()
 	cat.UpdatedAt = time.Now()
 
-	query := h.DB.convertPlaceholders("INSERT INTO categories (id, name, icon, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)")
-	_, err := h.DB.DB.Exec(query, cat.ID, cat.Name, cat.Icon, cat.Description, cat.CreatedAt, cat.UpdatedAt)
+	query := h.DB.convertPlaceholders("INSERT INTO categories (id, workspace_id, owner_id, name, icon, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	_, err := h.DB.DB.Exec(query, cat.ID, cat.WorkspaceID, cat.OwnerID, cat.Name, cat.Icon, cat.Description, cat.CreatedAt, cat.UpdatedAt)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error creating category")
 		return
 	}
+	h.audit(r, AuditCategoryCreate, "category", cat.ID, workspaceID, nil, cat)
 
 	respondWithJSON(w, http.StatusCreated, cat)
 }
 
 func (h *Handlers) UpdateCategory(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot update categories")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	vars := mux.Vars(r)
@@ -326,32 +372,60 @@ func (h *Handlers) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := h.loadCategory(id, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
 	cat.UpdatedAt = time.Now()
-	query := h.DB.convertPlaceholders("UPDATE categories SET name = ?, icon = ?, description = ?, updated_at = ? WHERE id = ?")
-	_, err := h.DB.DB.Exec(query, cat.Name, cat.Icon, cat.Description, cat.UpdatedAt, id)
+	cat.WorkspaceID = workspaceID
+	query := h.DB.convertPlaceholders("UPDATE categories SET name = ?, icon = ?, description = ?, updated_at = ? WHERE id = ? AND workspace_id = ?")
+	result, err := h.DB.DB.Exec(query, cat.Name, cat.Icon, cat.Description, cat.UpdatedAt, id, cat.WorkspaceID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error updating category")
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+	if after, err := h.loadCategory(id, workspaceID); err == nil {
+		h.audit(r, AuditCategoryUpdate, "category", id, workspaceID, before, after)
+	}
 
 	cat.ID = id
 	respondWithJSON(w, http.StatusOK, cat)
 }
 
 func (h *Handlers) DeleteCategory(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot delete categories")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	query := h.DB.convertPlaceholders("DELETE FROM categories WHERE id = ?")
-	_, err := h.DB.DB.Exec(query, id)
+	before, err := h.loadCategory(id, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	found, err := h.deleteContent(workspaceID, "categories", id)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error deleting category")
 		return
 	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+	h.audit(r, AuditCategoryDelete, "category", id, workspaceID, before, nil)
 
 	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Category deleted"})
 }
@@ -359,19 +433,25 @@ func (h *Handlers) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 // Pattern handlers
 
 func (h *Handlers) GetPatterns(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	categoryID := vars["categoryId"]
 
 	query := h.DB.convertPlaceholders(`
-		SELECT p.id, p.category_id, p.name, p.icon, p.description, COALESCE(p.theory, '') as theory, p.created_at, p.updated_at,
-		       COUNT(DISTINCT pr.id) as problem_count
+		SELECT p.id, p.workspace_id, p.owner_id, p.category_id, p.name, p.icon, p.description, COALESCE(p.theory, '') as theory, p.created_at, p.updated_at,
+		       COUNT(DISTINCT pr.id) as problem_count,
+		       COUNT(DISTINCT CASE WHEN pp.status IN ` + solvedStatusesSQL + ` THEN pr.id END) as solved_count
 		FROM patterns p
 		LEFT JOIN problems pr ON pr.pattern_id = p.id
-		WHERE p.category_id = ?
-		GROUP BY p.id, p.category_id, p.name, p.icon, p.description, p.theory, p.created_at, p.updated_at
+		LEFT JOIN problem_progress pp ON pp.problem_id = pr.id AND pp.user_id = ?
+		WHERE p.category_id = ? AND p.workspace_id = ?
+		GROUP BY p.id, p.workspace_id, p.owner_id, p.category_id, p.name, p.icon, p.description, p.theory, p.created_at, p.updated_at
 		ORDER BY p.created_at ASC
 	`)
-	rows, err := h.DB.DB.Query(query, categoryID)
+	rows, err := h.DB.DB.Query(query, getUserID(r), categoryID, workspaceID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Database error: %v", err))
 		return
@@ -381,7 +461,7 @@ func (h *Handlers) GetPatterns(w http.ResponseWriter, r *http.Request) {
 	var patterns []Pattern
 	for rows.Next() {
 		var pat Pattern
-		err := rows.Scan(&pat.ID, &pat.CategoryID, &pat.Name, &pat.Icon, &pat.Description, &pat.Theory, &pat.CreatedAt, &pat.UpdatedAt, &pat.ProblemCount)
+		err := rows.Scan(&pat.ID, &pat.WorkspaceID, &pat.OwnerID, &pat.CategoryID, &pat.Name, &pat.Icon, &pat.Description, &pat.Theory, &pat.CreatedAt, &pat.UpdatedAt, &pat.ProblemCount, &pat.SolvedCount)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Error scanning pattern")
 			return
@@ -393,13 +473,23 @@ func (h *Handlers) GetPatterns(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) CreatePattern(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot create patterns")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	vars := mux.Vars(r)
 	categoryID := vars["categoryId"]
 
+	found, err := h.inWorkspace("categories", categoryID, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
 	var pat Pattern
 	if err := json.NewDecoder(r.Body).Decode(&pat); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
@@ -407,24 +497,31 @@ func (h *Handlers) CreatePattern(w http.ResponseWriter, r *http.Request) {
 	}
 
 	pat.ID = generateID()
+	pat.WorkspaceID = workspaceID
+	pat.OwnerID = getUserID(r)
 	pat.CategoryID = categoryID
 	pat.ProblemCount = 0
 	pat.CreatedAt = time.Now()
 	pat.UpdatedAt = time.Now()
 
-	query := h.DB.convertPlaceholders("INSERT INTO patterns (id, category_id, name, icon, description, theory, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
-	_, err := h.DB.DB.Exec(query, pat.ID, pat.CategoryID, pat.Name, pat.Icon, pat.Description, pat.Theory, pat.CreatedAt, pat.UpdatedAt)
+	query := h.DB.convertPlaceholders("INSERT INTO patterns (id, workspace_id, owner_id, category_id, name, icon, description, theory, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	_, err = h.DB.DB.Exec(query, pat.ID, pat.WorkspaceID, pat.OwnerID, pat.CategoryID, pat.Name, pat.Icon, pat.Description, pat.Theory, pat.CreatedAt, pat.UpdatedAt)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error creating pattern")
 		return
 	}
+	if err := h.recordRevision(workspaceID, RevisionPattern, pat.ID, "theory", "", pat.Theory, pat.OwnerID, 0); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving revision")
+		return
+	}
+	h.audit(r, AuditPatternCreate, "pattern", pat.ID, workspaceID, nil, pat)
 
 	respondWithJSON(w, http.StatusCreated, pat)
 }
 
 func (h *Handlers) UpdatePattern(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot update patterns")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	vars := mux.Vars(r)
@@ -436,40 +533,72 @@ func (h *Handlers) UpdatePattern(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before, err := h.loadPattern(id, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Pattern not found")
+		return
+	}
+
 	pat.UpdatedAt = time.Now()
-	query := h.DB.convertPlaceholders("UPDATE patterns SET name = ?, icon = ?, description = ?, theory = ?, updated_at = ? WHERE id = ?")
-	_, err := h.DB.DB.Exec(query, pat.Name, pat.Icon, pat.Description, pat.Theory, pat.UpdatedAt, id)
+	pat.WorkspaceID = workspaceID
+	query := h.DB.convertPlaceholders("UPDATE patterns SET name = ?, icon = ?, description = ?, theory = ?, updated_at = ? WHERE id = ? AND workspace_id = ?")
+	result, err := h.DB.DB.Exec(query, pat.Name, pat.Icon, pat.Description, pat.Theory, pat.UpdatedAt, id, pat.WorkspaceID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error updating pattern")
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Pattern not found")
+		return
+	}
+	if err := h.recordRevision(workspaceID, RevisionPattern, id, "theory", before.Theory, pat.Theory, getUserID(r), 0); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving revision")
+		return
+	}
+	if after, err := h.loadPattern(id, workspaceID); err == nil {
+		h.audit(r, AuditPatternUpdate, "pattern", id, workspaceID, before, after)
+	}
 
 	pat.ID = id
 	respondWithJSON(w, http.StatusOK, pat)
 }
 
 func (h *Handlers) DeletePattern(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot delete patterns")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	query := h.DB.convertPlaceholders("DELETE FROM patterns WHERE id = ?")
-	_, err := h.DB.DB.Exec(query, id)
+	before, err := h.loadPattern(id, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	found, err := h.deleteContent(workspaceID, "patterns", id)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error deleting pattern")
 		return
 	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Pattern not found")
+		return
+	}
+	h.audit(r, AuditPatternDelete, "pattern", id, workspaceID, before, nil)
 
 	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Pattern deleted"})
 }
 
 // UpdatePatternTheory updates only the theory field of a pattern
 func (h *Handlers) UpdatePatternTheory(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot update pattern theory")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	vars := mux.Vars(r)
@@ -483,12 +612,33 @@ func (h *Handlers) UpdatePatternTheory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := h.DB.convertPlaceholders("UPDATE patterns SET theory = ?, updated_at = ? WHERE id = ?")
-	_, err := h.DB.DB.Exec(query, req.Theory, time.Now(), id)
+	before, err := h.loadPattern(id, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Pattern not found")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE patterns SET theory = ?, updated_at = ? WHERE id = ? AND workspace_id = ?")
+	result, err := h.DB.DB.Exec(query, req.Theory, time.Now(), id, workspaceID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error updating pattern theory")
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Pattern not found")
+		return
+	}
+	if err := h.recordRevision(workspaceID, RevisionPattern, id, "theory", before.Theory, req.Theory, getUserID(r), 0); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving revision")
+		return
+	}
+	if after, err := h.loadPattern(id, workspaceID); err == nil {
+		h.audit(r, AuditPatternUpdate, "pattern", id, workspaceID, before, after)
+	}
 
 	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Pattern theory updated"})
 }
@@ -496,111 +646,148 @@ func (h *Handlers) UpdatePatternTheory(w http.ResponseWriter, r *http.Request) {
 // Problem handlers
 
 func (h *Handlers) GetProblems(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	patternID := vars["patternId"]
 
 	query := h.DB.convertPlaceholders(`
-		SELECT id, pattern_id, title, difficulty, description, input, output, 
-		       constraints, sample_input, sample_output, explanation, notes,
-		       created_at, updated_at
-		FROM problems
-		WHERE pattern_id = ?
-		ORDER BY created_at ASC
+		SELECT p.id, p.workspace_id, p.owner_id, p.pattern_id, p.title, p.difficulty, p.description, p.input, p.output,
+		       p.constraints, p.sample_input, p.sample_output, p.explanation, p.notes,
+		       p.created_at, p.updated_at, ` + progressColumns + `
+		FROM problems p
+		LEFT JOIN problem_progress pp ON pp.problem_id = p.id AND pp.user_id = ?
+		WHERE p.pattern_id = ? AND p.workspace_id = ?
+		ORDER BY p.created_at ASC
 	`)
-	rows, err := h.DB.DB.Query(query, patternID)
+	rows, err := h.DB.DB.Query(query, getUserID(r), patternID, workspaceID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Database error")
 		return
 	}
-	defer rows.Close()
 
 	var problems []Problem
 	for rows.Next() {
 		var prob Problem
-		err := rows.Scan(
-			&prob.ID, &prob.PatternID, &prob.Title, &prob.Difficulty,
+		var progress progressScanner
+		err := rows.Scan(append([]interface{}{
+			&prob.ID, &prob.WorkspaceID, &prob.OwnerID, &prob.PatternID, &prob.Title, &prob.Difficulty,
 			&prob.Description, &prob.Input, &prob.Output, &prob.Constraints,
 			&prob.SampleInput, &prob.SampleOutput, &prob.Explanation, &prob.Notes,
 			&prob.CreatedAt, &prob.UpdatedAt,
-		)
+		}, progress.dest()...)...)
 		if err != nil {
+			rows.Close()
 			respondWithError(w, http.StatusInternalServerError, "Error scanning problem")
 			return
 		}
+		prob.Progress = progress.result()
 
-		// Load solutions for this problem
-		solutions, err := h.getSolutions(prob.ID)
+		problems = append(problems, prob)
+	}
+	// Rows must be closed before loading solutions
+	rows.Close()
+
+	for i := range problems {
+		solutions, err := h.getSolutions(problems[i].ID)
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Error loading solutions")
 			return
 		}
-		prob.Solutions = solutions
-
-		problems = append(problems, prob)
+		problems[i].Solutions = solutions
+		if problems[i].Approaches, err = h.getApproaches(problems[i].ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error loading approaches")
+			return
+		}
 	}
 
 	respondWithJSON(w, http.StatusOK, problems)
 }
 
 func (h *Handlers) GetProblem(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var prob Problem
-	query := h.DB.convertPlaceholders(`
-		SELECT id, pattern_id, title, difficulty, description, input, output,
-		       constraints, sample_input, sample_output, explanation, notes,
-		       created_at, updated_at
-		FROM problems
-		WHERE id = ?
-	`)
-	err := h.DB.DB.QueryRow(query, id).Scan(
-		&prob.ID, &prob.PatternID, &prob.Title, &prob.Difficulty,
-		&prob.Description, &prob.Input, &prob.Output, &prob.Constraints,
-		&prob.SampleInput, &prob.SampleOutput, &prob.Explanation, &prob.Notes,
-		&prob.CreatedAt, &prob.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		respondWithError(w, http.StatusNotFound, "Problem not found")
-		return
-	}
+	prob, err := h.loadProblem(id, workspaceID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Database error")
 		return
 	}
+	if prob == nil {
+		respondWithError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
 
-	// Load solutions
-	solutions, err := h.getSolutions(prob.ID)
+	prob.Progress, err = h.DB.getProgress(getUserID(r), prob.ID)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error loading solutions")
+		respondWithError(w, http.StatusInternalServerError, "Error loading progress")
 		return
 	}
-	prob.Solutions = solutions
 
 	respondWithJSON(w, http.StatusOK, prob)
 }
 
 func (h *Handlers) CreateProblem(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot create problems")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	vars := mux.Vars(r)
 	patternID := vars["patternId"]
 
+	found, err := h.inWorkspace("patterns", patternID, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Pattern not found")
+		return
+	}
+
 	var prob Problem
 	if err := json.NewDecoder(r.Body).Decode(&prob); err != nil {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	testCases := make([]TestCaseInput, len(prob.TestCases))
+	for i, tc := range prob.TestCases {
+		if err := tc.validate(); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Test case %d: %v", i+1, err))
+			return
+		}
+		testCases[i] = tc.TestCaseInput
+	}
+	for _, sol := range prob.Solutions {
+		if !isSupportedLanguage(sol.Language) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported solution language %q", sol.Language))
+			return
+		}
+	}
+	approaches := make([]ApproachInput, len(prob.Approaches))
+	for i, a := range prob.Approaches {
+		if err := a.validate(); err != nil {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Approach %d: %v", i+1, err))
+			return
+		}
+		approaches[i] = a.ApproachInput
+	}
 
 	prob.ID = generateID()
+	prob.WorkspaceID = workspaceID
+	prob.OwnerID = getUserID(r)
 	prob.PatternID = patternID
 	prob.CreatedAt = time.Now()
 	prob.UpdatedAt = time.Now()
 
-	query := h.DB.convertPlaceholders(`INSERT INTO problems (id, pattern_id, title, difficulty, description, input, output, constraints, sample_input, sample_output, explanation, notes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
-	_, err := h.DB.DB.Exec(query, prob.ID, prob.PatternID, prob.Title, prob.Difficulty,
+	query := h.DB.convertPlaceholders(`INSERT INTO problems (id, workspace_id, owner_id, pattern_id, title, difficulty, description, input, output, constraints, sample_input, sample_output, explanation, notes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	_, err = h.DB.DB.Exec(query, prob.ID, prob.WorkspaceID, prob.OwnerID, prob.PatternID, prob.Title, prob.Difficulty,
 		prob.Description, prob.Input, prob.Output, prob.Constraints,
 		prob.SampleInput, prob.SampleOutput, prob.Explanation, prob.Notes,
 		prob.CreatedAt, prob.UpdatedAt)
@@ -608,6 +795,10 @@ func (h *Handlers) CreateProblem(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusInternalServerError, "Error creating problem")
 		return
 	}
+	if err := h.recordProblemRevisions(workspaceID, nil, &prob, prob.OwnerID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving revisions")
+		return
+	}
 
 	// Save solutions
 	for _, sol := range prob.Solutions {
@@ -617,12 +808,20 @@ func (h *Handlers) CreateProblem(w http.ResponseWriter, r *http.Request) {
 		sol.UpdatedAt = time.Now()
 		solQuery := h.DB.convertPlaceholders(`INSERT INTO solutions (id, problem_id, language, code, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`)
 		_, err := h.DB.DB.Exec(solQuery, sol.ID, sol.ProblemID, sol.Language, sol.Code, sol.CreatedAt, sol.UpdatedAt)
+		if err == nil {
+			err = h.recordRevision(workspaceID, RevisionSolution, prob.ID, sol.Language, "", sol.Code, prob.OwnerID, 0)
+		}
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Error saving solution")
 			return
 		}
 	}
 
+	if prob.Approaches, err = h.insertApproaches(workspaceID, prob.ID, approaches, prob.OwnerID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving approaches")
+		return
+	}
+
 	// Reload solutions
 	solutions, err := h.getSolutions(prob.ID)
 	if err != nil {
@@ -631,12 +830,20 @@ func (h *Handlers) CreateProblem(w http.ResponseWriter, r *http.Request) {
 	}
 	prob.Solutions = solutions
 
+	if len(testCases) > 0 {
+		if prob.TestCases, err = h.insertTestCases(prob.ID, testCases); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error saving test cases")
+			return
+		}
+	}
+	h.audit(r, AuditProblemCreate, "problem", prob.ID, workspaceID, nil, prob)
+
 	respondWithJSON(w, http.StatusCreated, prob)
 }
 
 func (h *Handlers) UpdateProblem(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot update problems")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	vars := mux.Vars(r)
@@ -647,47 +854,67 @@ func (h *Handlers) UpdateProblem(w http.ResponseWriter, r *http.Request) {
 		respondWithError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	for _, sol := range prob.Solutions {
+		if !isSupportedLanguage(sol.Language) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported solution language %q", sol.Language))
+			return
+		}
+	}
+
+	before, err := h.loadProblem(id, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
 
 	prob.UpdatedAt = time.Now()
-	query := h.DB.convertPlaceholders(`UPDATE problems SET title = ?, difficulty = ?, description = ?, input = ?, output = ?, constraints = ?, sample_input = ?, sample_output = ?, explanation = ?, notes = ?, updated_at = ? WHERE id = ?`)
-	_, err := h.DB.DB.Exec(query, prob.Title, prob.Difficulty, prob.Description, prob.Input, prob.Output,
+	prob.WorkspaceID = workspaceID
+	query := h.DB.convertPlaceholders(`UPDATE problems SET title = ?, difficulty = ?, description = ?, input = ?, output = ?, constraints = ?, sample_input = ?, sample_output = ?, explanation = ?, notes = ?, updated_at = ? WHERE id = ? AND workspace_id = ?`)
+	result, err := h.DB.DB.Exec(query, prob.Title, prob.Difficulty, prob.Description, prob.Input, prob.Output,
 		prob.Constraints, prob.SampleInput, prob.SampleOutput, prob.Explanation,
-		prob.Notes, prob.UpdatedAt, id)
+		prob.Notes, prob.UpdatedAt, id, prob.WorkspaceID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error updating problem")
 		return
 	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+	prob.ID = id
+	if err := h.recordProblemRevisions(workspaceID, before, &prob, getUserID(r)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving revisions")
+		return
+	}
 
-	// Update solutions - use UPSERT based on (problem_id, language) unique constraint
-	for _, sol := range prob.Solutions {
-		sol.ProblemID = id
-		sol.UpdatedAt = time.Now()
-
-		// Check if solution exists for this language
-		var existingID string
-		checkQuery := h.DB.convertPlaceholders(`SELECT id FROM solutions WHERE problem_id = ? AND language = ?`)
-		err := h.DB.DB.QueryRow(checkQuery, id, sol.Language).Scan(&existingID)
-
-		if err == sql.ErrNoRows {
-			// New solution - generate ID
-			sol.ID = generateID()
-			sol.CreatedAt = time.Now()
-			insertQuery := h.DB.convertPlaceholders(`INSERT INTO solutions (id, problem_id, language, code, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`)
-			_, err = h.DB.DB.Exec(insertQuery, sol.ID, sol.ProblemID, sol.Language, sol.Code, sol.CreatedAt, sol.UpdatedAt)
-		} else if err == nil {
-			// Existing solution - update it
-			sol.ID = existingID
-			updateQuery := h.DB.convertPlaceholders(`UPDATE solutions SET code = ?, updated_at = ? WHERE problem_id = ? AND language = ?`)
-			_, err = h.DB.DB.Exec(updateQuery, sol.Code, sol.UpdatedAt, sol.ProblemID, sol.Language)
+	// Solutions listed from approaches are sent back as read; storing them
+	// would pin the approach's current code
+	approachCode := map[string]string{}
+	for _, a := range before.Approaches {
+		for _, sol := range a.Solutions {
+			approachCode[sol.ID] = sol.Code
 		}
+	}
 
+	// Update solutions, keeping a revision of each one that changed
+	for _, sol := range prob.Solutions {
+		if code, ok := approachCode[sol.ID]; ok && code == sol.Code {
+			continue
+		}
+		previous, err := h.storeSolutionCode(id, sol.Language, sol.Code)
+		if err == nil {
+			err = h.recordRevision(workspaceID, RevisionSolution, id, sol.Language, previous, sol.Code, getUserID(r), 0)
+		}
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Error saving solution")
 			return
 		}
 	}
 
-	prob.ID = id
 	// Reload solutions
 	solutions, err := h.getSolutions(prob.ID)
 	if err != nil {
@@ -695,32 +922,167 @@ func (h *Handlers) UpdateProblem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	prob.Solutions = solutions
+	// Approaches are edited through their own endpoints
+	prob.Approaches = before.Approaches
+	if after, err := h.loadProblem(id, workspaceID); err == nil {
+		h.audit(r, AuditProblemUpdate, "problem", id, workspaceID, before, after)
+	}
 
 	respondWithJSON(w, http.StatusOK, prob)
 }
 
 func (h *Handlers) DeleteProblem(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot delete problems")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	query := h.DB.convertPlaceholders("DELETE FROM problems WHERE id = ?")
-	_, err := h.DB.DB.Exec(query, id)
+	before, err := h.loadProblem(id, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	found, err := h.deleteContent(workspaceID, "problems", id)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Error deleting problem")
 		return
 	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+	h.audit(r, AuditProblemDelete, "problem", id, workspaceID, before, nil)
 
 	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Problem deleted"})
 }
 
-// Helper function to get solutions for a problem
+// deleteContent deletes a category, pattern or problem of a workspace, with
+// the revisions of everything under it, and reports whether it was found
+func (h *Handlers) deleteContent(workspaceID, table, id string) (bool, error) {
+	tx, err := h.DB.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := h.deleteRevisionsUnder(tx, workspaceID, table, id); err != nil {
+		return false, err
+	}
+	query := h.DB.convertPlaceholders("DELETE FROM " + table + " WHERE id = ? AND workspace_id = ?")
+	result, err := tx.Exec(query, id, workspaceID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+// inWorkspace reports whether a category, pattern or problem belongs to the given workspace
+func (h *Handlers) inWorkspace(table, id, workspaceID string) (bool, error) {
+	var exists bool
+	query := h.DB.convertPlaceholders(fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE id = ? AND workspace_id = ?)", table))
+	err := h.DB.DB.QueryRow(query, id, workspaceID).Scan(&exists)
+	return exists, err
+}
+
+// loadCategory returns a category in a workspace, or nil if there is none
+func (h *Handlers) loadCategory(id, workspaceID string) (*Category, error) {
+	var cat Category
+	query := h.DB.convertPlaceholders("SELECT id, workspace_id, owner_id, name, icon, description, created_at, updated_at FROM categories WHERE id = ? AND workspace_id = ?")
+	err := h.DB.DB.QueryRow(query, id, workspaceID).Scan(&cat.ID, &cat.WorkspaceID, &cat.OwnerID, &cat.Name, &cat.Icon, &cat.Description, &cat.CreatedAt, &cat.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cat, nil
+}
+
+// loadPattern returns a pattern in a workspace, or nil if there is none
+func (h *Handlers) loadPattern(id, workspaceID string) (*Pattern, error) {
+	var pat Pattern
+	query := h.DB.convertPlaceholders("SELECT id, workspace_id, owner_id, category_id, name, icon, description, COALESCE(theory, ''), created_at, updated_at FROM patterns WHERE id = ? AND workspace_id = ?")
+	err := h.DB.DB.QueryRow(query, id, workspaceID).Scan(&pat.ID, &pat.WorkspaceID, &pat.OwnerID, &pat.CategoryID, &pat.Name, &pat.Icon, &pat.Description, &pat.Theory, &pat.CreatedAt, &pat.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pat, nil
+}
+
+// loadProblem returns a problem in a workspace with its solutions and
+// approaches, or nil if there is none
+func (h *Handlers) loadProblem(id, workspaceID string) (*Problem, error) {
+	var prob Problem
+	query := h.DB.convertPlaceholders(`
+		SELECT id, workspace_id, owner_id, pattern_id, title, difficulty, description, input, output,
+		       constraints, sample_input, sample_output, explanation, notes,
+		       created_at, updated_at
+		FROM problems
+		WHERE id = ? AND workspace_id = ?
+	`)
+	err := h.DB.DB.QueryRow(query, id, workspaceID).Scan(
+		&prob.ID, &prob.WorkspaceID, &prob.OwnerID, &prob.PatternID, &prob.Title, &prob.Difficulty,
+		&prob.Description, &prob.Input, &prob.Output, &prob.Constraints,
+		&prob.SampleInput, &prob.SampleOutput, &prob.Explanation, &prob.Notes,
+		&prob.CreatedAt, &prob.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	solutions, err := h.getSolutions(prob.ID)
+	if err != nil {
+		return nil, err
+	}
+	prob.Solutions = solutions
+	if prob.Approaches, err = h.getApproaches(prob.ID); err != nil {
+		return nil, err
+	}
+	return &prob, nil
+}
+
+// getSolutions returns a problem's solutions, one per language. Languages
+// with no stored solution get the code of the problem's first approach in
+// that language, so readers that predate approaches still see it.
 func (h *Handlers) getSolutions(problemID string) ([]Solution, error) {
+	solutions, err := h.getStoredSolutions(problemID)
+	if err != nil {
+		return nil, err
+	}
+	stored := map[string]bool{}
+	for _, sol := range solutions {
+		stored[sol.Language] = true
+	}
+
+	fallbacks, err := h.approachFallbackSolutions(problemID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sol := range fallbacks {
+		if !stored[sol.Language] {
+			solutions = append(solutions, sol)
+		}
+	}
+
+	return solutions, nil
+}
+
+// getStoredSolutions returns the solutions in the solutions table alone
+func (h *Handlers) getStoredSolutions(problemID string) ([]Solution, error) {
 	query := h.DB.convertPlaceholders(`
-		SELECT id, problem_id, language, code, created_at, updated_at
+		SELECT id, problem_id, language, code, measured_time_complexity, measured_space_complexity, benchmarked_at, created_at, updated_at
 		FROM solutions
 		WHERE problem_id = ?
 	`)
@@ -733,14 +1095,47 @@ func (h *Handlers) getSolutions(problemID string) ([]Solution, error) {
 	var solutions []Solution
 	for rows.Next() {
 		var sol Solution
-		err := rows.Scan(&sol.ID, &sol.ProblemID, &sol.Language, &sol.Code, &sol.CreatedAt, &sol.UpdatedAt)
+		var benchmarkedAt sql.NullTime
+		err := rows.Scan(&sol.ID, &sol.ProblemID, &sol.Language, &sol.Code, &sol.MeasuredTimeComplexity, &sol.MeasuredSpaceComplexity, &benchmarkedAt, &sol.CreatedAt, &sol.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
+		if benchmarkedAt.Valid {
+			sol.BenchmarkedAt = &benchmarkedAt.Time
+		}
 		solutions = append(solutions, sol)
 	}
 
-	return solutions, nil
+	return solutions, rows.Err()
+}
+
+// storeSolutionCode saves a problem's solution in a language, creating it if
+// there is none, and returns the code it replaced. Measurements of code that
+// changed are dropped.
+func (h *Handlers) storeSolutionCode(problemID, language, code string) (string, error) {
+	var existingID, previous string
+	checkQuery := h.DB.convertPlaceholders(`SELECT id, code FROM solutions WHERE problem_id = ? AND language = ?`)
+	err := h.DB.DB.QueryRow(checkQuery, problemID, language).Scan(&existingID, &previous)
+	now := time.Now()
+	if err == sql.ErrNoRows {
+		insertQuery := h.DB.convertPlaceholders(`INSERT INTO solutions (id, problem_id, language, code, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`)
+		_, err = h.DB.DB.Exec(insertQuery, generateID(), problemID, language, code, now, now)
+		return "", err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	updateQuery := h.DB.convertPlaceholders(`
+		UPDATE solutions SET
+			measured_time_complexity = CASE WHEN code = ? THEN measured_time_complexity ELSE '' END,
+			measured_space_complexity = CASE WHEN code = ? THEN measured_space_complexity ELSE '' END,
+			benchmarked_at = CASE WHEN code = ? THEN benchmarked_at ELSE NULL END,
+			code = ?, updated_at = ?
+		WHERE id = ?
+	`)
+	_, err = h.DB.DB.Exec(updateQuery, code, code, code, code, now, existingID)
+	return previous, err
 }
 
 // generateID generates a unique ID
@@ -757,16 +1152,17 @@ type GenerateProblemRequest struct {
 }
 
 type GenerateProblemResponse struct {
-	Title        string `json:"title"`
-	Difficulty   string `json:"difficulty"`
-	Description  string `json:"description"`
-	Input        string `json:"input"`
-	Output       string `json:"output"`
-	Constraints  string `json:"constraints"`
-	SampleInput  string `json:"sampleInput"`
-	SampleOutput string `json:"sampleOutput"`
-	Explanation  string `json:"explanation"`
-	Notes        string `json:"notes"`
+	Title        string          `json:"title"`
+	Difficulty   string          `json:"difficulty"`
+	Description  string          `json:"description"`
+	Input        string          `json:"input"`
+	Output       string          `json:"output"`
+	Constraints  string          `json:"constraints"`
+	SampleInput  string          `json:"sampleInput"`
+	SampleOutput string          `json:"sampleOutput"`
+	Explanation  string          `json:"explanation"`
+	Notes        string          `json:"notes"`
+	TestCases    []TestCaseInput `json:"testCases,omitempty"` // Every upstream test case, when fetched from an external source
 }
 
 // GenerateProblem uses AI to generate problem details
@@ -1030,6 +1426,14 @@ func (h *Handlers) FetchExternalProblem(w http.ResponseWriter, r *http.Request)
 		result.SampleOutput = cleanMarkdown(thitaResp.TestCases[0].ExpectedOutput)
 		result.Explanation = cleanMarkdown(thitaResp.TestCases[0].Explanation)
 	}
+	// Keep every case as test data, without the whitespace cleanup that would change it
+	for _, tc := range thitaResp.TestCases {
+		result.TestCases = append(result.TestCases, TestCaseInput{
+			Input:          html.UnescapeString(strings.TrimSpace(tc.InputData)),
+			ExpectedOutput: html.UnescapeString(strings.TrimSpace(tc.ExpectedOutput)),
+			Explanation:    cleanMarkdown(tc.Explanation),
+		})
+	}
 
 	// Map hints to notes
 	if len(thitaResp.Hints) > 0 {
@@ -1044,11 +1448,23 @@ func (h *Handlers) FetchExternalProblem(w http.ResponseWriter, r *http.Request)
 
 // FetchAllExternalData fetches the entire DSA pattern structure from Thita.ai
 func (h *Handlers) FetchAllExternalData(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot fetch bulk data")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
 		return
 	}
 
+	// Every attempt is audited; failed ones record why and the counts at that point
+	before, err := h.DB.countWorkspaceContent(workspaceID)
+	if err != nil {
+		h.audit(r, AuditExternalImportFail, "workspace", workspaceID, workspaceID, nil, map[string]string{"error": "Database error"})
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	fail := func(status int, message string) {
+		h.audit(r, AuditExternalImportFail, "workspace", workspaceID, workspaceID, before, h.DB.contentAuditState(workspaceID, map[string]interface{}{"error": message}))
+		respondWithError(w, status, message)
+	}
+
 	url := "https://api.thita.ai/api/technical-coaching/dsa-pattern-structure?refresh=true"
 
 	client := &http.Client{Timeout: 30 * time.Second}
@@ -1058,39 +1474,43 @@ func (h *Handlers) FetchAllExternalData(w http.ResponseWriter, r *http.Request)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to connect to external API: "+err.Error())
+		log.Printf("Error fetching external data: %v", err)
+		fail(http.StatusInternalServerError, "Failed to connect to external API")
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		respondWithError(w, resp.StatusCode, fmt.Sprintf("External API returned error status: %d", resp.StatusCode))
+		fail(resp.StatusCode, fmt.Sprintf("External API returned error status: %d", resp.StatusCode))
 		return
 	}
 
 	var thitaResp ThitaBulkResponse
 	if err := json.NewDecoder(resp.Body).Decode(&thitaResp); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to parse external API response")
+		fail(http.StatusInternalServerError, "Failed to parse external API response")
 		return
 	}
 
-	// Process categories, patterns, and problems
+	// Process categories, patterns, and problems into the caller's active workspace
+	userID := getUserID(r)
 	countCategories := 0
 	countPatterns := 0
 	countProblems := 0
+	countFailed := 0
 
 	for _, tCat := range thitaResp.Categories {
 		// 1. Check if category exists or create it
 		var catID string
-		query := h.DB.convertPlaceholders("SELECT id FROM categories WHERE name = ?")
-		err := h.DB.DB.QueryRow(query, tCat.Name).Scan(&catID)
+		query := h.DB.convertPlaceholders("SELECT id FROM categories WHERE name = ? AND workspace_id = ?")
+		err := h.DB.DB.QueryRow(query, tCat.Name, workspaceID).Scan(&catID)
 
 		if err == sql.ErrNoRows {
 			catID = generateID()
-			insertQuery := h.DB.convertPlaceholders("INSERT INTO categories (id, name, icon, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)")
-			_, err = h.DB.DB.Exec(insertQuery, catID, tCat.Name, "Globe", tCat.Description, time.Now(), time.Now())
+			insertQuery := h.DB.convertPlaceholders("INSERT INTO categories (id, workspace_id, owner_id, name, icon, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+			_, err = h.DB.DB.Exec(insertQuery, catID, workspaceID, userID, tCat.Name, "Globe", tCat.Description, time.Now(), time.Now())
 			if err != nil {
 				log.Printf("Error creating category %s: %v", tCat.Name, err)
+				countFailed++
 				continue
 			}
 			countCategories++
@@ -1099,15 +1519,16 @@ func (h *Handlers) FetchAllExternalData(w http.ResponseWriter, r *http.Request)
 		for _, tPat := range tCat.Patterns {
 			// 2. Check if pattern exists or create it
 			var patID string
-			query = h.DB.convertPlaceholders("SELECT id FROM patterns WHERE name = ? AND category_id = ?")
-			err = h.DB.DB.QueryRow(query, tPat.Name, catID).Scan(&patID)
+			query = h.DB.convertPlaceholders("SELECT id FROM patterns WHERE name = ? AND category_id = ? AND workspace_id = ?")
+			err = h.DB.DB.QueryRow(query, tPat.Name, catID, workspaceID).Scan(&patID)
 
 			if err == sql.ErrNoRows {
 				patID = generateID()
-				insertQuery := h.DB.convertPlaceholders("INSERT INTO patterns (id, category_id, name, icon, description, theory, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
-				_, err = h.DB.DB.Exec(insertQuery, patID, catID, tPat.Name, "Code", tPat.Description, "", time.Now(), time.Now())
+				insertQuery := h.DB.convertPlaceholders("INSERT INTO patterns (id, workspace_id, owner_id, category_id, name, icon, description, theory, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+				_, err = h.DB.DB.Exec(insertQuery, patID, workspaceID, userID, catID, tPat.Name, "Code", tPat.Description, "", time.Now(), time.Now())
 				if err != nil {
 					log.Printf("Error creating pattern %s: %v", tPat.Name, err)
+					countFailed++
 					continue
 				}
 				countPatterns++
@@ -1120,20 +1541,28 @@ func (h *Handlers) FetchAllExternalData(w http.ResponseWriter, r *http.Request)
 				targetProbID := tProb.ID
 				if targetProbID == "" {
 					targetProbID = generateID()
+				} else {
+					// Another workspace may already have imported this Thita problem
+					var taken bool
+					takenQuery := h.DB.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM problems WHERE id = ?)")
+					if err := h.DB.DB.QueryRow(takenQuery, targetProbID).Scan(&taken); err != nil || taken {
+						targetProbID = generateID()
+					}
 				}
 
-				query = h.DB.convertPlaceholders("SELECT id FROM problems WHERE title = ? AND pattern_id = ?")
-				err = h.DB.DB.QueryRow(query, tProb.Title, patID).Scan(&probID)
+				query = h.DB.convertPlaceholders("SELECT id FROM problems WHERE title = ? AND pattern_id = ? AND workspace_id = ?")
+				err = h.DB.DB.QueryRow(query, tProb.Title, patID, workspaceID).Scan(&probID)
 
 				if err == sql.ErrNoRows {
-					insertQuery := h.DB.convertPlaceholders("INSERT INTO problems (id, pattern_id, title, difficulty, description, input, output, constraints, sample_input, sample_output, explanation, notes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+					insertQuery := h.DB.convertPlaceholders("INSERT INTO problems (id, workspace_id, owner_id, pattern_id, title, difficulty, description, input, output, constraints, sample_input, sample_output, explanation, notes, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 					_, err = h.DB.DB.Exec(insertQuery,
-						targetProbID, patID, tProb.Title, tProb.Difficulty,
+						targetProbID, workspaceID, userID, patID, tProb.Title, tProb.Difficulty,
 						"Description pending fetch...", "See description", "See description",
 						"No specific constraints provided.", "", "", "", "",
 						time.Now(), time.Now())
 					if err != nil {
 						log.Printf("Error creating problem %s: %v", tProb.Title, err)
+						countFailed++
 						continue
 					}
 					countProblems++
@@ -1142,6 +1571,11 @@ func (h *Handlers) FetchAllExternalData(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	h.audit(r, AuditExternalImport, "workspace", workspaceID, workspaceID, before, h.DB.contentAuditState(workspaceID, map[string]interface{}{
+		"created": map[string]int{"categories": countCategories, "patterns": countPatterns, "problems": countProblems},
+		"failed":  countFailed,
+	}))
+
 	respondWithJSON(w, http.StatusOK, map[string]interface{}{
 		"message": "Bulk fetch completed successfully",
 		"stats": map[string]int{
@@ -1152,31 +1586,81 @@ func (h *Handlers) FetchAllExternalData(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// ClearAllData wipes the entire database (except users)
+// ClearAllData wipes the content of the caller's active workspace, including
+// learning topics it owns. Only workspace owners may do this.
 func (h *Handlers) ClearAllData(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot clear data")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleOwner)
+	if !ok {
 		return
 	}
 
-	// Order matters due to foreign keys
-	tables := []string{"solutions", "problems", "patterns", "categories", "learning_resources", "roadmap_items", "learning_topics"}
+	// Every attempt is audited with the rows it removed, including failed
+	// attempts that stopped part of the way through
+	before, err := h.DB.countWorkspaceContent(workspaceID)
+	if err != nil {
+		h.audit(r, AuditDataClearFailed, "workspace", workspaceID, workspaceID, nil, map[string]string{"error": "Database error"})
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	removed, err := h.DB.clearWorkspaceData(workspaceID)
+	if err != nil {
+		log.Printf("Error clearing workspace %s: %v", workspaceID, err)
+		h.audit(r, AuditDataClearFailed, "workspace", workspaceID, workspaceID, before, h.DB.contentAuditState(workspaceID, map[string]interface{}{"removed": removed, "error": "Error clearing data"}))
+		respondWithError(w, http.StatusInternalServerError, "Error clearing data")
+		return
+	}
+	h.audit(r, AuditDataClear, "workspace", workspaceID, workspaceID, before, h.DB.contentAuditState(workspaceID, map[string]interface{}{"removed": removed}))
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "All data cleared successfully"})
+}
 
+// clearWorkspaceData deletes all content that belongs to a workspace. It
+// returns how many rows it removed from each table, up to any failure.
+func (d *Database) clearWorkspaceData(workspaceID string) (map[string]int64, error) {
+	// Order matters due to foreign keys
+	queries := map[string]string{
+		"solutions":              "DELETE FROM solutions WHERE problem_id IN (SELECT id FROM problems WHERE workspace_id = ?)",
+		"approach_solutions":     "DELETE FROM approach_solutions WHERE approach_id IN (SELECT a.id FROM problem_approaches a JOIN problems p ON p.id = a.problem_id WHERE p.workspace_id = ?)",
+		"problem_approaches":     "DELETE FROM problem_approaches WHERE problem_id IN (SELECT id FROM problems WHERE workspace_id = ?)",
+		"problem_progress":       "DELETE FROM problem_progress WHERE problem_id IN (SELECT id FROM problems WHERE workspace_id = ?)",
+		"problem_attempts":       "DELETE FROM problem_attempts WHERE problem_id IN (SELECT id FROM problems WHERE workspace_id = ?)",
+		"test_cases":             "DELETE FROM test_cases WHERE problem_id IN (SELECT id FROM problems WHERE workspace_id = ?)",
+		"problem_checkers":       "DELETE FROM problem_checkers WHERE problem_id IN (SELECT id FROM problems WHERE workspace_id = ?)",
+		"problem_stress_configs": "DELETE FROM problem_stress_configs WHERE problem_id IN (SELECT id FROM problems WHERE workspace_id = ?)",
+		"revisions":              "DELETE FROM revisions WHERE workspace_id = ?",
+		"solution_benchmarks":    "DELETE FROM solution_benchmarks WHERE problem_id IN (SELECT id FROM problems WHERE workspace_id = ?)",
+		"interview_submissions":  "DELETE FROM interview_submissions WHERE session_id IN (SELECT id FROM interview_sessions WHERE workspace_id = ?)",
+		"interview_problems":     "DELETE FROM interview_problems WHERE session_id IN (SELECT id FROM interview_sessions WHERE workspace_id = ?)",
+		"interview_sessions":     "DELETE FROM interview_sessions WHERE workspace_id = ?",
+		"problem_list_items":     "DELETE FROM problem_list_items WHERE list_id IN (SELECT id FROM problem_lists WHERE workspace_id = ?)",
+		"problem_lists":          "DELETE FROM problem_lists WHERE workspace_id = ?",
+		"problems":               "DELETE FROM problems WHERE workspace_id = ?",
+		"patterns":               "DELETE FROM patterns WHERE workspace_id = ?",
+		"categories":             "DELETE FROM categories WHERE workspace_id = ?",
+		"learning_resources":     "DELETE FROM learning_resources WHERE topic_id IN (SELECT id FROM learning_topics WHERE workspace_id = ?)",
+		"roadmap_items":          "DELETE FROM roadmap_items WHERE topic_id IN (SELECT id FROM learning_topics WHERE workspace_id = ?)",
+		"learning_topics":        "DELETE FROM learning_topics WHERE workspace_id = ?",
+	}
+	tables := []string{"solutions", "approach_solutions", "problem_approaches", "problem_progress", "problem_attempts", "test_cases", "problem_checkers", "problem_stress_configs", "solution_benchmarks", "revisions", "interview_submissions", "interview_problems", "interview_sessions", "problem_list_items", "problem_lists", "problems", "patterns", "categories", "learning_resources", "roadmap_items", "learning_topics"}
+
+	removed := map[string]int64{}
 	for _, table := range tables {
-		_, err := h.DB.DB.Exec(fmt.Sprintf("DELETE FROM %s", table))
+		result, err := d.DB.Exec(d.convertPlaceholders(queries[table]), workspaceID)
 		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to clear table %s: %v", table, err))
-			return
+			return removed, fmt.Errorf("Failed to clear table %s: %v", table, err)
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			removed[table] = n
 		}
 	}
 
-	respondWithJSON(w, http.StatusOK, map[string]string{"message": "All data cleared successfully"})
+	return removed, nil
 }
 
 // GenerateCategoryDescription uses AI to generate category description
 func (h *Handlers) GenerateCategoryDescription(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot generate content")
+	if _, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor); !ok {
 		return
 	}
 
@@ -1223,8 +1707,7 @@ func (h *Handlers) GenerateCategoryDescription(w http.ResponseWriter, r *http.Re
 
 // GeneratePatternContent uses AI to generate pattern description and theory
 func (h *Handlers) GeneratePatternContent(w http.ResponseWriter, r *http.Request) {
-	if isDemoUser(r) {
-		respondWithError(w, http.StatusForbidden, "Demo users cannot generate content")
+	if _, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor); !ok {
 		return
 	}
 
@@ -1394,8 +1877,36 @@ func min(a, b int) int {
 
 // Learning Resource Handlers
 
+// requireVisibleTopic checks that a learning topic is shared or belongs to the
+// caller's active workspace, writing an error response if it is not
+func (h *Handlers) requireVisibleTopic(w http.ResponseWriter, r *http.Request, topicID string) bool {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return false
+	}
+
+	var visible bool
+	query := h.DB.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM learning_topics WHERE id = ? AND (workspace_id = '' OR workspace_id = ?))")
+	if err := h.DB.DB.QueryRow(query, topicID, workspaceID).Scan(&visible); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error: "+err.Error())
+		return false
+	}
+	if !visible {
+		respondWithError(w, http.StatusNotFound, "Topic not found")
+		return false
+	}
+	return true
+}
+
 func (h *Handlers) GetLearningTopics(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.DB.DB.Query("SELECT id, name, icon, description, slug, created_at, updated_at FROM learning_topics ORDER BY name ASC")
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	// Topics without a workspace are shared with everyone
+	query := h.DB.convertPlaceholders("SELECT id, workspace_id, name, icon, description, slug, created_at, updated_at FROM learning_topics WHERE workspace_id = '' OR workspace_id = ? ORDER BY name ASC")
+	rows, err := h.DB.DB.Query(query, workspaceID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Database error: "+err.Error())
 		return
@@ -1405,7 +1916,7 @@ func (h *Handlers) GetLearningTopics(w http.ResponseWriter, r *http.Request) {
 	var topics []LearningTopic
 	for rows.Next() {
 		var t LearningTopic
-		if err := rows.Scan(&t.ID, &t.Name, &t.Icon, &t.Description, &t.Slug, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		if err := rows.Scan(&t.ID, &t.WorkspaceID, &t.Name, &t.Icon, &t.Description, &t.Slug, &t.CreatedAt, &t.UpdatedAt); err != nil {
 			respondWithError(w, http.StatusInternalServerError, "Error scanning topic")
 			return
 		}
@@ -1416,12 +1927,16 @@ func (h *Handlers) GetLearningTopics(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handlers) GetLearningTopicBySlug(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	slug := vars["slug"]
 
 	var t LearningTopic
-	query := h.DB.convertPlaceholders("SELECT id, name, icon, description, slug, created_at, updated_at FROM learning_topics WHERE slug = ?")
-	err := h.DB.DB.QueryRow(query, slug).Scan(&t.ID, &t.Name, &t.Icon, &t.Description, &t.Slug, &t.CreatedAt, &t.UpdatedAt)
+	query := h.DB.convertPlaceholders("SELECT id, workspace_id, name, icon, description, slug, created_at, updated_at FROM learning_topics WHERE slug = ? AND (workspace_id = '' OR workspace_id = ?)")
+	err := h.DB.DB.QueryRow(query, slug, workspaceID).Scan(&t.ID, &t.WorkspaceID, &t.Name, &t.Icon, &t.Description, &t.Slug, &t.CreatedAt, &t.UpdatedAt)
 	if err == sql.ErrNoRows {
 		respondWithError(w, http.StatusNotFound, "Topic not found")
 		return
@@ -1437,6 +1952,9 @@ func (h *Handlers) GetLearningTopicBySlug(w http.ResponseWriter, r *http.Request
 func (h *Handlers) GetLearningResources(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	topicID := vars["topicId"]
+	if !h.requireVisibleTopic(w, r, topicID) {
+		return
+	}
 
 	query := h.DB.convertPlaceholders("SELECT id, topic_id, title, content, type, url, order_index, created_at, updated_at FROM learning_resources WHERE topic_id = ? ORDER BY order_index ASC")
 	rows, err := h.DB.DB.Query(query, topicID)
@@ -1462,6 +1980,9 @@ func (h *Handlers) GetLearningResources(w http.ResponseWriter, r *http.Request)
 func (h *Handlers) GetRoadmap(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	topicID := vars["topicId"]
+	if !h.requireVisibleTopic(w, r, topicID) {
+		return
+	}
 
 	query := h.DB.convertPlaceholders("SELECT id, topic_id, title, description, order_index, status, created_at, updated_at FROM roadmap_items WHERE topic_id = ? ORDER BY order_index ASC")
 	rows, err := h.DB.DB.Query(query, topicID)
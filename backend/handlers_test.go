@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestHandlers returns handlers on a fresh SQLite database that is
+// removed when the test ends. Mail goes to a file in the test's directory.
+func newTestHandlers(t *testing.T) *Handlers {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "")
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mailer := &LogMailer{Path: filepath.Join(t.TempDir(), "mail.log")}
+	return &Handlers{DB: db, JWTSecret: "test-secret", Mailer: mailer, Limiter: NewAuthLimiter(false)}
+}
+
+// createTestUser inserts a user with no role and returns its ID
+func createTestUser(t *testing.T, h *Handlers, email string) string {
+	t.Helper()
+	id := generateID()
+	query := h.DB.convertPlaceholders("INSERT INTO users (id, email, name, password) VALUES (?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, id, email, email, "unused"); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	return id
+}
+
+// createTestAccount inserts a user with a personal workspace, as
+// registration would, and returns its ID
+func createTestAccount(t *testing.T, h *Handlers, email string) string {
+	t.Helper()
+	userID := createTestUser(t, h, email)
+	if _, err := h.DB.createPersonalWorkspace(userID, email); err != nil {
+		t.Fatalf("createPersonalWorkspace: %v", err)
+	}
+	return userID
+}
+
+// serveAs calls a handler the way AuthMiddleware and the router would for a
+// request by userID, with the given route variables and JSON body
+func serveAs(handler http.HandlerFunc, userID, method string, vars map[string]string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	}
+	r := httptest.NewRequest(method, "/api/test", reader)
+	r = r.WithContext(context.WithValue(r.Context(), userIDKey, userID))
+	w := httptest.NewRecorder()
+	handler(w, mux.SetURLVars(r, vars))
+	return w
+}
+
+// createdID returns the id of the row a create handler responded with
+func createdID(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d, body %s", w.Code, w.Body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil || created.ID == "" {
+		t.Fatalf("create: no id in response: %v", err)
+	}
+	return created.ID
+}
+
+// createTestContent creates a category with a pattern and a problem as
+// userID and returns their IDs
+func createTestContent(t *testing.T, h *Handlers, userID string) (categoryID, patternID, problemID string) {
+	t.Helper()
+	categoryID = createdID(t, serveAs(h.CreateCategory, userID, http.MethodPost, nil, map[string]string{"name": "Arrays"}))
+	patternID = createdID(t, serveAs(h.CreatePattern, userID, http.MethodPost, map[string]string{"categoryId": categoryID}, map[string]string{"name": "Two Pointers"}))
+	problemID = createdID(t, serveAs(h.CreateProblem, userID, http.MethodPost, map[string]string{"patternId": patternID}, map[string]string{"title": "Two Sum", "difficulty": "Easy"}))
+	return categoryID, patternID, problemID
+}
+
+func TestContentIsIsolatedBetweenUsers(t *testing.T) {
+	h := newTestHandlers(t)
+	alice := createTestAccount(t, h, "alice@example.com")
+	bob := createTestAccount(t, h, "bob@example.com")
+	categoryID, patternID, problemID := createTestContent(t, h, alice)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		vars    map[string]string
+		body    interface{}
+	}{
+		{"get problem", h.GetProblem, http.MethodGet, map[string]string{"id": problemID}, nil},
+		{"update problem", h.UpdateProblem, http.MethodPut, map[string]string{"id": problemID}, map[string]string{"title": "Taken"}},
+		{"delete problem", h.DeleteProblem, http.MethodDelete, map[string]string{"id": problemID}, nil},
+		{"create problem", h.CreateProblem, http.MethodPost, map[string]string{"patternId": patternID}, map[string]string{"title": "Planted"}},
+		{"update pattern", h.UpdatePattern, http.MethodPut, map[string]string{"id": patternID}, map[string]string{"name": "Taken"}},
+		{"delete pattern", h.DeletePattern, http.MethodDelete, map[string]string{"id": patternID}, nil},
+		{"create pattern", h.CreatePattern, http.MethodPost, map[string]string{"categoryId": categoryID}, map[string]string{"name": "Planted"}},
+		{"update category", h.UpdateCategory, http.MethodPut, map[string]string{"id": categoryID}, map[string]string{"name": "Taken"}},
+		{"delete category", h.DeleteCategory, http.MethodDelete, map[string]string{"id": categoryID}, nil},
+	}
+	for _, tt := range tests {
+		if w := serveAs(tt.handler, bob, tt.method, tt.vars, tt.body); w.Code != http.StatusNotFound {
+			t.Errorf("%s of another user's content: status %d, want %d", tt.name, w.Code, http.StatusNotFound)
+		}
+	}
+
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"categories": serveAs(h.GetCategories, bob, http.MethodGet, nil, nil),
+		"patterns":   serveAs(h.GetPatterns, bob, http.MethodGet, map[string]string{"categoryId": categoryID}, nil),
+		"problems":   serveAs(h.GetProblems, bob, http.MethodGet, map[string]string{"patternId": patternID}, nil),
+	} {
+		var listed []map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&listed); err != nil || len(listed) != 0 {
+			t.Errorf("another user's %s are listed: %v, err = %v", name, listed, err)
+		}
+	}
+
+	// Nothing was changed or deleted
+	w := serveAs(h.GetProblem, alice, http.MethodGet, map[string]string{"id": problemID}, nil)
+	var problem Problem
+	if err := json.NewDecoder(w.Body).Decode(&problem); err != nil || problem.Title != "Two Sum" {
+		t.Errorf("owner's problem after the other user's requests: status %d, title %q, err = %v", w.Code, problem.Title, err)
+	}
+}
+
+func TestRegisterBootstrapsOnlyTheConfiguredAdmin(t *testing.T) {
+	h := newTestHandlers(t)
+	h.BootstrapAdminEmail = "Boss@example.com"
+	register := func(email string) string {
+		body, _ := json.Marshal(map[string]string{"email": email, "password": "secret", "name": "New"})
+		w := httptest.NewRecorder()
+		h.Register(w, httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(string(body))))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("register %s: status %d, body %s", email, w.Code, w.Body)
+		}
+		var role string
+		query := h.DB.convertPlaceholders("SELECT role FROM users WHERE LOWER(email) = ?")
+		if err := h.DB.DB.QueryRow(query, normalizeEmail(email)).Scan(&role); err != nil {
+			t.Fatal(err)
+		}
+		return role
+	}
+
+	if role := register("first@example.com"); role != "user" {
+		t.Errorf("first account got role %q, want user", role)
+	}
+	if role := register("boss@example.com"); role != "admin" {
+		t.Errorf("bootstrap email got role %q, want admin", role)
+	}
+
+	// Once an admin exists the bootstrap email is an ordinary account
+	query := h.DB.convertPlaceholders("DELETE FROM users WHERE email = ?")
+	if _, err := h.DB.DB.Exec(query, "boss@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	createTestAccountWithRole(t, h, "admin@example.com", "admin")
+	if role := register("boss@example.com"); role != "user" {
+		t.Errorf("bootstrap email with an admin present got role %q, want user", role)
+	}
+}
+
+func TestRegisterHidesExistingEmails(t *testing.T) {
+	h := newTestHandlers(t)
+	host, port, messages := fakeSMTPServer(t)
+	h.Mailer = &SMTPMailer{Host: host, Port: port, From: "noreply@example.com"}
+	register := func(email string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"email": email, "password": "secret", "name": "New"})
+		w := httptest.NewRecorder()
+		h.Register(w, httptest.NewRequest(http.MethodPost, "/api/register", strings.NewReader(string(body))))
+		return w
+	}
+
+	first := register("new@example.com")
+	if first.Code != http.StatusCreated {
+		t.Fatalf("first registration: status %d, body %s", first.Code, first.Body)
+	}
+	if msg := <-messages; !strings.Contains(msg.Data, "/verify-email?token=") {
+		t.Errorf("first registration sent no verification link:\n%s", msg.Data)
+	}
+
+	second := register(" New@Example.com ")
+	if second.Code != first.Code || second.Body.String() != first.Body.String() {
+		t.Errorf("registering a taken email answered %d %s, want the same as a new one: %d %s",
+			second.Code, second.Body, first.Code, first.Body)
+	}
+	if msg := <-messages; !strings.Contains(msg.Data, "already has one") || msg.To[0] != "new@example.com" {
+		t.Errorf("the account owner was not told about the second registration:\n%s", msg.Data)
+	}
+
+	var count int
+	if err := h.DB.DB.QueryRow("SELECT COUNT(*) FROM users WHERE email = 'new@example.com'").Scan(&count); err != nil || count != 1 {
+		t.Errorf("%d accounts with the email, err = %v; want 1", count, err)
+	}
+}
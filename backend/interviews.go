@@ -0,0 +1,600 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Limits for generated mock interviews
+const (
+	defaultInterviewProblems = 3
+	maxInterviewProblems     = 10
+	minInterviewMinutes      = 5
+	maxInterviewMinutes      = 240
+)
+
+// interviewMinutesByDifficulty is the time budget each problem adds to a
+// session when no duration is requested
+var interviewMinutesByDifficulty = map[string]int{
+	"Easy":   15,
+	"Medium": 25,
+	"Hard":   40,
+}
+
+// interviewPointsByDifficulty weights problems in the final score
+var interviewPointsByDifficulty = map[string]float64{
+	"Easy":   1,
+	"Medium": 2,
+	"Hard":   3,
+}
+
+// interviewOutcomeCredit is the share of a problem's points each outcome earns
+var interviewOutcomeCredit = map[string]float64{
+	AttemptSolved:  1,
+	AttemptPartial: 0.5,
+	AttemptFailed:  0,
+}
+
+// InterviewSubmission is an answer to one problem of a session
+type InterviewSubmission struct {
+	ID             string    `json:"id"`
+	ProblemID      string    `json:"problemId"`
+	Language       string    `json:"language"`
+	Code           string    `json:"code"`
+	Outcome        string    `json:"outcome"`        // solved, partial or failed
+	ElapsedSeconds int       `json:"elapsedSeconds"` // Since the session started
+	SubmittedAt    time.Time `json:"submittedAt"`
+}
+
+// InterviewProblem is a problem in a session. Reference solutions are only
+// included once the session is over.
+type InterviewProblem struct {
+	Position    int                   `json:"position"`
+	Problem     Problem               `json:"problem"`
+	Submissions []InterviewSubmission `json:"submissions"`
+	Result      *InterviewResult      `json:"result,omitempty"` // Set once the session is over
+}
+
+// InterviewResult scores one problem of a finished session
+type InterviewResult struct {
+	Outcome   string  `json:"outcome"` // The last submission's outcome, or unanswered
+	Points    float64 `json:"points"`
+	MaxPoints float64 `json:"maxPoints"`
+}
+
+// InterviewSession is a timed set of problems
+type InterviewSession struct {
+	ID               string             `json:"id"`
+	WorkspaceID      string             `json:"workspaceId"`
+	DurationMinutes  int                `json:"durationMinutes"`
+	StartedAt        time.Time          `json:"startedAt"`
+	EndsAt           time.Time          `json:"endsAt"`
+	FinishedAt       *time.Time         `json:"finishedAt,omitempty"`
+	ServerTime       time.Time          `json:"serverTime"`
+	RemainingSeconds int                `json:"remainingSeconds"`
+	Active           bool               `json:"active"`
+	Problems         []InterviewProblem `json:"problems,omitempty"`
+	Summary          *InterviewSummary  `json:"summary,omitempty"`
+	ProblemCount     int                `json:"problemCount"`
+}
+
+// InterviewSummary scores a finished session
+type InterviewSummary struct {
+	Score           float64 `json:"score"` // 0-100, weighted by difficulty
+	Points          float64 `json:"points"`
+	MaxPoints       float64 `json:"maxPoints"`
+	Solved          int     `json:"solved"`
+	Partial         int     `json:"partial"`
+	Failed          int     `json:"failed"`
+	Unanswered      int     `json:"unanswered"`
+	TimeUsedSeconds int     `json:"timeUsedSeconds"`
+}
+
+// interviewCandidate is a problem that may be picked for a session
+type interviewCandidate struct {
+	id, difficulty string
+	lastSolvedAt   *time.Time
+}
+
+// over reports whether a session can no longer take submissions
+func (s *InterviewSession) over(now time.Time) bool {
+	return s.FinishedAt != nil || !now.Before(s.EndsAt)
+}
+
+// pickInterviewProblems orders candidates so problems the user never solved
+// come first, then those solved longest ago, with ties shuffled, and takes
+// count of them; a non-empty mix takes that many per difficulty instead
+func pickInterviewProblems(candidates []interviewCandidate, count int, mix map[string]int) ([]interviewCandidate, bool) {
+	rand.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i].lastSolvedAt, candidates[j].lastSolvedAt
+		if a == nil || b == nil {
+			return a == nil && b != nil
+		}
+		// Solve dates are compared by day so recent practice on the same day stays shuffled
+		return a.Truncate(24 * time.Hour).Before(b.Truncate(24 * time.Hour))
+	})
+
+	if len(mix) == 0 {
+		if len(candidates) < count {
+			return nil, false
+		}
+		return candidates[:count], true
+	}
+
+	picked := []interviewCandidate{}
+	for _, candidate := range candidates {
+		if mix[candidate.difficulty] > 0 {
+			picked = append(picked, candidate)
+			mix[candidate.difficulty]--
+		}
+	}
+	for _, remaining := range mix {
+		if remaining > 0 {
+			return nil, false
+		}
+	}
+	return picked, true
+}
+
+// CreateInterview generates a mock interview from the caller's active
+// workspace and starts its clock
+func (h *Handlers) CreateInterview(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Count             int            `json:"count"`
+		Difficulty        map[string]int `json:"difficulty"` // Problems per difficulty, such as {"Easy": 1, "Medium": 2}
+		IncludeCategories []string       `json:"includeCategories"`
+		ExcludeCategories []string       `json:"excludeCategories"`
+		IncludePatterns   []string       `json:"includePatterns"`
+		ExcludePatterns   []string       `json:"excludePatterns"`
+		DurationMinutes   int            `json:"durationMinutes"` // 0 sizes the session from the problems picked
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	mixTotal := 0
+	for difficulty, n := range req.Difficulty {
+		if _, ok := interviewMinutesByDifficulty[difficulty]; !ok || n < 0 {
+			respondWithError(w, http.StatusBadRequest, "Difficulty mix must map Easy, Medium or Hard to a count")
+			return
+		}
+		mixTotal += n
+	}
+	if mixTotal > 0 {
+		if req.Count != 0 && req.Count != mixTotal {
+			respondWithError(w, http.StatusBadRequest, "count must match the difficulty mix")
+			return
+		}
+		req.Count = mixTotal
+	}
+	if req.Count == 0 {
+		req.Count = defaultInterviewProblems
+	}
+	if req.Count < 1 || req.Count > maxInterviewProblems {
+		respondWithError(w, http.StatusBadRequest, "count must be between 1 and 10")
+		return
+	}
+	if req.DurationMinutes != 0 && (req.DurationMinutes < minInterviewMinutes || req.DurationMinutes > maxInterviewMinutes) {
+		respondWithError(w, http.StatusBadRequest, "durationMinutes must be between 5 and 240")
+		return
+	}
+
+	userID := getUserID(r)
+	query := `
+		SELECT p.id, p.difficulty, pp.last_solved_at
+		FROM problems p
+		JOIN patterns pat ON pat.id = p.pattern_id
+		LEFT JOIN problem_progress pp ON pp.problem_id = p.id AND pp.user_id = ?
+		WHERE p.workspace_id = ?`
+	args := []interface{}{userID, workspaceID}
+	filters := []struct {
+		column string
+		ids    []string
+		negate bool
+	}{
+		{"pat.category_id", req.IncludeCategories, false},
+		{"pat.category_id", req.ExcludeCategories, true},
+		{"p.pattern_id", req.IncludePatterns, false},
+		{"p.pattern_id", req.ExcludePatterns, true},
+	}
+	for _, filter := range filters {
+		if len(filter.ids) == 0 {
+			continue
+		}
+		operator := " IN "
+		if filter.negate {
+			operator = " NOT IN "
+		}
+		query += " AND " + filter.column + operator + "(" + strings.TrimSuffix(strings.Repeat("?, ", len(filter.ids)), ", ") + ")"
+		for _, id := range filter.ids {
+			args = append(args, id)
+		}
+	}
+
+	rows, err := h.DB.DB.Query(h.DB.convertPlaceholders(query), args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	candidates := []interviewCandidate{}
+	for rows.Next() {
+		var candidate interviewCandidate
+		var lastSolvedAt sql.NullTime
+		if err := rows.Scan(&candidate.id, &candidate.difficulty, &lastSolvedAt); err != nil {
+			rows.Close()
+			respondWithError(w, http.StatusInternalServerError, "Error scanning problem")
+			return
+		}
+		candidate.lastSolvedAt = nullTimePtr(lastSolvedAt)
+		candidates = append(candidates, candidate)
+	}
+	rows.Close()
+
+	picked, ok := pickInterviewProblems(candidates, req.Count, req.Difficulty)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "Not enough problems match these filters")
+		return
+	}
+
+	duration := req.DurationMinutes
+	if duration == 0 {
+		for _, candidate := range picked {
+			minutes, ok := interviewMinutesByDifficulty[candidate.difficulty]
+			if !ok {
+				minutes = interviewMinutesByDifficulty["Medium"]
+			}
+			duration += minutes
+		}
+	}
+
+	now := time.Now()
+	sessionID := generateID()
+	query = h.DB.convertPlaceholders("INSERT INTO interview_sessions (id, user_id, workspace_id, duration_minutes, started_at, ends_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, sessionID, userID, workspaceID, duration, now, now.Add(time.Duration(duration)*time.Minute), now); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating interview")
+		return
+	}
+	query = h.DB.convertPlaceholders("INSERT INTO interview_problems (session_id, problem_id, position) VALUES (?, ?, ?)")
+	for i, candidate := range picked {
+		if _, err := h.DB.DB.Exec(query, sessionID, candidate.id, i+1); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error creating interview")
+			return
+		}
+	}
+
+	h.respondWithInterview(w, http.StatusCreated, sessionID, userID)
+}
+
+// GetInterviews lists the caller's sessions in their active workspace, newest first
+func (h *Handlers) GetInterviews(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	query := h.DB.convertPlaceholders(`
+		SELECT s.id, s.workspace_id, s.duration_minutes, s.started_at, s.ends_at, s.finished_at,
+		       (SELECT COUNT(*) FROM interview_problems ip WHERE ip.session_id = s.id)
+		FROM interview_sessions s
+		WHERE s.user_id = ? AND s.workspace_id = ?
+		ORDER BY s.started_at DESC
+	`)
+	rows, err := h.DB.DB.Query(query, getUserID(r), workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := []InterviewSession{}
+	for rows.Next() {
+		var session InterviewSession
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&session.ID, &session.WorkspaceID, &session.DurationMinutes, &session.StartedAt, &session.EndsAt, &finishedAt, &session.ProblemCount); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning interview")
+			return
+		}
+		session.FinishedAt = nullTimePtr(finishedAt)
+		session.setClock(now)
+		sessions = append(sessions, session)
+	}
+
+	respondWithJSON(w, http.StatusOK, sessions)
+}
+
+// GetInterview returns a session with its problems and submissions, and the
+// scored summary once it is over
+func (h *Handlers) GetInterview(w http.ResponseWriter, r *http.Request) {
+	h.respondWithInterview(w, http.StatusOK, mux.Vars(r)["id"], getUserID(r))
+}
+
+// SubmitInterviewAnswer records an answer to one problem while the session
+// clock is running. The answer is also logged as an attempt at the problem.
+func (h *Handlers) SubmitInterviewAnswer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userID := getUserID(r)
+
+	session, err := h.loadInterview(vars["id"], userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if session == nil {
+		respondWithError(w, http.StatusNotFound, "Interview not found")
+		return
+	}
+	now := time.Now()
+	if session.over(now) {
+		respondWithError(w, http.StatusConflict, "Interview is over")
+		return
+	}
+
+	var inSession bool
+	query := h.DB.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM interview_problems WHERE session_id = ? AND problem_id = ?)")
+	if err := h.DB.DB.QueryRow(query, session.ID, vars["problemId"]).Scan(&inSession); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !inSession {
+		respondWithError(w, http.StatusNotFound, "Problem is not part of this interview")
+		return
+	}
+
+	var req struct {
+		Language string `json:"language"`
+		Code     string `json:"code"`
+		Outcome  string `json:"outcome"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if _, ok := interviewOutcomeCredit[req.Outcome]; !ok {
+		respondWithError(w, http.StatusBadRequest, "Outcome must be solved, partial or failed")
+		return
+	}
+	if len(req.Code) > maxAttemptCodeBytes {
+		respondWithError(w, http.StatusBadRequest, "Code is too large")
+		return
+	}
+
+	submission := InterviewSubmission{
+		ID:             generateID(),
+		ProblemID:      vars["problemId"],
+		Language:       strings.ToLower(strings.TrimSpace(req.Language)),
+		Code:           req.Code,
+		Outcome:        req.Outcome,
+		ElapsedSeconds: int(now.Sub(session.StartedAt).Seconds()),
+		SubmittedAt:    now,
+	}
+
+	// The attempt covers the time since the previous submission in this session
+	attemptStart := session.StartedAt
+	query = h.DB.convertPlaceholders("SELECT submitted_at FROM interview_submissions WHERE session_id = ? ORDER BY submitted_at DESC LIMIT 1")
+	if err := h.DB.DB.QueryRow(query, session.ID).Scan(&attemptStart); err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	query = h.DB.convertPlaceholders("INSERT INTO interview_submissions (id, session_id, problem_id, language, code, outcome, elapsed_seconds, submitted_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, submission.ID, session.ID, submission.ProblemID, submission.Language, submission.Code, submission.Outcome, submission.ElapsedSeconds, submission.SubmittedAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving submission")
+		return
+	}
+
+	query = h.DB.convertPlaceholders(`
+		INSERT INTO problem_attempts (id, problem_id, user_id, language, code, outcome, reflection, started_at, ended_at, duration_seconds, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	_, err = h.DB.DB.Exec(query, generateID(), submission.ProblemID, userID, submission.Language, submission.Code, submission.Outcome,
+		"Mock interview", attemptStart, now, int(now.Sub(attemptStart).Seconds()), now)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving attempt")
+		return
+	}
+	if _, err := h.DB.recordAttempt(userID, submission.ProblemID, submission.Outcome == AttemptSolved, now); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving progress")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, submission)
+}
+
+// FinishInterview stops the session clock and returns the scored session
+func (h *Handlers) FinishInterview(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+	session, err := h.loadInterview(mux.Vars(r)["id"], userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if session == nil {
+		respondWithError(w, http.StatusNotFound, "Interview not found")
+		return
+	}
+
+	if session.FinishedAt == nil {
+		// A session that ran out of time finished when its clock did
+		finishedAt := time.Now()
+		if finishedAt.After(session.EndsAt) {
+			finishedAt = session.EndsAt
+		}
+		query := h.DB.convertPlaceholders("UPDATE interview_sessions SET finished_at = ? WHERE id = ?")
+		if _, err := h.DB.DB.Exec(query, finishedAt, session.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error finishing interview")
+			return
+		}
+	}
+
+	h.respondWithInterview(w, http.StatusOK, session.ID, userID)
+}
+
+// setClock fills in the server-side timing fields
+func (s *InterviewSession) setClock(now time.Time) {
+	s.ServerTime = now
+	s.Active = !s.over(now)
+	if s.Active {
+		s.RemainingSeconds = int(s.EndsAt.Sub(now).Seconds())
+	}
+}
+
+// loadInterview returns one of a user's sessions without its problems, or
+// nil if there is none or the user has since left its workspace
+func (h *Handlers) loadInterview(sessionID, userID string) (*InterviewSession, error) {
+	var session InterviewSession
+	var finishedAt sql.NullTime
+	query := h.DB.convertPlaceholders("SELECT id, workspace_id, duration_minutes, started_at, ends_at, finished_at FROM interview_sessions WHERE id = ? AND user_id = ?")
+	err := h.DB.DB.QueryRow(query, sessionID, userID).Scan(&session.ID, &session.WorkspaceID, &session.DurationMinutes, &session.StartedAt, &session.EndsAt, &finishedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.FinishedAt = nullTimePtr(finishedAt)
+
+	role, err := h.workspaceRole(session.WorkspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// respondWithInterview writes a full session. Solutions, approaches and the summary are
+// only included once the session is over.
+func (h *Handlers) respondWithInterview(w http.ResponseWriter, status int, sessionID, userID string) {
+	session, err := h.loadInterview(sessionID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if session == nil {
+		respondWithError(w, http.StatusNotFound, "Interview not found")
+		return
+	}
+	now := time.Now()
+	session.setClock(now)
+
+	// Collect problem IDs first; rows must be closed before loading each problem
+	query := h.DB.convertPlaceholders("SELECT problem_id, position FROM interview_problems WHERE session_id = ? ORDER BY position")
+	rows, err := h.DB.DB.Query(query, session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	var problemIDs []string
+	var positions []int
+	for rows.Next() {
+		var problemID string
+		var position int
+		if err := rows.Scan(&problemID, &position); err != nil {
+			rows.Close()
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		problemIDs = append(problemIDs, problemID)
+		positions = append(positions, position)
+	}
+	rows.Close()
+
+	submissions := map[string][]InterviewSubmission{}
+	query = h.DB.convertPlaceholders("SELECT id, problem_id, language, code, outcome, elapsed_seconds, submitted_at FROM interview_submissions WHERE session_id = ? ORDER BY submitted_at")
+	rows, err = h.DB.DB.Query(query, session.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	for rows.Next() {
+		var submission InterviewSubmission
+		if err := rows.Scan(&submission.ID, &submission.ProblemID, &submission.Language, &submission.Code, &submission.Outcome, &submission.ElapsedSeconds, &submission.SubmittedAt); err != nil {
+			rows.Close()
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		submissions[submission.ProblemID] = append(submissions[submission.ProblemID], submission)
+	}
+	rows.Close()
+
+	over := session.over(now)
+	var summary InterviewSummary
+	session.Problems = []InterviewProblem{}
+	for i, problemID := range problemIDs {
+		problem, err := h.loadProblem(problemID, session.WorkspaceID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error loading problem")
+			return
+		}
+		if problem == nil {
+			continue // Deleted since the session was created
+		}
+		if !over {
+			problem.Solutions = nil
+			problem.Approaches = nil
+		}
+
+		item := InterviewProblem{Position: positions[i], Problem: *problem, Submissions: submissions[problemID]}
+		if item.Submissions == nil {
+			item.Submissions = []InterviewSubmission{}
+		}
+
+		if over {
+			result := InterviewResult{Outcome: "unanswered", MaxPoints: interviewPointsByDifficulty[problem.Difficulty]}
+			if result.MaxPoints == 0 {
+				result.MaxPoints = interviewPointsByDifficulty["Medium"]
+			}
+			if n := len(item.Submissions); n > 0 {
+				result.Outcome = item.Submissions[n-1].Outcome
+				result.Points = result.MaxPoints * interviewOutcomeCredit[result.Outcome]
+			}
+			item.Result = &result
+
+			summary.Points += result.Points
+			summary.MaxPoints += result.MaxPoints
+			switch result.Outcome {
+			case AttemptSolved:
+				summary.Solved++
+			case AttemptPartial:
+				summary.Partial++
+			case AttemptFailed:
+				summary.Failed++
+			default:
+				summary.Unanswered++
+			}
+		}
+		session.Problems = append(session.Problems, item)
+	}
+	session.ProblemCount = len(session.Problems)
+
+	if over {
+		end := session.EndsAt
+		if session.FinishedAt != nil && session.FinishedAt.Before(end) {
+			end = *session.FinishedAt
+		}
+		summary.TimeUsedSeconds = int(end.Sub(session.StartedAt).Seconds())
+		if summary.MaxPoints > 0 {
+			summary.Score = math.Round(summary.Points/summary.MaxPoints*1000) / 10
+		}
+		session.Summary = &summary
+	}
+
+	respondWithJSON(w, status, session)
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// WorkspaceInvite is a pending invitation to join a workspace. It is
+// addressed to an email rather than an account, so inviting does not reveal
+// whether someone has registered, and nobody joins a workspace without
+// accepting.
+type WorkspaceInvite struct {
+	ID            string    `json:"id"`
+	WorkspaceID   string    `json:"workspaceId"`
+	WorkspaceName string    `json:"workspaceName"`
+	Email         string    `json:"email"`
+	Role          string    `json:"role"` // Granted on acceptance: owner, editor or viewer
+	InvitedBy     string    `json:"invitedBy"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+const inviteColumns = "i.id, i.workspace_id, ws.name, i.email, i.role, i.invited_by, i.created_at"
+
+// queryInvites returns the invites matching a condition on i (workspace_invites) and ws (workspaces)
+func (h *Handlers) queryInvites(condition string, args ...interface{}) ([]WorkspaceInvite, error) {
+	query := h.DB.convertPlaceholders("SELECT " + inviteColumns + " FROM workspace_invites i JOIN workspaces ws ON ws.id = i.workspace_id WHERE " + condition + " ORDER BY i.created_at ASC")
+	rows, err := h.DB.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := []WorkspaceInvite{}
+	for rows.Next() {
+		var invite WorkspaceInvite
+		if err := rows.Scan(&invite.ID, &invite.WorkspaceID, &invite.WorkspaceName, &invite.Email, &invite.Role, &invite.InvitedBy, &invite.CreatedAt); err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+// requireWorkspaceOwner checks that the caller owns a workspace. On failure
+// it writes the error response and returns false.
+func (h *Handlers) requireWorkspaceOwner(w http.ResponseWriter, r *http.Request, workspaceID, action string) bool {
+	role, err := h.workspaceRole(workspaceID, getUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return false
+	}
+	if role == "" {
+		respondWithError(w, http.StatusNotFound, "Workspace not found")
+		return false
+	}
+	if role != WorkspaceRoleOwner {
+		respondWithError(w, http.StatusForbidden, "Only workspace owners can "+action)
+		return false
+	}
+	return true
+}
+
+// requireInviteRecipient loads the caller and one of the invites addressed to
+// their email. Invites can only be seen once the email has been verified, so
+// registering with someone else's address does not reveal theirs. On failure
+// it writes the error response and returns false.
+func (h *Handlers) requireInviteRecipient(w http.ResponseWriter, r *http.Request, inviteID string) (*User, *WorkspaceInvite, bool) {
+	user, err := h.getUserByID(getUserID(r))
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return nil, nil, false
+	}
+	if user.EmailVerifiedAt == nil {
+		respondWithError(w, http.StatusForbidden, "Email verification required")
+		return nil, nil, false
+	}
+	if inviteID == "" {
+		return user, nil, true
+	}
+
+	invites, err := h.queryInvites("i.id = ? AND i.email = ?", inviteID, normalizeEmail(user.Email))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return nil, nil, false
+	}
+	if len(invites) == 0 {
+		respondWithError(w, http.StatusNotFound, "Invite not found")
+		return nil, nil, false
+	}
+	return user, &invites[0], true
+}
+
+// sendInviteEmail tells the recipient of an invite how to accept it
+func (h *Handlers) sendInviteEmail(invite *WorkspaceInvite, inviterName string) error {
+	body := fmt.Sprintf("Hi,\n\n%s invited you to the AlgoVault workspace %q as %s.\n\n"+
+		"Sign in, or create an account with this email address, to accept the invitation:\n\n%s\n",
+		inviterName, invite.WorkspaceName, invite.Role, h.AppURL)
+	return h.Mailer.Send(invite.Email, "You are invited to an AlgoVault workspace", body)
+}
+
+// InviteWorkspaceMember invites an email address to a workspace. The response
+// is the same whether or not an account with that email exists.
+func (h *Handlers) InviteWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	workspaceID := mux.Vars(r)["id"]
+	if !h.requireWorkspaceOwner(w, r, workspaceID, "invite members") {
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Email = normalizeEmail(req.Email)
+	if !strings.Contains(req.Email, "@") {
+		respondWithError(w, http.StatusBadRequest, "A valid email is required")
+		return
+	}
+	if req.Role == "" {
+		req.Role = WorkspaceRoleViewer
+	}
+	if !isValidWorkspaceRole(req.Role) {
+		respondWithError(w, http.StatusBadRequest, "Role must be owner, editor or viewer")
+		return
+	}
+
+	// Members are listed with their emails, so this reveals nothing new
+	var isMember bool
+	query := h.DB.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM workspace_members m JOIN users u ON u.id = m.user_id WHERE m.workspace_id = ? AND LOWER(u.email) = ?)")
+	if err := h.DB.DB.QueryRow(query, workspaceID, req.Email).Scan(&isMember); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if isMember {
+		respondWithError(w, http.StatusConflict, "This email already belongs to a member of the workspace")
+		return
+	}
+
+	// Inviting the same email again replaces the earlier invite
+	query = h.DB.convertPlaceholders("DELETE FROM workspace_invites WHERE workspace_id = ? AND email = ?")
+	if _, err := h.DB.DB.Exec(query, workspaceID, req.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating invite")
+		return
+	}
+	inviteID := generateID()
+	query = h.DB.convertPlaceholders("INSERT INTO workspace_invites (id, workspace_id, email, role, invited_by, created_at) VALUES (?, ?, ?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, inviteID, workspaceID, req.Email, req.Role, getUserID(r), time.Now()); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating invite")
+		return
+	}
+
+	invites, err := h.queryInvites("i.id = ?", inviteID)
+	if err != nil || len(invites) == 0 {
+		respondWithError(w, http.StatusInternalServerError, "Error loading invite")
+		return
+	}
+
+	invite := invites[0]
+	h.audit(r, AuditWorkspaceInvite, "invite", invite.ID, workspaceID, nil, map[string]string{"email": invite.Email, "role": invite.Role})
+
+	// A failed email does not fail the invite; it is also listed at /api/invites
+	inviterName := "A workspace owner"
+	if inviter, err := h.getUserByID(getUserID(r)); err == nil && inviter != nil {
+		inviterName = inviter.Name
+	}
+	if err := h.sendInviteEmail(&invite, inviterName); err != nil {
+		log.Printf("Error sending workspace invite to %s: %v", invite.Email, err)
+	}
+
+	respondWithJSON(w, http.StatusAccepted, invite)
+}
+
+// GetWorkspaceInvites lists the pending invites of a workspace the caller owns
+func (h *Handlers) GetWorkspaceInvites(w http.ResponseWriter, r *http.Request) {
+	workspaceID := mux.Vars(r)["id"]
+	if !h.requireWorkspaceOwner(w, r, workspaceID, "see invites") {
+		return
+	}
+
+	invites, err := h.queryInvites("i.workspace_id = ?", workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, invites)
+}
+
+// RevokeWorkspaceInvite withdraws a pending invite
+func (h *Handlers) RevokeWorkspaceInvite(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if !h.requireWorkspaceOwner(w, r, vars["id"], "revoke invites") {
+		return
+	}
+
+	query := h.DB.convertPlaceholders("DELETE FROM workspace_invites WHERE id = ? AND workspace_id = ?")
+	result, err := h.DB.DB.Exec(query, vars["inviteId"], vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking invite")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+	h.audit(r, AuditInviteRevoke, "invite", vars["inviteId"], vars["id"], nil, nil)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Invite revoked"})
+}
+
+// GetMyInvites lists the pending invites addressed to the caller's verified email
+func (h *Handlers) GetMyInvites(w http.ResponseWriter, r *http.Request) {
+	user, _, ok := h.requireInviteRecipient(w, r, "")
+	if !ok {
+		return
+	}
+
+	invites, err := h.queryInvites("i.email = ?", normalizeEmail(user.Email))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, invites)
+}
+
+// AcceptInvite joins the workspace of an invite addressed to the caller
+func (h *Handlers) AcceptInvite(w http.ResponseWriter, r *http.Request) {
+	user, invite, ok := h.requireInviteRecipient(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	// The invite is claimed first so it can only be accepted once
+	query := h.DB.convertPlaceholders("DELETE FROM workspace_invites WHERE id = ?")
+	result, err := h.DB.DB.Exec(query, invite.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error accepting invite")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Invite not found")
+		return
+	}
+
+	existingRole, err := h.workspaceRole(invite.WorkspaceID, user.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	member := WorkspaceMember{
+		WorkspaceID: invite.WorkspaceID,
+		UserID:      user.ID,
+		Email:       user.Email,
+		Name:        user.Name,
+		Role:        existingRole,
+		CreatedAt:   time.Now(),
+	}
+	if existingRole == "" {
+		member.Role = invite.Role
+		query = h.DB.convertPlaceholders("INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES (?, ?, ?, ?)")
+		if _, err := h.DB.DB.Exec(query, member.WorkspaceID, member.UserID, member.Role, member.CreatedAt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error adding member")
+			return
+		}
+	}
+	h.audit(r, AuditInviteAccept, "invite", invite.ID, invite.WorkspaceID, map[string]string{"role": existingRole}, map[string]string{"email": invite.Email, "role": member.Role})
+
+	respondWithJSON(w, http.StatusOK, member)
+}
+
+// DeclineInvite discards an invite addressed to the caller
+func (h *Handlers) DeclineInvite(w http.ResponseWriter, r *http.Request) {
+	_, invite, ok := h.requireInviteRecipient(w, r, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+
+	query := h.DB.convertPlaceholders("DELETE FROM workspace_invites WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, invite.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error declining invite")
+		return
+	}
+	h.audit(r, AuditInviteDecline, "invite", invite.ID, invite.WorkspaceID, nil, map[string]string{"email": invite.Email})
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Invite declined"})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Judge verdicts
+const (
+	VerdictAccepted      = "AC"
+	VerdictWrongAnswer   = "WA"
+	VerdictTimeLimit     = "TLE"
+	VerdictRuntimeError  = "RE"
+	VerdictMemoryLimit   = "MLE"
+	VerdictCompileError  = "CE"
+	VerdictCheckerFailed = "CF" // A custom checker crashed or gave no verdict
+)
+
+// runVerdicts maps the status of a finished run to its verdict; a run that
+// ended normally is accepted or a wrong answer depending on its output
+var runVerdicts = map[string]string{
+	RunRuntimeError: VerdictRuntimeError,
+	RunTimeLimit:    VerdictTimeLimit,
+	RunMemoryLimit:  VerdictMemoryLimit,
+}
+
+// JudgeCaseResult is the outcome of one test case. Input and outputs of
+// hidden cases are left out for callers who may not see them.
+type JudgeCaseResult struct {
+	TestCaseID     string `json:"testCaseId"`
+	Position       int    `json:"position"`
+	Hidden         bool   `json:"hidden"`
+	Verdict        string `json:"verdict"`
+	TimeMs         int64  `json:"timeMs"`
+	CPUTimeMs      int64  `json:"cpuTimeMs"`
+	MemoryKB       int64  `json:"memoryKb"`
+	ExitCode       int    `json:"exitCode"`
+	Input          string `json:"input,omitempty"`
+	ExpectedOutput string `json:"expectedOutput,omitempty"`
+	ActualOutput   string `json:"actualOutput,omitempty"`
+	Stderr         string `json:"stderr,omitempty"`
+	CheckerMessage string `json:"checkerMessage,omitempty"` // What a custom checker printed
+}
+
+// JudgeResult is the outcome of judging a solution against all of a problem's test cases
+type JudgeResult struct {
+	Verdict   string            `json:"verdict"` // AC, or the verdict of the first failing case
+	Checker   string            `json:"checker"` // Checker mode the outputs were compared with
+	Passed    int               `json:"passed"`
+	Total     int               `json:"total"`
+	MaxTimeMs int64             `json:"maxTimeMs"`
+	MaxMemKB  int64             `json:"maxMemoryKb"`
+	Compile   *RunResult        `json:"compile,omitempty"` // Set on a compile error of the solution
+	Cases     []JudgeCaseResult `json:"cases"`
+}
+
+// JudgeSolution compiles a problem's stored solution in a language once and
+// runs it against every test case of the problem
+func (h *Handlers) JudgeSolution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID, ok := h.requireProblemInWorkspace(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	var req struct {
+		TimeLimitMs   int `json:"timeLimitMs"`
+		MemoryLimitMB int `json:"memoryLimitMb"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	limits, err := h.runLimits(req.TimeLimitMs, req.MemoryLimitMB)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	testCases, err := h.getTestCases(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if len(testCases) == 0 {
+		respondWithError(w, http.StatusBadRequest, "Problem has no test cases")
+		return
+	}
+	seeHidden, err := h.canSeeHiddenTestCases(r, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	code, found, err := h.loadSolutionCode(vars["id"], vars["language"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Solution not found")
+		return
+	}
+
+	checkerConfig, err := h.loadChecker(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	checker, checkerCompile, err := h.newOutputChecker(r.Context(), checkerConfig)
+	if err != nil {
+		status, message := runnerErrorStatus(err)
+		respondWithError(w, status, "Checker: "+message)
+		return
+	}
+	if checkerCompile != nil {
+		respondWithError(w, http.StatusConflict, "Checker does not compile: "+checkerCompile.Stderr)
+		return
+	}
+	defer checker.Close()
+
+	result := JudgeResult{Verdict: VerdictAccepted, Checker: checkerConfig.Mode, Total: len(testCases), Cases: []JudgeCaseResult{}}
+
+	program, compileResult, err := h.Runner.Compile(r.Context(), vars["language"], code)
+	if err != nil {
+		status, message := runnerErrorStatus(err)
+		respondWithError(w, status, message)
+		return
+	}
+	if compileResult != nil {
+		result.Verdict = VerdictCompileError
+		result.Compile = compileResult
+		respondWithJSON(w, http.StatusOK, result)
+		return
+	}
+	defer program.Close()
+
+	for _, tc := range testCases {
+		run, err := program.Run(r.Context(), tc.Input, limits)
+		if err != nil {
+			status, message := runnerErrorStatus(err)
+			respondWithError(w, status, message)
+			return
+		}
+
+		verdict, failed := runVerdicts[run.Status]
+		var checkerMessage string
+		if !failed {
+			verdict, checkerMessage, err = checker.check(r.Context(), tc.Input, tc.ExpectedOutput, run.Stdout)
+			if err != nil {
+				status, message := runnerErrorStatus(err)
+				respondWithError(w, status, "Checker: "+message)
+				return
+			}
+		}
+
+		caseResult := JudgeCaseResult{
+			TestCaseID: tc.ID,
+			Position:   tc.Position,
+			Hidden:     tc.Hidden,
+			Verdict:    verdict,
+			TimeMs:     run.TimeMs,
+			CPUTimeMs:  run.CPUTimeMs,
+			MemoryKB:   run.MemoryKB,
+			ExitCode:   run.ExitCode,
+		}
+		if !tc.Hidden || seeHidden {
+			caseResult.Input = tc.Input
+			caseResult.ExpectedOutput = tc.ExpectedOutput
+			caseResult.ActualOutput = run.Stdout
+			caseResult.Stderr = run.Stderr
+			caseResult.CheckerMessage = checkerMessage
+		}
+		result.Cases = append(result.Cases, caseResult)
+
+		if verdict == VerdictAccepted {
+			result.Passed++
+		} else if result.Verdict == VerdictAccepted {
+			result.Verdict = verdict
+		}
+		result.MaxTimeMs = max(result.MaxTimeMs, run.TimeMs)
+		result.MaxMemKB = max(result.MaxMemKB, run.MemoryKB)
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+)
+
+// Language is a language solutions can be written in
+type Language struct {
+	ID        string `json:"id"`   // As stored with a solution, such as cpp
+	Name      string `json:"name"` // For display, such as C++
+	Extension string `json:"extension"`
+	Runnable  bool   `json:"runnable"` // Whether this server has the toolchain to run it
+}
+
+// supportedLanguages is the registry of languages solutions may be written
+// in, in display order. Each one needs an entry in runnerLanguages to run.
+var supportedLanguages = []Language{
+	{ID: "cpp", Name: "C++", Extension: ".cpp"},
+	{ID: "go", Name: "Go", Extension: ".go"},
+	{ID: "python", Name: "Python", Extension: ".py"},
+	{ID: "java", Name: "Java", Extension: ".java"},
+	{ID: "javascript", Name: "JavaScript", Extension: ".js"},
+}
+
+// isSupportedLanguage reports whether id is in the language registry
+func isSupportedLanguage(id string) bool {
+	for _, lang := range supportedLanguages {
+		if lang.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// GetLanguages lists the supported languages and whether each can be run here
+func (h *Handlers) GetLanguages(w http.ResponseWriter, r *http.Request) {
+	languages := make([]Language, len(supportedLanguages))
+	for i, lang := range supportedLanguages {
+		lang.Runnable = h.Runner.Available(lang.ID) == nil
+		languages[i] = lang
+	}
+	respondWithJSON(w, http.StatusOK, languages)
+}
@@ -0,0 +1,577 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// dateLayout is the format of calendar days in study plans
+const dateLayout = "2006-01-02"
+
+// maxPlanDays limits how far into a study plan an item can be scheduled
+const maxPlanDays = 3650
+
+// ProblemListItem is a problem in a list, with the caller's status on it
+type ProblemListItem struct {
+	ProblemID   string    `json:"problemId"`
+	Title       string    `json:"title"`
+	Difficulty  string    `json:"difficulty"`
+	PatternID   string    `json:"patternId"`
+	PatternName string    `json:"patternName"`
+	Position    int       `json:"position"`
+	Day         *int      `json:"day,omitempty"`  // 1-based day of a study plan
+	Date        string    `json:"date,omitempty"` // Calendar day of Day, once the list has a start date
+	Status      string    `json:"status"`
+	AddedAt     time.Time `json:"addedAt"`
+}
+
+// ProblemList is a user's ordered list of problems across patterns. A list
+// with a start date is a study plan that schedules its items on calendar days.
+type ProblemList struct {
+	ID              string            `json:"id"`
+	WorkspaceID     string            `json:"workspaceId"`
+	Name            string            `json:"name"`
+	Description     string            `json:"description"`
+	StartDate       string            `json:"startDate,omitempty"` // YYYY-MM-DD
+	ItemCount       int               `json:"itemCount"`
+	SolvedCount     int               `json:"solvedCount"`
+	ProgressPercent float64           `json:"progressPercent"`
+	Items           []ProblemListItem `json:"items,omitempty"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	UpdatedAt       time.Time         `json:"updatedAt"`
+}
+
+// setProgress derives the completion percentage from the item counts
+func (l *ProblemList) setProgress() {
+	l.ProgressPercent = 0
+	if l.ItemCount > 0 {
+		l.ProgressPercent = math.Round(float64(l.SolvedCount)/float64(l.ItemCount)*1000) / 10
+	}
+}
+
+// parsePlanDate validates an optional YYYY-MM-DD start date
+func parsePlanDate(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", true
+	}
+	if _, err := time.Parse(dateLayout, value); err != nil {
+		return "", false
+	}
+	return value, true
+}
+
+// nullIfEmpty stores an empty string as NULL
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+// loadProblemList returns one of a user's lists in a workspace with its
+// items, or nil if there is none
+func (h *Handlers) loadProblemList(id, userID, workspaceID string) (*ProblemList, error) {
+	var list ProblemList
+	var startDate sql.NullString
+	query := h.DB.convertPlaceholders("SELECT id, workspace_id, name, description, start_date, created_at, updated_at FROM problem_lists WHERE id = ? AND user_id = ? AND workspace_id = ?")
+	err := h.DB.DB.QueryRow(query, id, userID, workspaceID).Scan(&list.ID, &list.WorkspaceID, &list.Name, &list.Description, &startDate, &list.CreatedAt, &list.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list.StartDate = startDate.String
+
+	var start time.Time
+	if list.StartDate != "" {
+		start, _ = time.Parse(dateLayout, list.StartDate)
+	}
+
+	query = h.DB.convertPlaceholders(`
+		SELECT p.id, p.title, p.difficulty, p.pattern_id, pat.name, i.position, i.day, i.added_at, COALESCE(pp.status, '` + ProgressUnsolved + `')
+		FROM problem_list_items i
+		JOIN problems p ON p.id = i.problem_id AND p.workspace_id = ?
+		JOIN patterns pat ON pat.id = p.pattern_id
+		LEFT JOIN problem_progress pp ON pp.problem_id = p.id AND pp.user_id = ?
+		WHERE i.list_id = ?
+		ORDER BY i.position ASC
+	`)
+	rows, err := h.DB.DB.Query(query, workspaceID, userID, list.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list.Items = []ProblemListItem{}
+	for rows.Next() {
+		var item ProblemListItem
+		var day sql.NullInt64
+		if err := rows.Scan(&item.ProblemID, &item.Title, &item.Difficulty, &item.PatternID, &item.PatternName, &item.Position, &day, &item.AddedAt, &item.Status); err != nil {
+			return nil, err
+		}
+		if day.Valid {
+			d := int(day.Int64)
+			item.Day = &d
+			if !start.IsZero() {
+				item.Date = start.AddDate(0, 0, d-1).Format(dateLayout)
+			}
+		}
+		if item.Status == ProgressSolved || item.Status == ProgressMastered {
+			list.SolvedCount++
+		}
+		list.Items = append(list.Items, item)
+	}
+	list.ItemCount = len(list.Items)
+	list.setProgress()
+	return &list, rows.Err()
+}
+
+// requireProblemList loads one of the caller's lists in their active
+// workspace, writing an error response if it cannot
+func (h *Handlers) requireProblemList(w http.ResponseWriter, r *http.Request) (*ProblemList, bool) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return nil, false
+	}
+
+	list, err := h.loadProblemList(mux.Vars(r)["id"], getUserID(r), workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return nil, false
+	}
+	if list == nil {
+		respondWithError(w, http.StatusNotFound, "List not found")
+		return nil, false
+	}
+	return list, true
+}
+
+// addListItem appends a problem to a list
+func (h *Handlers) addListItem(listID, problemID string, day *int) error {
+	var position int
+	query := h.DB.convertPlaceholders("SELECT COALESCE(MAX(position), 0) FROM problem_list_items WHERE list_id = ?")
+	if err := h.DB.DB.QueryRow(query, listID).Scan(&position); err != nil {
+		return err
+	}
+
+	var dayValue interface{}
+	if day != nil {
+		dayValue = *day
+	}
+	query = h.DB.convertPlaceholders("INSERT INTO problem_list_items (list_id, problem_id, position, day, added_at) VALUES (?, ?, ?, ?, ?)")
+	_, err := h.DB.DB.Exec(query, listID, problemID, position+1, dayValue, time.Now())
+	return err
+}
+
+// touchProblemList bumps a list's updated_at after its items change
+func (h *Handlers) touchProblemList(listID string) error {
+	query := h.DB.convertPlaceholders("UPDATE problem_lists SET updated_at = ? WHERE id = ?")
+	_, err := h.DB.DB.Exec(query, time.Now(), listID)
+	return err
+}
+
+// GetProblemLists returns the caller's lists in their active workspace with
+// their progress, newest first
+func (h *Handlers) GetProblemLists(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+	userID := getUserID(r)
+
+	query := h.DB.convertPlaceholders(`
+		SELECT l.id, l.workspace_id, l.name, l.description, l.start_date, l.created_at, l.updated_at,
+		       COUNT(p.id), COUNT(CASE WHEN pp.status IN ` + solvedStatusesSQL + ` THEN 1 END)
+		FROM problem_lists l
+		LEFT JOIN problem_list_items i ON i.list_id = l.id
+		LEFT JOIN problems p ON p.id = i.problem_id AND p.workspace_id = l.workspace_id
+		LEFT JOIN problem_progress pp ON pp.problem_id = p.id AND pp.user_id = ?
+		WHERE l.user_id = ? AND l.workspace_id = ?
+		GROUP BY l.id, l.workspace_id, l.name, l.description, l.start_date, l.created_at, l.updated_at
+		ORDER BY l.created_at DESC
+	`)
+	rows, err := h.DB.DB.Query(query, userID, userID, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	lists := []ProblemList{}
+	for rows.Next() {
+		var list ProblemList
+		var startDate sql.NullString
+		if err := rows.Scan(&list.ID, &list.WorkspaceID, &list.Name, &list.Description, &startDate, &list.CreatedAt, &list.UpdatedAt, &list.ItemCount, &list.SolvedCount); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning list")
+			return
+		}
+		list.StartDate = startDate.String
+		list.setProgress()
+		lists = append(lists, list)
+	}
+
+	respondWithJSON(w, http.StatusOK, lists)
+}
+
+// GetProblemList returns one of the caller's lists with its items in order
+func (h *Handlers) GetProblemList(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.requireProblemList(w, r)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// CreateProblemList creates a list for the caller, optionally filled with
+// problemIds in order. A startDate makes it a study plan.
+func (h *Handlers) CreateProblemList(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		StartDate   string   `json:"startDate"`
+		ProblemIDs  []string `json:"problemIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	startDate, ok := parsePlanDate(req.StartDate)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "startDate must be a YYYY-MM-DD date")
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, problemID := range req.ProblemIDs {
+		if seen[problemID] {
+			respondWithError(w, http.StatusBadRequest, "Duplicate problem in list")
+			return
+		}
+		seen[problemID] = true
+		found, err := h.inWorkspace("problems", problemID, workspaceID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if !found {
+			respondWithError(w, http.StatusBadRequest, "Problem not found: "+problemID)
+			return
+		}
+	}
+
+	userID := getUserID(r)
+	now := time.Now()
+	id := generateID()
+	query := h.DB.convertPlaceholders("INSERT INTO problem_lists (id, user_id, workspace_id, name, description, start_date, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, id, userID, workspaceID, req.Name, req.Description, nullIfEmpty(startDate), now, now); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating list")
+		return
+	}
+	for _, problemID := range req.ProblemIDs {
+		if err := h.addListItem(id, problemID, nil); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error adding problem to list")
+			return
+		}
+	}
+
+	h.respondWithProblemList(w, http.StatusCreated, id, userID, workspaceID)
+}
+
+// UpdateProblemList replaces a list's name, description and start date.
+// An empty startDate turns a study plan back into a plain list.
+func (h *Handlers) UpdateProblemList(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.requireProblemList(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		StartDate   string `json:"startDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	startDate, ok := parsePlanDate(req.StartDate)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, "startDate must be a YYYY-MM-DD date")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE problem_lists SET name = ?, description = ?, start_date = ?, updated_at = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, req.Name, req.Description, nullIfEmpty(startDate), time.Now(), list.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating list")
+		return
+	}
+
+	h.respondWithProblemList(w, http.StatusOK, list.ID, getUserID(r), list.WorkspaceID)
+}
+
+// DeleteProblemList deletes one of the caller's lists. The problems stay.
+func (h *Handlers) DeleteProblemList(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.requireProblemList(w, r)
+	if !ok {
+		return
+	}
+
+	query := h.DB.convertPlaceholders("DELETE FROM problem_list_items WHERE list_id = ?")
+	if _, err := h.DB.DB.Exec(query, list.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting list")
+		return
+	}
+	query = h.DB.convertPlaceholders("DELETE FROM problem_lists WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, list.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting list")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "List deleted"})
+}
+
+// AddProblemListItem appends a problem to a list, optionally on a plan day
+func (h *Handlers) AddProblemListItem(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.requireProblemList(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ProblemID string `json:"problemId"`
+		Day       *int   `json:"day"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Day != nil && (*req.Day < 1 || *req.Day > maxPlanDays) {
+		respondWithError(w, http.StatusBadRequest, "day must be between 1 and 3650")
+		return
+	}
+
+	found, err := h.inWorkspace("problems", req.ProblemID, list.WorkspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Problem not found")
+		return
+	}
+	for _, item := range list.Items {
+		if item.ProblemID == req.ProblemID {
+			respondWithError(w, http.StatusConflict, "Problem is already in this list")
+			return
+		}
+	}
+
+	if err := h.addListItem(list.ID, req.ProblemID, req.Day); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error adding problem to list")
+		return
+	}
+	if err := h.touchProblemList(list.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating list")
+		return
+	}
+
+	h.respondWithProblemList(w, http.StatusCreated, list.ID, getUserID(r), list.WorkspaceID)
+}
+
+// UpdateProblemListItem moves a list item to another plan day. A null day
+// unschedules it.
+func (h *Handlers) UpdateProblemListItem(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.requireProblemList(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Day *int `json:"day"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	var day interface{}
+	if req.Day != nil {
+		if *req.Day < 1 || *req.Day > maxPlanDays {
+			respondWithError(w, http.StatusBadRequest, "day must be between 1 and 3650")
+			return
+		}
+		day = *req.Day
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE problem_list_items SET day = ? WHERE list_id = ? AND problem_id = ?")
+	result, err := h.DB.DB.Exec(query, day, list.ID, mux.Vars(r)["problemId"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating list item")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Problem is not in this list")
+		return
+	}
+	if err := h.touchProblemList(list.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating list")
+		return
+	}
+
+	h.respondWithProblemList(w, http.StatusOK, list.ID, getUserID(r), list.WorkspaceID)
+}
+
+// DeleteProblemListItem removes a problem from a list
+func (h *Handlers) DeleteProblemListItem(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.requireProblemList(w, r)
+	if !ok {
+		return
+	}
+
+	query := h.DB.convertPlaceholders("DELETE FROM problem_list_items WHERE list_id = ? AND problem_id = ?")
+	result, err := h.DB.DB.Exec(query, list.ID, mux.Vars(r)["problemId"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error removing problem from list")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusNotFound, "Problem is not in this list")
+		return
+	}
+	if err := h.touchProblemList(list.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating list")
+		return
+	}
+
+	h.respondWithProblemList(w, http.StatusOK, list.ID, getUserID(r), list.WorkspaceID)
+}
+
+// ReorderProblemList sets the order of a list's items. problemIds must name
+// every problem in the list exactly once.
+func (h *Handlers) ReorderProblemList(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.requireProblemList(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ProblemIDs []string `json:"problemIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	inList := map[string]bool{}
+	for _, item := range list.Items {
+		inList[item.ProblemID] = true
+	}
+	if len(req.ProblemIDs) != len(inList) {
+		respondWithError(w, http.StatusBadRequest, "problemIds must list every problem in the list exactly once")
+		return
+	}
+	for _, problemID := range req.ProblemIDs {
+		if !inList[problemID] {
+			respondWithError(w, http.StatusBadRequest, "problemIds must list every problem in the list exactly once")
+			return
+		}
+		delete(inList, problemID)
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE problem_list_items SET position = ? WHERE list_id = ? AND problem_id = ?")
+	for i, problemID := range req.ProblemIDs {
+		if _, err := h.DB.DB.Exec(query, i+1, list.ID, problemID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error reordering list")
+			return
+		}
+	}
+	if err := h.touchProblemList(list.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating list")
+		return
+	}
+
+	h.respondWithProblemList(w, http.StatusOK, list.ID, getUserID(r), list.WorkspaceID)
+}
+
+// CloneProblemList copies a list with its order and plan days. The copy
+// keeps the original's start date unless startDate is given, so a plan can
+// be restarted from a new day.
+func (h *Handlers) CloneProblemList(w http.ResponseWriter, r *http.Request) {
+	list, ok := h.requireProblemList(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name      string  `json:"name"`
+		StartDate *string `json:"startDate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = list.Name + " (copy)"
+	}
+	startDate := list.StartDate
+	if req.StartDate != nil {
+		if startDate, ok = parsePlanDate(*req.StartDate); !ok {
+			respondWithError(w, http.StatusBadRequest, "startDate must be a YYYY-MM-DD date")
+			return
+		}
+	}
+
+	userID := getUserID(r)
+	now := time.Now()
+	id := generateID()
+	query := h.DB.convertPlaceholders("INSERT INTO problem_lists (id, user_id, workspace_id, name, description, start_date, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, id, userID, list.WorkspaceID, name, list.Description, nullIfEmpty(startDate), now, now); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error cloning list")
+		return
+	}
+	for _, item := range list.Items {
+		if err := h.addListItem(id, item.ProblemID, item.Day); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error cloning list")
+			return
+		}
+	}
+
+	h.respondWithProblemList(w, http.StatusCreated, id, userID, list.WorkspaceID)
+}
+
+// respondWithProblemList writes a list as it is stored now
+func (h *Handlers) respondWithProblemList(w http.ResponseWriter, status int, id, userID, workspaceID string) {
+	list, err := h.loadProblemList(id, userID, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if list == nil {
+		respondWithError(w, http.StatusNotFound, "List not found")
+		return
+	}
+	respondWithJSON(w, status, list)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends plain text emails
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPMailer delivers mail through an SMTP server. STARTTLS is used when the
+// server offers it; credentials are optional so a local SMTP stand-in works.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send implements Mailer
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// The envelope sender must be a bare address even if From has a display name
+	sender, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %v", m.From, err)
+	}
+	return smtp.SendMail(m.Host+":"+m.Port, auth, sender.Address, []string{to}, buildMessage(m.From, to, subject, body))
+}
+
+// LogMailer writes mail to a file, or to the server log when Path is empty.
+// It is meant for local development.
+type LogMailer struct {
+	Path string
+	From string
+
+	mu sync.Mutex
+}
+
+// Send implements Mailer
+func (m *LogMailer) Send(to, subject, body string) error {
+	message := buildMessage(m.From, to, subject, body)
+	if m.Path == "" {
+		log.Printf("📧 Mail to %s\n%s", to, message)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\n\n", message)
+	return err
+}
+
+// buildMessage formats an RFC 5322 message with CRLF line endings
+func buildMessage(from, to, subject, body string) []byte {
+	headers := []string{
+		"From: " + from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+	message := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+	return []byte(strings.ReplaceAll(strings.ReplaceAll(message, "\r\n", "\n"), "\n", "\r\n"))
+}
+
+// newMailer returns an SMTP mailer when a host is configured and a log mailer otherwise
+func newMailer(host, port, username, password, from, logPath string) Mailer {
+	if host == "" {
+		if logPath != "" {
+			log.Printf("SMTP_HOST not set, writing outgoing mail to %s", logPath)
+		} else {
+			log.Printf("SMTP_HOST not set, writing outgoing mail to the server log")
+		}
+		return &LogMailer{Path: logPath, From: from}
+	}
+	return &SMTPMailer{Host: host, Port: port, Username: username, Password: password, From: from}
+}
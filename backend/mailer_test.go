@@ -0,0 +1,150 @@
+package main
+
+import (
+	"net"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// smtpMessage is one message received by fakeSMTPServer
+type smtpMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeSMTPServer accepts mail on a local port without authentication or
+// TLS and passes each message it receives to the returned channel
+func fakeSMTPServer(t *testing.T) (host, port string, messages <-chan smtpMessage) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(textproto.NewConn(conn), received)
+		}
+	}()
+	host, port, _ = net.SplitHostPort(listener.Addr().String())
+	return host, port, received
+}
+
+func serveSMTP(conn *textproto.Conn, received chan<- smtpMessage) {
+	defer conn.Close()
+	var msg smtpMessage
+	conn.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case command == "EHLO" || command == "HELO":
+			conn.PrintfLine("250 localhost")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+			msg = smtpMessage{From: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			conn.PrintfLine("250 OK")
+		case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+			msg.To = append(msg.To, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			conn.PrintfLine("250 OK")
+		case command == "DATA":
+			conn.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			// ReadDotLines undoes dot-stuffing and strips the line endings
+			lines, err := conn.ReadDotLines()
+			if err != nil {
+				return
+			}
+			msg.Data = strings.Join(lines, "\r\n")
+			received <- msg
+			conn.PrintfLine("250 OK")
+		case command == "QUIT":
+			conn.PrintfLine("221 Bye")
+			return
+		default:
+			conn.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	host, port, messages := fakeSMTPServer(t)
+	mailer := &SMTPMailer{Host: host, Port: port, From: "AlgoVault <noreply@example.com>"}
+
+	body := "Hello,\n.leading dot\nBye\n"
+	if err := mailer.Send("user@example.com", "Greetings", body); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	msg := <-messages
+
+	if msg.From != "noreply@example.com" {
+		t.Errorf("envelope sender = %q, want the bare address", msg.From)
+	}
+	if len(msg.To) != 1 || msg.To[0] != "user@example.com" {
+		t.Errorf("recipients = %q, want [user@example.com]", msg.To)
+	}
+	headers, received, found := strings.Cut(msg.Data, "\r\n\r\n")
+	if !found {
+		t.Fatalf("message has no header separator:\n%s", msg.Data)
+	}
+	for _, header := range []string{"From: AlgoVault <noreply@example.com>", "To: user@example.com", "Subject: Greetings", "Content-Type: text/plain; charset=UTF-8"} {
+		if !strings.Contains(headers+"\r\n", header+"\r\n") {
+			t.Errorf("headers are missing %q:\n%s", header, headers)
+		}
+	}
+	if want := "Hello,\r\n.leading dot\r\nBye"; received != want {
+		t.Errorf("body = %q, want %q", received, want)
+	}
+}
+
+func TestSMTPMailerRejectsInvalidSender(t *testing.T) {
+	mailer := &SMTPMailer{Host: "127.0.0.1", Port: "1", From: "not an address"}
+	if err := mailer.Send("user@example.com", "Subject", "Body"); err == nil {
+		t.Error("Send with an invalid From succeeded")
+	}
+}
+
+func TestBuildMessageUsesCRLF(t *testing.T) {
+	message := string(buildMessage("a@example.com", "b@example.com", "Subject", "one\ntwo\r\nthree"))
+	if strings.Contains(strings.ReplaceAll(message, "\r\n", ""), "\n") {
+		t.Errorf("message has a bare LF: %q", message)
+	}
+	if !strings.HasSuffix(message, "\r\n\r\none\r\ntwo\r\nthree") {
+		t.Errorf("message body = %q", message)
+	}
+}
+
+func TestPasswordResetEmailRoundTrip(t *testing.T) {
+	h := newTestHandlers(t)
+	host, port, messages := fakeSMTPServer(t)
+	h.Mailer = &SMTPMailer{Host: host, Port: port, From: "noreply@example.com"}
+	h.AppURL = "https://algovault.example.com"
+	userID := createTestUser(t, h, "reset@example.com")
+
+	if err := h.sendPasswordResetEmail(userID, "reset@example.com", "Reset"); err != nil {
+		t.Fatalf("sendPasswordResetEmail: %v", err)
+	}
+	msg := <-messages
+
+	match := regexp.MustCompile(`https://algovault\.example\.com/reset-password\?token=(\w+)`).FindStringSubmatch(msg.Data)
+	if match == nil {
+		t.Fatalf("email has no reset link:\n%s", msg.Data)
+	}
+	got, err := h.DB.consumeUserToken(match[1], tokenPurposePasswordReset)
+	if err != nil || got != userID {
+		t.Fatalf("consumeUserToken = %q, %v; want %q", got, err, userID)
+	}
+	if _, err := h.DB.consumeUserToken(match[1], tokenPurposePasswordReset); err != errInvalidUserToken {
+		t.Errorf("second use of the reset token: err = %v, want %v", err, errInvalidUserToken)
+	}
+}
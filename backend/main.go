@@ -1,17 +1,25 @@
 package main
 
 import (
-	"database/sql"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	// The server binary doubles as the init of sandboxed programs
+	if len(os.Args) > 1 && os.Args[1] == sandboxInitArg {
+		runSandboxInit(os.Args[2:])
+	}
+
 	// Configuration
 	// Use PORT environment variable if available (for Render, Railway, etc.)
 	portEnv := getEnv("PORT", "")
@@ -24,6 +32,31 @@ func main() {
 	port := flag.String("port", portEnv, "Server port")
 	jwtSecret := flag.String("jwt-secret", getEnv("JWT_SECRET", "your-secret-key-change-in-production"), "JWT secret key")
 	aiAPIKey := flag.String("ai-api-key", getEnv("AI_API_KEY", "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"), "OpenRouter API key")
+	bootstrapAdminEmail := flag.String("bootstrap-admin-email", getEnv("BOOTSTRAP_ADMIN_EMAIL", ""), "Email that registers as admin while no enabled admin exists")
+	appURL := flag.String("app-url", getEnv("APP_URL", "http://localhost:3000"), "Frontend base URL used in emailed links")
+	smtpHost := flag.String("smtp-host", getEnv("SMTP_HOST", ""), "SMTP server host (mail is logged when empty)")
+	smtpPort := flag.String("smtp-port", getEnv("SMTP_PORT", "587"), "SMTP server port")
+	smtpUsername := flag.String("smtp-username", getEnv("SMTP_USERNAME", ""), "SMTP username")
+	smtpPassword := flag.String("smtp-password", getEnv("SMTP_PASSWORD", ""), "SMTP password")
+	mailFrom := flag.String("mail-from", getEnv("MAIL_FROM", "AlgoVault <no-reply@algovault.local>"), "Sender address for outgoing mail")
+	trustProxy := flag.Bool("trust-proxy", getEnv("TRUST_PROXY", "") == "true", "Take client IPs for rate limiting from X-Forwarded-For")
+	oidcIssuer := flag.String("oidc-issuer", getEnv("OIDC_ISSUER", ""), "OpenID Connect issuer URL (single sign-on is disabled when empty)")
+	oidcClientID := flag.String("oidc-client-id", getEnv("OIDC_CLIENT_ID", ""), "OpenID Connect client ID")
+	oidcClientSecret := flag.String("oidc-client-secret", getEnv("OIDC_CLIENT_SECRET", ""), "OpenID Connect client secret (optional with PKCE)")
+	oidcRedirectURL := flag.String("oidc-redirect-url", getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/oidc/callback"), "Callback URL registered with the OpenID Connect provider")
+	oidcScopes := flag.String("oidc-scopes", getEnv("OIDC_SCOPES", "openid email profile"), "Scopes requested from the OpenID Connect provider")
+	oidcRoleClaim := flag.String("oidc-role-claim", getEnv("OIDC_ROLE_CLAIM", ""), "ID token claim mapped to the user's role, such as groups")
+	oidcRoleMapping := flag.String("oidc-role-mapping", getEnv("OIDC_ROLE_MAPPING", ""), "Claim values to roles, such as algovault-admins=admin,engineering=user")
+	oidcDefaultRole := flag.String("oidc-default-role", getEnv("OIDC_DEFAULT_ROLE", "user"), "Role for new single sign-on users without a mapped claim")
+	mailLogFile := flag.String("mail-log-file", getEnv("MAIL_LOG_FILE", ""), "File that receives outgoing mail when no SMTP host is set")
+	runnerTimeLimit := flag.Int("runner-time-limit-ms", getEnvInt("RUNNER_TIME_LIMIT_MS", 2000), "Maximum CPU time of one sandboxed run in milliseconds")
+	runnerWallLimit := flag.Int("runner-wall-limit-ms", getEnvInt("RUNNER_WALL_LIMIT_MS", 10000), "Maximum wall-clock time of one sandboxed run in milliseconds")
+	runnerMemoryLimit := flag.Int("runner-memory-limit-mb", getEnvInt("RUNNER_MEMORY_LIMIT_MB", 256), "Maximum memory of one sandboxed run in MiB")
+	runnerCompileTimeout := flag.Int("runner-compile-timeout-ms", getEnvInt("RUNNER_COMPILE_TIMEOUT_MS", 60000), "Maximum wall-clock time of one compile in milliseconds")
+	runnerMaxConcurrent := flag.Int("runner-max-concurrent", getEnvInt("RUNNER_MAX_CONCURRENT", 2), "Sandboxed processes allowed at once")
+	runnerCacheDir := flag.String("runner-cache-dir", getEnv("RUNNER_CACHE_DIR", filepath.Join(os.TempDir(), "algovault-runner-cache")), "Build caches shared between sandboxed compiles")
+	runnerSandboxUID := flag.Int("runner-sandbox-uid", getEnvInt("RUNNER_SANDBOX_UID", 2000000), "First of runner-max-concurrent consecutive uids that sandboxed processes run as")
+	runnerPath := flag.String("runner-path", getEnv("RUNNER_PATH", "/usr/local/go/bin:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"), "PATH searched for compilers and interpreters inside the sandbox")
 	flag.Parse()
 
 	// Log configuration
@@ -49,12 +82,45 @@ func main() {
 	}
 	defer db.Close()
 	log.Printf("✅ Database ready and connected")
+	if err := db.failInterruptedBenchmarks(); err != nil {
+		log.Printf("Failed to close out interrupted benchmarks: %v", err)
+	}
+
+	// Single sign-on is optional
+	oidcProvider := NewOIDCProvider(OIDCConfig{
+		Issuer:       *oidcIssuer,
+		ClientID:     *oidcClientID,
+		ClientSecret: *oidcClientSecret,
+		RedirectURL:  *oidcRedirectURL,
+		Scopes:       *oidcScopes,
+		RoleClaim:    *oidcRoleClaim,
+		RoleMapping:  parseRoleMapping(*oidcRoleMapping),
+		DefaultRole:  *oidcDefaultRole,
+	})
+	if oidcProvider != nil {
+		log.Printf("Single sign-on enabled with issuer %s", oidcProvider.Config.Issuer)
+	}
 
 	// Initialize handlers
 	handlers := &Handlers{
-		DB:        db,
-		JWTSecret: *jwtSecret,
-		AIAPIKey:  *aiAPIKey,
+		DB:                  db,
+		JWTSecret:           *jwtSecret,
+		AIAPIKey:            *aiAPIKey,
+		BootstrapAdminEmail: *bootstrapAdminEmail,
+		Mailer:              newMailer(*smtpHost, *smtpPort, *smtpUsername, *smtpPassword, *mailFrom, *mailLogFile),
+		AppURL:              strings.TrimRight(*appURL, "/"),
+		Limiter:             NewAuthLimiter(*trustProxy),
+		OIDC:                oidcProvider,
+		Runner: NewRunner(RunnerConfig{
+			TimeLimit:      time.Duration(*runnerTimeLimit) * time.Millisecond,
+			WallLimit:      time.Duration(*runnerWallLimit) * time.Millisecond,
+			MemoryLimitMB:  *runnerMemoryLimit,
+			CompileTimeout: time.Duration(*runnerCompileTimeout) * time.Millisecond,
+			MaxConcurrent:  *runnerMaxConcurrent,
+			CacheDir:       *runnerCacheDir,
+			Path:           *runnerPath,
+			SandboxUID:     *runnerSandboxUID,
+		}),
 	}
 
 	// Setup router
@@ -64,48 +130,176 @@ func main() {
 	router.Use(corsMiddleware)
 
 	// Public routes
-	router.HandleFunc("/api/login", handlers.Login).Methods("POST", "OPTIONS")
-	router.HandleFunc("/api/register", handlers.Register).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/login", RateLimit(handlers.Limiter, handlers.Login)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/register", RateLimit(handlers.Limiter, handlers.Register)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/login/2fa", RateLimit(handlers.Limiter, handlers.LoginTwoFactor)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/oidc/config", handlers.GetOIDCConfig).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/oidc/login", RateLimit(handlers.Limiter, handlers.OIDCLogin)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/oidc/callback", RateLimit(handlers.Limiter, handlers.OIDCCallback)).Methods("GET", "OPTIONS")
+	router.HandleFunc("/api/oidc/exchange", RateLimit(handlers.Limiter, handlers.OIDCExchange)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/token/refresh", handlers.RefreshToken).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/password/forgot", RateLimit(handlers.Limiter, handlers.ForgotPassword)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/password/reset", RateLimit(handlers.Limiter, handlers.ResetPassword)).Methods("POST", "OPTIONS")
+	router.HandleFunc("/api/email/verify", RateLimit(handlers.Limiter, handlers.VerifyEmail)).Methods("POST", "OPTIONS")
 
 	// Protected routes
 	api := router.PathPrefix("/api").Subrouter()
 	api.Use(AuthMiddleware(*jwtSecret, db))
 
+	// Session routes
+	api.HandleFunc("/logout", RequireUserSession(handlers.Logout)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/password/change", RequireUserSession(handlers.ChangePassword)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/email/verify/resend", RequireUserSession(handlers.ResendVerificationEmail)).Methods("POST", "OPTIONS")
+
+	// Two-factor authentication routes
+	api.HandleFunc("/2fa", RequireUserSession(handlers.GetTwoFactorStatus)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/2fa/setup", RequireUserSession(handlers.SetupTwoFactor)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/2fa/enable", RequireUserSession(handlers.EnableTwoFactor)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/2fa/disable", RequireUserSession(handlers.DisableTwoFactor)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/2fa/recovery-codes", RequireUserSession(handlers.RegenerateRecoveryCodes)).Methods("POST", "OPTIONS")
+
+	// API key routes
+	api.HandleFunc("/api-keys", RequireUserSession(handlers.GetAPIKeys)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/api-keys", RequireUserSession(handlers.CreateAPIKey)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/api-keys/{id}", RequireUserSession(handlers.RevokeAPIKey)).Methods("DELETE", "OPTIONS")
+
+	// Admin user management routes
+	api.HandleFunc("/admin/users", RequirePermission(db, PermUserManage, handlers.AdminGetUsers)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/admin/users/{id}", RequirePermission(db, PermUserManage, handlers.AdminGetUser)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/admin/users/{id}", RequirePermission(db, PermUserManage, handlers.AdminDeleteUser)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/admin/users/{id}/role", RequirePermission(db, PermUserManage, handlers.AdminUpdateUserRole)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/admin/users/{id}/disable", RequirePermission(db, PermUserManage, handlers.AdminDisableUser)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/admin/users/{id}/enable", RequirePermission(db, PermUserManage, handlers.AdminEnableUser)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/admin/users/{id}/reset-password", RequirePermission(db, PermUserManage, handlers.AdminResetUserPassword)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/admin/users/{id}/2fa/reset", RequirePermission(db, PermUserManage, handlers.AdminResetUserTwoFactor)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/admin/audit", RequirePermission(db, PermAuditRead, handlers.AdminGetAuditLog)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/admin/roles", RequirePermission(db, PermUserManage, handlers.AdminGetRoles)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/admin/roles/{role}/2fa", RequirePermission(db, PermUserManage, handlers.AdminSetRoleTwoFactor)).Methods("PUT", "OPTIONS")
+
+	// Workspace routes
+	api.HandleFunc("/workspaces", RequirePermission(db, PermContentRead, handlers.GetWorkspaces)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/workspaces", RequirePermission(db, PermWorkspaceManage, handlers.CreateWorkspace)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/workspaces/{id}/members", RequirePermission(db, PermContentRead, handlers.GetWorkspaceMembers)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/workspaces/{id}/members", RequirePermission(db, PermWorkspaceManage, handlers.InviteWorkspaceMember)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/workspaces/{id}/invites", RequirePermission(db, PermWorkspaceManage, handlers.GetWorkspaceInvites)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/workspaces/{id}/invites/{inviteId}", RequirePermission(db, PermWorkspaceManage, handlers.RevokeWorkspaceInvite)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/workspaces/{id}/members/{userId}", RequirePermission(db, PermWorkspaceManage, handlers.UpdateWorkspaceMember)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/workspaces/{id}/members/{userId}", RequirePermission(db, PermWorkspaceManage, handlers.RemoveWorkspaceMember)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/invites", RequirePermission(db, PermContentRead, handlers.GetMyInvites)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/invites/{id}/accept", RequirePermission(db, PermContentRead, handlers.AcceptInvite)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/invites/{id}", RequirePermission(db, PermContentRead, handlers.DeclineInvite)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/workspaces/{id}/switch", RequirePermission(db, PermContentRead, handlers.SwitchWorkspace)).Methods("POST", "OPTIONS")
+
 	// Category routes
-	api.HandleFunc("/categories", handlers.GetCategories).Methods("GET", "OPTIONS")
-	api.HandleFunc("/categories", handlers.CreateCategory).Methods("POST", "OPTIONS")
-	api.HandleFunc("/categories/{id}", handlers.UpdateCategory).Methods("PUT", "OPTIONS")
-	api.HandleFunc("/categories/{id}", handlers.DeleteCategory).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/categories", RequirePermission(db, PermContentRead, handlers.GetCategories)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/categories", RequirePermission(db, PermCategoryWrite, handlers.CreateCategory)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/categories/{id}", RequirePermission(db, PermCategoryWrite, handlers.UpdateCategory)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/categories/{id}", RequirePermission(db, PermCategoryWrite, handlers.DeleteCategory)).Methods("DELETE", "OPTIONS")
 
 	// Pattern routes
-	api.HandleFunc("/categories/{categoryId}/patterns", handlers.GetPatterns).Methods("GET", "OPTIONS")
-	api.HandleFunc("/categories/{categoryId}/patterns", handlers.CreatePattern).Methods("POST", "OPTIONS")
-	api.HandleFunc("/patterns/{id}", handlers.UpdatePattern).Methods("PUT", "OPTIONS")
-	api.HandleFunc("/patterns/{id}", handlers.DeletePattern).Methods("DELETE", "OPTIONS")
-	api.HandleFunc("/patterns/{id}/theory", handlers.UpdatePatternTheory).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/categories/{categoryId}/patterns", RequirePermission(db, PermContentRead, handlers.GetPatterns)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/categories/{categoryId}/patterns", RequirePermission(db, PermPatternWrite, handlers.CreatePattern)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/patterns/{id}", RequirePermission(db, PermPatternWrite, handlers.UpdatePattern)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/patterns/{id}", RequirePermission(db, PermPatternWrite, handlers.DeletePattern)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/patterns/{id}/theory", RequirePermission(db, PermPatternWrite, handlers.UpdatePatternTheory)).Methods("PUT", "OPTIONS")
+
+	// Languages solutions can be written in
+	api.HandleFunc("/languages", RequirePermission(db, PermContentRead, handlers.GetLanguages)).Methods("GET", "OPTIONS")
 
 	// Problem routes
-	api.HandleFunc("/patterns/{patternId}/problems", handlers.GetProblems).Methods("GET", "OPTIONS")
-	api.HandleFunc("/patterns/{patternId}/problems", handlers.CreateProblem).Methods("POST", "OPTIONS")
-	api.HandleFunc("/problems/{id}", handlers.GetProblem).Methods("GET", "OPTIONS")
-	api.HandleFunc("/problems/{id}", handlers.UpdateProblem).Methods("PUT", "OPTIONS")
-	api.HandleFunc("/problems/{id}", handlers.DeleteProblem).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/patterns/{patternId}/problems", RequirePermission(db, PermContentRead, handlers.GetProblems)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/patterns/{patternId}/problems", RequirePermission(db, PermProblemWrite, handlers.CreateProblem)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}", RequirePermission(db, PermContentRead, handlers.GetProblem)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}", RequirePermission(db, PermProblemWrite, handlers.UpdateProblem)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/problems/{id}", RequirePermission(db, PermProblemWrite, handlers.DeleteProblem)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/problems/{id}/solutions", RequirePermission(db, PermContentRead, handlers.GetProblemSolutions)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/solutions", RequirePermission(db, PermProblemWrite, handlers.CreateProblemSolution)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}/solutions/{language}", RequirePermission(db, PermContentRead, handlers.GetProblemSolution)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/solutions/{language}", RequirePermission(db, PermProblemWrite, handlers.UpdateProblemSolution)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/problems/{id}/solutions/{language}", RequirePermission(db, PermProblemWrite, handlers.DeleteProblemSolution)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/problems/{id}/solutions/{language}/run", RequirePermission(db, PermCodeRun, handlers.RunSolution)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}/solutions/{language}/judge", RequirePermission(db, PermCodeRun, handlers.JudgeSolution)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}/solutions/{language}/stress", RequirePermission(db, PermCodeRun, handlers.StressSolution)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}/solutions/{language}/benchmarks", RequirePermission(db, PermCodeRun, handlers.BenchmarkSolution)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}/benchmarks", RequirePermission(db, PermContentRead, handlers.GetBenchmarks)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/benchmarks/{benchmarkId}", RequirePermission(db, PermContentRead, handlers.GetBenchmark)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/checker", RequirePermission(db, PermContentRead, handlers.GetChecker)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/checker", RequirePermission(db, PermProblemWrite, handlers.UpdateChecker)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/problems/{id}/stress", RequirePermission(db, PermContentRead, handlers.GetStressConfig)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/stress", RequirePermission(db, PermProblemWrite, handlers.UpdateStressConfig)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/problems/{id}/stress", RequirePermission(db, PermProblemWrite, handlers.DeleteStressConfig)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/problems/{id}/approaches", RequirePermission(db, PermContentRead, handlers.GetApproaches)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/approaches", RequirePermission(db, PermProblemWrite, handlers.CreateApproach)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}/approaches/order", RequirePermission(db, PermProblemWrite, handlers.ReorderApproaches)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/problems/{id}/approaches/{approachId}", RequirePermission(db, PermProblemWrite, handlers.UpdateApproach)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/problems/{id}/approaches/{approachId}", RequirePermission(db, PermProblemWrite, handlers.DeleteApproach)).Methods("DELETE", "OPTIONS")
+	// Revision history of solutions, problem markdown fields, approach code and pattern theory
+	revisionRoutes := []struct {
+		path   string
+		target revisionTargetFunc
+		write  string
+	}{
+		{"/problems/{id}/solutions/{language}/revisions", handlers.solutionRevisionTarget, PermProblemWrite},
+		{"/problems/{id}/fields/{field}/revisions", handlers.problemRevisionTarget, PermProblemWrite},
+		{"/problems/{id}/approaches/{approachId}/solutions/{language}/revisions", handlers.approachRevisionTarget, PermProblemWrite},
+		{"/patterns/{id}/theory/revisions", handlers.patternRevisionTarget, PermPatternWrite},
+	}
+	for _, route := range revisionRoutes {
+		api.HandleFunc(route.path, RequirePermission(db, PermContentRead, handlers.ListRevisions(route.target))).Methods("GET", "OPTIONS")
+		api.HandleFunc(route.path+"/diff", RequirePermission(db, PermContentRead, handlers.DiffRevisions(route.target))).Methods("GET", "OPTIONS")
+		api.HandleFunc(route.path+"/{revision}", RequirePermission(db, PermContentRead, handlers.GetRevision(route.target))).Methods("GET", "OPTIONS")
+		api.HandleFunc(route.path+"/{revision}/restore", RequirePermission(db, route.write, handlers.RestoreRevision(route.target))).Methods("POST", "OPTIONS")
+	}
+	api.HandleFunc("/problems/{id}/test-cases", RequirePermission(db, PermContentRead, handlers.GetTestCases)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/test-cases", RequirePermission(db, PermProblemWrite, handlers.CreateTestCase)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}/test-cases/{caseId}", RequirePermission(db, PermProblemWrite, handlers.UpdateTestCase)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/problems/{id}/test-cases/{caseId}", RequirePermission(db, PermProblemWrite, handlers.DeleteTestCase)).Methods("DELETE", "OPTIONS")
+
+	// Progress routes - personal to the caller
+	api.HandleFunc("/problems/{id}/progress", RequirePermission(db, PermContentRead, handlers.GetProblemProgress)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/progress", RequirePermission(db, PermProgressWrite, handlers.UpdateProblemProgress)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/problems/{id}/progress/attempts", RequirePermission(db, PermProgressWrite, handlers.RecordProblemAttempt)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}/attempts", RequirePermission(db, PermContentRead, handlers.GetProblemAttempts)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/problems/{id}/attempts", RequirePermission(db, PermProgressWrite, handlers.CreateProblemAttempt)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/problems/{id}/attempts/{attemptId}", RequirePermission(db, PermProgressWrite, handlers.DeleteProblemAttempt)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/problems/{id}/review", RequirePermission(db, PermProgressWrite, handlers.ReviewProblem)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/review/due", RequirePermission(db, PermContentRead, handlers.GetDueReviews)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/stats", RequirePermission(db, PermContentRead, handlers.GetStats)).Methods("GET", "OPTIONS")
+
+	// Mock interviews
+	api.HandleFunc("/interviews", RequirePermission(db, PermContentRead, handlers.GetInterviews)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/interviews", RequirePermission(db, PermProgressWrite, handlers.CreateInterview)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/interviews/{id}", RequirePermission(db, PermContentRead, handlers.GetInterview)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/interviews/{id}/problems/{problemId}/submissions", RequirePermission(db, PermProgressWrite, handlers.SubmitInterviewAnswer)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/interviews/{id}/finish", RequirePermission(db, PermProgressWrite, handlers.FinishInterview)).Methods("POST", "OPTIONS")
+
+	// Problem lists and study plans - personal to the caller
+	api.HandleFunc("/lists", RequirePermission(db, PermContentRead, handlers.GetProblemLists)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/lists", RequirePermission(db, PermProgressWrite, handlers.CreateProblemList)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/lists/{id}", RequirePermission(db, PermContentRead, handlers.GetProblemList)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/lists/{id}", RequirePermission(db, PermProgressWrite, handlers.UpdateProblemList)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/lists/{id}", RequirePermission(db, PermProgressWrite, handlers.DeleteProblemList)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/lists/{id}/items", RequirePermission(db, PermProgressWrite, handlers.AddProblemListItem)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/lists/{id}/items/{problemId}", RequirePermission(db, PermProgressWrite, handlers.UpdateProblemListItem)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/lists/{id}/items/{problemId}", RequirePermission(db, PermProgressWrite, handlers.DeleteProblemListItem)).Methods("DELETE", "OPTIONS")
+	api.HandleFunc("/lists/{id}/order", RequirePermission(db, PermProgressWrite, handlers.ReorderProblemList)).Methods("PUT", "OPTIONS")
+	api.HandleFunc("/lists/{id}/clone", RequirePermission(db, PermProgressWrite, handlers.CloneProblemList)).Methods("POST", "OPTIONS")
 
 	// AI routes
-	api.HandleFunc("/ai/generate-problem", handlers.GenerateProblem).Methods("POST", "OPTIONS")
-	api.HandleFunc("/ai/generate-category-description", handlers.GenerateCategoryDescription).Methods("POST", "OPTIONS")
-	api.HandleFunc("/ai/generate-pattern-content", handlers.GeneratePatternContent).Methods("POST", "OPTIONS")
+	api.HandleFunc("/ai/generate-problem", RequirePermission(db, PermAIGenerate, handlers.GenerateProblem)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/ai/generate-category-description", RequirePermission(db, PermAIGenerate, handlers.GenerateCategoryDescription)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/ai/generate-pattern-content", RequirePermission(db, PermAIGenerate, handlers.GeneratePatternContent)).Methods("POST", "OPTIONS")
 
 	// External API routes
-	api.HandleFunc("/external/fetch-problem/{problemId}", handlers.FetchExternalProblem).Methods("GET", "OPTIONS")
-	api.HandleFunc("/external/fetch-all", handlers.FetchAllExternalData).Methods("POST", "OPTIONS")
-	api.HandleFunc("/external/clear-all", handlers.ClearAllData).Methods("POST", "OPTIONS")
+	api.HandleFunc("/external/fetch-problem/{problemId}", RequirePermission(db, PermExternalImport, handlers.FetchExternalProblem)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/external/fetch-all", RequirePermission(db, PermExternalImport, handlers.FetchAllExternalData)).Methods("POST", "OPTIONS")
+	api.HandleFunc("/external/clear-all", RequirePermission(db, PermDataClear, handlers.ClearAllData)).Methods("POST", "OPTIONS")
 
 	// Learning routes
-	api.HandleFunc("/learning/topics", handlers.GetLearningTopics).Methods("GET", "OPTIONS")
-	api.HandleFunc("/learning/topics/{slug}", handlers.GetLearningTopicBySlug).Methods("GET", "OPTIONS")
-	api.HandleFunc("/learning/topics/{topicId}/resources", handlers.GetLearningResources).Methods("GET", "OPTIONS")
-	api.HandleFunc("/learning/topics/{topicId}/roadmap", handlers.GetRoadmap).Methods("GET", "OPTIONS")
+	api.HandleFunc("/learning/topics", RequirePermission(db, PermContentRead, handlers.GetLearningTopics)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/learning/topics/{slug}", RequirePermission(db, PermContentRead, handlers.GetLearningTopicBySlug)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/learning/topics/{topicId}/resources", RequirePermission(db, PermContentRead, handlers.GetLearningResources)).Methods("GET", "OPTIONS")
+	api.HandleFunc("/learning/topics/{topicId}/roadmap", RequirePermission(db, PermContentRead, handlers.GetRoadmap)).Methods("GET", "OPTIONS")
 
 	// Health check - returns OK immediately so Render can detect the port
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -115,36 +309,6 @@ func main() {
 		w.Write([]byte("OK"))
 	}).Methods("GET")
 
-	// Debug endpoint to check if user exists (remove in production)
-	router.HandleFunc("/api/debug/user-exists", func(w http.ResponseWriter, r *http.Request) {
-		email := r.URL.Query().Get("email")
-		if email == "" {
-			respondWithError(w, http.StatusBadRequest, "Email parameter required")
-			return
-		}
-
-		var userID string
-		var storedEmail string
-		err := db.DB.QueryRow("SELECT id, email FROM users WHERE email = ? OR LOWER(email) = LOWER(?)", email, email).Scan(&userID, &storedEmail)
-		if err == sql.ErrNoRows {
-			respondWithJSON(w, http.StatusOK, map[string]interface{}{
-				"exists":  false,
-				"message": "User not found",
-			})
-			return
-		}
-		if err != nil {
-			respondWithError(w, http.StatusInternalServerError, "Database error: "+err.Error())
-			return
-		}
-
-		respondWithJSON(w, http.StatusOK, map[string]interface{}{
-			"exists": true,
-			"id":     userID,
-			"email":  storedEmail,
-		})
-	}).Methods("GET", "OPTIONS")
-
 	// Start server
 	addr := fmt.Sprintf("0.0.0.0:%s", *port)
 	log.Printf("Starting HTTP server on %s", addr)
@@ -159,7 +323,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 		// Set CORS headers for all requests
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Max-Age", "3600")
 
@@ -180,3 +344,11 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt gets an integer environment variable or returns default
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -13,8 +14,12 @@ type contextKey string
 
 const userIDKey contextKey = "userID"
 const roleKey contextKey = "role"
+const accessTokenIDKey contextKey = "accessTokenID"
+const emailVerifiedKey contextKey = "emailVerified"
+const twoFactorMissingKey contextKey = "twoFactorMissing"
+const apiKeyScopesKey contextKey = "apiKeyScopes"
 
-// AuthMiddleware validates JWT tokens and adds user ID to context
+// AuthMiddleware validates JWT access tokens or API keys and adds user ID to context
 func AuthMiddleware(jwtSecret string, db *Database) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -28,64 +33,138 @@ func AuthMiddleware(jwtSecret string, db *Database) func(http.Handler) http.Hand
 			}
 
 			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				respondWithError(w, http.StatusUnauthorized, "Authorization header required")
-				return
-			}
 
-			// Extract token from "Bearer <token>"
-			parts := strings.Split(authHeader, " ")
-			if len(parts) != 2 || parts[0] != "Bearer" {
-				respondWithError(w, http.StatusUnauthorized, "Invalid authorization header format")
-				return
+			// API keys come in X-API-Key or as a Bearer token with the av_ prefix
+			apiKey := r.Header.Get("X-API-Key")
+			if apiKey == "" && strings.HasPrefix(authHeader, "Bearer "+apiKeyPrefix) {
+				apiKey = strings.TrimPrefix(authHeader, "Bearer ")
 			}
 
-			tokenString := parts[1]
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, jwt.ErrSignatureInvalid
+			var userID string
+			var claims jwt.MapClaims
+			var apiKeyScopes []string
+			if apiKey != "" {
+				key, err := db.authenticateAPIKey(apiKey)
+				if err != nil {
+					respondWithError(w, http.StatusInternalServerError, "Error checking API key")
+					return
+				}
+				if key == nil {
+					respondWithError(w, http.StatusUnauthorized, "Invalid or expired API key")
+					return
+				}
+				userID = key.UserID
+				apiKeyScopes = key.Scopes
+			} else {
+				if authHeader == "" {
+					respondWithError(w, http.StatusUnauthorized, "Authorization header required")
+					return
+				}
+
+				// Extract token from "Bearer <token>"
+				parts := strings.Split(authHeader, " ")
+				if len(parts) != 2 || parts[0] != "Bearer" {
+					respondWithError(w, http.StatusUnauthorized, "Invalid authorization header format")
+					return
 				}
-				return []byte(jwtSecret), nil
-			})
 
-			if err != nil || !token.Valid {
-				respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
-				return
+				tokenString := parts[1]
+				token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+					if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+						return nil, jwt.ErrSignatureInvalid
+					}
+					return []byte(jwtSecret), nil
+				})
+
+				if err != nil || !token.Valid {
+					respondWithError(w, http.StatusUnauthorized, "Invalid or expired token")
+					return
+				}
+
+				var ok bool
+				claims, ok = token.Claims.(jwt.MapClaims)
+				if !ok {
+					respondWithError(w, http.StatusUnauthorized, "Invalid token claims")
+					return
+				}
+
+				userID, ok = claims["userID"].(string)
+				if !ok {
+					respondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+					return
+				}
+
+				// Only access tokens may be used here; refresh tokens are opaque and never JWTs
+				if typ, _ := claims["typ"].(string); typ != "access" {
+					respondWithError(w, http.StatusUnauthorized, "Invalid token type")
+					return
+				}
 			}
 
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok {
-				respondWithError(w, http.StatusUnauthorized, "Invalid token claims")
+			// Access tokens carry an ID so a single one can be revoked at logout
+			tokenID, _ := claims["jti"].(string)
+
+			// Always read the role from the database so role changes apply immediately
+			var userRole string
+			var tokenVersion, mustChangePassword int
+			var disabledAt, emailVerifiedAt sql.NullTime
+			var tokenRevoked, twoFactorMissing bool
+			query := db.convertPlaceholders(`
+				SELECT COALESCE(u.role, ''), u.token_version, u.disabled_at, u.must_change_password, u.email_verified_at,
+					COALESCE(p.require_2fa, 0) = 1 AND u.totp_enabled_at IS NULL,
+					EXISTS(SELECT 1 FROM revoked_access_tokens WHERE jti = ?)
+				FROM users u
+				LEFT JOIN role_policies p ON p.role = u.role
+				WHERE u.id = ?
+			`)
+			if err := db.DB.QueryRow(query, tokenID, userID).Scan(&userRole, &tokenVersion, &disabledAt, &mustChangePassword, &emailVerifiedAt, &twoFactorMissing, &tokenRevoked); err != nil {
+				respondWithError(w, http.StatusUnauthorized, "User not found")
 				return
 			}
 
-			userID, ok := claims["userID"].(string)
-			if !ok {
-				respondWithError(w, http.StatusUnauthorized, "Invalid user ID in token")
+			if disabledAt.Valid {
+				respondWithError(w, http.StatusUnauthorized, "Account is disabled")
 				return
 			}
 
-			// Get user role from claims (if available) or fetch from database
-			userRole, _ := claims["role"].(string)
-			if userRole == "" {
-				// Fetch role from database
-				var role string
-				err := db.DB.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&role)
-				if err == nil {
-					userRole = role
-				} else {
-					userRole = "admin" // Default to admin if not found
+			// Tokens issued before the last revocation carry an older version.
+			// API keys are revoked individually instead.
+			if claims != nil {
+				if tv, ok := claims["tv"].(float64); !ok || int(tv) != tokenVersion || tokenRevoked {
+					respondWithError(w, http.StatusUnauthorized, "Token has been revoked")
+					return
 				}
 			}
 
-			// Add user ID and role to context
+			// After an admin-forced reset the user may only set a new password
+			if mustChangePassword == 1 && r.URL.Path != "/api/password/change" && r.URL.Path != "/api/logout" {
+				respondWithError(w, http.StatusForbidden, "Password change required")
+				return
+			}
+
+			// Add user ID, role and verification state to context
 			ctx := context.WithValue(r.Context(), userIDKey, userID)
-			ctx = context.WithValue(ctx, contextKey("role"), userRole)
+			ctx = context.WithValue(ctx, roleKey, userRole)
+			if tokenID != "" {
+				ctx = context.WithValue(ctx, accessTokenIDKey, tokenID)
+			}
+			ctx = context.WithValue(ctx, emailVerifiedKey, emailVerifiedAt.Valid)
+			ctx = context.WithValue(ctx, twoFactorMissingKey, twoFactorMissing)
+			if apiKeyScopes != nil {
+				ctx = context.WithValue(ctx, apiKeyScopesKey, apiKeyScopes)
+			}
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// getAccessTokenID returns the ID of the access token a request was made
+// with, or "" for API keys and tokens issued without one
+func getAccessTokenID(r *http.Request) string {
+	tokenID, _ := r.Context().Value(accessTokenIDKey).(string)
+	return tokenID
+}
+
 // getUserID extracts user ID from context
 func getUserID(r *http.Request) string {
 	userID, ok := r.Context().Value(userIDKey).(string)
@@ -95,18 +174,45 @@ func getUserID(r *http.Request) string {
 	return userID
 }
 
-// getUserRole extracts user role from context
+// getUserRole extracts user role from context.
+// Returns "" when no role is known, which grants no permissions.
 func getUserRole(r *http.Request) string {
 	role, ok := r.Context().Value(roleKey).(string)
 	if !ok {
-		return "admin" // Default to admin
+		return ""
 	}
 	return role
 }
 
-// isDemoUser checks if the current user is a demo user
-func isDemoUser(r *http.Request) bool {
-	return getUserRole(r) == "demo"
+// isEmailVerified reports whether the authenticated user has verified their email
+func isEmailVerified(r *http.Request) bool {
+	verified, _ := r.Context().Value(emailVerifiedKey).(bool)
+	return verified
+}
+
+// isTwoFactorMissing reports whether the user's role requires 2FA they have not enrolled
+func isTwoFactorMissing(r *http.Request) bool {
+	missing, _ := r.Context().Value(twoFactorMissingKey).(bool)
+	return missing
+}
+
+// getAPIKeyScopes returns the scopes of the API key used for the request.
+// ok is false when the request was authenticated with a JWT.
+func getAPIKeyScopes(r *http.Request) (scopes []string, ok bool) {
+	scopes, ok = r.Context().Value(apiKeyScopesKey).([]string)
+	return scopes, ok
+}
+
+// RequireUserSession rejects requests authenticated with an API key. It guards
+// account management routes that a leaked key must not be able to use.
+func RequireUserSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := getAPIKeyScopes(r); ok {
+			respondWithError(w, http.StatusForbidden, "This endpoint cannot be used with an API key")
+			return
+		}
+		next(w, r)
+	}
 }
 
 // respondWithError sends a JSON error response
@@ -136,6 +242,6 @@ func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 func setCORSHeaders(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 	w.Header().Set("Access-Control-Allow-Credentials", "true")
 }
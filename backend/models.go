@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
@@ -14,21 +15,51 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID        string    `json:"id"`
-	Email     string    `json:"email"`
-	Name      string    `json:"name"`
-	Password  string    `json:"-"`    // Never return password in JSON
-	Role      string    `json:"role"` // "admin" or "demo"
-	CreatedAt time.Time `json:"createdAt"`
+	ID                 string     `json:"id"`
+	Email              string     `json:"email"`
+	Name               string     `json:"name"`
+	Password           string     `json:"-"`    // Never return password in JSON
+	Role               string     `json:"role"` // "admin", "user" or "demo"
+	DisabledAt         *time.Time `json:"disabledAt,omitempty"`
+	EmailVerifiedAt    *time.Time `json:"emailVerifiedAt,omitempty"`
+	TwoFactorEnabled   bool       `json:"twoFactorEnabled"`
+	MustChangePassword bool       `json:"mustChangePassword"`
+	CreatedAt          time.Time  `json:"createdAt"`
+}
+
+// Workspace owns a set of categories, patterns, problems and learning topics
+type Workspace struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	OwnerID    string    `json:"ownerId"`
+	IsPersonal bool      `json:"isPersonal"`
+	Role       string    `json:"role,omitempty"` // Caller's role: owner, editor or viewer
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// WorkspaceMember represents a user's membership in a workspace
+type WorkspaceMember struct {
+	WorkspaceID string    `json:"workspaceId"`
+	UserID      string    `json:"userId"`
+	Email       string    `json:"email"`
+	Name        string    `json:"name"`
+	Role        string    `json:"role"` // owner, editor, viewer
+	CreatedAt   time.Time `json:"createdAt"`
 }
 
 // Category represents a problem category
 type Category struct {
 	ID           string    `json:"id"`
+	WorkspaceID  string    `json:"workspaceId"`
+	OwnerID      string    `json:"ownerId"` // User who created the category
 	Name         string    `json:"name"`
 	Icon         string    `json:"icon"`
 	Description  string    `json:"description"`
 	PatternCount int       `json:"patternCount"`
+	ProblemCount int       `json:"problemCount"`
+	SolvedCount  int       `json:"solvedCount"` // Problems the caller has solved or mastered
 	CreatedAt    time.Time `json:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt"`
 }
@@ -36,48 +67,61 @@ type Category struct {
 // Pattern represents a problem pattern under a category
 type Pattern struct {
 	ID           string    `json:"id"`
+	WorkspaceID  string    `json:"workspaceId"`
+	OwnerID      string    `json:"ownerId"` // User who created the pattern
 	CategoryID   string    `json:"categoryId"`
 	Name         string    `json:"name"`
 	Icon         string    `json:"icon"`
 	Description  string    `json:"description"`
 	Theory       string    `json:"theory"` // Markdown content
 	ProblemCount int       `json:"problemCount"`
+	SolvedCount  int       `json:"solvedCount"` // Problems the caller has solved or mastered
 	CreatedAt    time.Time `json:"createdAt"`
 	UpdatedAt    time.Time `json:"updatedAt"`
 }
 
 // Solution represents a solution in a specific language
 type Solution struct {
-	ID        string    `json:"id"`
-	ProblemID string    `json:"problemId"`
-	Language  string    `json:"language"` // cpp, go, python, java, javascript
-	Code      string    `json:"code"`
-	CreatedAt time.Time `json:"createdAt"`
-	UpdatedAt time.Time `json:"updatedAt"`
+	ID        string `json:"id"`
+	ProblemID string `json:"problemId"`
+	Language  string `json:"language"` // cpp, go, python, java, javascript
+	Code      string `json:"code"`
+	// Complexities fitted by the latest benchmark of this code, such as O(n log n)
+	MeasuredTimeComplexity  string     `json:"measuredTimeComplexity,omitempty"`
+	MeasuredSpaceComplexity string     `json:"measuredSpaceComplexity,omitempty"`
+	BenchmarkedAt           *time.Time `json:"benchmarkedAt,omitempty"`
+	CreatedAt               time.Time  `json:"createdAt"`
+	UpdatedAt               time.Time  `json:"updatedAt"`
 }
 
 // Problem represents a coding problem
 type Problem struct {
-	ID           string     `json:"id"`
-	PatternID    string     `json:"patternId"`
-	Title        string     `json:"title"`
-	Difficulty   string     `json:"difficulty"`   // Easy, Medium, Hard
-	Description  string     `json:"description"`  // Markdown
-	Input        string     `json:"input"`        // Markdown
-	Output       string     `json:"output"`       // Markdown
-	Constraints  string     `json:"constraints"`  // Markdown
-	SampleInput  string     `json:"sampleInput"`  // Markdown
-	SampleOutput string     `json:"sampleOutput"` // Markdown
-	Explanation  string     `json:"explanation"`  // Markdown
-	Notes        string     `json:"notes"`        // Markdown
-	Solutions    []Solution `json:"solutions"`
-	CreatedAt    time.Time  `json:"createdAt"`
-	UpdatedAt    time.Time  `json:"updatedAt"`
+	ID           string           `json:"id"`
+	WorkspaceID  string           `json:"workspaceId"`
+	OwnerID      string           `json:"ownerId"` // User who created the problem
+	PatternID    string           `json:"patternId"`
+	Title        string           `json:"title"`
+	Difficulty   string           `json:"difficulty"`   // Easy, Medium, Hard
+	Description  string           `json:"description"`  // Markdown
+	Input        string           `json:"input"`        // Markdown
+	Output       string           `json:"output"`       // Markdown
+	Constraints  string           `json:"constraints"`  // Markdown
+	SampleInput  string           `json:"sampleInput"`  // Markdown
+	SampleOutput string           `json:"sampleOutput"` // Markdown
+	Explanation  string           `json:"explanation"`  // Markdown
+	Notes        string           `json:"notes"`        // Markdown
+	Solutions    []Solution       `json:"solutions"`
+	Approaches   []Approach       `json:"approaches"`
+	TestCases    []TestCase       `json:"testCases,omitempty"` // Only set when creating a problem
+	Progress     *ProblemProgress `json:"progress,omitempty"`  // The caller's progress, when listed for a user
+	CreatedAt    time.Time        `json:"createdAt"`
+	UpdatedAt    time.Time        `json:"updatedAt"`
 }
 
 // LearningTopic represents a learning category (e.g., LLD, HLD)
 type LearningTopic struct {
 	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspaceId"` // Empty for topics shared with every workspace
 	Name        string    `json:"name"`
 	Icon        string    `json:"icon"`
 	Description string    `json:"description"`
@@ -137,7 +181,7 @@ func NewDatabase(dbPath string) (*Database, error) {
 		db.SetMaxIdleConns(5)
 	} else {
 		// Use SQLite with WAL mode and busy timeout
-		db, err = sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+		db, err = sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on")
 		isPostgres = false
 		if err != nil {
 			return nil, fmt.Errorf("failed to open SQLite connection: %v", err)
@@ -162,10 +206,18 @@ func NewDatabase(dbPath string) (*Database, error) {
 		return nil, fmt.Errorf("failed to run migrations: %v", err)
 	}
 
+	// Seed the default role permissions
+	if err := database.seedRolePermissions(); err != nil {
+		return nil, fmt.Errorf("failed to seed role permissions: %v", err)
+	}
+
 	// Create demo user if it doesn't exist
 	if err := database.createDemoUser(); err != nil {
 		return nil, fmt.Errorf("failed to create demo user: %v", err)
 	}
+	if err := database.ensureDemoWorkspace(); err != nil {
+		return nil, fmt.Errorf("failed to create demo workspace: %v", err)
+	}
 
 	// Seed initial learning data
 	if err := database.seedLearningData(); err != nil {
@@ -178,11 +230,13 @@ func NewDatabase(dbPath string) (*Database, error) {
 // InitSchema creates all necessary tables
 // Supports both SQLite and PostgreSQL
 func (d *Database) InitSchema(isPostgres bool) error {
-	var timestampType string
+	var timestampType, nullableTimestampType string
 	if isPostgres {
 		timestampType = "TIMESTAMP DEFAULT CURRENT_TIMESTAMP"
+		nullableTimestampType = "TIMESTAMP"
 	} else {
 		timestampType = "DATETIME DEFAULT CURRENT_TIMESTAMP"
+		nullableTimestampType = "DATETIME"
 	}
 
 	queries := []string{
@@ -191,11 +245,119 @@ func (d *Database) InitSchema(isPostgres bool) error {
 			email TEXT UNIQUE NOT NULL,
 			name TEXT NOT NULL,
 			password TEXT NOT NULL,
-			role TEXT NOT NULL DEFAULT 'admin',
+			role TEXT NOT NULL DEFAULT '',
+			active_workspace_id TEXT NOT NULL DEFAULT '',
+			token_version INTEGER NOT NULL DEFAULT 0,
+			disabled_at ` + nullableTimestampType + `,
+			must_change_password INTEGER NOT NULL DEFAULT 0,
+			email_verified_at ` + nullableTimestampType + `,
+			totp_secret TEXT NOT NULL DEFAULT '',
+			totp_enabled_at ` + nullableTimestampType + `,
+			totp_last_step INTEGER NOT NULL DEFAULT 0,
+			created_at ` + timestampType + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS recovery_codes (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			code_hash TEXT NOT NULL,
+			used_at ` + nullableTimestampType + `,
 			created_at ` + timestampType + `
 		)`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			prefix TEXT NOT NULL,
+			key_hash TEXT UNIQUE NOT NULL,
+			scopes TEXT NOT NULL DEFAULT '',
+			expires_at ` + nullableTimestampType + `,
+			last_used_at ` + nullableTimestampType + `,
+			revoked_at ` + nullableTimestampType + `,
+			created_at ` + timestampType + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS oidc_states (
+			state TEXT PRIMARY KEY,
+			code_verifier TEXT NOT NULL,
+			nonce TEXT NOT NULL,
+			expires_at ` + nullableTimestampType + ` NOT NULL,
+			created_at ` + timestampType + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_identities (
+			issuer TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			email TEXT NOT NULL DEFAULT '',
+			created_at ` + timestampType + `,
+			PRIMARY KEY (issuer, subject)
+		)`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id TEXT PRIMARY KEY,
+			actor_id TEXT NOT NULL DEFAULT '',
+			actor_email TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL DEFAULT '',
+			target_id TEXT NOT NULL DEFAULT '',
+			workspace_id TEXT NOT NULL DEFAULT '',
+			changes TEXT NOT NULL DEFAULT '{}',
+			created_at ` + timestampType + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS role_policies (
+			role TEXT PRIMARY KEY,
+			require_2fa INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE TABLE IF NOT EXISTS user_tokens (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			purpose TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			expires_at ` + nullableTimestampType + ` NOT NULL,
+			used_at ` + nullableTimestampType + `,
+			created_at ` + timestampType + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS refresh_tokens (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			expires_at ` + nullableTimestampType + ` NOT NULL,
+			revoked_at ` + nullableTimestampType + `,
+			created_at ` + timestampType + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS role_permissions (
+			role TEXT NOT NULL,
+			permission TEXT NOT NULL,
+			PRIMARY KEY (role, permission)
+		)`,
+		`CREATE TABLE IF NOT EXISTS workspaces (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			owner_id TEXT NOT NULL,
+			is_personal INTEGER NOT NULL DEFAULT 0,
+			created_at ` + timestampType + `,
+			updated_at ` + timestampType + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS workspace_members (
+			workspace_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			role TEXT NOT NULL,
+			created_at ` + timestampType + `,
+			PRIMARY KEY (workspace_id, user_id),
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS workspace_invites (
+			id TEXT PRIMARY KEY,
+			workspace_id TEXT NOT NULL,
+			email TEXT NOT NULL,
+			role TEXT NOT NULL,
+			invited_by TEXT NOT NULL,
+			created_at ` + timestampType + `,
+			UNIQUE(workspace_id, email),
+			FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE
+		)`,
 		`CREATE TABLE IF NOT EXISTS categories (
 			id TEXT PRIMARY KEY,
+			workspace_id TEXT NOT NULL DEFAULT '',
+			owner_id TEXT NOT NULL DEFAULT '',
 			name TEXT NOT NULL,
 			icon TEXT NOT NULL,
 			description TEXT NOT NULL,
@@ -204,6 +366,8 @@ func (d *Database) InitSchema(isPostgres bool) error {
 		)`,
 		`CREATE TABLE IF NOT EXISTS patterns (
 			id TEXT PRIMARY KEY,
+			workspace_id TEXT NOT NULL DEFAULT '',
+			owner_id TEXT NOT NULL DEFAULT '',
 			category_id TEXT NOT NULL,
 			name TEXT NOT NULL,
 			icon TEXT NOT NULL,
@@ -215,6 +379,8 @@ func (d *Database) InitSchema(isPostgres bool) error {
 		)`,
 		`CREATE TABLE IF NOT EXISTS problems (
 			id TEXT PRIMARY KEY,
+			workspace_id TEXT NOT NULL DEFAULT '',
+			owner_id TEXT NOT NULL DEFAULT '',
 			pattern_id TEXT NOT NULL,
 			title TEXT NOT NULL,
 			difficulty TEXT NOT NULL,
@@ -235,13 +401,184 @@ func (d *Database) InitSchema(isPostgres bool) error {
 			problem_id TEXT NOT NULL,
 			language TEXT NOT NULL,
 			code TEXT NOT NULL,
+			measured_time_complexity TEXT NOT NULL DEFAULT '',
+			measured_space_complexity TEXT NOT NULL DEFAULT '',
+			benchmarked_at ` + nullableTimestampType + `,
 			created_at ` + timestampType + `,
 			updated_at ` + timestampType + `,
 			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE,
 			UNIQUE(problem_id, language)
 		)`,
+		`CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+			jti TEXT PRIMARY KEY,
+			expires_at ` + nullableTimestampType + ` NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS problem_progress (
+			user_id TEXT NOT NULL,
+			problem_id TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'unsolved',
+			attempt_count INTEGER NOT NULL DEFAULT 0,
+			confidence INTEGER NOT NULL DEFAULT 0,
+			first_solved_at ` + nullableTimestampType + `,
+			last_solved_at ` + nullableTimestampType + `,
+			ease_factor REAL NOT NULL DEFAULT 2.5,
+			interval_days INTEGER NOT NULL DEFAULT 0,
+			repetitions INTEGER NOT NULL DEFAULT 0,
+			due_at ` + nullableTimestampType + `,
+			last_reviewed_at ` + nullableTimestampType + `,
+			updated_at ` + timestampType + `,
+			PRIMARY KEY (user_id, problem_id),
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS problem_attempts (
+			id TEXT PRIMARY KEY,
+			problem_id TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			language TEXT NOT NULL DEFAULT '',
+			code TEXT NOT NULL DEFAULT '',
+			outcome TEXT NOT NULL,
+			reflection TEXT NOT NULL DEFAULT '',
+			started_at ` + nullableTimestampType + ` NOT NULL,
+			ended_at ` + nullableTimestampType + ` NOT NULL,
+			duration_seconds INTEGER NOT NULL DEFAULT 0,
+			created_at ` + timestampType + `,
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS interview_sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			workspace_id TEXT NOT NULL,
+			duration_minutes INTEGER NOT NULL,
+			started_at ` + nullableTimestampType + ` NOT NULL,
+			ends_at ` + nullableTimestampType + ` NOT NULL,
+			finished_at ` + nullableTimestampType + `,
+			created_at ` + timestampType + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS interview_problems (
+			session_id TEXT NOT NULL,
+			problem_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			PRIMARY KEY (session_id, problem_id),
+			FOREIGN KEY (session_id) REFERENCES interview_sessions(id) ON DELETE CASCADE,
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS interview_submissions (
+			id TEXT PRIMARY KEY,
+			session_id TEXT NOT NULL,
+			problem_id TEXT NOT NULL,
+			language TEXT NOT NULL DEFAULT '',
+			code TEXT NOT NULL DEFAULT '',
+			outcome TEXT NOT NULL,
+			elapsed_seconds INTEGER NOT NULL DEFAULT 0,
+			submitted_at ` + nullableTimestampType + ` NOT NULL,
+			FOREIGN KEY (session_id) REFERENCES interview_sessions(id) ON DELETE CASCADE,
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS problem_lists (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			workspace_id TEXT NOT NULL,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			start_date TEXT,
+			created_at ` + timestampType + `,
+			updated_at ` + timestampType + `
+		)`,
+		`CREATE TABLE IF NOT EXISTS problem_list_items (
+			list_id TEXT NOT NULL,
+			problem_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			day INTEGER,
+			added_at ` + timestampType + `,
+			PRIMARY KEY (list_id, problem_id),
+			FOREIGN KEY (list_id) REFERENCES problem_lists(id) ON DELETE CASCADE,
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS test_cases (
+			id TEXT PRIMARY KEY,
+			problem_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			input TEXT NOT NULL,
+			expected_output TEXT NOT NULL,
+			hidden INTEGER NOT NULL DEFAULT 0,
+			explanation TEXT NOT NULL DEFAULT '',
+			created_at ` + timestampType + `,
+			updated_at ` + timestampType + `,
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS problem_checkers (
+			problem_id TEXT PRIMARY KEY,
+			mode TEXT NOT NULL,
+			epsilon REAL NOT NULL DEFAULT 0,
+			language TEXT NOT NULL DEFAULT '',
+			code TEXT NOT NULL DEFAULT '',
+			updated_at ` + timestampType + `,
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS problem_stress_configs (
+			problem_id TEXT PRIMARY KEY,
+			generator_language TEXT NOT NULL,
+			generator_code TEXT NOT NULL,
+			brute_force_language TEXT NOT NULL,
+			brute_force_code TEXT NOT NULL,
+			updated_at ` + timestampType + `,
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS solution_benchmarks (
+			id TEXT PRIMARY KEY,
+			problem_id TEXT NOT NULL,
+			language TEXT NOT NULL,
+			user_id TEXT NOT NULL,
+			status TEXT NOT NULL,
+			min_size INTEGER NOT NULL,
+			max_size INTEGER NOT NULL,
+			repeats INTEGER NOT NULL,
+			points TEXT NOT NULL DEFAULT '[]',
+			time_complexity TEXT NOT NULL DEFAULT '',
+			space_complexity TEXT NOT NULL DEFAULT '',
+			error TEXT NOT NULL DEFAULT '',
+			started_at ` + nullableTimestampType + ` NOT NULL,
+			finished_at ` + nullableTimestampType + `,
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS problem_approaches (
+			id TEXT PRIMARY KEY,
+			problem_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			intuition TEXT NOT NULL DEFAULT '',
+			time_complexity TEXT NOT NULL DEFAULT '',
+			space_complexity TEXT NOT NULL DEFAULT '',
+			created_at ` + timestampType + `,
+			updated_at ` + timestampType + `,
+			FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS approach_solutions (
+			id TEXT PRIMARY KEY,
+			approach_id TEXT NOT NULL,
+			language TEXT NOT NULL,
+			code TEXT NOT NULL,
+			created_at ` + timestampType + `,
+			updated_at ` + timestampType + `,
+			FOREIGN KEY (approach_id) REFERENCES problem_approaches(id) ON DELETE CASCADE,
+			UNIQUE(approach_id, language)
+		)`,
+		`CREATE TABLE IF NOT EXISTS revisions (
+			id TEXT PRIMARY KEY,
+			workspace_id TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			field TEXT NOT NULL,
+			number INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			author_id TEXT NOT NULL DEFAULT '',
+			restored_from INTEGER NOT NULL DEFAULT 0,
+			created_at ` + timestampType + `,
+			UNIQUE(target_type, target_id, field, number)
+		)`,
 		`CREATE TABLE IF NOT EXISTS learning_topics (
 			id TEXT PRIMARY KEY,
+			workspace_id TEXT NOT NULL DEFAULT '',
 			name TEXT NOT NULL,
 			icon TEXT NOT NULL,
 			description TEXT NOT NULL,
@@ -277,6 +614,49 @@ func (d *Database) InitSchema(isPostgres bool) error {
 		`CREATE INDEX IF NOT EXISTS idx_solutions_problem_id ON solutions(problem_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_learning_resources_topic_id ON learning_resources(topic_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_roadmap_items_topic_id ON roadmap_items(topic_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON workspace_members(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_workspace_invites_email ON workspace_invites(email)`,
+		`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users(LOWER(email))`,
+		`CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_problem_progress_problem_id ON problem_progress(problem_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_problem_attempts_problem_user ON problem_attempts(problem_id, user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_problem_attempts_user_started ON problem_attempts(user_id, started_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_interview_sessions_user ON interview_sessions(user_id, workspace_id, started_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_interview_submissions_session ON interview_submissions(session_id, submitted_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_problem_lists_user ON problem_lists(user_id, workspace_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_problem_list_items_problem_id ON problem_list_items(problem_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_test_cases_problem_id ON test_cases(problem_id, position)`,
+		`CREATE INDEX IF NOT EXISTS idx_solution_benchmarks_problem ON solution_benchmarks(problem_id, language, started_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_problem_approaches_problem_id ON problem_approaches(problem_id, position)`,
+		`CREATE INDEX IF NOT EXISTS idx_revisions_workspace_id ON revisions(workspace_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_actor_id ON audit_log(actor_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id)`,
+	}
+
+	// The audit log is append-only, even for code with direct database access
+	if isPostgres {
+		queries = append(queries,
+			`CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+			BEGIN
+				RAISE EXCEPTION 'audit_log is append-only';
+			END;
+			$$ LANGUAGE plpgsql`,
+			`DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log`,
+			`CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE ON audit_log
+			FOR EACH ROW EXECUTE PROCEDURE audit_log_append_only()`,
+		)
+	} else {
+		queries = append(queries,
+			`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+			`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+			BEGIN SELECT RAISE(ABORT, 'audit_log is append-only'); END`,
+		)
 	}
 
 	for _, query := range queries {
@@ -291,103 +671,453 @@ func (d *Database) InitSchema(isPostgres bool) error {
 // migrate runs database migrations for existing databases
 func (d *Database) migrate(isPostgres bool) error {
 	// Check if role column exists
-	var columnExists bool
-	var err error
+	columnExists, err := d.columnExists("users", "role")
+	if err != nil {
+		return err
+	}
 
-	if isPostgres {
-		// PostgreSQL: Check if column exists
-		err = d.DB.QueryRow(`
-			SELECT EXISTS (
-				SELECT 1 FROM information_schema.columns 
-				WHERE table_name = 'users' AND column_name = 'role'
-			)
-		`).Scan(&columnExists)
-	} else {
-		// SQLite: Use PRAGMA
-		rows, err := d.DB.Query("PRAGMA table_info(users)")
+	if !columnExists {
+		// Column doesn't exist, add it
+		_, err = d.DB.Exec(`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT ''`)
 		if err != nil {
 			return err
 		}
-		defer rows.Close()
 
-		columnExists = false
-		for rows.Next() {
-			var cid int
-			var name, dataType string
-			var notNull int
-			var defaultValue sql.NullString
-			var pk int
+		// Accounts from before roles existed could do everything
+		_, err = d.DB.Exec(`UPDATE users SET role = 'admin' WHERE role = ''`)
+		if err != nil {
+			return err
+		}
+	}
 
-			if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
-				return err
-			}
+	// Registration used to store emails as typed. Normalize them unless that
+	// would collide with another account, which an admin has to resolve.
+	if _, err := d.DB.Exec(`
+		UPDATE users SET email = LOWER(TRIM(email))
+		WHERE email <> LOWER(TRIM(email)) AND NOT EXISTS (
+			SELECT 1 FROM users other WHERE other.id <> users.id AND LOWER(TRIM(other.email)) = LOWER(TRIM(users.email))
+		)
+	`); err != nil {
+		return err
+	}
 
-			if name == "role" {
-				columnExists = true
-				break
-			}
+	// Users inserted without a role used to become admins
+	if err := d.dropAdminRoleDefault(isPostgres); err != nil {
+		return err
+	}
+
+	// Migrate patterns table to add theory column
+	theoryColumnExists, err := d.columnExists("patterns", "theory")
+	if err != nil {
+		return err
+	}
+
+	if !theoryColumnExists {
+		_, err = d.DB.Exec(`ALTER TABLE patterns ADD COLUMN theory TEXT DEFAULT ''`)
+		if err != nil {
+			return err
 		}
 	}
 
+	// Migrate content tables to add owner_id so each user has an isolated vault
+	if err := d.migrateOwnership(); err != nil {
+		return err
+	}
+
+	// Move content ownership from individual users to workspaces
+	if err := d.migrateWorkspaces(); err != nil {
+		return err
+	}
+
+	// The demo account used to be a viewer of the first real user's workspace.
+	// Its personal workspace is recreated by ensureDemoWorkspace.
+	if _, err := d.DB.Exec(`
+		DELETE FROM workspace_members
+		WHERE user_id IN (SELECT id FROM users WHERE email = 'demo@algovault.com')
+		AND workspace_id NOT IN (SELECT id FROM workspaces WHERE owner_id = workspace_members.user_id)
+	`); err != nil {
+		return err
+	}
+
+	// Migrate users table to add token_version, bumped to revoke access tokens
+	tokenVersionExists, err := d.columnExists("users", "token_version")
 	if err != nil {
 		return err
 	}
 
-	if !columnExists {
-		// Column doesn't exist, add it
-		_, err = d.DB.Exec(`ALTER TABLE users ADD COLUMN role TEXT DEFAULT 'admin'`)
+	if !tokenVersionExists {
+		_, err = d.DB.Exec(`ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0`)
 		if err != nil {
 			return err
 		}
+	}
+
+	// Migrate users table to add account state managed by admins
+	disabledAtExists, err := d.columnExists("users", "disabled_at")
+	if err != nil {
+		return err
+	}
 
-		// Update any existing NULL values to 'admin'
-		_, err = d.DB.Exec(`UPDATE users SET role = 'admin' WHERE role IS NULL`)
+	if !disabledAtExists {
+		timestampType := "DATETIME"
+		if isPostgres {
+			timestampType = "TIMESTAMP"
+		}
+		_, err = d.DB.Exec(`ALTER TABLE users ADD COLUMN disabled_at ` + timestampType)
 		if err != nil {
 			return err
 		}
 	}
 
-	// Migrate patterns table to add theory column
-	var theoryColumnExists bool
+	mustChangeExists, err := d.columnExists("users", "must_change_password")
+	if err != nil {
+		return err
+	}
+
+	if !mustChangeExists {
+		_, err = d.DB.Exec(`ALTER TABLE users ADD COLUMN must_change_password INTEGER NOT NULL DEFAULT 0`)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Migrate users table to add email verification. Accounts that existed
+	// before verification was introduced are treated as verified.
+	emailVerifiedExists, err := d.columnExists("users", "email_verified_at")
+	if err != nil {
+		return err
+	}
+
+	if !emailVerifiedExists {
+		timestampType := "DATETIME"
+		if isPostgres {
+			timestampType = "TIMESTAMP"
+		}
+		_, err = d.DB.Exec(`ALTER TABLE users ADD COLUMN email_verified_at ` + timestampType)
+		if err != nil {
+			return err
+		}
+		_, err = d.DB.Exec(`UPDATE users SET email_verified_at = CURRENT_TIMESTAMP`)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Migrate users table to add two-factor authentication
+	nullableTimestampType := "DATETIME"
 	if isPostgres {
-		err = d.DB.QueryRow(`
+		nullableTimestampType = "TIMESTAMP"
+	}
+	twoFactorColumns := []struct{ name, definition string }{
+		{"totp_secret", "TEXT NOT NULL DEFAULT ''"},
+		{"totp_enabled_at", nullableTimestampType},
+		{"totp_last_step", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, column := range twoFactorColumns {
+		if err := d.addColumnIfMissing("users", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// Migrate problem_progress to add the spaced-repetition schedule
+	reviewColumns := []struct{ name, definition string }{
+		{"ease_factor", "REAL NOT NULL DEFAULT 2.5"},
+		{"interval_days", "INTEGER NOT NULL DEFAULT 0"},
+		{"repetitions", "INTEGER NOT NULL DEFAULT 0"},
+		{"due_at", nullableTimestampType},
+		{"last_reviewed_at", nullableTimestampType},
+	}
+	for _, column := range reviewColumns {
+		if err := d.addColumnIfMissing("problem_progress", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+
+	// Migrate solutions to add the complexity measured by benchmarks
+	benchmarkColumns := []struct{ name, definition string }{
+		{"measured_time_complexity", "TEXT NOT NULL DEFAULT ''"},
+		{"measured_space_complexity", "TEXT NOT NULL DEFAULT ''"},
+		{"benchmarked_at", nullableTimestampType},
+	}
+	for _, column := range benchmarkColumns {
+		if err := d.addColumnIfMissing("solutions", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	// Problems solved before reviews existed are due for their first review right away
+	if _, err := d.DB.Exec(`UPDATE problem_progress SET due_at = last_solved_at WHERE due_at IS NULL AND last_solved_at IS NOT NULL`); err != nil {
+		return err
+	}
+	// Created here rather than in InitSchema because due_at may only exist after the migration
+	if _, err := d.DB.Exec(`CREATE INDEX IF NOT EXISTS idx_problem_progress_due ON problem_progress(user_id, due_at)`); err != nil {
+		return err
+	}
+
+	// SQLite databases created before foreign keys were enforced may hold
+	// rows whose parent was deleted
+	if !isPostgres {
+		if err := d.removeOrphanedRows(); err != nil {
+			return err
+		}
+	}
+	// Deleting a category or pattern used to leave the revisions of the
+	// content under it behind, on either database
+	if err := d.removeOrphanedRevisions(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// orphanChecks lists each foreign key as child table, column and parent
+// table, with parents before their children so removals cascade
+var orphanChecks = []struct{ table, column, parent string }{
+	{"workspace_members", "workspace_id", "workspaces"},
+	{"workspace_invites", "workspace_id", "workspaces"},
+	{"patterns", "category_id", "categories"},
+	{"problems", "pattern_id", "patterns"},
+	{"solutions", "problem_id", "problems"},
+	{"problem_progress", "problem_id", "problems"},
+	{"problem_attempts", "problem_id", "problems"},
+	{"interview_problems", "problem_id", "problems"},
+	{"interview_problems", "session_id", "interview_sessions"},
+	{"interview_submissions", "problem_id", "problems"},
+	{"interview_submissions", "session_id", "interview_sessions"},
+	{"problem_list_items", "problem_id", "problems"},
+	{"problem_list_items", "list_id", "problem_lists"},
+	{"test_cases", "problem_id", "problems"},
+	{"problem_checkers", "problem_id", "problems"},
+	{"problem_stress_configs", "problem_id", "problems"},
+	{"solution_benchmarks", "problem_id", "problems"},
+	{"problem_approaches", "problem_id", "problems"},
+	{"approach_solutions", "approach_id", "problem_approaches"},
+	{"learning_resources", "topic_id", "learning_topics"},
+	{"roadmap_items", "topic_id", "learning_topics"},
+}
+
+// revisionOrphanChecks maps each kind of revision to the table of its
+// target, which revisions have no foreign key to
+var revisionOrphanChecks = map[string]string{
+	RevisionSolution: "problems",
+	RevisionProblem:  "problems",
+	RevisionPattern:  "patterns",
+	RevisionApproach: "problem_approaches",
+}
+
+// removeOrphanedRows deletes rows whose foreign key points at a deleted row
+func (d *Database) removeOrphanedRows() error {
+	for _, check := range orphanChecks {
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s NOT IN (SELECT id FROM %s)", check.table, check.column, check.parent)
+		if _, err := d.DB.Exec(query); err != nil {
+			return fmt.Errorf("failed to remove orphaned %s: %v", check.table, err)
+		}
+	}
+	return nil
+}
+
+// removeOrphanedRevisions deletes revisions of content that no longer exists
+func (d *Database) removeOrphanedRevisions() error {
+	for targetType, parent := range revisionOrphanChecks {
+		query := d.convertPlaceholders(fmt.Sprintf("DELETE FROM revisions WHERE target_type = ? AND target_id NOT IN (SELECT id FROM %s)", parent))
+		if _, err := d.DB.Exec(query, targetType); err != nil {
+			return fmt.Errorf("failed to remove orphaned %s revisions: %v", targetType, err)
+		}
+	}
+	return nil
+}
+
+// dropAdminRoleDefault makes users.role default to no role, which grants
+// nothing. SQLite cannot change a column default in place, so the table is
+// rebuilt from its stored definition.
+func (d *Database) dropAdminRoleDefault(isPostgres bool) error {
+	if isPostgres {
+		_, err := d.DB.Exec(`ALTER TABLE users ALTER COLUMN role SET DEFAULT ''`)
+		return err
+	}
+
+	var definition string
+	if err := d.DB.QueryRow(`SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'users'`).Scan(&definition); err != nil {
+		return err
+	}
+	if !strings.Contains(definition, "DEFAULT 'admin'") || !strings.HasPrefix(definition, "CREATE TABLE users") {
+		return nil
+	}
+	definition = strings.Replace(definition, "CREATE TABLE users", "CREATE TABLE users_rebuilt", 1)
+	definition = strings.ReplaceAll(definition, "DEFAULT 'admin'", "DEFAULT ''")
+
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, query := range []string{
+		definition,
+		`INSERT INTO users_rebuilt SELECT * FROM users`,
+		`DROP TABLE users`,
+		`ALTER TABLE users_rebuilt RENAME TO users`,
+		`CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users(LOWER(email))`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return fmt.Errorf("failed to rebuild users table: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// addColumnIfMissing adds a column to a table unless it is already there
+func (d *Database) addColumnIfMissing(table, column, definition string) error {
+	exists, err := d.columnExists(table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = d.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// columnExists reports whether the given column is present on a table
+func (d *Database) columnExists(table, column string) (bool, error) {
+	if d.IsPostgres {
+		var exists bool
+		err := d.DB.QueryRow(`
 			SELECT EXISTS (
-				SELECT 1 FROM information_schema.columns 
-				WHERE table_name = 'patterns' AND column_name = 'theory'
+				SELECT 1 FROM information_schema.columns
+				WHERE table_name = $1 AND column_name = $2
 			)
-		`).Scan(&theoryColumnExists)
-	} else {
-		patternRows, err := d.DB.Query("PRAGMA table_info(patterns)")
+		`, table, column).Scan(&exists)
+		return exists, err
+	}
+
+	rows, err := d.DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid int
+		var name, dataType string
+		var notNull int
+		var defaultValue sql.NullString
+		var pk int
+
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// migrateOwnership adds owner_id to categories, patterns and problems and
+// assigns any unowned rows to the earliest non-demo user
+func (d *Database) migrateOwnership() error {
+	for _, table := range []string{"categories", "patterns", "problems"} {
+		exists, err := d.columnExists(table, "owner_id")
 		if err != nil {
 			return err
 		}
-		defer patternRows.Close()
+		if !exists {
+			_, err = d.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''", table))
+			if err != nil {
+				return err
+			}
+		}
 
-		theoryColumnExists = false
-		for patternRows.Next() {
-			var cid int
-			var name, dataType string
-			var notNull int
-			var defaultValue sql.NullString
-			var pk int
+		_, err = d.DB.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_owner_id ON %s(owner_id)", table, table))
+		if err != nil {
+			return err
+		}
+	}
 
-			if err := patternRows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
+	// Existing rows predate ownership, so hand them to the first real account.
+	// If nobody has registered yet this is retried on the next startup.
+	var ownerID string
+	err := d.DB.QueryRow("SELECT id FROM users WHERE role <> 'demo' ORDER BY created_at ASC, id ASC LIMIT 1").Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"categories", "patterns", "problems"} {
+		query := d.convertPlaceholders(fmt.Sprintf("UPDATE %s SET owner_id = ? WHERE owner_id IS NULL OR owner_id = ''", table))
+		if _, err := d.DB.Exec(query, ownerID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateWorkspaces adds workspace_id to content tables, gives every user a
+// personal workspace and moves each user's existing rows into it
+func (d *Database) migrateWorkspaces() error {
+	exists, err := d.columnExists("users", "active_workspace_id")
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = d.DB.Exec("ALTER TABLE users ADD COLUMN active_workspace_id TEXT NOT NULL DEFAULT ''")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, table := range []string{"categories", "patterns", "problems", "learning_topics"} {
+		exists, err := d.columnExists(table, "workspace_id")
+		if err != nil {
+			return err
+		}
+		if !exists {
+			_, err = d.DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN workspace_id TEXT NOT NULL DEFAULT ''", table))
+			if err != nil {
 				return err
 			}
+		}
 
-			if name == "theory" {
-				theoryColumnExists = true
-				break
-			}
+		_, err = d.DB.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_workspace_id ON %s(workspace_id)", table, table))
+		if err != nil {
+			return err
 		}
 	}
 
+	// Every non-demo user without a personal workspace gets one
+	rows, err := d.DB.Query(`
+		SELECT id, name FROM users
+		WHERE role <> 'demo' AND id NOT IN (SELECT owner_id FROM workspaces WHERE is_personal = 1)
+	`)
 	if err != nil {
 		return err
 	}
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Name); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, u)
+	}
+	rows.Close()
 
-	if !theoryColumnExists {
-		_, err = d.DB.Exec(`ALTER TABLE patterns ADD COLUMN theory TEXT DEFAULT ''`)
+	for _, u := range users {
+		if _, err := d.createPersonalWorkspace(u.ID, u.Name); err != nil {
+			return err
+		}
+	}
+
+	// Rows created before workspaces existed move into their owner's personal workspace
+	for _, table := range []string{"categories", "patterns", "problems"} {
+		_, err := d.DB.Exec(fmt.Sprintf(`
+			UPDATE %s SET workspace_id = (
+				SELECT w.id FROM workspaces w WHERE w.owner_id = %s.owner_id AND w.is_personal = 1
+			)
+			WHERE workspace_id = '' AND owner_id IN (SELECT owner_id FROM workspaces WHERE is_personal = 1)
+		`, table, table))
 		if err != nil {
 			return err
 		}
@@ -396,6 +1126,41 @@ func (d *Database) migrate(isPostgres bool) error {
 	return nil
 }
 
+// createPersonalWorkspace creates a user's personal workspace, makes them its
+// owner and selects it as their active workspace
+func (d *Database) createPersonalWorkspace(userID, userName string) (string, error) {
+	return d.createPersonalWorkspaceWith(d.DB, userID, userName)
+}
+
+// sqlExecer is satisfied by both *sql.DB and *sql.Tx
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// createPersonalWorkspaceWith is createPersonalWorkspace run on a given
+// connection or transaction
+func (d *Database) createPersonalWorkspaceWith(db sqlExecer, userID, userName string) (string, error) {
+	workspaceID := generateID()
+	now := time.Now()
+
+	query := d.convertPlaceholders("INSERT INTO workspaces (id, name, owner_id, is_personal, created_at, updated_at) VALUES (?, ?, ?, 1, ?, ?)")
+	if _, err := db.Exec(query, workspaceID, userName+"'s Workspace", userID, now, now); err != nil {
+		return "", err
+	}
+
+	query = d.convertPlaceholders("INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES (?, ?, ?, ?)")
+	if _, err := db.Exec(query, workspaceID, userID, WorkspaceRoleOwner, now); err != nil {
+		return "", err
+	}
+
+	query = d.convertPlaceholders("UPDATE users SET active_workspace_id = ? WHERE id = ?")
+	if _, err := db.Exec(query, workspaceID, userID); err != nil {
+		return "", err
+	}
+
+	return workspaceID, nil
+}
+
 // convertPlaceholders converts SQLite placeholders (?) to PostgreSQL placeholders ($1, $2, ...)
 func (d *Database) convertPlaceholders(query string) string {
 	if !d.IsPostgres {
@@ -436,8 +1201,30 @@ func (d *Database) createDemoUser() error {
 	}
 
 	demoUserID := "demo-user-001"
-	query = d.convertPlaceholders("INSERT INTO users (id, email, name, password, role) VALUES (?, ?, ?, ?, ?)")
-	_, err = d.DB.Exec(query, demoUserID, "demo@algovault.com", "Demo User", string(hashedPassword), "demo")
+	query = d.convertPlaceholders("INSERT INTO users (id, email, name, password, role, email_verified_at) VALUES (?, ?, ?, ?, ?, ?)")
+	_, err = d.DB.Exec(query, demoUserID, "demo@algovault.com", "Demo User", string(hashedPassword), "demo", time.Now())
+	return err
+}
+
+// ensureDemoWorkspace gives the demo user an empty personal workspace, so
+// the shared demo login never sees anyone else's vault
+func (d *Database) ensureDemoWorkspace() error {
+	var demoUserID, demoUserName string
+	query := d.convertPlaceholders("SELECT id, name FROM users WHERE email = ?")
+	if err := d.DB.QueryRow(query, "demo@algovault.com").Scan(&demoUserID, &demoUserName); err != nil {
+		return err
+	}
+
+	var hasWorkspace bool
+	query = d.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM workspaces WHERE owner_id = ? AND is_personal = 1)")
+	if err := d.DB.QueryRow(query, demoUserID).Scan(&hasWorkspace); err != nil {
+		return err
+	}
+	if hasWorkspace {
+		return nil
+	}
+
+	_, err := d.createPersonalWorkspace(demoUserID, demoUserName)
 	return err
 }
 
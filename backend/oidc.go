@@ -0,0 +1,567 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oidcStateTTL          = 10 * time.Minute
+	oidcLoginCodeTTL      = time.Minute
+	tokenPurposeOIDCLogin = "oidc_login"
+)
+
+// oidcLoginError is a sign-in failure whose message is safe to show the user.
+// Any other error is logged and replaced with a generic message.
+type oidcLoginError string
+
+func (e oidcLoginError) Error() string { return string(e) }
+
+// OIDCConfig configures single sign-on with an OpenID Connect provider
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // Optional; public clients rely on PKCE alone
+	RedirectURL  string // This server's /api/oidc/callback URL as registered with the provider
+	Scopes       string
+	RoleClaim    string            // ID token claim holding the user's role or groups
+	RoleMapping  map[string]string // Claim value to AlgoVault role
+	DefaultRole  string            // Role for new users when no claim value is mapped
+}
+
+// parseRoleMapping parses "claim-value=role,other=role" into a map
+func parseRoleMapping(spec string) map[string]string {
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(spec, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, role := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if value != "" && role != "" {
+			mapping[value] = role
+		}
+	}
+	return mapping
+}
+
+// OIDCProvider talks to an OpenID Connect provider. Discovery and signing
+// keys are fetched lazily and cached.
+type OIDCProvider struct {
+	Config OIDCConfig
+	Client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProvider returns nil when no issuer is configured
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	if config.Issuer == "" {
+		return nil
+	}
+	config.Issuer = strings.TrimRight(config.Issuer, "/")
+	return &OIDCProvider{
+		Config: config,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// getJSON fetches a URL and decodes the JSON response into v
+func (p *OIDCProvider) getJSON(target string, v interface{}) error {
+	resp, err := p.Client.Get(target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// getDiscovery returns the provider metadata from /.well-known/openid-configuration
+func (p *OIDCProvider) getDiscovery() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(p.Config.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != p.Config.Issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", discovery.Issuer, p.Config.Issuer)
+	}
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// getKey returns the RSA signing key with the given key ID. The key set is
+// refetched when the ID is unknown so provider key rotation is picked up.
+func (p *OIDCProvider) getKey(kid string) (*rsa.PublicKey, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetching OIDC signing keys failed: %v", err)
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown OIDC signing key %q", kid)
+	}
+	return key, nil
+}
+
+// authCodeURL builds the authorization request with a PKCE S256 challenge
+func (p *OIDCProvider) authCodeURL(state, nonce, codeVerifier string) (string, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.Config.ClientID)
+	params.Set("redirect_uri", p.Config.RedirectURL)
+	params.Set("scope", p.Config.Scopes)
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// exchangeCode redeems an authorization code and returns the verified ID token claims
+func (p *OIDCProvider) exchangeCode(code, codeVerifier, nonce string) (jwt.MapClaims, error) {
+	discovery, err := p.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.Config.RedirectURL)
+	form.Set("client_id", p.Config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequest("POST", discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.Config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return nil, fmt.Errorf("invalid token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResponse.IDToken == "" {
+		return nil, fmt.Errorf("token request failed: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+
+	return p.verifyIDToken(tokenResponse.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce of an ID token
+func (p *OIDCProvider) verifyIDToken(idToken, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(p.Config.Issuer),
+		jwt.WithAudience(p.Config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	return claims, nil
+}
+
+// mapRole returns the AlgoVault role for the configured claim, or "" when no
+// claim value is mapped. Both string and list claims (such as groups) work.
+func (p *OIDCProvider) mapRole(claims jwt.MapClaims) string {
+	if p.Config.RoleClaim == "" {
+		return ""
+	}
+
+	var values []string
+	switch claim := claims[p.Config.RoleClaim].(type) {
+	case string:
+		values = []string{claim}
+	case []interface{}:
+		for _, item := range claim {
+			if value, ok := item.(string); ok {
+				values = append(values, value)
+			}
+		}
+	}
+
+	for _, value := range values {
+		if role, ok := p.Config.RoleMapping[value]; ok {
+			return role
+		}
+	}
+	return ""
+}
+
+// GetOIDCConfig tells the frontend whether single sign-on is available
+func (h *Handlers) GetOIDCConfig(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, map[string]bool{"enabled": h.OIDC != nil})
+}
+
+// OIDCLogin starts the authorization code flow by redirecting to the provider
+func (h *Handlers) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if h.OIDC == nil {
+		respondWithError(w, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	state := generateID()
+	nonce := generateID()
+	codeVerifier := generateID() + generateID()
+
+	now := time.Now()
+	query := h.DB.convertPlaceholders("DELETE FROM oidc_states WHERE expires_at < ?")
+	if _, err := h.DB.DB.Exec(query, now); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	query = h.DB.convertPlaceholders("INSERT INTO oidc_states (state, code_verifier, nonce, expires_at, created_at) VALUES (?, ?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, state, codeVerifier, nonce, now.Add(oidcStateTTL), now); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	authURL, err := h.OIDC.authCodeURL(state, nonce, codeVerifier)
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		respondWithError(w, http.StatusBadGateway, "Identity provider is unavailable")
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// OIDCCallback handles the provider's redirect. It signs the user in, creating
+// an account on first login, and sends the browser back to the frontend with
+// a short-lived login code to exchange at /api/oidc/exchange.
+func (h *Handlers) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.OIDC == nil {
+		respondWithError(w, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	fail := func(message string) {
+		http.Redirect(w, r, h.AppURL+"/?oidc_error="+url.QueryEscape(message), http.StatusFound)
+	}
+
+	if providerError := r.URL.Query().Get("error"); providerError != "" {
+		fail("Sign-in was cancelled or denied")
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	code := r.URL.Query().Get("code")
+	if state == "" || code == "" {
+		fail("Invalid sign-in response")
+		return
+	}
+
+	// States are single use: claiming one deletes it, so a replayed callback finds nothing
+	var codeVerifier, nonce string
+	query := h.DB.convertPlaceholders("DELETE FROM oidc_states WHERE state = ? AND expires_at > ? RETURNING code_verifier, nonce")
+	if err := h.DB.DB.QueryRow(query, state, time.Now()).Scan(&codeVerifier, &nonce); err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("OIDC state lookup failed: %v", err)
+		}
+		fail("Sign-in session expired, please try again")
+		return
+	}
+
+	claims, err := h.OIDC.exchangeCode(code, codeVerifier, nonce)
+	if err != nil {
+		log.Printf("OIDC callback failed: %v", err)
+		fail("Could not verify your identity provider login")
+		return
+	}
+
+	user, err := h.findOrProvisionOIDCUser(r, claims)
+	if err != nil {
+		log.Printf("OIDC user provisioning failed: %v", err)
+		// Only messages written for the user reach the redirect
+		var loginErr oidcLoginError
+		if errors.As(err, &loginErr) {
+			fail(string(loginErr))
+		} else {
+			fail("Could not complete sign-in")
+		}
+		return
+	}
+	if user.DisabledAt != nil {
+		fail("Account is disabled")
+		return
+	}
+
+	loginCode, err := h.DB.createUserToken(user.ID, tokenPurposeOIDCLogin, oidcLoginCodeTTL)
+	if err != nil {
+		fail("Could not complete sign-in")
+		return
+	}
+
+	http.Redirect(w, r, h.AppURL+"/?oidc_code="+url.QueryEscape(loginCode), http.StatusFound)
+}
+
+// OIDCExchange trades the login code from OIDCCallback for a token pair, or
+// for a 2FA challenge when the account has two-factor authentication
+func (h *Handlers) OIDCExchange(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	userID, err := h.DB.consumeUserToken(req.Code, tokenPurposeOIDCLogin)
+	if err == errInvalidUserToken {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired login code")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	user, err := h.getUserByID(userID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	h.completeLogin(w, r, user, "oidc")
+}
+
+// findOrProvisionOIDCUser returns the user linked to the ID token subject.
+// Unlinked users are matched by verified email or created. The mapped role
+// claim, when present, is applied on every login.
+func (h *Handlers) findOrProvisionOIDCUser(r *http.Request, claims jwt.MapClaims) (*User, error) {
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, oidcLoginError("Identity provider did not return a subject")
+	}
+	email, _ := claims["email"].(string)
+	email = normalizeEmail(email)
+	emailVerified, _ := claims["email_verified"].(bool)
+	name, _ := claims["name"].(string)
+	if name == "" {
+		name, _ = claims["preferred_username"].(string)
+	}
+	if name == "" {
+		name = email
+	}
+	issuer := h.OIDC.Config.Issuer
+	mappedRole := h.OIDC.mapRole(claims)
+
+	if mappedRole != "" {
+		exists, err := h.DB.roleExists(mappedRole)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			log.Printf("OIDC role mapping points to unknown role %q, ignoring it", mappedRole)
+			mappedRole = ""
+		}
+	}
+
+	var userID string
+	query := h.DB.convertPlaceholders("SELECT user_id FROM user_identities WHERE issuer = ? AND subject = ?")
+	err := h.DB.DB.QueryRow(query, issuer, subject).Scan(&userID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if err == sql.ErrNoRows {
+		if email == "" {
+			return nil, oidcLoginError("Identity provider did not return an email address")
+		}
+
+		existing, err := h.DB.findUserByEmail(email)
+		if err != nil {
+			return nil, err
+		}
+		// Only link to an existing account when the provider vouches for the address
+		if existing != nil && !emailVerified {
+			return nil, oidcLoginError("An account with this email already exists")
+		}
+
+		// A new account, its workspace and the link are created together or not at all
+		tx, err := h.DB.DB.Begin()
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+
+		if existing != nil {
+			userID = existing.ID
+		} else {
+			userID, err = h.provisionOIDCUser(tx, email, name, emailVerified, mappedRole)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		query = h.DB.convertPlaceholders("INSERT INTO user_identities (issuer, subject, user_id, email, created_at) VALUES (?, ?, ?, ?, ?)")
+		if _, err := tx.Exec(query, issuer, subject, userID, email, time.Now()); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			log.Printf("Provisioned user %s from single sign-on", email)
+		}
+	}
+
+	if mappedRole != "" {
+		var currentRole string
+		query = h.DB.convertPlaceholders("SELECT COALESCE(role, '') FROM users WHERE id = ?")
+		err := h.DB.DB.QueryRow(query, userID).Scan(&currentRole)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == nil && currentRole != mappedRole {
+			query = h.DB.convertPlaceholders("UPDATE users SET role = ? WHERE id = ?")
+			if _, err := h.DB.DB.Exec(query, mappedRole, userID); err != nil {
+				return nil, err
+			}
+			// The identity provider made this change, so there is no actor
+			h.auditAs(r, "", "", AuditUserRoleChange, "user", userID, "", map[string]string{"role": currentRole}, map[string]string{"role": mappedRole})
+		}
+	}
+	if emailVerified {
+		query = h.DB.convertPlaceholders("UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?")
+		if _, err := h.DB.DB.Exec(query, time.Now(), userID); err != nil {
+			return nil, err
+		}
+	}
+
+	user, err := h.getUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, oidcLoginError("Linked account no longer exists")
+	}
+	return user, nil
+}
+
+// provisionOIDCUser creates an account for a first-time single sign-on user
+// inside the caller's transaction. It has no password, so it can only sign in
+// through the provider until a password is set with the reset flow.
+func (h *Handlers) provisionOIDCUser(tx *sql.Tx, email, name string, emailVerified bool, role string) (string, error) {
+	if role == "" {
+		role = h.OIDC.Config.DefaultRole
+	}
+
+	var verifiedAt interface{}
+	if emailVerified {
+		verifiedAt = time.Now()
+	}
+
+	userID := generateID()
+	query := h.DB.convertPlaceholders("INSERT INTO users (id, email, name, password, role, email_verified_at) VALUES (?, ?, ?, ?, ?, ?)")
+	if _, err := tx.Exec(query, userID, email, name, "", role, verifiedAt); err != nil {
+		return "", err
+	}
+	if _, err := h.DB.createPersonalWorkspaceWith(tx, userID, name); err != nil {
+		return "", err
+	}
+	return userID, nil
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testOIDCClientID = "algovault-test"
+
+// mockOIDCProvider is an OpenID Connect provider on a local test server. Its
+// authorization endpoint approves every request at once, and its token
+// endpoint checks the PKCE verifier before issuing an ID token.
+type mockOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu     sync.Mutex
+	claims jwt.MapClaims // Added to every ID token
+	grants map[string]mockOIDCGrant
+}
+
+// mockOIDCGrant is an authorization code and the request it was issued for
+type mockOIDCGrant struct {
+	challenge string
+	nonce     string
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDCProvider{key: key, kid: "key-1", grants: map[string]mockOIDCGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/authorize",
+			TokenEndpoint:         m.server.URL + "/token",
+			JWKSURI:               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kid": m.kid,
+			"kty": "RSA",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		code := generateID()
+		m.mu.Lock()
+		m.grants[code] = mockOIDCGrant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+		m.mu.Unlock()
+		http.Redirect(w, r, query.Get("redirect_uri")+"?code="+code+"&state="+url.QueryEscape(query.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		grant, ok := m.grants[r.PostForm.Get("code")]
+		delete(m.grants, r.PostForm.Get("code"))
+		m.mu.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || r.PostForm.Get("grant_type") != "authorization_code" || base64.RawURLEncoding.EncodeToString(verifier[:]) != grant.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken(t, jwt.MapClaims{"nonce": grant.nonce})})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// config returns the settings that point AlgoVault at the provider
+func (m *mockOIDCProvider) config() OIDCConfig {
+	return OIDCConfig{
+		Issuer:      m.server.URL,
+		ClientID:    testOIDCClientID,
+		RedirectURL: "https://algovault.example.com/api/oidc/callback",
+		Scopes:      "openid email profile",
+	}
+}
+
+// idToken signs an ID token with the provider's claims and the given claims on top
+func (m *mockOIDCProvider) idToken(t *testing.T, extra jwt.MapClaims) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	claims := jwt.MapClaims{
+		"iss": m.server.URL,
+		"aud": testOIDCClientID,
+		"sub": "subject-1",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(5 * time.Minute).Unix(),
+	}
+	for name, value := range m.claims {
+		claims[name] = value
+	}
+	for name, value := range extra {
+		claims[name] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = m.kid
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	provider := NewOIDCProvider(m.config())
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedWith := func(method jwt.SigningMethod, key interface{}, kid string) string {
+		token := jwt.NewWithClaims(method, jwt.MapClaims{
+			"iss": m.server.URL, "aud": testOIDCClientID, "sub": "subject-1", "nonce": "n",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = kid
+		signed, _ := token.SignedString(key)
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", m.idToken(t, jwt.MapClaims{"nonce": "n"}), false},
+		{"nonce mismatch", m.idToken(t, jwt.MapClaims{"nonce": "other"}), true},
+		{"missing nonce", m.idToken(t, nil), true},
+		{"other audience", m.idToken(t, jwt.MapClaims{"nonce": "n", "aud": "someone-else"}), true},
+		{"other issuer", m.idToken(t, jwt.MapClaims{"nonce": "n", "iss": "https://evil.example.com"}), true},
+		{"expired", m.idToken(t, jwt.MapClaims{"nonce": "n", "exp": time.Now().Add(-2 * time.Minute).Unix()}), true},
+		{"no expiry", m.idToken(t, jwt.MapClaims{"nonce": "n", "exp": nil}), true},
+		{"signed with another key", signedWith(jwt.SigningMethodRS256, otherKey, m.kid), true},
+		{"unknown key", signedWith(jwt.SigningMethodRS256, m.key, "key-2"), true},
+		{"HMAC with the client ID", signedWith(jwt.SigningMethodHS256, []byte(testOIDCClientID), m.kid), true},
+	}
+	for _, tt := range tests {
+		claims, err := provider.verifyIDToken(tt.token, "n")
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: verifyIDToken error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && claims["sub"] != "subject-1" {
+			t.Errorf("%s: sub = %v, want subject-1", tt.name, claims["sub"])
+		}
+	}
+}
+
+func TestOIDCProviderPicksUpRotatedKeys(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	provider := NewOIDCProvider(m.config())
+	if _, err := provider.verifyIDToken(m.idToken(t, jwt.MapClaims{"nonce": "n"}), "n"); err != nil {
+		t.Fatalf("verifyIDToken: %v", err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.key, m.kid = key, "key-2"
+	m.mu.Unlock()
+	if _, err := provider.verifyIDToken(m.idToken(t, jwt.MapClaims{"nonce": "n"}), "n"); err != nil {
+		t.Errorf("verifyIDToken after key rotation: %v", err)
+	}
+}
+
+func TestOIDCDiscoveryRejectsOtherIssuer(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	config := m.config()
+	// The provider is reached under another name than the one it reports
+	config.Issuer = strings.Replace(m.server.URL, "127.0.0.1", "localhost", 1)
+	if _, err := NewOIDCProvider(config).getDiscovery(); err == nil {
+		t.Error("discovery accepted a document for another issuer")
+	}
+}
+
+func TestAuthCodeURLUsesPKCE(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	provider := NewOIDCProvider(m.config())
+
+	authURL, err := provider.authCodeURL("state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge := sha256.Sum256([]byte("verifier-1"))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testOIDCClientID,
+		"redirect_uri":          m.config().RedirectURL,
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := parsed.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if parsed.Query().Has("code_verifier") {
+		t.Error("the authorization URL leaks the code verifier")
+	}
+}
+
+func TestParseRoleMappingAndMapRole(t *testing.T) {
+	mapping := parseRoleMapping(" admins = admin ,staff=editor,broken,=nobody,empty=")
+	if len(mapping) != 2 || mapping["admins"] != "admin" || mapping["staff"] != "editor" {
+		t.Fatalf("parseRoleMapping = %v", mapping)
+	}
+
+	provider := &OIDCProvider{Config: OIDCConfig{RoleClaim: "groups", RoleMapping: mapping}}
+	tests := []struct {
+		claim interface{}
+		want  string
+	}{
+		{"admins", "admin"},
+		{[]interface{}{"others", "staff"}, "editor"},
+		{[]interface{}{"others", 3}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := provider.mapRole(jwt.MapClaims{"groups": tt.claim}); got != tt.want {
+			t.Errorf("mapRole(%v) = %q, want %q", tt.claim, got, tt.want)
+		}
+	}
+}
+
+// oidcRedirect returns the query of a redirect response
+func oidcRedirect(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+	if w.Code != http.StatusFound {
+		t.Fatalf("status %d, want a redirect; body %s", w.Code, w.Body)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query()
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	m.claims = jwt.MapClaims{"email": "SSO.User@Example.com", "email_verified": true, "name": "SSO User"}
+	h := newTestHandlers(t)
+	h.OIDC = NewOIDCProvider(m.config())
+	h.AppURL = "https://algovault.example.com"
+
+	// The login redirects to the provider, which approves and redirects back
+	w := httptest.NewRecorder()
+	h.OIDCLogin(w, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	h.OIDCCallback(w, httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+callback.RawQuery, nil))
+	loginCode := oidcRedirect(t, w).Get("oidc_code")
+	if loginCode == "" {
+		t.Fatalf("callback redirected to %s, want a login code", w.Header().Get("Location"))
+	}
+
+	// The state is single use
+	w = httptest.NewRecorder()
+	h.OIDCCallback(w, httptest.NewRequest(http.MethodGet, "/api/oidc/callback?"+callback.RawQuery, nil))
+	if oidcRedirect(t, w).Get("oidc_error") == "" {
+		t.Error("a replayed callback did not fail")
+	}
+
+	w = httptest.NewRecorder()
+	h.OIDCExchange(w, httptest.NewRequest(http.MethodPost, "/api/oidc/exchange", strings.NewReader(`{"code":"`+loginCode+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("exchange: status %d, body %s", w.Code, w.Body)
+	}
+	var session struct {
+		Token string `json:"token"`
+		User  User   `json:"user"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&session); err != nil {
+		t.Fatal(err)
+	}
+	if session.Token == "" || session.User.Email != "sso.user@example.com" {
+		t.Errorf("exchange returned token %q for %q, want a token for the normalized email", session.Token, session.User.Email)
+	}
+
+	w = httptest.NewRecorder()
+	h.OIDCExchange(w, httptest.NewRequest(http.MethodPost, "/api/oidc/exchange", strings.NewReader(`{"code":"`+loginCode+`"}`)))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("second exchange of a login code: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOIDCCallbackRejectsUnknownState(t *testing.T) {
+	m := newMockOIDCProvider(t)
+	h := newTestHandlers(t)
+	h.OIDC = NewOIDCProvider(m.config())
+	h.AppURL = "https://algovault.example.com"
+
+	w := httptest.NewRecorder()
+	h.OIDCCallback(w, httptest.NewRequest(http.MethodGet, "/api/oidc/callback?code=c&state=unknown", nil))
+	query := oidcRedirect(t, w)
+	if query.Get("oidc_error") == "" || query.Get("oidc_code") != "" {
+		t.Errorf("callback with an unknown state redirected to %s", w.Header().Get("Location"))
+	}
+}
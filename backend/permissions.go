@@ -0,0 +1,141 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// Named permissions checked at the route level
+const (
+	PermContentRead     = "content:read"
+	PermCategoryWrite   = "category:write"
+	PermPatternWrite    = "pattern:write"
+	PermProblemWrite    = "problem:write"
+	PermAIGenerate      = "ai:generate"
+	PermExternalImport  = "external:import"
+	PermDataClear       = "data:clear"
+	PermWorkspaceManage = "workspace:manage"
+	PermUserManage      = "user:manage"
+	PermAuditRead       = "audit:read"
+	PermProgressWrite   = "progress:write"
+	PermCodeRun         = "code:run"
+)
+
+// defaultRolePermissions is seeded into role_permissions on startup.
+// Roles that are not listed here have no permissions.
+var defaultRolePermissions = map[string][]string{
+	"admin": {
+		PermContentRead,
+		PermCategoryWrite,
+		PermPatternWrite,
+		PermProblemWrite,
+		PermAIGenerate,
+		PermExternalImport,
+		PermDataClear,
+		PermWorkspaceManage,
+		PermUserManage,
+		PermAuditRead,
+		PermProgressWrite,
+		PermCodeRun,
+	},
+	"user": {
+		PermContentRead,
+		PermCategoryWrite,
+		PermPatternWrite,
+		PermProblemWrite,
+		PermAIGenerate,
+		PermExternalImport,
+		PermDataClear,
+		PermWorkspaceManage,
+		PermProgressWrite,
+		PermCodeRun,
+	},
+	"demo": {
+		PermContentRead,
+	},
+}
+
+// unverifiedPermissions are the only permissions usable before a user has
+// verified their email address, whatever their role grants
+var unverifiedPermissions = map[string]bool{
+	PermContentRead: true,
+}
+
+// seedRolePermissions inserts any missing default role permissions.
+// Existing rows are left alone so permissions granted in the database survive restarts.
+func (d *Database) seedRolePermissions() error {
+	query := d.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM role_permissions WHERE role = ? AND permission = ?)")
+	insertQuery := d.convertPlaceholders("INSERT INTO role_permissions (role, permission) VALUES (?, ?)")
+
+	for role, permissions := range defaultRolePermissions {
+		for _, permission := range permissions {
+			var exists bool
+			if err := d.DB.QueryRow(query, role, permission).Scan(&exists); err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			if _, err := d.DB.Exec(insertQuery, role, permission); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// twoFactorEnforceablePermissions are the permissions that let admins make
+// two-factor authentication mandatory for a role
+var twoFactorEnforceablePermissions = []string{PermDataClear, PermExternalImport}
+
+// roleExists reports whether any permissions are defined for a role
+func (d *Database) roleExists(role string) (bool, error) {
+	var exists bool
+	query := d.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM role_permissions WHERE role = ?)")
+	err := d.DB.QueryRow(query, role).Scan(&exists)
+	return exists, err
+}
+
+// hasPermission reports whether a role grants a permission.
+// An empty or unknown role never grants anything.
+func (d *Database) hasPermission(role, permission string) (bool, error) {
+	if role == "" {
+		return false, nil
+	}
+
+	var granted bool
+	query := d.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM role_permissions WHERE role = ? AND permission = ?)")
+	err := d.DB.QueryRow(query, role, permission).Scan(&granted)
+	return granted, err
+}
+
+// RequirePermission only runs next when the caller's role grants permission.
+// It must be used on routes behind AuthMiddleware.
+func RequirePermission(db *Database, permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		granted, err := db.hasPermission(getUserRole(r), permission)
+		if err != nil {
+			log.Printf("Error checking permission %s: %v", permission, err)
+			respondWithError(w, http.StatusInternalServerError, "Error checking permissions")
+			return
+		}
+		if !granted {
+			respondWithError(w, http.StatusForbidden, "Permission denied: "+permission)
+			return
+		}
+		if !unverifiedPermissions[permission] && !isEmailVerified(r) {
+			respondWithError(w, http.StatusForbidden, "Email verification required")
+			return
+		}
+		if scopes, ok := getAPIKeyScopes(r); ok && !containsString(scopes, permission) {
+			respondWithError(w, http.StatusForbidden, "API key scope does not allow: "+permission)
+			return
+		}
+		if isTwoFactorMissing(r) {
+			respondWithError(w, http.StatusForbidden, "Two-factor authentication is required for your role")
+			return
+		}
+
+		next(w, r)
+	}
+}
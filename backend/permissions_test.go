@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// createTestAccountWithRole inserts a user with a personal workspace, a role
+// and a verified email, and returns its ID
+func createTestAccountWithRole(t *testing.T, h *Handlers, email, role string) string {
+	t.Helper()
+	userID := createTestAccount(t, h, email)
+	query := h.DB.convertPlaceholders("UPDATE users SET role = ?, email_verified_at = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, role, time.Now(), userID); err != nil {
+		t.Fatalf("set role: %v", err)
+	}
+	return userID
+}
+
+// testRouter serves a few protected routes wrapped as main wraps them
+func testRouter(h *Handlers) *mux.Router {
+	router := mux.NewRouter()
+	api := router.PathPrefix("/api").Subrouter()
+	api.Use(AuthMiddleware(h.JWTSecret, h.DB))
+	api.HandleFunc("/logout", h.Logout).Methods("POST")
+	api.HandleFunc("/categories", RequirePermission(h.DB, PermContentRead, h.GetCategories)).Methods("GET")
+	api.HandleFunc("/categories", RequirePermission(h.DB, PermCategoryWrite, h.CreateCategory)).Methods("POST")
+	api.HandleFunc("/problems/{id}", RequirePermission(h.DB, PermContentRead, h.GetProblem)).Methods("GET")
+	api.HandleFunc("/external/clear-all", RequirePermission(h.DB, PermDataClear, h.ClearAllData)).Methods("POST")
+	api.HandleFunc("/admin/users", RequirePermission(h.DB, PermUserManage, h.AdminGetUsers)).Methods("GET")
+	api.HandleFunc("/api-keys", RequireUserSession(h.GetAPIKeys)).Methods("GET")
+	api.HandleFunc("/api-keys", RequireUserSession(h.CreateAPIKey)).Methods("POST")
+	api.HandleFunc("/api-keys/{id}", RequireUserSession(h.RevokeAPIKey)).Methods("DELETE")
+	return router
+}
+
+// serveRoute sends a request through router with the given Authorization header
+func serveRoute(router http.Handler, authorization, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+// bearer returns the Authorization header of a fresh access token for userID
+func bearer(t *testing.T, h *Handlers, userID string) string {
+	t.Helper()
+	tokens, err := h.issueTokens(userID)
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	return "Bearer " + tokens.Token
+}
+
+func TestRoutesRequireRolePermissions(t *testing.T) {
+	h := newTestHandlers(t)
+	router := testRouter(h)
+	users := map[string]string{
+		"admin":   createTestAccountWithRole(t, h, "admin@example.com", "admin"),
+		"user":    createTestAccountWithRole(t, h, "user@example.com", "user"),
+		"demo":    createTestAccountWithRole(t, h, "viewer@example.com", "demo"),
+		"none":    createTestAccount(t, h, "none@example.com"),
+		"unknown": createTestAccountWithRole(t, h, "unknown@example.com", "ghost"),
+	}
+
+	tests := []struct {
+		role, method, path, body string
+		want                     int
+	}{
+		{"user", "GET", "/api/categories", "", http.StatusOK},
+		{"user", "POST", "/api/categories", `{"name": "Arrays"}`, http.StatusCreated},
+		{"user", "GET", "/api/admin/users", "", http.StatusForbidden},
+		{"admin", "GET", "/api/admin/users", "", http.StatusOK},
+		{"demo", "GET", "/api/categories", "", http.StatusOK},
+		{"demo", "POST", "/api/categories", `{"name": "Arrays"}`, http.StatusForbidden},
+		{"demo", "POST", "/api/external/clear-all", "", http.StatusForbidden},
+		{"none", "GET", "/api/categories", "", http.StatusForbidden},
+		{"unknown", "GET", "/api/categories", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		w := serveRoute(router, bearer(t, h, users[tt.role]), tt.method, tt.path, tt.body)
+		if w.Code != tt.want {
+			t.Errorf("%s %s as %s: status %d, want %d (%s)", tt.method, tt.path, tt.role, w.Code, tt.want, strings.TrimSpace(w.Body.String()))
+		}
+	}
+
+	if w := serveRoute(router, "", "GET", "/api/categories", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("request without a token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestRoutesRequireVerifiedEmailToWrite(t *testing.T) {
+	h := newTestHandlers(t)
+	router := testRouter(h)
+	userID := createTestAccountWithRole(t, h, "unverified@example.com", "user")
+	query := h.DB.convertPlaceholders("UPDATE users SET email_verified_at = NULL WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, userID); err != nil {
+		t.Fatal(err)
+	}
+	auth := bearer(t, h, userID)
+
+	if w := serveRoute(router, auth, "GET", "/api/categories", ""); w.Code != http.StatusOK {
+		t.Errorf("unverified user reading: status %d, want %d", w.Code, http.StatusOK)
+	}
+	w := serveRoute(router, auth, "POST", "/api/categories", `{"name": "Arrays"}`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "verification") {
+		t.Errorf("unverified user writing: status %d, body %s; want %d", w.Code, w.Body, http.StatusForbidden)
+	}
+}
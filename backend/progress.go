@@ -0,0 +1,301 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Problem progress statuses, from least to most complete
+const (
+	ProgressUnsolved  = "unsolved"
+	ProgressAttempted = "attempted"
+	ProgressSolved    = "solved"
+	ProgressMastered  = "mastered"
+)
+
+// maxConfidence is the top of the confidence scale; 0 means not rated
+const maxConfidence = 5
+
+// isValidProgressStatus checks if a status can be stored on a progress record
+func isValidProgressStatus(status string) bool {
+	switch status {
+	case ProgressUnsolved, ProgressAttempted, ProgressSolved, ProgressMastered:
+		return true
+	}
+	return false
+}
+
+// solvedStatusesSQL matches progress rows that count as solved
+const solvedStatusesSQL = "('" + ProgressSolved + "', '" + ProgressMastered + "')"
+
+// ProblemProgress is one user's progress on one problem, including its
+// spaced-repetition review schedule
+type ProblemProgress struct {
+	Status         string     `json:"status"`
+	AttemptCount   int        `json:"attemptCount"`
+	Confidence     int        `json:"confidence"` // 1-5, 0 when not rated
+	FirstSolvedAt  *time.Time `json:"firstSolvedAt,omitempty"`
+	LastSolvedAt   *time.Time `json:"lastSolvedAt,omitempty"`
+	EaseFactor     float64    `json:"easeFactor"`
+	IntervalDays   int        `json:"intervalDays"`
+	Repetitions    int        `json:"repetitions"`     // Successful reviews in a row
+	DueAt          *time.Time `json:"dueAt,omitempty"` // nil until the problem enters the review queue
+	LastReviewedAt *time.Time `json:"lastReviewedAt,omitempty"`
+	UpdatedAt      *time.Time `json:"updatedAt,omitempty"` // nil until progress is first recorded
+}
+
+// newProblemProgress is the progress of a problem nothing was recorded for
+func newProblemProgress() *ProblemProgress {
+	return &ProblemProgress{Status: ProgressUnsolved, EaseFactor: defaultEaseFactor}
+}
+
+// progressColumns selects a problem_progress row aliased as pp, tolerating a
+// missing row from a LEFT JOIN. Scan it with progressScanner.
+const progressColumns = "COALESCE(pp.status, '" + ProgressUnsolved + "'), COALESCE(pp.attempt_count, 0), COALESCE(pp.confidence, 0), pp.first_solved_at, pp.last_solved_at, " +
+	"COALESCE(pp.ease_factor, 2.5), COALESCE(pp.interval_days, 0), COALESCE(pp.repetitions, 0), pp.due_at, pp.last_reviewed_at, pp.updated_at"
+
+// progressScanner holds scan destinations for progressColumns
+type progressScanner struct {
+	progress                                                      ProblemProgress
+	firstSolvedAt, lastSolvedAt, dueAt, lastReviewedAt, updatedAt sql.NullTime
+}
+
+func (s *progressScanner) dest() []interface{} {
+	return []interface{}{
+		&s.progress.Status, &s.progress.AttemptCount, &s.progress.Confidence, &s.firstSolvedAt, &s.lastSolvedAt,
+		&s.progress.EaseFactor, &s.progress.IntervalDays, &s.progress.Repetitions, &s.dueAt, &s.lastReviewedAt, &s.updatedAt,
+	}
+}
+
+func (s *progressScanner) result() *ProblemProgress {
+	progress := s.progress
+	progress.FirstSolvedAt = nullTimePtr(s.firstSolvedAt)
+	progress.LastSolvedAt = nullTimePtr(s.lastSolvedAt)
+	progress.DueAt = nullTimePtr(s.dueAt)
+	progress.LastReviewedAt = nullTimePtr(s.lastReviewedAt)
+	progress.UpdatedAt = nullTimePtr(s.updatedAt)
+	return &progress
+}
+
+// nullTimePtr converts a nullable time column to a pointer
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	value := t.Time
+	return &value
+}
+
+// timePtrValue converts a pointer to a value for a nullable time column
+func timePtrValue(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+// getProgress returns a user's progress on a problem, which is unsolved when
+// nothing has been recorded yet
+func (d *Database) getProgress(userID, problemID string) (*ProblemProgress, error) {
+	var scanner progressScanner
+	query := d.convertPlaceholders("SELECT " + progressColumns + " FROM problem_progress pp WHERE pp.user_id = ? AND pp.problem_id = ?")
+	err := d.DB.QueryRow(query, userID, problemID).Scan(scanner.dest()...)
+	if err == sql.ErrNoRows {
+		return newProblemProgress(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanner.result(), nil
+}
+
+// saveProgress stores a user's progress on a problem and sets its UpdatedAt
+func (d *Database) saveProgress(userID, problemID string, progress *ProblemProgress) error {
+	now := time.Now()
+	progress.UpdatedAt = &now
+
+	var exists bool
+	query := d.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM problem_progress WHERE user_id = ? AND problem_id = ?)")
+	if err := d.DB.QueryRow(query, userID, problemID).Scan(&exists); err != nil {
+		return err
+	}
+
+	values := []interface{}{
+		progress.Status, progress.AttemptCount, progress.Confidence,
+		timePtrValue(progress.FirstSolvedAt), timePtrValue(progress.LastSolvedAt),
+		progress.EaseFactor, progress.IntervalDays, progress.Repetitions,
+		timePtrValue(progress.DueAt), timePtrValue(progress.LastReviewedAt), now,
+		userID, problemID,
+	}
+
+	if exists {
+		query = d.convertPlaceholders(`
+			UPDATE problem_progress SET status = ?, attempt_count = ?, confidence = ?, first_solved_at = ?, last_solved_at = ?,
+			       ease_factor = ?, interval_days = ?, repetitions = ?, due_at = ?, last_reviewed_at = ?, updated_at = ?
+			WHERE user_id = ? AND problem_id = ?
+		`)
+		_, err := d.DB.Exec(query, values...)
+		return err
+	}
+	query = d.convertPlaceholders(`
+		INSERT INTO problem_progress (status, attempt_count, confidence, first_solved_at, last_solved_at,
+		       ease_factor, interval_days, repetitions, due_at, last_reviewed_at, updated_at, user_id, problem_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	_, err := d.DB.Exec(query, values...)
+	return err
+}
+
+// markSolved moves progress to solved, keeping mastered, and stamps the
+// solve times. The first solve puts the problem in the review queue.
+func (p *ProblemProgress) markSolved(at time.Time) {
+	if p.Status != ProgressMastered {
+		p.Status = ProgressSolved
+	}
+	if p.FirstSolvedAt == nil {
+		p.FirstSolvedAt = &at
+	}
+	p.LastSolvedAt = &at
+	if p.DueAt == nil {
+		due := at.AddDate(0, 0, firstReviewIntervalDays)
+		p.DueAt = &due
+		p.IntervalDays = firstReviewIntervalDays
+	}
+}
+
+// recordAttempt counts one attempt at a problem. A failed attempt moves an
+// unsolved problem to attempted; a successful one marks it solved.
+func (d *Database) recordAttempt(userID, problemID string, solved bool, at time.Time) (*ProblemProgress, error) {
+	progress, err := d.getProgress(userID, problemID)
+	if err != nil {
+		return nil, err
+	}
+
+	progress.AttemptCount++
+	if solved {
+		progress.markSolved(at)
+	} else if progress.Status == ProgressUnsolved {
+		progress.Status = ProgressAttempted
+	}
+
+	if err := d.saveProgress(userID, problemID, progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// requireProblemInWorkspace checks that a problem is in the caller's active
+// workspace and returns the workspace ID
+func (h *Handlers) requireProblemInWorkspace(w http.ResponseWriter, r *http.Request, problemID string) (string, bool) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return "", false
+	}
+
+	found, err := h.inWorkspace("problems", problemID, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return "", false
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Problem not found")
+		return "", false
+	}
+	return workspaceID, true
+}
+
+// GetProblemProgress returns the caller's progress on a problem
+func (h *Handlers) GetProblemProgress(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	progress, err := h.DB.getProgress(getUserID(r), problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, progress)
+}
+
+// UpdateProblemProgress sets the caller's status and confidence for a
+// problem. Omitted fields are left unchanged. Moving to solved or mastered
+// stamps the solve times.
+func (h *Handlers) UpdateProblemProgress(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	var req struct {
+		Status     *string `json:"status"`
+		Confidence *int    `json:"confidence"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Status != nil && !isValidProgressStatus(*req.Status) {
+		respondWithError(w, http.StatusBadRequest, "Status must be unsolved, attempted, solved or mastered")
+		return
+	}
+	if req.Confidence != nil && (*req.Confidence < 0 || *req.Confidence > maxConfidence) {
+		respondWithError(w, http.StatusBadRequest, "Confidence must be between 0 and 5")
+		return
+	}
+
+	userID := getUserID(r)
+	progress, err := h.DB.getProgress(userID, problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if req.Status != nil && *req.Status != progress.Status {
+		wasSolved := progress.Status == ProgressSolved || progress.Status == ProgressMastered
+		if !wasSolved && (*req.Status == ProgressSolved || *req.Status == ProgressMastered) {
+			progress.markSolved(time.Now())
+		}
+		progress.Status = *req.Status
+	}
+	if req.Confidence != nil {
+		progress.Confidence = *req.Confidence
+	}
+
+	if err := h.DB.saveProgress(userID, problemID, progress); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving progress")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, progress)
+}
+
+// RecordProblemAttempt counts an attempt at a problem by the caller
+func (h *Handlers) RecordProblemAttempt(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	var req struct {
+		Solved bool `json:"solved"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	progress, err := h.DB.recordAttempt(getUserID(r), problemID, req.Solved, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving progress")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, progress)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits for the public authentication endpoints
+const (
+	authRequestsPerIP       = 30 // requests per authRequestWindow
+	authRequestWindow       = time.Minute
+	loginFailuresPerAccount = 5 // failed logins per loginFailureWindow before lockout
+	loginFailuresPerIP      = 20
+	loginFailureWindow      = 15 * time.Minute
+	loginLockout            = 15 * time.Minute
+)
+
+// attemptLimiter counts events per key within a fixed window and locks the
+// key out once the limit is reached. State is kept in memory.
+type attemptLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	lockout   time.Duration
+	entries   map[string]*attemptEntry
+	lastSweep time.Time
+}
+
+type attemptEntry struct {
+	count       int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+func newAttemptLimiter(limit int, window, lockout time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		limit:   limit,
+		window:  window,
+		lockout: lockout,
+		entries: make(map[string]*attemptEntry),
+	}
+}
+
+// blocked returns how long key is still locked out, or 0 if it is not
+func (l *attemptLimiter) blocked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return 0
+	}
+	if remaining := time.Until(entry.lockedUntil); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// record counts one event for key and locks it out when the limit is reached
+func (l *attemptLimiter) record(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.windowStart) > l.window {
+		entry = &attemptEntry{windowStart: now}
+		l.entries[key] = entry
+	}
+
+	entry.count++
+	if entry.count >= l.limit {
+		entry.lockedUntil = now.Add(l.lockout)
+		entry.count = 0
+		entry.windowStart = now
+	}
+}
+
+// reset forgets everything recorded for key
+func (l *attemptLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// sweep drops stale entries so the map does not grow without bound.
+// The caller must hold l.mu.
+func (l *attemptLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, entry := range l.entries {
+		if now.Sub(entry.windowStart) > l.window && now.After(entry.lockedUntil) {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// AuthLimiter throttles the public authentication endpoints per client IP
+// and locks out accounts and IPs after repeated failed logins
+type AuthLimiter struct {
+	// TrustProxy makes the client IP come from X-Forwarded-For. Only enable
+	// it behind a proxy that sets the header.
+	TrustProxy bool
+
+	requests        *attemptLimiter
+	ipFailures      *attemptLimiter
+	accountFailures *attemptLimiter
+}
+
+// NewAuthLimiter creates an AuthLimiter with the default limits
+func NewAuthLimiter(trustProxy bool) *AuthLimiter {
+	return &AuthLimiter{
+		TrustProxy:      trustProxy,
+		requests:        newAttemptLimiter(authRequestsPerIP, authRequestWindow, authRequestWindow),
+		ipFailures:      newAttemptLimiter(loginFailuresPerIP, loginFailureWindow, loginLockout),
+		accountFailures: newAttemptLimiter(loginFailuresPerAccount, loginFailureWindow, loginLockout),
+	}
+}
+
+// clientIP returns the IP address a request came from
+func (l *AuthLimiter) clientIP(r *http.Request) string {
+	if l.TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// loginBlocked returns how long logins for email from this request's IP are locked out
+func (l *AuthLimiter) loginBlocked(r *http.Request, email string) time.Duration {
+	ipWait := l.ipFailures.blocked(l.clientIP(r))
+	accountWait := l.accountFailures.blocked(email)
+	if ipWait > accountWait {
+		return ipWait
+	}
+	return accountWait
+}
+
+// loginFailed records a failed login for email and the request's IP
+func (l *AuthLimiter) loginFailed(r *http.Request, email string) {
+	l.ipFailures.record(l.clientIP(r))
+	l.accountFailures.record(email)
+}
+
+// loginSucceeded clears the failure count of an account
+func (l *AuthLimiter) loginSucceeded(email string) {
+	l.accountFailures.reset(email)
+}
+
+// respondTooManyRequests sends a 429 with a Retry-After header
+func respondTooManyRequests(w http.ResponseWriter, wait time.Duration, message string) {
+	seconds := int(wait.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, message)
+}
+
+// RateLimit only runs next while the client IP stays within the request limit
+// for authentication endpoints
+func RateLimit(limiter *AuthLimiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := limiter.clientIP(r)
+		if wait := limiter.requests.blocked(ip); wait > 0 {
+			respondTooManyRequests(w, wait, "Too many requests. Please try again later.")
+			return
+		}
+		limiter.requests.record(ip)
+
+		next(w, r)
+	}
+}
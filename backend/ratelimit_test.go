@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestAttemptLimiterLocksOutAtLimit(t *testing.T) {
+	l := newAttemptLimiter(3, time.Minute, 10*time.Minute)
+	for i := 0; i < 2; i++ {
+		l.record("key")
+	}
+	if wait := l.blocked("key"); wait != 0 {
+		t.Fatalf("blocked below the limit for %v", wait)
+	}
+
+	l.record("key")
+	if wait := l.blocked("key"); wait <= 9*time.Minute || wait > 10*time.Minute {
+		t.Errorf("blocked for %v at the limit, want about the 10 minute lockout", wait)
+	}
+	if wait := l.blocked("other"); wait != 0 {
+		t.Errorf("another key is blocked for %v", wait)
+	}
+
+	l.reset("key")
+	if wait := l.blocked("key"); wait != 0 {
+		t.Errorf("blocked for %v after reset", wait)
+	}
+}
+
+func TestAttemptLimiterWindowAndLockoutExpire(t *testing.T) {
+	l := newAttemptLimiter(3, time.Minute, time.Minute)
+	l.record("key")
+	l.record("key")
+	// Events from an earlier window no longer count
+	l.entries["key"].windowStart = time.Now().Add(-2 * time.Minute)
+	l.record("key")
+	if wait := l.blocked("key"); wait != 0 {
+		t.Fatalf("blocked for %v after the window restarted", wait)
+	}
+
+	l.record("key")
+	l.record("key")
+	if l.blocked("key") == 0 {
+		t.Fatal("not blocked at the limit")
+	}
+	l.entries["key"].lockedUntil = time.Now().Add(-time.Second)
+	if wait := l.blocked("key"); wait != 0 {
+		t.Errorf("blocked for %v after the lockout ended", wait)
+	}
+}
+
+func TestAttemptLimiterSweepsStaleEntries(t *testing.T) {
+	l := newAttemptLimiter(5, time.Minute, time.Minute)
+	l.record("stale")
+	l.record("locked")
+	past := time.Now().Add(-2 * time.Minute)
+	l.entries["stale"].windowStart = past
+	l.entries["locked"].windowStart = past
+	l.entries["locked"].lockedUntil = time.Now().Add(time.Minute)
+	l.lastSweep = past
+
+	l.record("fresh")
+	if _, ok := l.entries["stale"]; ok {
+		t.Error("stale entry was not swept")
+	}
+	if _, ok := l.entries["locked"]; !ok {
+		t.Error("entry that is still locked out was swept")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+	r.RemoteAddr = "192.0.2.1:5000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7, 10.0.0.1")
+
+	if ip := (&AuthLimiter{}).clientIP(r); ip != "192.0.2.1" {
+		t.Errorf("clientIP without a trusted proxy = %q, want the remote address", ip)
+	}
+	if ip := (&AuthLimiter{TrustProxy: true}).clientIP(r); ip != "198.51.100.7" {
+		t.Errorf("clientIP behind a trusted proxy = %q, want the first forwarded address", ip)
+	}
+}
+
+func TestLoginFailuresLockOutAccount(t *testing.T) {
+	l := NewAuthLimiter(false)
+	request := func(addr string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		r.RemoteAddr = addr
+		return r
+	}
+
+	// Failures from different addresses still add up for the account
+	for i := 0; i < loginFailuresPerAccount; i++ {
+		l.loginFailed(request("192.0.2."+strconv.Itoa(i+1)+":5000"), "user@example.com")
+	}
+	if l.loginBlocked(request("203.0.113.1:5000"), "user@example.com") == 0 {
+		t.Error("account is not locked out after repeated failures")
+	}
+	if wait := l.loginBlocked(request("203.0.113.1:5000"), "other@example.com"); wait != 0 {
+		t.Errorf("another account is locked out for %v", wait)
+	}
+
+	l.loginSucceeded("user@example.com")
+	if wait := l.loginBlocked(request("203.0.113.1:5000"), "user@example.com"); wait != 0 {
+		t.Errorf("account is locked out for %v after a successful login", wait)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	l := NewAuthLimiter(false)
+	calls := 0
+	handler := RateLimit(l, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+	send := func(addr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	for i := 0; i < authRequestsPerIP; i++ {
+		if w := send("192.0.2.1:5000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, w.Code)
+		}
+	}
+	w := send("192.0.2.1:5000")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the limit: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retry, err := strconv.Atoi(w.Header().Get("Retry-After")); err != nil || retry < 1 {
+		t.Errorf("Retry-After = %q, want a positive number of seconds", w.Header().Get("Retry-After"))
+	}
+	if calls != authRequestsPerIP {
+		t.Errorf("handler ran %d times, want %d", calls, authRequestsPerIP)
+	}
+	if w := send("192.0.2.2:5000"); w.Code != http.StatusOK {
+		t.Errorf("request from another address: status %d", w.Code)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// SM-2 scheduling parameters
+const (
+	defaultEaseFactor        = 2.5
+	minEaseFactor            = 1.3
+	firstReviewIntervalDays  = 1
+	secondReviewIntervalDays = 6
+	maxReviewGrade           = 5
+	passingReviewGrade       = 3 // Grades below this mean the problem was not recalled
+)
+
+// Page sizes for the review queue
+const (
+	defaultReviewQueueSize = 50
+	maxReviewQueueSize     = 200
+)
+
+// ReviewItem is a problem waiting in the caller's review queue
+type ReviewItem struct {
+	ProblemID    string           `json:"problemId"`
+	Title        string           `json:"title"`
+	Difficulty   string           `json:"difficulty"`
+	PatternID    string           `json:"patternId"`
+	PatternName  string           `json:"patternName"`
+	CategoryID   string           `json:"categoryId"`
+	CategoryName string           `json:"categoryName"`
+	Progress     *ProblemProgress `json:"progress"`
+}
+
+// applyReview schedules the next review from a 0-5 recall grade using SM-2.
+// Passing grades grow the interval by the ease factor; failing grades start
+// the problem over with a one day interval.
+func (p *ProblemProgress) applyReview(grade int, at time.Time) {
+	if grade >= passingReviewGrade {
+		switch p.Repetitions {
+		case 0:
+			p.IntervalDays = firstReviewIntervalDays
+		case 1:
+			p.IntervalDays = secondReviewIntervalDays
+		default:
+			p.IntervalDays = int(math.Round(float64(p.IntervalDays) * p.EaseFactor))
+		}
+		p.Repetitions++
+	} else {
+		p.Repetitions = 0
+		p.IntervalDays = firstReviewIntervalDays
+	}
+
+	miss := float64(maxReviewGrade - grade)
+	p.EaseFactor += 0.1 - miss*(0.08+miss*0.02)
+	if p.EaseFactor < minEaseFactor {
+		p.EaseFactor = minEaseFactor
+	}
+
+	due := at.AddDate(0, 0, p.IntervalDays)
+	p.DueAt = &due
+	p.LastReviewedAt = &at
+}
+
+// ReviewProblem records a recall grade for a problem and schedules its next
+// review. A passing grade also counts as solving the problem.
+func (h *Handlers) ReviewProblem(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	var req struct {
+		Grade *int `json:"grade"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Grade == nil || *req.Grade < 0 || *req.Grade > maxReviewGrade {
+		respondWithError(w, http.StatusBadRequest, "Grade must be between 0 and 5")
+		return
+	}
+
+	userID := getUserID(r)
+	progress, err := h.DB.getProgress(userID, problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	now := time.Now()
+	if *req.Grade >= passingReviewGrade {
+		progress.markSolved(now)
+	}
+	progress.applyReview(*req.Grade, now)
+
+	if err := h.DB.saveProgress(userID, problemID, progress); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving progress")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, progress)
+}
+
+// GetDueReviews returns the caller's problems due for review by the end of
+// today, most overdue first. categoryId and patternId narrow the queue.
+func (h *Handlers) GetDueReviews(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+
+	limit := defaultReviewQueueSize
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxReviewQueueSize {
+			respondWithError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxReviewQueueSize))
+			return
+		}
+		limit = n
+	}
+
+	now := time.Now()
+	endOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+
+	query := `
+		SELECT p.id, p.title, p.difficulty, p.pattern_id, pat.name, pat.category_id, c.name, ` + progressColumns + `
+		FROM problem_progress pp
+		JOIN problems p ON p.id = pp.problem_id
+		JOIN patterns pat ON pat.id = p.pattern_id
+		JOIN categories c ON c.id = pat.category_id
+		WHERE pp.user_id = ? AND p.workspace_id = ? AND pp.due_at IS NOT NULL AND pp.due_at < ?`
+	args := []interface{}{getUserID(r), workspaceID, endOfToday}
+	if categoryID := r.URL.Query().Get("categoryId"); categoryID != "" {
+		query += " AND pat.category_id = ?"
+		args = append(args, categoryID)
+	}
+	if patternID := r.URL.Query().Get("patternId"); patternID != "" {
+		query += " AND p.pattern_id = ?"
+		args = append(args, patternID)
+	}
+	query += " ORDER BY pp.due_at ASC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := h.DB.DB.Query(h.DB.convertPlaceholders(query), args...)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	items := []ReviewItem{}
+	for rows.Next() {
+		var item ReviewItem
+		var progress progressScanner
+		dest := append([]interface{}{&item.ProblemID, &item.Title, &item.Difficulty, &item.PatternID, &item.PatternName, &item.CategoryID, &item.CategoryName}, progress.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning review item")
+			return
+		}
+		item.Progress = progress.result()
+		items = append(items, item)
+	}
+
+	respondWithJSON(w, http.StatusOK, items)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestApplyReviewSchedulesSM2Intervals(t *testing.T) {
+	p := newProblemProgress()
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	// Each perfect recall raises the ease factor by 0.1
+	steps := []struct {
+		grade        int
+		wantInterval int
+		wantEase     float64
+		wantReps     int
+	}{
+		{5, 1, 2.6, 1},
+		{5, 6, 2.7, 2},
+		{5, 16, 2.8, 3}, // round(6 * 2.7)
+		{4, 45, 2.8, 4}, // round(16 * 2.8); grade 4 keeps the ease factor
+		{3, 126, 2.66, 5},
+	}
+	for i, step := range steps {
+		p.applyReview(step.grade, at)
+		if p.IntervalDays != step.wantInterval || p.Repetitions != step.wantReps || math.Abs(p.EaseFactor-step.wantEase) > 1e-9 {
+			t.Fatalf("review %d (grade %d): interval %d, repetitions %d, ease %.4f; want %d, %d, %.4f",
+				i+1, step.grade, p.IntervalDays, p.Repetitions, p.EaseFactor, step.wantInterval, step.wantReps, step.wantEase)
+		}
+		if want := at.AddDate(0, 0, step.wantInterval); p.DueAt == nil || !p.DueAt.Equal(want) {
+			t.Errorf("review %d: due %v, want %v", i+1, p.DueAt, want)
+		}
+		if p.LastReviewedAt == nil || !p.LastReviewedAt.Equal(at) {
+			t.Errorf("review %d: last reviewed %v, want %v", i+1, p.LastReviewedAt, at)
+		}
+		at = *p.DueAt
+	}
+}
+
+func TestApplyReviewFailingGradeStartsOver(t *testing.T) {
+	p := &ProblemProgress{EaseFactor: 2.5, IntervalDays: 30, Repetitions: 4}
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	p.applyReview(2, at)
+	if p.Repetitions != 0 || p.IntervalDays != firstReviewIntervalDays {
+		t.Errorf("after a failing grade: repetitions %d, interval %d; want 0, %d", p.Repetitions, p.IntervalDays, firstReviewIntervalDays)
+	}
+	if want := 2.5 - 0.32; math.Abs(p.EaseFactor-want) > 1e-9 {
+		t.Errorf("ease factor %.4f, want %.4f", p.EaseFactor, want)
+	}
+
+	// The next pass starts the interval sequence from the beginning
+	p.applyReview(5, at.AddDate(0, 0, 1))
+	if p.Repetitions != 1 || p.IntervalDays != firstReviewIntervalDays {
+		t.Errorf("after passing again: repetitions %d, interval %d; want 1, %d", p.Repetitions, p.IntervalDays, firstReviewIntervalDays)
+	}
+}
+
+func TestApplyReviewEaseFactorFloor(t *testing.T) {
+	p := newProblemProgress()
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		p.applyReview(0, at)
+	}
+	if p.EaseFactor != minEaseFactor {
+		t.Errorf("ease factor %.4f after repeated blackouts, want the floor %.2f", p.EaseFactor, minEaseFactor)
+	}
+}
@@ -0,0 +1,713 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Kinds of content that keep a revision for every save
+const (
+	RevisionSolution = "solution" // Target is the problem, field the language
+	RevisionProblem  = "problem"  // Field is one of problemRevisionColumns, as named in JSON
+	RevisionPattern  = "pattern"  // Field is theory
+	RevisionApproach = "approach" // Target is the approach, field the language
+)
+
+// problemRevisionColumns maps the markdown fields of a problem that keep
+// revisions to their columns
+var problemRevisionColumns = map[string]string{
+	"description":  "description",
+	"input":        "input",
+	"output":       "output",
+	"constraints":  "constraints",
+	"sampleInput":  "sample_input",
+	"sampleOutput": "sample_output",
+	"explanation":  "explanation",
+	"notes":        "notes",
+}
+
+const (
+	diffContextLines = 3
+	maxDiffEdits     = 2000  // Texts further apart than this are diffed as a whole replacement...
+	maxDiffLines     = 20000 // ...as are texts with more changed lines than this between their common ends
+)
+
+// Revision is an immutable copy of one field as it was saved
+type Revision struct {
+	ID           string    `json:"id"`
+	TargetType   string    `json:"targetType"`
+	TargetID     string    `json:"targetId"`
+	Field        string    `json:"field"`
+	Number       int       `json:"number"`            // Counts up from 1 for each field
+	Content      *string   `json:"content,omitempty"` // Left out of listings
+	AuthorID     string    `json:"authorId"`          // Empty for content saved before revisions were kept
+	AuthorEmail  string    `json:"authorEmail"`
+	RestoredFrom int       `json:"restoredFrom,omitempty"` // Number of the revision this one restored
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// problemRevisionContent returns the markdown fields of a problem that keep revisions
+func problemRevisionContent(p *Problem) map[string]string {
+	return map[string]string{
+		"description":  p.Description,
+		"input":        p.Input,
+		"output":       p.Output,
+		"constraints":  p.Constraints,
+		"sampleInput":  p.SampleInput,
+		"sampleOutput": p.SampleOutput,
+		"explanation":  p.Explanation,
+		"notes":        p.Notes,
+	}
+}
+
+// recordRevision keeps content as the next revision of a field if it differs
+// from previous, the content it replaced. When a field has no revisions yet,
+// previous is kept first without an author, so content saved before
+// revisions were kept is not lost.
+func (h *Handlers) recordRevision(workspaceID, targetType, targetID, field, previous, content, authorID string, restoredFrom int) error {
+	if content == previous {
+		return nil
+	}
+
+	var number int
+	query := h.DB.convertPlaceholders("SELECT COALESCE(MAX(number), 0) FROM revisions WHERE target_type = ? AND target_id = ? AND field = ?")
+	if err := h.DB.DB.QueryRow(query, targetType, targetID, field).Scan(&number); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	insertQuery := h.DB.convertPlaceholders(`INSERT INTO revisions (id, workspace_id, target_type, target_id, field, number, content, author_id, restored_from, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if number == 0 && previous != "" {
+		number++
+		if _, err := h.DB.DB.Exec(insertQuery, generateID(), workspaceID, targetType, targetID, field, number, previous, "", 0, now); err != nil {
+			return err
+		}
+	}
+	_, err := h.DB.DB.Exec(insertQuery, generateID(), workspaceID, targetType, targetID, field, number+1, content, authorID, restoredFrom, now)
+	return err
+}
+
+// recordProblemRevisions keeps a revision of each markdown field of a problem
+// that changed. before is nil for a new problem.
+func (h *Handlers) recordProblemRevisions(workspaceID string, before, after *Problem, authorID string) error {
+	previous := map[string]string{}
+	if before != nil {
+		previous = problemRevisionContent(before)
+	}
+	for field, content := range problemRevisionContent(after) {
+		if err := h.recordRevision(workspaceID, RevisionProblem, after.ID, field, previous[field], content, authorID, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteRevisions removes the history of a deleted approach
+func (h *Handlers) deleteRevisions(targetID string, targetTypes ...string) error {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(targetTypes)), ", ")
+	query := h.DB.convertPlaceholders("DELETE FROM revisions WHERE target_id = ? AND target_type IN (" + placeholders + ")")
+	args := []interface{}{targetID}
+	for _, targetType := range targetTypes {
+		args = append(args, targetType)
+	}
+	_, err := h.DB.DB.Exec(query, args...)
+	return err
+}
+
+// deleteRevisionsUnder removes the history of a category, pattern or problem
+// of a workspace and of everything under it. It runs in the transaction that
+// deletes the row, before the delete cascades, while the children can still
+// be found.
+func (h *Handlers) deleteRevisionsUnder(tx sqlExecer, workspaceID, table, id string) error {
+	patterns := "SELECT id FROM patterns WHERE id = ?"
+	problems := "SELECT id FROM problems WHERE pattern_id IN (" + patterns + ")"
+	switch table {
+	case "categories":
+		patterns = "SELECT id FROM patterns WHERE category_id = ?"
+		problems = "SELECT id FROM problems WHERE pattern_id IN (" + patterns + ")"
+	case "problems":
+		problems = "SELECT id FROM problems WHERE id = ?"
+	}
+
+	type scope struct {
+		targetTypes []string
+		ids         string // Subquery taking the ID of the deleted row
+	}
+	scopes := []scope{
+		{[]string{RevisionProblem, RevisionSolution}, problems},
+		{[]string{RevisionApproach}, "SELECT id FROM problem_approaches WHERE problem_id IN (" + problems + ")"},
+	}
+	if table != "problems" {
+		scopes = append(scopes, scope{[]string{RevisionPattern}, patterns})
+	}
+	for _, scope := range scopes {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(scope.targetTypes)), ", ")
+		query := h.DB.convertPlaceholders("DELETE FROM revisions WHERE workspace_id = ? AND target_type IN (" + placeholders + ") AND target_id IN (" + scope.ids + ")")
+		args := []interface{}{workspaceID}
+		for _, targetType := range scope.targetTypes {
+			args = append(args, targetType)
+		}
+		if _, err := tx.Exec(query, append(args, id)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revisionTarget is a field with revisions, resolved from a request
+type revisionTarget struct {
+	workspaceID string
+	targetType  string
+	targetID    string
+	field       string
+	// current returns the content as it is now
+	current func() (string, error)
+	// restore replaces the content as it is now
+	restore func(content string) error
+}
+
+// revisionTargetFunc resolves the target of a revisions request for a caller
+// with at least minRole in the workspace. On failure it writes the error
+// response and returns false.
+type revisionTargetFunc func(w http.ResponseWriter, r *http.Request, minRole string) (*revisionTarget, bool)
+
+// solutionRevisionTarget resolves /problems/{id}/solutions/{language}/revisions
+func (h *Handlers) solutionRevisionTarget(w http.ResponseWriter, r *http.Request, minRole string) (*revisionTarget, bool) {
+	vars := mux.Vars(r)
+	workspaceID, ok := h.requireProblemRole(w, r, vars["id"], minRole)
+	if !ok {
+		return nil, false
+	}
+	problemID, language := vars["id"], vars["language"]
+	return &revisionTarget{
+		workspaceID: workspaceID,
+		targetType:  RevisionSolution,
+		targetID:    problemID,
+		field:       language,
+		current: func() (string, error) {
+			code, _, err := h.loadStoredSolutionCode(problemID, language)
+			return code, err
+		},
+		restore: func(content string) error {
+			// An empty revision records that the solution was deleted
+			if content == "" {
+				return h.deleteSolution(problemID, language)
+			}
+			_, err := h.storeSolutionCode(problemID, language, content)
+			return err
+		},
+	}, true
+}
+
+// approachRevisionTarget resolves /problems/{id}/approaches/{approachId}/solutions/{language}/revisions
+func (h *Handlers) approachRevisionTarget(w http.ResponseWriter, r *http.Request, minRole string) (*revisionTarget, bool) {
+	vars := mux.Vars(r)
+	workspaceID, ok := h.requireProblemRole(w, r, vars["id"], minRole)
+	if !ok {
+		return nil, false
+	}
+	var exists bool
+	query := h.DB.convertPlaceholders("SELECT EXISTS(SELECT 1 FROM problem_approaches WHERE id = ? AND problem_id = ?)")
+	if err := h.DB.DB.QueryRow(query, vars["approachId"], vars["id"]).Scan(&exists); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return nil, false
+	}
+	if !exists {
+		respondWithError(w, http.StatusNotFound, "Approach not found")
+		return nil, false
+	}
+	approachID, language := vars["approachId"], vars["language"]
+	return &revisionTarget{
+		workspaceID: workspaceID,
+		targetType:  RevisionApproach,
+		targetID:    approachID,
+		field:       language,
+		current: func() (string, error) {
+			var code string
+			query := h.DB.convertPlaceholders("SELECT code FROM approach_solutions WHERE approach_id = ? AND language = ?")
+			err := h.DB.DB.QueryRow(query, approachID, language).Scan(&code)
+			if err == sql.ErrNoRows {
+				return "", nil
+			}
+			return code, err
+		},
+		restore: func(content string) error {
+			// An empty revision records that the language was removed
+			if content == "" {
+				query := h.DB.convertPlaceholders("DELETE FROM approach_solutions WHERE approach_id = ? AND language = ?")
+				_, err := h.DB.DB.Exec(query, approachID, language)
+				return err
+			}
+			now := time.Now()
+			query := h.DB.convertPlaceholders("UPDATE approach_solutions SET code = ?, updated_at = ? WHERE approach_id = ? AND language = ?")
+			result, err := h.DB.DB.Exec(query, content, now, approachID, language)
+			if err != nil {
+				return err
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				return nil
+			}
+			query = h.DB.convertPlaceholders("INSERT INTO approach_solutions (id, approach_id, language, code, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)")
+			_, err = h.DB.DB.Exec(query, generateID(), approachID, language, content, now, now)
+			return err
+		},
+	}, true
+}
+
+// problemRevisionTarget resolves /problems/{id}/fields/{field}/revisions
+func (h *Handlers) problemRevisionTarget(w http.ResponseWriter, r *http.Request, minRole string) (*revisionTarget, bool) {
+	vars := mux.Vars(r)
+	column, ok := problemRevisionColumns[vars["field"]]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Problem field has no revisions")
+		return nil, false
+	}
+	workspaceID, ok := h.requireProblemRole(w, r, vars["id"], minRole)
+	if !ok {
+		return nil, false
+	}
+	problemID := vars["id"]
+	return &revisionTarget{
+		workspaceID: workspaceID,
+		targetType:  RevisionProblem,
+		targetID:    problemID,
+		field:       vars["field"],
+		current: func() (string, error) {
+			var content string
+			query := h.DB.convertPlaceholders("SELECT " + column + " FROM problems WHERE id = ?")
+			err := h.DB.DB.QueryRow(query, problemID).Scan(&content)
+			return content, err
+		},
+		restore: func(content string) error {
+			query := h.DB.convertPlaceholders("UPDATE problems SET " + column + " = ?, updated_at = ? WHERE id = ?")
+			_, err := h.DB.DB.Exec(query, content, time.Now(), problemID)
+			return err
+		},
+	}, true
+}
+
+// patternRevisionTarget resolves /patterns/{id}/theory/revisions
+func (h *Handlers) patternRevisionTarget(w http.ResponseWriter, r *http.Request, minRole string) (*revisionTarget, bool) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, minRole)
+	if !ok {
+		return nil, false
+	}
+	patternID := mux.Vars(r)["id"]
+	found, err := h.inWorkspace("patterns", patternID, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return nil, false
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Pattern not found")
+		return nil, false
+	}
+	return &revisionTarget{
+		workspaceID: workspaceID,
+		targetType:  RevisionPattern,
+		targetID:    patternID,
+		field:       "theory",
+		current: func() (string, error) {
+			var theory string
+			query := h.DB.convertPlaceholders("SELECT COALESCE(theory, '') FROM patterns WHERE id = ?")
+			err := h.DB.DB.QueryRow(query, patternID).Scan(&theory)
+			return theory, err
+		},
+		restore: func(content string) error {
+			query := h.DB.convertPlaceholders("UPDATE patterns SET theory = ?, updated_at = ? WHERE id = ?")
+			_, err := h.DB.DB.Exec(query, content, time.Now(), patternID)
+			return err
+		},
+	}, true
+}
+
+// requireProblemRole checks the caller's workspace role and that the problem
+// belongs to the workspace
+func (h *Handlers) requireProblemRole(w http.ResponseWriter, r *http.Request, problemID, minRole string) (string, bool) {
+	if minRole == WorkspaceRoleEditor {
+		return h.requireEditableProblem(w, r, problemID)
+	}
+	return h.requireProblemInWorkspace(w, r, problemID)
+}
+
+const revisionColumns = "r.id, r.target_type, r.target_id, r.field, r.number, r.author_id, COALESCE(u.email, ''), r.restored_from, r.created_at"
+
+func scanRevision(scan func(dest ...interface{}) error, content *string) (*Revision, error) {
+	var rev Revision
+	dest := []interface{}{&rev.ID, &rev.TargetType, &rev.TargetID, &rev.Field, &rev.Number, &rev.AuthorID, &rev.AuthorEmail, &rev.RestoredFrom, &rev.CreatedAt}
+	if content != nil {
+		dest = append(dest, content)
+		rev.Content = content
+	}
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// loadRevision returns a revision of a target with its content, or nil if there is none
+func (h *Handlers) loadRevision(t *revisionTarget, number int) (*Revision, error) {
+	query := h.DB.convertPlaceholders(`
+		SELECT ` + revisionColumns + `, r.content
+		FROM revisions r LEFT JOIN users u ON u.id = r.author_id
+		WHERE r.target_type = ? AND r.target_id = ? AND r.field = ? AND r.number = ?
+	`)
+	var content string
+	rev, err := scanRevision(h.DB.DB.QueryRow(query, t.targetType, t.targetID, t.field, number).Scan, &content)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rev, err
+}
+
+// revisionNumber reads a revision number from a route variable or query
+// parameter and loads that revision. On failure it writes the error response
+// and returns false.
+func (h *Handlers) revisionNumber(w http.ResponseWriter, t *revisionTarget, name, value string) (*Revision, bool) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < 1 {
+		respondWithError(w, http.StatusBadRequest, name+" must be a revision number")
+		return nil, false
+	}
+	rev, err := h.loadRevision(t, number)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return nil, false
+	}
+	if rev == nil {
+		respondWithError(w, http.StatusNotFound, fmt.Sprintf("Revision %d not found", number))
+		return nil, false
+	}
+	return rev, true
+}
+
+// ListRevisions lists the revisions of a field, newest first, without their content
+func (h *Handlers) ListRevisions(target revisionTargetFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := target(w, r, WorkspaceRoleViewer)
+		if !ok {
+			return
+		}
+
+		query := h.DB.convertPlaceholders(`
+			SELECT ` + revisionColumns + `
+			FROM revisions r LEFT JOIN users u ON u.id = r.author_id
+			WHERE r.target_type = ? AND r.target_id = ? AND r.field = ?
+			ORDER BY r.number DESC
+		`)
+		rows, err := h.DB.DB.Query(query, t.targetType, t.targetID, t.field)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		defer rows.Close()
+
+		revisions := []Revision{}
+		for rows.Next() {
+			rev, err := scanRevision(rows.Scan, nil)
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "Error scanning revision")
+				return
+			}
+			revisions = append(revisions, *rev)
+		}
+
+		respondWithJSON(w, http.StatusOK, revisions)
+	}
+}
+
+// GetRevision returns one revision of a field with its content
+func (h *Handlers) GetRevision(target revisionTargetFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := target(w, r, WorkspaceRoleViewer)
+		if !ok {
+			return
+		}
+		rev, ok := h.revisionNumber(w, t, "revision", mux.Vars(r)["revision"])
+		if !ok {
+			return
+		}
+		respondWithJSON(w, http.StatusOK, rev)
+	}
+}
+
+// DiffRevisions returns a unified diff from the revision numbered by the
+// from query parameter to the one numbered by to
+func (h *Handlers) DiffRevisions(target revisionTargetFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := target(w, r, WorkspaceRoleViewer)
+		if !ok {
+			return
+		}
+		from, ok := h.revisionNumber(w, t, "from", r.URL.Query().Get("from"))
+		if !ok {
+			return
+		}
+		to, ok := h.revisionNumber(w, t, "to", r.URL.Query().Get("to"))
+		if !ok {
+			return
+		}
+
+		respondWithJSON(w, http.StatusOK, map[string]interface{}{
+			"from": from.Number,
+			"to":   to.Number,
+			"diff": unifiedDiff(
+				fmt.Sprintf("%s@%d", t.field, from.Number), *from.Content,
+				fmt.Sprintf("%s@%d", t.field, to.Number), *to.Content,
+			),
+		})
+	}
+}
+
+// RestoreRevision makes an old revision the current content, which is kept
+// as a new revision pointing back to the old one
+func (h *Handlers) RestoreRevision(target revisionTargetFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t, ok := target(w, r, WorkspaceRoleEditor)
+		if !ok {
+			return
+		}
+		rev, ok := h.revisionNumber(w, t, "revision", mux.Vars(r)["revision"])
+		if !ok {
+			return
+		}
+
+		current, err := t.current()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if current == *rev.Content {
+			respondWithError(w, http.StatusConflict, "Revision matches the current content")
+			return
+		}
+		if err := t.restore(*rev.Content); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error restoring revision")
+			return
+		}
+		if err := h.recordRevision(t.workspaceID, t.targetType, t.targetID, t.field, current, *rev.Content, getUserID(r), rev.Number); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error saving revision")
+			return
+		}
+		h.audit(r, AuditRevisionRestore, t.targetType, t.targetID, t.workspaceID,
+			map[string]string{t.field: current}, map[string]string{t.field: *rev.Content})
+
+		var latest int
+		query := h.DB.convertPlaceholders("SELECT MAX(number) FROM revisions WHERE target_type = ? AND target_id = ? AND field = ?")
+		if err := h.DB.DB.QueryRow(query, t.targetType, t.targetID, t.field).Scan(&latest); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		restored, err := h.loadRevision(t, latest)
+		if err != nil || restored == nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, restored)
+	}
+}
+
+// diffLine is one line of an edit script: ' ' kept, '-' removed or '+' added
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// splitLines splits text into lines that keep their newline, so a missing
+// newline at the end counts as a change
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script from a to b, found with Myers'
+// algorithm. Past maxDiffEdits or maxDiffLines the middle is replaced as a
+// whole.
+func diffLines(a, b []string) []diffLine {
+	// Common ends need no search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	script := make([]diffLine, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		script = append(script, diffLine{' ', line})
+	}
+	script = append(script, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		script = append(script, diffLine{' ', line})
+	}
+	return script
+}
+
+// diffMiddle runs Myers' search on the texts between the common ends. The
+// frontier v is indexed by diagonal k = x - y; before step d only diagonals
+// -d-1 to d+1 are read, so that window is all each step keeps for the
+// backtrack.
+func diffMiddle(a, b []string) []diffLine {
+	n, m := len(a), len(b)
+	if n+m > maxDiffLines {
+		return replaceLines(a, b)
+	}
+	maxD := min(n+m, maxDiffEdits)
+	offset := maxD + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackDiff(a, b, trace)
+			}
+		}
+	}
+	return replaceLines(a, b)
+}
+
+// replaceLines is the edit script that removes all of a and adds all of b
+func replaceLines(a, b []string) []diffLine {
+	script := make([]diffLine, 0, len(a)+len(b))
+	for _, line := range a {
+		script = append(script, diffLine{'-', line})
+	}
+	for _, line := range b {
+		script = append(script, diffLine{'+', line})
+	}
+	return script
+}
+
+// backtrackDiff walks the saved frontiers of diffMiddle back from the end.
+// trace[d] holds diagonals -d-1 to d+1, so diagonal k is at index k+d+1.
+func backtrackDiff(a, b []string, trace [][]int) []diffLine {
+	var reversed []diffLine
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && v[k+d] < v[k+d+2]) {
+			prevK = k + 1
+		}
+		prevX := v[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffLine{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffLine{'+', b[y-1]})
+			} else {
+				reversed = append(reversed, diffLine{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	script := make([]diffLine, len(reversed))
+	for i, line := range reversed {
+		script[len(reversed)-1-i] = line
+	}
+	return script
+}
+
+// unifiedDiff renders the changes from a to b in unified format with
+// diffContextLines of context, or "" when they are equal
+func unifiedDiff(fromName, a, toName, b string) string {
+	script := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	changed := false
+	for start := 0; start < len(script); {
+		if script[start].op == ' ' {
+			start++
+			continue
+		}
+		changed = true
+
+		// A hunk runs until a change is followed by more unchanged lines
+		// than the context on both sides would cover
+		end := start
+		for i := start; i < len(script) && i-end <= 2*diffContextLines; i++ {
+			if script[i].op != ' ' {
+				end = i + 1
+			}
+		}
+		first := max(start-diffContextLines, 0)
+		last := min(end+diffContextLines, len(script))
+
+		aStart, bStart := 1, 1
+		for _, line := range script[:first] {
+			if line.op != '+' {
+				aStart++
+			}
+			if line.op != '-' {
+				bStart++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, line := range script[first:last] {
+			if line.op != '+' {
+				aCount++
+			}
+			if line.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, line := range script[first:last] {
+			out.WriteByte(line.op)
+			out.WriteString(line.text)
+			if !strings.HasSuffix(line.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = last
+	}
+
+	if !changed {
+		return ""
+	}
+	return out.String()
+}
+
+// hunkRange formats the start and length of one side of a hunk. An empty
+// side starts at the line before it, as in GNU diff.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return strconv.Itoa(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	tests := map[string][]string{
+		"":         {},
+		"a":        {"a"},
+		"a\n":      {"a\n"},
+		"a\nb":     {"a\n", "b"},
+		"a\n\nb\n": {"a\n", "\n", "b\n"},
+	}
+	for text, want := range tests {
+		if got := splitLines(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("splitLines(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+// lcsLength is the quadratic dynamic program the edit scripts are checked against
+func lcsLength(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(cur[j], prev[j+1])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// applyScript returns the two texts an edit script leads from and to, and
+// the number of edits in it
+func applyScript(script []diffLine) (from, to []string, edits int) {
+	from, to = []string{}, []string{}
+	for _, line := range script {
+		if line.op != '+' {
+			from = append(from, line.text)
+		}
+		if line.op != '-' {
+			to = append(to, line.text)
+		}
+		if line.op != ' ' {
+			edits++
+		}
+	}
+	return from, to, edits
+}
+
+func TestDiffLinesIsShortestEditScript(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a'+rng.Intn(4))) + "\n"
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := randomLines(), randomLines()
+		from, to, edits := applyScript(diffLines(a, b))
+		if !reflect.DeepEqual(from, a) || !reflect.DeepEqual(to, b) {
+			t.Fatalf("diffLines(%q, %q) does not turn one into the other", a, b)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+			t.Fatalf("diffLines(%q, %q) has %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+// interleavedLines returns count distinct lines with a shared line between
+// each pair, so a minimal diff keeps count-1 lines and edits 2*count
+func interleavedLines(prefix string, count int) []string {
+	lines := make([]string, 0, 2*count-1)
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			lines = append(lines, "shared\n")
+		}
+		lines = append(lines, prefix+strconv.Itoa(i)+"\n")
+	}
+	return lines
+}
+
+func TestDiffLinesFallsBackToReplacement(t *testing.T) {
+	tests := []struct {
+		name        string
+		count       int
+		wantReplace bool
+	}{
+		{"at the edit limit", maxDiffEdits / 2, false},
+		{"past the edit limit", maxDiffEdits/2 + 1, true},
+	}
+	for _, tt := range tests {
+		a, b := interleavedLines("a", tt.count), interleavedLines("b", tt.count)
+		from, to, edits := applyScript(diffLines(a, b))
+		if !reflect.DeepEqual(from, a) || !reflect.DeepEqual(to, b) {
+			t.Fatalf("%s: the edit script does not turn one text into the other", tt.name)
+		}
+		want := 2 * tt.count
+		if tt.wantReplace {
+			want = len(a) + len(b)
+		}
+		if edits != want {
+			t.Errorf("%s: %d edits, want %d", tt.name, edits, want)
+		}
+	}
+
+	// Long texts are replaced even when they differ only at their ends
+	middle := interleavedLines("", maxDiffLines/4)
+	a := append(append([]string{"a first\n"}, middle...), "a last\n")
+	b := append(append([]string{"b first\n"}, middle...), "b last\n")
+	if _, _, edits := applyScript(diffLines(a, b)); edits != len(a)+len(b) {
+		t.Errorf("past the line limit: %d edits, want %d", edits, len(a)+len(b))
+	}
+
+	// Common ends are kept even when the middle is replaced
+	a = append(append([]string{"first\n"}, interleavedLines("a", maxDiffEdits)...), "last\n")
+	b = append(append([]string{"first\n"}, interleavedLines("b", maxDiffEdits)...), "last\n")
+	script := diffLines(a, b)
+	if script[0] != (diffLine{' ', "first\n"}) || script[len(script)-1] != (diffLine{' ', "last\n"}) {
+		t.Errorf("replacement script starts with %q and ends with %q, want the common lines kept",
+			script[0], script[len(script)-1])
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	numbered := func(lines ...string) string { return strings.Join(lines, "\n") + "\n" }
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{
+			"changed line",
+			"a\nb\nc\n", "a\nB\nc\n",
+			"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			"distant changes",
+			numbered("1", "2", "3", "4", "5", "6", "7", "8", "9", "10"),
+			numbered("one", "2", "3", "4", "5", "6", "7", "8", "9", "ten"),
+			"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			"nearby changes",
+			numbered("1", "2", "3", "4", "5", "6", "7", "8"),
+			numbered("one", "2", "3", "4", "5", "6", "7", "eight"),
+			"@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+		{"added to empty", "", "x\n", "@@ -0,0 +1 @@\n+x\n"},
+		{"removed all", "x\ny\n", "", "@@ -1,2 +0,0 @@\n-x\n-y\n"},
+		{
+			"newline removed at end",
+			"x\n", "x",
+			"@@ -1 +1 @@\n-x\n+x\n\\ No newline at end of file\n",
+		},
+		{
+			"line added after one without newline",
+			"x", "x\ny\n",
+			"@@ -1 +1,2 @@\n-x\n\\ No newline at end of file\n+x\n+y\n",
+		},
+	}
+	for _, tt := range tests {
+		want := tt.want
+		if want != "" {
+			want = "--- from\n+++ to\n" + want
+		}
+		if got := unifiedDiff("from", tt.a, "to", tt.b); got != want {
+			t.Errorf("%s: unifiedDiff =\n%s\nwant\n%s", tt.name, got, want)
+		}
+	}
+}
+
+func TestHunkRange(t *testing.T) {
+	tests := []struct {
+		start, count int
+		want         string
+	}{
+		{1, 0, "0,0"},
+		{5, 0, "4,0"},
+		{3, 1, "3"},
+		{3, 4, "3,4"},
+	}
+	for _, tt := range tests {
+		if got := hunkRange(tt.start, tt.count); got != tt.want {
+			t.Errorf("hunkRange(%d, %d) = %q, want %q", tt.start, tt.count, got, tt.want)
+		}
+	}
+}
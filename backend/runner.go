@@ -0,0 +1,711 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Run statuses
+const (
+	RunOK           = "ok"
+	RunCompileError = "compile_error"
+	RunRuntimeError = "runtime_error"
+	RunTimeLimit    = "time_limit"
+	RunMemoryLimit  = "memory_limit"
+)
+
+// Fixed limits of the sandbox
+const (
+	maxRunOutputBytes   = 64 * 1024
+	maxRunFileBytes     = 10 * 1024 * 1024
+	maxRunStdinBytes    = 16 * 1024 * 1024
+	maxRunProcesses     = 64 // Processes and threads of one run
+	maxCompileProcesses = 512
+	compileCPUSeconds   = 120
+	compileMemoryMB     = 2048
+)
+
+var (
+	ErrUnsupportedLanguage = errors.New("unsupported language")
+	ErrToolchainMissing    = errors.New("toolchain not installed")
+	ErrSandboxUnavailable  = errors.New("sandbox unavailable")
+)
+
+// outOfMemoryPattern recognises allocation failures in runtimes that are
+// limited by address space, where hitting the limit surfaces as an error
+// rather than a kill
+var outOfMemoryPattern = regexp.MustCompile(`MemoryError|bad_alloc|out of memory|cannot allocate memory`)
+
+// runnerLanguage describes how to build and start programs in one language.
+// {mem} in an argument or variable is replaced by the memory limit in MiB.
+type runnerLanguage struct {
+	Source  string
+	Compile []string // nil for interpreted languages
+	Run     []string
+	RunEnv  []string
+	// LimitAddressSpace enforces the memory limit with RLIMIT_AS. Runtimes
+	// that reserve large virtual ranges up front are limited by heap flags
+	// and killed once their sampled RSS goes over the limit instead.
+	LimitAddressSpace bool
+	// CompileLimitAddressSpace is LimitAddressSpace for the compiler
+	CompileLimitAddressSpace bool
+}
+
+var runnerLanguages = map[string]runnerLanguage{
+	"cpp": {
+		Source:                   "main.cpp",
+		Compile:                  []string{"g++", "-O2", "-std=c++17", "-o", "main", "main.cpp"},
+		Run:                      []string{"./main"},
+		LimitAddressSpace:        true,
+		CompileLimitAddressSpace: true,
+	},
+	"go": {
+		Source:                   "main.go",
+		Compile:                  []string{"go", "build", "-o", "main", "main.go"},
+		Run:                      []string{"./main"},
+		RunEnv:                   []string{"GOMEMLIMIT={mem}MiB"},
+		CompileLimitAddressSpace: true,
+	},
+	"python": {
+		Source:            "main.py",
+		Run:               []string{"python3", "main.py"},
+		LimitAddressSpace: true,
+	},
+	"java": {
+		Source:  "Main.java",
+		Compile: []string{"javac", "-J-Xmx{mem}m", "Main.java"},
+		Run:     []string{"java", "-Xmx{mem}m", "-Xss64m", "-cp", ".", "Main"},
+	},
+	"javascript": {
+		Source: "main.js",
+		Run:    []string{"node", "--max-old-space-size={mem}", "main.js"},
+	},
+}
+
+// RunnerConfig holds the sandbox limits. Requests may lower the time and
+// memory limits but not raise them.
+type RunnerConfig struct {
+	TimeLimit      time.Duration // CPU time per run
+	WallLimit      time.Duration // Wall-clock time per run
+	MemoryLimitMB  int
+	CompileTimeout time.Duration
+	MaxConcurrent  int
+	CacheDir       string // Build caches shared between compiles
+	Path           string // PATH searched for toolchains inside the sandbox
+	SandboxUID     int    // First of MaxConcurrent consecutive uids that sandboxed processes run as
+}
+
+// Runner compiles and runs untrusted programs in sandboxed subprocesses.
+// Each process gets its own mount, PID, network, IPC and UTS namespaces, a root
+// holding only the toolchains and a throwaway working directory, a dedicated
+// unprivileged uid, CPU time, memory, file size and process limits and a
+// wall-clock timeout. See runSandboxInit.
+type Runner struct {
+	Config RunnerConfig
+	slots  chan int // Free slots; slot i runs as Config.SandboxUID + i
+}
+
+// NewRunner creates a runner
+func NewRunner(config RunnerConfig) *Runner {
+	if config.MaxConcurrent < 1 {
+		config.MaxConcurrent = 1
+	}
+	slots := make(chan int, config.MaxConcurrent)
+	for slot := 0; slot < config.MaxConcurrent; slot++ {
+		slots <- slot
+	}
+	return &Runner{Config: config, slots: slots}
+}
+
+// RunLimits are the limits of a single run
+type RunLimits struct {
+	TimeLimit   time.Duration
+	MemoryMB    int
+	OutputBytes int // Captured per stream, maxRunOutputBytes when 0
+}
+
+// RunResult is the outcome of compiling or running a program
+type RunResult struct {
+	Status          string `json:"status"` // ok, compile_error, runtime_error, time_limit, memory_limit
+	Stdout          string `json:"stdout"`
+	Stderr          string `json:"stderr"`
+	OutputTruncated bool   `json:"outputTruncated,omitempty"` // stdout or stderr went over 64 KiB
+	ExitCode        int    `json:"exitCode"`                  // -1 when killed by a signal
+	Signal          string `json:"signal,omitempty"`
+	TimeMs          int64  `json:"timeMs"`    // Wall-clock time
+	CPUTimeMs       int64  `json:"cpuTimeMs"` // User and system CPU time
+	MemoryKB        int64  `json:"memoryKb"`  // Peak resident set size; see measurePeakMemory
+}
+
+// Program is a compiled program ready to run any number of times
+type Program struct {
+	runner   *Runner
+	language runnerLanguage
+	dir      string
+}
+
+// WriteFile puts a file in the program's working directory, where the next run can read it
+func (p *Program) WriteFile(name, content string) error {
+	return os.WriteFile(filepath.Join(p.dir, name), []byte(content), 0644)
+}
+
+// Close removes the program's working directory
+func (p *Program) Close() {
+	os.RemoveAll(p.dir)
+}
+
+// limitedBuffer keeps the first max bytes written to it and drops the rest
+type limitedBuffer struct {
+	data      []byte
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - len(b.data); room < len(p) {
+		b.data = append(b.data, p[:max(room, 0)]...)
+		b.truncated = true
+	} else {
+		b.data = append(b.data, p...)
+	}
+	return len(p), nil
+}
+
+// lookPath finds a toolchain binary in the sandbox PATH rather than the
+// server's, which may point at per-user installs the sandbox cannot read
+func (r *Runner) lookPath(name string) (string, error) {
+	for _, dir := range filepath.SplitList(r.Config.Path) {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrToolchainMissing, name)
+}
+
+// Available reports whether a language is supported and its toolchain installed
+func (r *Runner) Available(language string) error {
+	lang, ok := runnerLanguages[language]
+	if !ok {
+		return ErrUnsupportedLanguage
+	}
+	for _, command := range [][]string{lang.Compile, lang.Run} {
+		if len(command) == 0 || strings.HasPrefix(command[0], "./") {
+			continue
+		}
+		if _, err := r.lookPath(command[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// acquire waits for a free sandbox slot. Slots have their own uid, so
+// concurrent runs cannot signal each other or share a process limit.
+func (r *Runner) acquire(ctx context.Context) (int, error) {
+	select {
+	case slot := <-r.slots:
+		return slot, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func (r *Runner) release(slot int) {
+	r.slots <- slot
+}
+
+// slotUID is the uid processes in a slot run as
+func (r *Runner) slotUID(slot int) int {
+	return r.Config.SandboxUID + slot
+}
+
+// Compile writes source code to a fresh working directory and builds it. A
+// compile error is returned as a result with status compile_error and no
+// program; err is only set when the sandbox itself failed.
+func (r *Runner) Compile(ctx context.Context, language, code string) (*Program, *RunResult, error) {
+	if err := r.Available(language); err != nil {
+		return nil, nil, err
+	}
+	lang := runnerLanguages[language]
+
+	dir, err := os.MkdirTemp("", "algovault-run-")
+	if err != nil {
+		return nil, nil, err
+	}
+	program := &Program{runner: r, language: lang, dir: dir}
+	if err := os.WriteFile(filepath.Join(dir, lang.Source), []byte(code), 0644); err != nil {
+		program.Close()
+		return nil, nil, err
+	}
+
+	if lang.Compile != nil {
+		slot, err := r.acquire(ctx)
+		if err != nil {
+			program.Close()
+			return nil, nil, err
+		}
+		defer r.release(slot)
+
+		// Each slot has a build cache of its own, writable only by its uid
+		cacheDir := filepath.Join(r.Config.CacheDir, strconv.Itoa(slot))
+		if err := prepareCacheDir(cacheDir, r.slotUID(slot)); err != nil {
+			program.Close()
+			return nil, nil, err
+		}
+
+		withMemory := memorySubstituter(compileMemoryMB)
+		spec := sandboxSpec{
+			uid:        r.slotUID(slot),
+			cpuSeconds: compileCPUSeconds,
+			fileBytes:  0, // Build caches hold large archives
+			processes:  maxCompileProcesses,
+			wallLimit:  r.Config.CompileTimeout,
+			mounts:     []sandboxMount{{Source: cacheDir, Target: sandboxCacheDir, Writable: true}},
+			env: append(withMemory(lang.RunEnv),
+				"GOCACHE="+filepath.Join(sandboxCacheDir, "go-build"),
+				"GOPATH="+filepath.Join(sandboxCacheDir, "gopath"),
+				"GOTOOLCHAIN=local",
+				"GO111MODULE=off",
+				"CGO_ENABLED=0",
+			),
+		}
+		if lang.CompileLimitAddressSpace {
+			spec.addressSpaceKB = compileMemoryMB * 1024
+		} else {
+			spec.rssLimitKB = compileMemoryMB * 1024
+		}
+
+		result, err := r.execute(ctx, dir, withMemory(lang.Compile), "", spec)
+		if err != nil {
+			program.Close()
+			return nil, nil, err
+		}
+		if result.Status != RunOK {
+			program.Close()
+			result.Status = RunCompileError
+			return nil, result, nil
+		}
+	}
+
+	return program, nil, nil
+}
+
+// Run runs the program once with the given stdin
+func (p *Program) Run(ctx context.Context, stdin string, limits RunLimits) (*RunResult, error) {
+	r := p.runner
+	if limits.TimeLimit <= 0 || limits.TimeLimit > r.Config.TimeLimit {
+		limits.TimeLimit = r.Config.TimeLimit
+	}
+	if limits.MemoryMB <= 0 || limits.MemoryMB > r.Config.MemoryLimitMB {
+		limits.MemoryMB = r.Config.MemoryLimitMB
+	}
+
+	withMemory := memorySubstituter(limits.MemoryMB)
+	args := withMemory(p.language.Run)
+
+	slot, err := r.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.release(slot)
+
+	spec := sandboxSpec{
+		uid: r.slotUID(slot),
+		// The kernel limit is in whole seconds and only a backstop; CPU time is checked exactly below
+		cpuSeconds:  int((limits.TimeLimit+time.Second-1)/time.Second) + 1,
+		fileBytes:   maxRunFileBytes,
+		processes:   maxRunProcesses,
+		wallLimit:   r.Config.WallLimit,
+		outputBytes: limits.OutputBytes,
+		env:         withMemory(p.language.RunEnv),
+	}
+	if p.language.LimitAddressSpace {
+		spec.addressSpaceKB = limits.MemoryMB * 1024
+	} else {
+		spec.rssLimitKB = int64(limits.MemoryMB) * 1024
+	}
+
+	result, err := r.execute(ctx, p.dir, args, stdin, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	memoryLimitKB := int64(limits.MemoryMB) * 1024
+	switch {
+	case result.Status == RunTimeLimit || result.CPUTimeMs > limits.TimeLimit.Milliseconds() || result.Signal == syscall.SIGXCPU.String():
+		result.Status = RunTimeLimit
+	case result.MemoryKB > memoryLimitKB:
+		result.Status = RunMemoryLimit
+	case result.Status == RunRuntimeError && p.language.LimitAddressSpace && outOfMemoryPattern.MatchString(result.Stderr):
+		result.Status = RunMemoryLimit
+	}
+	return result, nil
+}
+
+// memorySubstituter returns a function that replaces {mem} in arguments or
+// variables with a memory limit in MiB
+func memorySubstituter(memoryMB int) func([]string) []string {
+	return func(values []string) []string {
+		replaced := make([]string, len(values))
+		for i, value := range values {
+			replaced[i] = strings.ReplaceAll(value, "{mem}", strconv.Itoa(memoryMB))
+		}
+		return replaced
+	}
+}
+
+// sandboxSpec are the limits and environment of one sandboxed process
+type sandboxSpec struct {
+	uid            int
+	cpuSeconds     int
+	fileBytes      int64 // Largest file the process may write, 0 for no limit
+	addressSpaceKB int   // 0 for no address space limit
+	rssLimitKB     int64 // Kill the process once its sampled RSS goes over this, 0 for no limit
+	processes      int   // Processes and threads the uid may have
+	wallLimit      time.Duration
+	outputBytes    int // Captured per stream, maxRunOutputBytes when 0
+	mounts         []sandboxMount
+	env            []string
+}
+
+// execute runs a command in dir inside the sandbox. The server binary is
+// started again as the sandbox's init, which confines itself and then execs
+// the command, so the measured process is the command itself. Without the
+// privileges to set up namespaces and switch users nothing runs and
+// ErrSandboxUnavailable is returned.
+func (r *Runner) execute(ctx context.Context, dir string, command []string, stdin string, spec sandboxSpec) (*RunResult, error) {
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("%w: the server must run as root to isolate programs", ErrSandboxUnavailable)
+	}
+	if !strings.HasPrefix(command[0], "./") {
+		path, err := r.lookPath(command[0])
+		if err != nil {
+			return nil, err
+		}
+		command = append([]string{path}, command[1:]...)
+	}
+
+	root := filepath.Join(os.TempDir(), "algovault-sandbox-root")
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSandboxUnavailable, err)
+	}
+	if err := chownTree(dir, spec.uid); err != nil {
+		return nil, err
+	}
+	config, err := json.Marshal(sandboxInit{
+		Root:           root,
+		Mounts:         append(append(sandboxMounts(r.Config.Path), sandboxMount{Source: dir, Target: sandboxWorkDir, Writable: true}), spec.mounts...),
+		UID:            spec.uid,
+		CPUSeconds:     uint64(spec.cpuSeconds),
+		FileBytes:      uint64(spec.fileBytes),
+		AddressSpaceKB: uint64(spec.addressSpaceKB),
+		Processes:      uint64(spec.processes),
+		Command:        command,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The init reports setup failures on this pipe; it closes without a word once the command starts
+	statusReader, statusWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer statusReader.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, spec.wallLimit)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", sandboxInitArg, string(config))
+	cmd.Env = append([]string{"PATH=" + r.Config.Path, "HOME=" + sandboxWorkDir, "TMPDIR=" + sandboxWorkDir, "LANG=C.UTF-8"}, spec.env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.ExtraFiles = []*os.File{statusWriter}
+	outputBytes := spec.outputBytes
+	if outputBytes <= 0 {
+		outputBytes = maxRunOutputBytes
+	}
+	stdout := &limitedBuffer{max: outputBytes}
+	stderr := &limitedBuffer{max: outputBytes}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:    true,
+		Cloneflags: syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+	}
+	// Kill the whole process group so children cannot outlive the run
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	serverPeakKB := readPeakMemoryKB(os.Getpid())
+	start := time.Now()
+	err = cmd.Start()
+	statusWriter.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSandboxUnavailable, err)
+	}
+	if status, _ := io.ReadAll(statusReader); len(status) > 0 {
+		cmd.Wait()
+		return nil, fmt.Errorf("%w: %s", ErrSandboxUnavailable, status)
+	}
+	sampledPeakKB := samplePeakMemory(cmd.Process.Pid, spec.rssLimitKB, func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	})
+	waitErr := cmd.Wait()
+	elapsed := time.Since(start)
+	// Background processes left behind by the program die with it
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+
+	result := &RunResult{
+		Status:          RunOK,
+		Stdout:          string(stdout.data),
+		Stderr:          string(stderr.data),
+		OutputTruncated: stdout.truncated || stderr.truncated,
+		TimeMs:          elapsed.Milliseconds(),
+	}
+	state := cmd.ProcessState
+	if state == nil {
+		return nil, waitErr
+	}
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		result.CPUTimeMs = (usage.Utime.Nano() + usage.Stime.Nano()) / int64(time.Millisecond)
+		result.MemoryKB = measurePeakMemory(usage.Maxrss, serverPeakKB, sampledPeakKB())
+	}
+	result.ExitCode = state.ExitCode()
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		result.Signal = status.Signal().String()
+	}
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		result.Status = RunTimeLimit
+	case result.ExitCode != 0:
+		result.Status = RunRuntimeError
+	}
+	return result, nil
+}
+
+// measurePeakMemory picks the best available peak RSS of a finished process.
+// The kernel records the spawning process's peak RSS in the child's maxrss
+// when it execs, so rusage can only be trusted above the server's own peak
+// at spawn time. Below that, the peak sampled from /proc while the process
+// ran is used; it may miss growth in the last few milliseconds. A sample can
+// also read slightly above rusage, as when it triggered a kill.
+func measurePeakMemory(rusageKB, serverPeakKB, sampledKB int64) int64 {
+	if serverPeakKB > 0 && rusageKB > serverPeakKB {
+		return max(rusageKB, sampledKB)
+	}
+	if sampledKB > 0 || serverPeakKB > 0 {
+		return sampledKB
+	}
+	return rusageKB
+}
+
+// samplePeakMemory polls a process's peak RSS until it exits, calling kill
+// once if it goes over limitKB. The returned function stops polling and
+// reports the highest value seen.
+func samplePeakMemory(pid int, limitKB int64, kill func()) func() int64 {
+	var mu sync.Mutex
+	var peak int64
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(5 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			if kb := readPeakMemoryKB(pid); kb > 0 {
+				mu.Lock()
+				peak = max(peak, kb)
+				mu.Unlock()
+				if limitKB > 0 && kb > limitKB {
+					kill()
+					limitKB = 0
+				}
+			}
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() int64 {
+		close(done)
+		<-stopped
+		mu.Lock()
+		defer mu.Unlock()
+		return peak
+	}
+}
+
+// readPeakMemoryKB reads VmHWM from /proc, or 0 if it is unavailable
+func readPeakMemoryKB(pid int) int64 {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "VmHWM:"); ok {
+			kb, _ := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			return kb
+		}
+	}
+	return 0
+}
+
+// prepareCacheDir creates a slot's build cache and hands it to the slot's uid
+func prepareCacheDir(dir string, uid int) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) == uid {
+		return nil
+	}
+	return chownTree(dir, uid)
+}
+
+// chownTree hands a working directory to the sandbox user
+func chownTree(dir string, uid int) error {
+	return filepath.WalkDir(dir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, uid)
+	})
+}
+
+// runnerErrorStatus maps runner errors to HTTP responses
+func runnerErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrUnsupportedLanguage):
+		return http.StatusBadRequest, "Language cannot be run"
+	case errors.Is(err, ErrToolchainMissing):
+		return http.StatusNotImplemented, "Toolchain is not installed on this server"
+	case errors.Is(err, ErrSandboxUnavailable):
+		return http.StatusServiceUnavailable, "Sandbox is not available on this server"
+	case errors.Is(err, context.Canceled):
+		return http.StatusRequestTimeout, "Request cancelled"
+	}
+	return http.StatusInternalServerError, "Error running code"
+}
+
+// loadSolutionCode returns the stored code of a problem's solution in a
+// language, falling back to its first approach in that language, or false if
+// there is neither
+func (h *Handlers) loadSolutionCode(problemID, language string) (string, bool, error) {
+	code, found, err := h.loadStoredSolutionCode(problemID, language)
+	if err == nil && !found {
+		return h.loadApproachCode(problemID, language)
+	}
+	return code, found, err
+}
+
+// loadStoredSolutionCode returns the code of a problem's solution in a
+// language from the solutions table alone, or false if there is none
+func (h *Handlers) loadStoredSolutionCode(problemID, language string) (string, bool, error) {
+	var code string
+	query := h.DB.convertPlaceholders("SELECT code FROM solutions WHERE problem_id = ? AND language = ? ORDER BY updated_at DESC LIMIT 1")
+	err := h.DB.DB.QueryRow(query, problemID, language).Scan(&code)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	return code, err == nil, err
+}
+
+// runLimits validates per-request limits, which may only tighten the
+// server's. Zero means the server's limit.
+func (h *Handlers) runLimits(timeLimitMs, memoryLimitMB int) (RunLimits, error) {
+	if timeLimitMs < 0 || time.Duration(timeLimitMs)*time.Millisecond > h.Runner.Config.TimeLimit {
+		return RunLimits{}, fmt.Errorf("timeLimitMs must be at most %d", h.Runner.Config.TimeLimit.Milliseconds())
+	}
+	if memoryLimitMB < 0 || memoryLimitMB > h.Runner.Config.MemoryLimitMB {
+		return RunLimits{}, fmt.Errorf("memoryLimitMb must be at most %d", h.Runner.Config.MemoryLimitMB)
+	}
+	return RunLimits{
+		TimeLimit: time.Duration(timeLimitMs) * time.Millisecond,
+		MemoryMB:  memoryLimitMB,
+	}, nil
+}
+
+// RunSolution compiles a problem's stored solution in a language and runs
+// it once in the sandbox with custom stdin
+func (h *Handlers) RunSolution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, ok := h.requireProblemInWorkspace(w, r, vars["id"]); !ok {
+		return
+	}
+
+	var req struct {
+		Stdin         string `json:"stdin"`
+		TimeLimitMs   int    `json:"timeLimitMs"`
+		MemoryLimitMB int    `json:"memoryLimitMb"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.Stdin) > maxRunStdinBytes {
+		respondWithError(w, http.StatusBadRequest, "stdin is too large")
+		return
+	}
+	limits, err := h.runLimits(req.TimeLimitMs, req.MemoryLimitMB)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	code, found, err := h.loadSolutionCode(vars["id"], vars["language"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Solution not found")
+		return
+	}
+
+	program, compileResult, err := h.Runner.Compile(r.Context(), vars["language"], code)
+	if err != nil {
+		status, message := runnerErrorStatus(err)
+		respondWithError(w, status, message)
+		return
+	}
+	if compileResult != nil {
+		respondWithJSON(w, http.StatusOK, compileResult)
+		return
+	}
+	defer program.Close()
+
+	result, err := program.Run(r.Context(), req.Stdin, limits)
+	if err != nil {
+		status, message := runnerErrorStatus(err)
+		respondWithError(w, status, message)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// sandboxInitArg is the first argument of the server binary when it is run
+// again as the init of a sandbox; see runSandboxInit
+const sandboxInitArg = "__algovault_sandbox_init"
+
+// sandboxStatusFD is where the sandbox init reports a failed setup. It is
+// closed on exec, so the server reads nothing once the program has started.
+const sandboxStatusFD = 3
+
+// Where a run's temporary directory and a compile's build cache appear in the sandbox
+const (
+	sandboxWorkDir  = "/work"
+	sandboxCacheDir = "/cache"
+)
+
+// sandboxSystemPaths are made visible read-only in every sandbox, when they
+// exist on the host. Symlinks such as /bin on merged-usr systems are copied
+// as symlinks.
+var sandboxSystemPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32",
+	"/etc/alternatives", "/etc/ld.so.cache", "/etc/ld.so.conf", "/etc/ld.so.conf.d",
+	"/dev/null", "/dev/zero", "/dev/random", "/dev/urandom",
+}
+
+// sandboxMount is a host path bound into the sandbox root
+type sandboxMount struct {
+	Source   string `json:"source"`
+	Target   string `json:"target"`
+	Writable bool   `json:"writable"`
+}
+
+// sandboxInit is everything the sandbox init needs to confine one process
+type sandboxInit struct {
+	Root           string         `json:"root"` // Empty host directory the sandbox root is mounted on
+	Mounts         []sandboxMount `json:"mounts"`
+	UID            int            `json:"uid"`
+	CPUSeconds     uint64         `json:"cpuSeconds"`
+	FileBytes      uint64         `json:"fileBytes"` // 0 for no limit
+	AddressSpaceKB uint64         `json:"addressSpaceKb"`
+	Processes      uint64         `json:"processes"`
+	Command        []string       `json:"command"`
+}
+
+// sandboxMounts returns the read-only system and toolchain mounts of a
+// sandbox. Toolchains outside the system directories are mounted whole: the
+// parent of a bin directory in PATH, or the PATH entry itself.
+func sandboxMounts(path string) []sandboxMount {
+	var mounts []sandboxMount
+	covered := func(dir string) bool {
+		for _, mount := range mounts {
+			if dir == mount.Target || strings.HasPrefix(dir, mount.Target+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, source := range sandboxSystemPaths {
+		if _, err := os.Lstat(source); err == nil {
+			mounts = append(mounts, sandboxMount{Source: source, Target: source})
+		}
+	}
+	for _, dir := range filepath.SplitList(path) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil || !filepath.IsAbs(resolved) || covered(resolved) {
+			continue
+		}
+		if filepath.Base(resolved) == "bin" {
+			resolved = filepath.Dir(resolved)
+		}
+		if resolved != "/" {
+			mounts = append(mounts, sandboxMount{Source: resolved, Target: resolved})
+		}
+	}
+	return mounts
+}
+
+// runSandboxInit runs in the server binary started with sandboxInitArg, as
+// root and PID 1 of fresh mount, PID, network, IPC and UTS namespaces. It
+// builds a root that holds only the toolchains and the run's working
+// directory, applies the resource limits, switches to the sandbox user and
+// execs the command. The command stays PID 1, so every process it leaves
+// behind is killed when it exits.
+func runSandboxInit(args []string) {
+	syscall.CloseOnExec(sandboxStatusFD)
+	fail := func(err error) {
+		status := os.NewFile(sandboxStatusFD, "sandbox-status")
+		fmt.Fprintf(status, "%v", err)
+		os.Exit(1)
+	}
+
+	var config sandboxInit
+	if len(args) != 1 {
+		fail(fmt.Errorf("expected one argument"))
+	}
+	if err := json.Unmarshal([]byte(args[0]), &config); err != nil {
+		fail(fmt.Errorf("invalid configuration: %v", err))
+	}
+	if err := config.enterRoot(); err != nil {
+		fail(err)
+	}
+	if err := config.applyLimits(); err != nil {
+		fail(err)
+	}
+
+	// Supplementary groups go first; setuid gives up the right to change them
+	if err := syscall.Setgroups(nil); err != nil {
+		fail(fmt.Errorf("setgroups: %v", err))
+	}
+	if err := syscall.Setgid(config.UID); err != nil {
+		fail(fmt.Errorf("setgid: %v", err))
+	}
+	if err := syscall.Setuid(config.UID); err != nil {
+		fail(fmt.Errorf("setuid: %v", err))
+	}
+	if err := prctl(prSetNoNewPrivs, 1); err != nil {
+		fail(fmt.Errorf("no_new_privs: %v", err))
+	}
+
+	err := syscall.Exec(config.Command[0], config.Command, os.Environ())
+	fail(fmt.Errorf("exec %s: %v", config.Command[0], err))
+}
+
+// enterRoot mounts a tmpfs on the root directory, binds the configured
+// mounts and a proc into it, makes it read-only and pivots into it. Nothing else of the
+// host filesystem stays reachable.
+func (s *sandboxInit) enterRoot() error {
+	// Keep every mount below private to this namespace
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %v", err)
+	}
+	if err := syscall.Mount("tmpfs", s.Root, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "size=1m,mode=0755"); err != nil {
+		return fmt.Errorf("mount root: %v", err)
+	}
+
+	for _, mount := range s.Mounts {
+		if err := bindIntoRoot(s.Root, mount); err != nil {
+			return err
+		}
+	}
+	// A proc of the new PID namespace shows the sandbox's own processes only
+	if err := os.Mkdir(filepath.Join(s.Root, "proc"), 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("proc", filepath.Join(s.Root, "proc"), "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount proc: %v", err)
+	}
+	if err := syscall.Mount("", s.Root, "", syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("remount root read-only: %v", err)
+	}
+
+	// pivot_root with the same old and new root stacks the old root on top,
+	// where it can be detached
+	if err := syscall.Chdir(s.Root); err != nil {
+		return fmt.Errorf("chdir to root: %v", err)
+	}
+	if err := syscall.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %v", err)
+	}
+	if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach old root: %v", err)
+	}
+	if err := syscall.Chdir(sandboxWorkDir); err != nil {
+		return fmt.Errorf("chdir to %s: %v", sandboxWorkDir, err)
+	}
+	return nil
+}
+
+// bindIntoRoot binds one host path into the sandbox root, read-only unless
+// the mount is writable
+func bindIntoRoot(root string, mount sandboxMount) error {
+	target := filepath.Join(root, mount.Target)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(mount.Source)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(mount.Source)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	case info.IsDir():
+		err = os.Mkdir(target, 0755)
+	default:
+		err = os.WriteFile(target, nil, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.Mount(mount.Source, target, "", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind %s: %v", mount.Source, err)
+	}
+	// Device nodes are only bound read-only, which still lets them be written
+	flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_NOSUID)
+	if mount.Writable {
+		flags |= syscall.MS_NODEV
+	} else {
+		flags |= syscall.MS_RDONLY
+	}
+	if err := syscall.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("remount %s: %v", mount.Source, err)
+	}
+	return nil
+}
+
+// applyLimits sets the resource limits the command starts with. Soft and hard
+// limits are equal so the command cannot raise them.
+func (s *sandboxInit) applyLimits() error {
+	type limit struct {
+		resource int
+		value    uint64
+	}
+	limits := []limit{
+		{syscall.RLIMIT_CPU, s.CPUSeconds},
+		{syscall.RLIMIT_CORE, 0},
+		{rlimitNPROC, s.Processes},
+	}
+	if s.FileBytes > 0 {
+		limits = append(limits, limit{syscall.RLIMIT_FSIZE, s.FileBytes})
+	}
+	if s.AddressSpaceKB > 0 {
+		limits = append(limits, limit{syscall.RLIMIT_AS, s.AddressSpaceKB * 1024})
+	}
+
+	for _, limit := range limits {
+		if err := syscall.Setrlimit(limit.resource, &syscall.Rlimit{Cur: limit.value, Max: limit.value}); err != nil {
+			return fmt.Errorf("setrlimit %d: %v", limit.resource, err)
+		}
+	}
+	return nil
+}
+
+// Constants the syscall package does not name. RLIMIT_NPROC limits the
+// processes and threads of the sandbox user.
+const (
+	rlimitNPROC     = 0x6
+	prSetNoNewPrivs = 0x26
+)
+
+func prctl(option int, arg uintptr) error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, uintptr(option), arg, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
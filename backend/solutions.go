@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// loadSolution returns a problem's stored solution in a language, or nil if there is none
+func (h *Handlers) loadSolution(problemID, language string) (*Solution, error) {
+	solutions, err := h.getStoredSolutions(problemID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range solutions {
+		if solutions[i].Language == language {
+			return &solutions[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// deleteSolution removes a problem's stored solution in a language
+func (h *Handlers) deleteSolution(problemID, language string) error {
+	query := h.DB.convertPlaceholders("DELETE FROM solutions WHERE problem_id = ? AND language = ?")
+	_, err := h.DB.DB.Exec(query, problemID, language)
+	return err
+}
+
+// GetProblemSolutions lists a problem's stored solutions. Code that only
+// exists in approaches is listed under the approaches.
+func (h *Handlers) GetProblemSolutions(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	solutions, err := h.getStoredSolutions(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if solutions == nil {
+		solutions = []Solution{}
+	}
+	respondWithJSON(w, http.StatusOK, solutions)
+}
+
+// GetProblemSolution returns a problem's stored solution in one language
+func (h *Handlers) GetProblemSolution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, ok := h.requireProblemInWorkspace(w, r, vars["id"]); !ok {
+		return
+	}
+
+	sol, err := h.loadSolution(vars["id"], vars["language"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if sol == nil {
+		respondWithError(w, http.StatusNotFound, "Solution not found")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, sol)
+}
+
+// CreateProblemSolution adds a solution in a language the problem has no
+// solution in yet
+func (h *Handlers) CreateProblemSolution(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	workspaceID, ok := h.requireEditableProblem(w, r, problemID)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Language string `json:"language"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		respondWithError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+	if !isSupportedLanguage(req.Language) {
+		respondWithError(w, http.StatusBadRequest, "Unsupported language")
+		return
+	}
+
+	existing, err := h.loadSolution(problemID, req.Language)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if existing != nil {
+		respondWithError(w, http.StatusConflict, "Problem already has a solution in this language")
+		return
+	}
+
+	if _, err := h.storeSolutionCode(problemID, req.Language, req.Code); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving solution")
+		return
+	}
+	if err := h.recordRevision(workspaceID, RevisionSolution, problemID, req.Language, "", req.Code, getUserID(r), 0); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving revision")
+		return
+	}
+	sol, err := h.loadSolution(problemID, req.Language)
+	if err != nil || sol == nil {
+		respondWithError(w, http.StatusInternalServerError, "Error loading solution")
+		return
+	}
+	h.audit(r, AuditSolutionCreate, "solution", sol.ID, workspaceID, nil, sol)
+
+	respondWithJSON(w, http.StatusCreated, sol)
+}
+
+// UpdateProblemSolution replaces the code of a problem's solution in one language
+func (h *Handlers) UpdateProblemSolution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID, ok := h.requireEditableProblem(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		respondWithError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	before, err := h.loadSolution(vars["id"], vars["language"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Solution not found")
+		return
+	}
+
+	if _, err := h.storeSolutionCode(before.ProblemID, before.Language, req.Code); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving solution")
+		return
+	}
+	if err := h.recordRevision(workspaceID, RevisionSolution, before.ProblemID, before.Language, before.Code, req.Code, getUserID(r), 0); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving revision")
+		return
+	}
+	sol, err := h.loadSolution(before.ProblemID, before.Language)
+	if err != nil || sol == nil {
+		respondWithError(w, http.StatusInternalServerError, "Error loading solution")
+		return
+	}
+	h.audit(r, AuditSolutionUpdate, "solution", sol.ID, workspaceID, before, sol)
+
+	respondWithJSON(w, http.StatusOK, sol)
+}
+
+// DeleteProblemSolution removes a problem's solution in one language. The
+// removal is kept as an empty revision, so the code can be restored.
+func (h *Handlers) DeleteProblemSolution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID, ok := h.requireEditableProblem(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	before, err := h.loadSolution(vars["id"], vars["language"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Solution not found")
+		return
+	}
+
+	if err := h.deleteSolution(before.ProblemID, before.Language); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting solution")
+		return
+	}
+	if err := h.recordRevision(workspaceID, RevisionSolution, before.ProblemID, before.Language, before.Code, "", getUserID(r), 0); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving revision")
+		return
+	}
+	h.audit(r, AuditSolutionDelete, "solution", before.ID, workspaceID, before, nil)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Solution deleted"})
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Tuning for the statistics endpoint
+const (
+	heatmapDays            = 365
+	weakPatternMinAttempts = 2 // Patterns with fewer logged attempts are not ranked
+	weakPatternCount       = 5
+)
+
+// SolvedCount is how many of a group's problems the caller has solved
+type SolvedCount struct {
+	Solved int `json:"solved"`
+	Total  int `json:"total"`
+}
+
+// DifficultyStats counts solved problems of one difficulty
+type DifficultyStats struct {
+	Difficulty string `json:"difficulty"`
+	SolvedCount
+}
+
+// CategoryStats counts solved problems in one category
+type CategoryStats struct {
+	CategoryID string `json:"categoryId"`
+	Name       string `json:"name"`
+	SolvedCount
+}
+
+// PatternStats counts solved problems and logged attempts in one pattern
+type PatternStats struct {
+	PatternID      string  `json:"patternId"`
+	CategoryID     string  `json:"categoryId"`
+	Name           string  `json:"name"`
+	Attempts       int     `json:"attempts"`
+	SolvedAttempts int     `json:"solvedAttempts"`
+	SuccessRate    float64 `json:"successRate"` // Solved attempts / attempts, 0 without attempts
+	SolvedCount
+}
+
+// ActivityDay is one day of the activity heatmap
+type ActivityDay struct {
+	Date     string `json:"date"` // YYYY-MM-DD in the requested time zone
+	Attempts int    `json:"attempts"`
+}
+
+// Stats aggregates the caller's learning activity in their active workspace
+type Stats struct {
+	Solved                 SolvedCount       `json:"solved"`
+	ByDifficulty           []DifficultyStats `json:"byDifficulty"`
+	ByCategory             []CategoryStats   `json:"byCategory"`
+	ByPattern              []PatternStats    `json:"byPattern"`
+	Heatmap                []ActivityDay     `json:"heatmap"` // Days with activity over the last year, oldest first
+	CurrentStreak          int               `json:"currentStreak"`
+	LongestStreak          int               `json:"longestStreak"`
+	TotalAttempts          int               `json:"totalAttempts"`
+	AverageSolveSeconds    int               `json:"averageSolveSeconds"` // Mean duration of solved attempts
+	WeakestPatterns        []PatternStats    `json:"weakestPatterns"`
+	DueReviews             int               `json:"dueReviews"`
+	TimeZone               string            `json:"timeZone"`
+	WeakPatternMinAttempts int               `json:"weakPatternMinAttempts"`
+}
+
+// GetStats aggregates the caller's progress and attempts. Days are counted in
+// the IANA time zone given by tz, or the server's when it is omitted.
+func (h *Handlers) GetStats(w http.ResponseWriter, r *http.Request) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleViewer)
+	if !ok {
+		return
+	}
+	userID := getUserID(r)
+
+	loc := time.Local
+	if tz := r.URL.Query().Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Unknown time zone: "+tz)
+			return
+		}
+	}
+
+	stats := Stats{
+		ByDifficulty:           []DifficultyStats{},
+		ByCategory:             []CategoryStats{},
+		ByPattern:              []PatternStats{},
+		Heatmap:                []ActivityDay{},
+		WeakestPatterns:        []PatternStats{},
+		TimeZone:               loc.String(),
+		WeakPatternMinAttempts: weakPatternMinAttempts,
+	}
+
+	if err := h.loadSolvedStats(userID, workspaceID, &stats); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if err := h.loadAttemptStats(userID, workspaceID, loc, &stats); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	now := time.Now().In(loc)
+	endOfToday := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1)
+	query := h.DB.convertPlaceholders(`
+		SELECT COUNT(*) FROM problem_progress pp
+		JOIN problems p ON p.id = pp.problem_id
+		WHERE pp.user_id = ? AND p.workspace_id = ? AND pp.due_at IS NOT NULL AND pp.due_at < ?
+	`)
+	if err := h.DB.DB.QueryRow(query, userID, workspaceID, endOfToday).Scan(&stats.DueReviews); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
+
+// loadSolvedStats fills in solved and total problem counts overall, per
+// difficulty, per category and per pattern
+func (h *Handlers) loadSolvedStats(userID, workspaceID string, stats *Stats) error {
+	solvedExpr := "COUNT(DISTINCT CASE WHEN pp.status IN " + solvedStatusesSQL + " THEN p.id END)"
+
+	query := h.DB.convertPlaceholders(`
+		SELECT p.difficulty, COUNT(DISTINCT p.id), ` + solvedExpr + `
+		FROM problems p
+		LEFT JOIN problem_progress pp ON pp.problem_id = p.id AND pp.user_id = ?
+		WHERE p.workspace_id = ?
+		GROUP BY p.difficulty
+		ORDER BY p.difficulty
+	`)
+	rows, err := h.DB.DB.Query(query, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var item DifficultyStats
+		if err := rows.Scan(&item.Difficulty, &item.Total, &item.Solved); err != nil {
+			rows.Close()
+			return err
+		}
+		stats.Solved.Total += item.Total
+		stats.Solved.Solved += item.Solved
+		stats.ByDifficulty = append(stats.ByDifficulty, item)
+	}
+	rows.Close()
+
+	query = h.DB.convertPlaceholders(`
+		SELECT c.id, c.name, COUNT(DISTINCT p.id), ` + solvedExpr + `
+		FROM categories c
+		LEFT JOIN patterns pat ON pat.category_id = c.id
+		LEFT JOIN problems p ON p.pattern_id = pat.id
+		LEFT JOIN problem_progress pp ON pp.problem_id = p.id AND pp.user_id = ?
+		WHERE c.workspace_id = ?
+		GROUP BY c.id, c.name, c.created_at
+		ORDER BY c.created_at ASC
+	`)
+	rows, err = h.DB.DB.Query(query, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var item CategoryStats
+		if err := rows.Scan(&item.CategoryID, &item.Name, &item.Total, &item.Solved); err != nil {
+			rows.Close()
+			return err
+		}
+		stats.ByCategory = append(stats.ByCategory, item)
+	}
+	rows.Close()
+
+	query = h.DB.convertPlaceholders(`
+		SELECT pat.id, pat.category_id, pat.name, COUNT(DISTINCT p.id), ` + solvedExpr + `
+		FROM patterns pat
+		LEFT JOIN problems p ON p.pattern_id = pat.id
+		LEFT JOIN problem_progress pp ON pp.problem_id = p.id AND pp.user_id = ?
+		WHERE pat.workspace_id = ?
+		GROUP BY pat.id, pat.category_id, pat.name, pat.created_at
+		ORDER BY pat.created_at ASC
+	`)
+	rows, err = h.DB.DB.Query(query, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item PatternStats
+		if err := rows.Scan(&item.PatternID, &item.CategoryID, &item.Name, &item.Total, &item.Solved); err != nil {
+			return err
+		}
+		stats.ByPattern = append(stats.ByPattern, item)
+	}
+	return rows.Err()
+}
+
+// loadAttemptStats fills in everything derived from the attempt log: the
+// heatmap, streaks, average solve time and per-pattern success rates.
+// It must run after loadSolvedStats, which lists the patterns.
+func (h *Handlers) loadAttemptStats(userID, workspaceID string, loc *time.Location, stats *Stats) error {
+	query := h.DB.convertPlaceholders(`
+		SELECT p.pattern_id, a.outcome, a.duration_seconds, a.ended_at
+		FROM problem_attempts a
+		JOIN problems p ON p.id = a.problem_id
+		WHERE a.user_id = ? AND p.workspace_id = ?
+	`)
+	rows, err := h.DB.DB.Query(query, userID, workspaceID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	patternIndex := map[string]int{}
+	for i, pattern := range stats.ByPattern {
+		patternIndex[pattern.PatternID] = i
+	}
+
+	attemptsByDay := map[string]int{}
+	solvedSeconds, solvedAttempts := 0, 0
+	for rows.Next() {
+		var patternID, outcome string
+		var duration int
+		var endedAt time.Time
+		if err := rows.Scan(&patternID, &outcome, &duration, &endedAt); err != nil {
+			return err
+		}
+
+		stats.TotalAttempts++
+		attemptsByDay[endedAt.In(loc).Format("2006-01-02")]++
+		if outcome == AttemptSolved {
+			solvedSeconds += duration
+			solvedAttempts++
+		}
+		if i, ok := patternIndex[patternID]; ok {
+			stats.ByPattern[i].Attempts++
+			if outcome == AttemptSolved {
+				stats.ByPattern[i].SolvedAttempts++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if solvedAttempts > 0 {
+		stats.AverageSolveSeconds = solvedSeconds / solvedAttempts
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	for day := today.AddDate(0, 0, -heatmapDays+1); !day.After(today); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		if count := attemptsByDay[date]; count > 0 {
+			stats.Heatmap = append(stats.Heatmap, ActivityDay{Date: date, Attempts: count})
+		}
+	}
+	stats.CurrentStreak, stats.LongestStreak = activityStreaks(attemptsByDay, today)
+
+	candidates := []PatternStats{}
+	for i := range stats.ByPattern {
+		pattern := &stats.ByPattern[i]
+		if pattern.Attempts > 0 {
+			pattern.SuccessRate = float64(pattern.SolvedAttempts) / float64(pattern.Attempts)
+		}
+		if pattern.Attempts >= weakPatternMinAttempts {
+			candidates = append(candidates, *pattern)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].SuccessRate != candidates[j].SuccessRate {
+			return candidates[i].SuccessRate < candidates[j].SuccessRate
+		}
+		return candidates[i].Attempts > candidates[j].Attempts
+	})
+	if len(candidates) > weakPatternCount {
+		candidates = candidates[:weakPatternCount]
+	}
+	stats.WeakestPatterns = candidates
+
+	return nil
+}
+
+// activityStreaks returns the current and longest runs of consecutive days
+// with activity. The current streak is still alive when the last active day
+// was yesterday, so it does not reset before the user had a chance to practice today.
+func activityStreaks(activeDays map[string]int, today time.Time) (int, int) {
+	dates := make([]string, 0, len(activeDays))
+	for date := range activeDays {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	longest, run := 0, 0
+	var previous time.Time
+	for i, date := range dates {
+		day, err := time.ParseInLocation("2006-01-02", date, today.Location())
+		if err != nil {
+			continue
+		}
+		if i > 0 && previous.AddDate(0, 0, 1).Equal(day) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		previous = day
+	}
+
+	current := 0
+	day := today
+	if activeDays[day.Format("2006-01-02")] == 0 {
+		day = day.AddDate(0, 0, -1)
+	}
+	for activeDays[day.Format("2006-01-02")] > 0 {
+		current++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	return current, longest
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Stress test outcomes
+const (
+	StressPassed       = "passed"        // Every iteration matched the brute force
+	StressFailed       = "failed"        // The solution disagreed with the brute force
+	StressProgramError = "program_error" // The generator or brute force did not compile or failed to run
+	StressTimedOut     = "timed_out"     // The iterations ran out of time before a disagreement was found
+)
+
+// Programs taking part in a stress test
+const (
+	StressGenerator  = "generator"
+	StressBruteForce = "bruteForce"
+	StressSolution   = "solution"
+)
+
+// Limits of a stress test request
+const (
+	defaultStressIterations = 100
+	maxStressIterations     = 1000
+	defaultStressMaxSize    = 10
+	maxStressMaxSize        = 100000
+	maxStressShrinkRuns     = 20              // Smaller sizes tried when shrinking a failing input
+	stressTimeout           = 2 * time.Minute // Time the iterations may take, after compiling
+)
+
+// StressConfig holds a problem's random input generator and brute-force
+// reference solution. The generator reads "<seed> <size>" from stdin and
+// prints one test input; the same seed and size must give the same input.
+type StressConfig struct {
+	ProblemID          string     `json:"problemId"`
+	GeneratorLanguage  string     `json:"generatorLanguage"`
+	GeneratorCode      string     `json:"generatorCode"`
+	BruteForceLanguage string     `json:"bruteForceLanguage"`
+	BruteForceCode     string     `json:"bruteForceCode"`
+	UpdatedAt          *time.Time `json:"updatedAt,omitempty"` // Unset until configured
+}
+
+// StressFailure is the smallest input found on which the solution disagreed
+// with the brute force
+type StressFailure struct {
+	Seed           int64  `json:"seed"`
+	Size           int    `json:"size"`
+	OriginalSize   int    `json:"originalSize"` // Size of the first failing input, before shrinking
+	Verdict        string `json:"verdict"`      // WA, TLE, RE, MLE or CF
+	Input          string `json:"input"`
+	ExpectedOutput string `json:"expectedOutput"` // Brute-force output
+	ActualOutput   string `json:"actualOutput"`
+	Stderr         string `json:"stderr,omitempty"`
+	CheckerMessage string `json:"checkerMessage,omitempty"`
+}
+
+// StressProgramFailure is a generator or brute-force program that did not
+// compile or failed to run
+type StressProgramFailure struct {
+	Program string     `json:"program"` // generator or bruteForce
+	Seed    int64      `json:"seed,omitempty"`
+	Size    int        `json:"size,omitempty"`
+	Input   string     `json:"input,omitempty"` // Input the brute force failed on
+	Result  *RunResult `json:"result"`
+}
+
+// StressResult is the outcome of a stress test
+type StressResult struct {
+	Status       string                `json:"status"`
+	Checker      string                `json:"checker"`
+	Seed         int64                 `json:"seed"` // Iteration i uses seed + i
+	Iterations   int                   `json:"iterations"`
+	MaxSize      int                   `json:"maxSize"`
+	Completed    int                   `json:"completed"`         // Iterations that matched
+	Compile      *RunResult            `json:"compile,omitempty"` // Set on a compile error of the solution
+	Failure      *StressFailure        `json:"failure,omitempty"`
+	ProgramError *StressProgramFailure `json:"programError,omitempty"`
+}
+
+// loadStressConfig returns a problem's stress test programs, or nil if none are configured
+func (h *Handlers) loadStressConfig(problemID string) (*StressConfig, error) {
+	config := StressConfig{ProblemID: problemID}
+	var updatedAt time.Time
+	query := h.DB.convertPlaceholders("SELECT generator_language, generator_code, brute_force_language, brute_force_code, updated_at FROM problem_stress_configs WHERE problem_id = ?")
+	err := h.DB.DB.QueryRow(query, problemID).Scan(&config.GeneratorLanguage, &config.GeneratorCode, &config.BruteForceLanguage, &config.BruteForceCode, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	config.UpdatedAt = &updatedAt
+	return &config, nil
+}
+
+// GetStressConfig returns a problem's generator and brute-force programs
+func (h *Handlers) GetStressConfig(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	if _, ok := h.requireProblemInWorkspace(w, r, problemID); !ok {
+		return
+	}
+
+	config, err := h.loadStressConfig(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if config == nil {
+		respondWithError(w, http.StatusNotFound, "Problem has no stress test configuration")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, config)
+}
+
+// UpdateStressConfig sets a problem's generator and brute-force programs
+func (h *Handlers) UpdateStressConfig(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	workspaceID, ok := h.requireEditableProblem(w, r, problemID)
+	if !ok {
+		return
+	}
+
+	var req StressConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	for _, program := range []struct{ name, language, code string }{
+		{"generator", req.GeneratorLanguage, req.GeneratorCode},
+		{"bruteForce", req.BruteForceLanguage, req.BruteForceCode},
+	} {
+		if _, ok := runnerLanguages[program.language]; !ok {
+			respondWithError(w, http.StatusBadRequest, "Unsupported "+program.name+"Language")
+			return
+		}
+		if strings.TrimSpace(program.code) == "" {
+			respondWithError(w, http.StatusBadRequest, program.name+"Code is required")
+			return
+		}
+	}
+
+	before, err := h.loadStressConfig(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	now := time.Now()
+	config := req
+	config.ProblemID = problemID
+	config.UpdatedAt = &now
+	values := []interface{}{config.GeneratorLanguage, config.GeneratorCode, config.BruteForceLanguage, config.BruteForceCode, now, problemID}
+	query := h.DB.convertPlaceholders("UPDATE problem_stress_configs SET generator_language = ?, generator_code = ?, brute_force_language = ?, brute_force_code = ?, updated_at = ? WHERE problem_id = ?")
+	if before == nil {
+		query = h.DB.convertPlaceholders("INSERT INTO problem_stress_configs (generator_language, generator_code, brute_force_language, brute_force_code, updated_at, problem_id) VALUES (?, ?, ?, ?, ?, ?)")
+	}
+	if _, err := h.DB.DB.Exec(query, values...); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving stress test configuration")
+		return
+	}
+	h.audit(r, AuditStressConfigUpdate, "problem", problemID, workspaceID, before, config)
+
+	respondWithJSON(w, http.StatusOK, config)
+}
+
+// DeleteStressConfig removes a problem's generator and brute-force programs
+func (h *Handlers) DeleteStressConfig(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	workspaceID, ok := h.requireEditableProblem(w, r, problemID)
+	if !ok {
+		return
+	}
+
+	before, err := h.loadStressConfig(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Problem has no stress test configuration")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("DELETE FROM problem_stress_configs WHERE problem_id = ?")
+	if _, err := h.DB.DB.Exec(query, problemID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting stress test configuration")
+		return
+	}
+	h.audit(r, AuditStressConfigUpdate, "problem", problemID, workspaceID, before, nil)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Stress test configuration deleted"})
+}
+
+// generateInput runs the generator for a seed and size. A failed run, or one
+// whose output is too large to be an input, is returned as a result with no
+// input.
+func generateInput(ctx context.Context, generator *Program, seed int64, size int) (string, *RunResult, error) {
+	result, err := generator.Run(ctx, fmt.Sprintf("%d %d\n", seed, size), RunLimits{OutputBytes: maxRunStdinBytes})
+	if err != nil {
+		return "", nil, err
+	}
+	if result.Status != RunOK || result.OutputTruncated {
+		return "", result, nil
+	}
+	return result.Stdout, nil, nil
+}
+
+// stressRun runs the programs of a stress test on generated inputs
+type stressRun struct {
+	generator  *Program
+	bruteForce *Program
+	solution   *Program
+	checker    *outputChecker
+	limits     RunLimits
+}
+
+// try runs one iteration. It returns a failure when the solution disagreed
+// with the brute force, or a program failure when the generator or brute
+// force failed; both are nil when the solution passed.
+func (s *stressRun) try(ctx context.Context, seed int64, size int) (*StressFailure, *StressProgramFailure, error) {
+	input, generatorResult, err := generateInput(ctx, s.generator, seed, size)
+	if err != nil {
+		return nil, nil, err
+	}
+	if generatorResult != nil {
+		return nil, &StressProgramFailure{Program: StressGenerator, Seed: seed, Size: size, Result: generatorResult}, nil
+	}
+
+	// Outputs are compared in full, so neither may be cut short
+	expected, err := s.bruteForce.Run(ctx, input, RunLimits{OutputBytes: maxRunStdinBytes})
+	if err != nil {
+		return nil, nil, err
+	}
+	if expected.Status != RunOK || expected.OutputTruncated {
+		return nil, &StressProgramFailure{Program: StressBruteForce, Seed: seed, Size: size, Input: input, Result: expected}, nil
+	}
+
+	actual, err := s.solution.Run(ctx, input, s.limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	verdict, failed := runVerdicts[actual.Status]
+	if !failed && actual.OutputTruncated {
+		verdict, failed = VerdictWrongAnswer, true
+	}
+	var checkerMessage string
+	if !failed {
+		if verdict, checkerMessage, err = s.checker.check(ctx, input, expected.Stdout, actual.Stdout); err != nil {
+			return nil, nil, err
+		}
+	}
+	if verdict == VerdictAccepted {
+		return nil, nil, nil
+	}
+
+	return &StressFailure{
+		Seed:           seed,
+		Size:           size,
+		OriginalSize:   size,
+		Verdict:        verdict,
+		Input:          input,
+		ExpectedOutput: expected.Stdout,
+		ActualOutput:   actual.Stdout,
+		Stderr:         actual.Stderr,
+		CheckerMessage: checkerMessage,
+	}, nil, nil
+}
+
+// shrink looks for a smaller failing input with the same seed, trying sizes
+// in ascending order so the first failure found is the smallest. When ctx
+// ends it returns the failure as it is.
+func (s *stressRun) shrink(ctx context.Context, failure *StressFailure) (*StressFailure, error) {
+	tried := map[int]bool{}
+	for i := 0; i < maxStressShrinkRuns; i++ {
+		size := 1 + i*(failure.Size-1)/maxStressShrinkRuns
+		if size >= failure.Size || tried[size] {
+			continue
+		}
+		tried[size] = true
+
+		smaller, programFailure, err := s.try(ctx, failure.Seed, size)
+		if ctx.Err() != nil {
+			return failure, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Sizes the generator or brute force cannot handle are skipped
+		if smaller != nil && programFailure == nil {
+			smaller.OriginalSize = failure.Size
+			return smaller, nil
+		}
+	}
+	return failure, nil
+}
+
+// StressSolution runs random inputs from the problem's generator through the
+// brute force and a stored solution, stopping at the first disagreement.
+// Sizes grow from 1 to maxSize over the iterations and a failing input is
+// shrunk before it is returned. The iterations stop after stressTimeout.
+func (h *Handlers) StressSolution(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, ok := h.requireProblemInWorkspace(w, r, vars["id"]); !ok {
+		return
+	}
+
+	var req struct {
+		Iterations    int    `json:"iterations"`
+		MaxSize       int    `json:"maxSize"`
+		Seed          *int64 `json:"seed"`
+		TimeLimitMs   int    `json:"timeLimitMs"`
+		MemoryLimitMB int    `json:"memoryLimitMb"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Iterations == 0 {
+		req.Iterations = defaultStressIterations
+	}
+	if req.Iterations < 1 || req.Iterations > maxStressIterations {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("iterations must be between 1 and %d", maxStressIterations))
+		return
+	}
+	if req.MaxSize == 0 {
+		req.MaxSize = defaultStressMaxSize
+	}
+	if req.MaxSize < 1 || req.MaxSize > maxStressMaxSize {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("maxSize must be between 1 and %d", maxStressMaxSize))
+		return
+	}
+	limits, err := h.runLimits(req.TimeLimitMs, req.MemoryLimitMB)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The solution may print as much as the brute force it is compared with
+	limits.OutputBytes = maxRunStdinBytes
+
+	config, err := h.loadStressConfig(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if config == nil {
+		respondWithError(w, http.StatusBadRequest, "Problem has no generator and brute force")
+		return
+	}
+	code, found, err := h.loadSolutionCode(vars["id"], vars["language"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Solution not found")
+		return
+	}
+	checkerConfig, err := h.loadChecker(vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	result := StressResult{Status: StressPassed, Checker: checkerConfig.Mode, Iterations: req.Iterations, MaxSize: req.MaxSize}
+	if req.Seed != nil {
+		result.Seed = *req.Seed
+	} else {
+		result.Seed = rand.Int63n(1 << 31)
+	}
+
+	run := stressRun{limits: limits}
+	for _, program := range []struct {
+		name     string
+		language string
+		code     string
+		target   **Program
+	}{
+		{StressGenerator, config.GeneratorLanguage, config.GeneratorCode, &run.generator},
+		{StressBruteForce, config.BruteForceLanguage, config.BruteForceCode, &run.bruteForce},
+		{StressSolution, vars["language"], code, &run.solution},
+	} {
+		compiled, compileResult, err := h.Runner.Compile(r.Context(), program.language, program.code)
+		if err != nil {
+			status, message := runnerErrorStatus(err)
+			respondWithError(w, status, message)
+			return
+		}
+		if compileResult != nil {
+			if program.name == StressSolution {
+				result.Status = StressFailed
+				result.Compile = compileResult
+			} else {
+				result.Status = StressProgramError
+				result.ProgramError = &StressProgramFailure{Program: program.name, Result: compileResult}
+			}
+			respondWithJSON(w, http.StatusOK, result)
+			return
+		}
+		defer compiled.Close()
+		*program.target = compiled
+	}
+
+	checker, checkerCompile, err := h.newOutputChecker(r.Context(), checkerConfig)
+	if err != nil {
+		status, message := runnerErrorStatus(err)
+		respondWithError(w, status, "Checker: "+message)
+		return
+	}
+	if checkerCompile != nil {
+		respondWithError(w, http.StatusConflict, "Checker does not compile: "+checkerCompile.Stderr)
+		return
+	}
+	defer checker.Close()
+	run.checker = checker
+
+	ctx, cancel := context.WithTimeout(r.Context(), stressTimeout)
+	defer cancel()
+	for i := 0; i < req.Iterations; i++ {
+		size := req.MaxSize
+		if req.Iterations > 1 {
+			size = 1 + i*(req.MaxSize-1)/(req.Iterations-1)
+		}
+		failure, programFailure, err := run.try(ctx, result.Seed+int64(i), size)
+		// A run cut short by the deadline looks like a time limit; it is not a verdict
+		if ctx.Err() == context.DeadlineExceeded {
+			result.Status = StressTimedOut
+			break
+		}
+		if err == nil && failure != nil {
+			failure, err = run.shrink(ctx, failure)
+		}
+		if err != nil {
+			status, message := runnerErrorStatus(err)
+			respondWithError(w, status, message)
+			return
+		}
+		if programFailure != nil {
+			result.Status = StressProgramError
+			result.ProgramError = programFailure
+			break
+		}
+		if failure != nil {
+			result.Status = StressFailed
+			result.Failure = failure
+			break
+		}
+		result.Completed++
+	}
+
+	respondWithJSON(w, http.StatusOK, result)
+}
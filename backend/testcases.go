@@ -0,0 +1,276 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// TestCaseInput is the editable part of a test case
+type TestCaseInput struct {
+	Input          string `json:"input"`          // Fed to the program on stdin
+	ExpectedOutput string `json:"expectedOutput"` // Compared with the program's stdout
+	Hidden         bool   `json:"hidden"`         // Input and expected output are only shown to workspace editors
+	Explanation    string `json:"explanation"`    // Markdown
+}
+
+// TestCase is one input and expected output pair a solution is judged against
+type TestCase struct {
+	ID        string `json:"id"`
+	ProblemID string `json:"problemId"`
+	Position  int    `json:"position"`
+	TestCaseInput
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// validate checks that a test case fits what the runner can feed and capture
+func (tc TestCaseInput) validate() error {
+	if len(tc.Input) > maxRunStdinBytes {
+		return fmt.Errorf("input must be at most %d bytes", maxRunStdinBytes)
+	}
+	if len(tc.ExpectedOutput) > maxRunOutputBytes {
+		return fmt.Errorf("expectedOutput must be at most %d bytes", maxRunOutputBytes)
+	}
+	return nil
+}
+
+// redacted blanks the data of a hidden test case for callers who may not see it
+func (tc TestCase) redacted() TestCase {
+	if tc.Hidden {
+		tc.Input = ""
+		tc.ExpectedOutput = ""
+		tc.Explanation = ""
+	}
+	return tc
+}
+
+// getTestCases returns a problem's test cases in order
+func (h *Handlers) getTestCases(problemID string) ([]TestCase, error) {
+	query := h.DB.convertPlaceholders(`
+		SELECT id, problem_id, position, input, expected_output, hidden, explanation, created_at, updated_at
+		FROM test_cases WHERE problem_id = ? ORDER BY position ASC, created_at ASC
+	`)
+	rows, err := h.DB.DB.Query(query, problemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	testCases := []TestCase{}
+	for rows.Next() {
+		var tc TestCase
+		if err := rows.Scan(&tc.ID, &tc.ProblemID, &tc.Position, &tc.Input, &tc.ExpectedOutput, &tc.Hidden, &tc.Explanation, &tc.CreatedAt, &tc.UpdatedAt); err != nil {
+			return nil, err
+		}
+		testCases = append(testCases, tc)
+	}
+	return testCases, rows.Err()
+}
+
+// loadTestCase returns one test case of a problem, or nil if there is none
+func (h *Handlers) loadTestCase(id, problemID string) (*TestCase, error) {
+	var tc TestCase
+	query := h.DB.convertPlaceholders(`
+		SELECT id, problem_id, position, input, expected_output, hidden, explanation, created_at, updated_at
+		FROM test_cases WHERE id = ? AND problem_id = ?
+	`)
+	err := h.DB.DB.QueryRow(query, id, problemID).Scan(&tc.ID, &tc.ProblemID, &tc.Position, &tc.Input, &tc.ExpectedOutput, &tc.Hidden, &tc.Explanation, &tc.CreatedAt, &tc.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tc, nil
+}
+
+// insertTestCases appends test cases to a problem after any it already has
+func (h *Handlers) insertTestCases(problemID string, inputs []TestCaseInput) ([]TestCase, error) {
+	var position int
+	query := h.DB.convertPlaceholders("SELECT COALESCE(MAX(position), -1) + 1 FROM test_cases WHERE problem_id = ?")
+	if err := h.DB.DB.QueryRow(query, problemID).Scan(&position); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	created := make([]TestCase, 0, len(inputs))
+	insertQuery := h.DB.convertPlaceholders(`INSERT INTO test_cases (id, problem_id, position, input, expected_output, hidden, explanation, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	for i, input := range inputs {
+		tc := TestCase{
+			ID:            generateID(),
+			ProblemID:     problemID,
+			Position:      position + i,
+			TestCaseInput: input,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if _, err := h.DB.DB.Exec(insertQuery, tc.ID, tc.ProblemID, tc.Position, tc.Input, tc.ExpectedOutput, tc.Hidden, tc.Explanation, tc.CreatedAt, tc.UpdatedAt); err != nil {
+			return nil, err
+		}
+		created = append(created, tc)
+	}
+	return created, nil
+}
+
+// canSeeHiddenTestCases reports whether the caller may see the data of hidden
+// test cases, which is reserved for those who can edit them
+func (h *Handlers) canSeeHiddenTestCases(r *http.Request, workspaceID string) (bool, error) {
+	role, err := h.workspaceRole(workspaceID, getUserID(r))
+	if err != nil {
+		return false, err
+	}
+	return workspaceRoleRank[role] >= workspaceRoleRank[WorkspaceRoleEditor], nil
+}
+
+// requireEditableProblem checks that the caller may edit the workspace and
+// that the problem belongs to it. On failure it writes the error response and
+// returns false.
+func (h *Handlers) requireEditableProblem(w http.ResponseWriter, r *http.Request, problemID string) (string, bool) {
+	workspaceID, ok := h.requireWorkspaceRole(w, r, WorkspaceRoleEditor)
+	if !ok {
+		return "", false
+	}
+
+	found, err := h.inWorkspace("problems", problemID, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return "", false
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Problem not found")
+		return "", false
+	}
+	return workspaceID, true
+}
+
+// GetTestCases lists a problem's test cases. Hidden cases are listed for
+// everyone, but their data only for workspace editors.
+func (h *Handlers) GetTestCases(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	workspaceID, ok := h.requireProblemInWorkspace(w, r, problemID)
+	if !ok {
+		return
+	}
+
+	testCases, err := h.getTestCases(problemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	seeHidden, err := h.canSeeHiddenTestCases(r, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !seeHidden {
+		for i := range testCases {
+			testCases[i] = testCases[i].redacted()
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, testCases)
+}
+
+// CreateTestCase appends a test case to a problem
+func (h *Handlers) CreateTestCase(w http.ResponseWriter, r *http.Request) {
+	problemID := mux.Vars(r)["id"]
+	workspaceID, ok := h.requireEditableProblem(w, r, problemID)
+	if !ok {
+		return
+	}
+
+	var req TestCaseInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := req.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	created, err := h.insertTestCases(problemID, []TestCaseInput{req})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating test case")
+		return
+	}
+	tc := created[0]
+	h.audit(r, AuditTestCaseCreate, "test_case", tc.ID, workspaceID, nil, tc)
+
+	respondWithJSON(w, http.StatusCreated, tc)
+}
+
+// UpdateTestCase replaces the input, expected output, hidden flag and
+// explanation of a test case
+func (h *Handlers) UpdateTestCase(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID, ok := h.requireEditableProblem(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	var req TestCaseInput
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := req.validate(); err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	before, err := h.loadTestCase(vars["caseId"], vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Test case not found")
+		return
+	}
+
+	tc := *before
+	tc.TestCaseInput = req
+	tc.UpdatedAt = time.Now()
+	query := h.DB.convertPlaceholders(`UPDATE test_cases SET input = ?, expected_output = ?, hidden = ?, explanation = ?, updated_at = ? WHERE id = ? AND problem_id = ?`)
+	if _, err := h.DB.DB.Exec(query, tc.Input, tc.ExpectedOutput, tc.Hidden, tc.Explanation, tc.UpdatedAt, tc.ID, tc.ProblemID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating test case")
+		return
+	}
+	h.audit(r, AuditTestCaseUpdate, "test_case", tc.ID, workspaceID, before, tc)
+
+	respondWithJSON(w, http.StatusOK, tc)
+}
+
+// DeleteTestCase removes a test case from a problem
+func (h *Handlers) DeleteTestCase(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID, ok := h.requireEditableProblem(w, r, vars["id"])
+	if !ok {
+		return
+	}
+
+	before, err := h.loadTestCase(vars["caseId"], vars["id"])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if before == nil {
+		respondWithError(w, http.StatusNotFound, "Test case not found")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("DELETE FROM test_cases WHERE id = ? AND problem_id = ?")
+	if _, err := h.DB.DB.Exec(query, before.ID, before.ProblemID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error deleting test case")
+		return
+	}
+	h.audit(r, AuditTestCaseDelete, "test_case", before.ID, workspaceID, before, nil)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Test case deleted"})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// TokenPair is returned by every endpoint that signs a user in
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // Access token lifetime in seconds
+}
+
+// hashToken returns the SHA-256 hex digest stored in place of a raw token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens signs a short-lived access token bound to the user's current
+// token version and stores a new refresh token for them
+func (h *Handlers) issueTokens(userID string) (*TokenPair, error) {
+	var tokenVersion int
+	query := h.DB.convertPlaceholders("SELECT token_version FROM users WHERE id = ?")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&tokenVersion); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"typ":    "access",
+		"tv":     tokenVersion,
+		"jti":    generateID(),
+		"iat":    now.Unix(),
+		"exp":    now.Add(accessTokenTTL).Unix(),
+	})
+	tokenString, err := token.SignedString([]byte(h.JWTSecret))
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := generateID() + generateID()
+	query = h.DB.convertPlaceholders("INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, generateID(), userID, hashToken(refreshToken), now.Add(refreshTokenTTL), now); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		Token:        tokenString,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL / time.Second),
+	}, nil
+}
+
+// revokeAllSessions revokes every refresh token of a user and bumps their
+// token version so all outstanding access tokens stop working immediately
+func (d *Database) revokeAllSessions(userID string) error {
+	query := d.convertPlaceholders("UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL")
+	if _, err := d.DB.Exec(query, time.Now(), userID); err != nil {
+		return err
+	}
+
+	query = d.convertPlaceholders("UPDATE users SET token_version = token_version + 1 WHERE id = ?")
+	_, err := d.DB.Exec(query, userID)
+	return err
+}
+
+// revokeAccessToken denylists one access token by its ID until it would
+// have expired anyway. Expired entries are pruned on the way.
+func (d *Database) revokeAccessToken(tokenID string) error {
+	now := time.Now()
+	query := d.convertPlaceholders("DELETE FROM revoked_access_tokens WHERE expires_at < ?")
+	if _, err := d.DB.Exec(query, now); err != nil {
+		return err
+	}
+	query = d.convertPlaceholders("INSERT INTO revoked_access_tokens (jti, expires_at) VALUES (?, ?)")
+	_, err := d.DB.Exec(query, tokenID, now.Add(accessTokenTTL))
+	return err
+}
+
+// RefreshToken exchanges a refresh token for a new token pair. Refresh tokens
+// are single use; presenting one that was already rotated revokes every
+// session of its owner since the token has probably been stolen.
+func (h *Handlers) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		respondWithError(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	var id, userID string
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	query := h.DB.convertPlaceholders("SELECT id, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?")
+	err := h.DB.DB.QueryRow(query, hashToken(req.RefreshToken)).Scan(&id, &userID, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	if revokedAt.Valid {
+		log.Printf("Refresh token reuse detected for user %s, revoking all sessions", userID)
+		if err := h.DB.revokeAllSessions(userID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error revoking sessions")
+			return
+		}
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	if time.Now().After(expiresAt) {
+		respondWithError(w, http.StatusUnauthorized, "Refresh token expired")
+		return
+	}
+
+	var disabledAt sql.NullTime
+	query = h.DB.convertPlaceholders("SELECT disabled_at FROM users WHERE id = ?")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&disabledAt); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	if disabledAt.Valid {
+		respondWithError(w, http.StatusForbidden, "Account is disabled")
+		return
+	}
+
+	// Revoke before issuing so a concurrent request cannot use the same token twice
+	query = h.DB.convertPlaceholders("UPDATE refresh_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL")
+	result, err := h.DB.DB.Exec(query, time.Now(), id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		respondWithError(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+
+	tokens, err := h.issueTokens(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, tokens)
+}
+
+// Logout revokes the given refresh token and the access token the request
+// was made with. With allSessions set it also revokes every other session
+// and invalidates all issued access tokens.
+func (h *Handlers) Logout(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+		AllSessions  bool   `json:"allSessions"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	userID := getUserID(r)
+
+	if req.AllSessions {
+		if err := h.DB.revokeAllSessions(userID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error revoking sessions")
+			return
+		}
+		respondWithJSON(w, http.StatusOK, map[string]string{"message": "Logged out of all sessions"})
+		return
+	}
+
+	if tokenID := getAccessTokenID(r); tokenID != "" {
+		if err := h.DB.revokeAccessToken(tokenID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error revoking token")
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		query := h.DB.convertPlaceholders("UPDATE refresh_tokens SET revoked_at = ? WHERE token_hash = ? AND user_id = ? AND revoked_at IS NULL")
+		if _, err := h.DB.DB.Exec(query, time.Now(), hashToken(req.RefreshToken), userID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error revoking token")
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func refresh(h *Handlers, refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"refreshToken": refreshToken})
+	w := httptest.NewRecorder()
+	h.RefreshToken(w, httptest.NewRequest(http.MethodPost, "/api/token/refresh", strings.NewReader(string(body))))
+	return w
+}
+
+func decodeTokenPair(t *testing.T, w *httptest.ResponseRecorder) TokenPair {
+	t.Helper()
+	var pair TokenPair
+	if err := json.NewDecoder(w.Body).Decode(&pair); err != nil {
+		t.Fatalf("decode token pair: %v", err)
+	}
+	return pair
+}
+
+func TestRefreshTokenRotates(t *testing.T) {
+	h := newTestHandlers(t)
+	userID := createTestUser(t, h, "rotate@example.com")
+	first, err := h.issueTokens(userID)
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+
+	w := refresh(h, first.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d, body %s", w.Code, w.Body)
+	}
+	second := decodeTokenPair(t, w)
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh returned refresh token %q, want a new one", second.RefreshToken)
+	}
+	if second.ExpiresIn != int64(accessTokenTTL/time.Second) {
+		t.Errorf("expiresIn = %d, want %d", second.ExpiresIn, int64(accessTokenTTL/time.Second))
+	}
+
+	// The rotated token was consumed
+	var revoked int
+	query := h.DB.convertPlaceholders("SELECT COUNT(*) FROM refresh_tokens WHERE token_hash = ? AND revoked_at IS NOT NULL")
+	if err := h.DB.DB.QueryRow(query, hashToken(first.RefreshToken)).Scan(&revoked); err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 1 {
+		t.Errorf("first refresh token is not revoked after rotation")
+	}
+	if w := refresh(h, second.RefreshToken); w.Code != http.StatusOK {
+		t.Errorf("refresh with rotated token: status %d, body %s", w.Code, w.Body)
+	}
+}
+
+func TestRefreshTokenReuseRevokesAllSessions(t *testing.T) {
+	h := newTestHandlers(t)
+	userID := createTestUser(t, h, "reuse@example.com")
+	stolen, err := h.issueTokens(userID)
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	other, err := h.issueTokens(userID)
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	w := refresh(h, stolen.RefreshToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("refresh: status %d, body %s", w.Code, w.Body)
+	}
+	rotated := decodeTokenPair(t, w)
+
+	if w := refresh(h, stolen.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	var tokenVersion int
+	query := h.DB.convertPlaceholders("SELECT token_version FROM users WHERE id = ?")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&tokenVersion); err != nil {
+		t.Fatal(err)
+	}
+	if tokenVersion != 1 {
+		t.Errorf("token_version = %d after reuse, want 1", tokenVersion)
+	}
+
+	for name, token := range map[string]string{"rotated": rotated.RefreshToken, "other session": other.RefreshToken} {
+		if w := refresh(h, token); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s refresh token after reuse: status %d, want %d", name, w.Code, http.StatusUnauthorized)
+		}
+	}
+}
+
+func TestRefreshTokenRejected(t *testing.T) {
+	h := newTestHandlers(t)
+	userID := createTestUser(t, h, "rejected@example.com")
+
+	expired, err := h.issueTokens(userID)
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	query := h.DB.convertPlaceholders("UPDATE refresh_tokens SET expires_at = ? WHERE token_hash = ?")
+	if _, err := h.DB.DB.Exec(query, time.Now().Add(-time.Minute), hashToken(expired.RefreshToken)); err != nil {
+		t.Fatal(err)
+	}
+	if w := refresh(h, expired.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("expired refresh token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	if w := refresh(h, "not-a-token"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown refresh token: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	disabled, err := h.issueTokens(userID)
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	query = h.DB.convertPlaceholders("UPDATE users SET disabled_at = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, time.Now(), userID); err != nil {
+		t.Fatal(err)
+	}
+	if w := refresh(h, disabled.RefreshToken); w.Code != http.StatusForbidden {
+		t.Errorf("refresh token of a disabled user: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestLogoutRevokesAccessTokens(t *testing.T) {
+	h := newTestHandlers(t)
+	router := testRouter(h)
+	userID := createTestAccountWithRole(t, h, "logout@example.com", "admin")
+	other := bearer(t, h, userID)
+
+	pair, err := h.issueTokens(userID)
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+	auth := "Bearer " + pair.Token
+	body := `{"refreshToken": "` + pair.RefreshToken + `"}`
+	if w := serveRoute(router, auth, "POST", "/api/logout", body); w.Code != http.StatusOK {
+		t.Fatalf("logout: status %d, body %s", w.Code, w.Body)
+	}
+	if w := serveRoute(router, auth, "GET", "/api/categories", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token used to log out: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := serveRoute(router, other, "GET", "/api/categories", ""); w.Code != http.StatusOK {
+		t.Errorf("another session's access token: status %d, want %d", w.Code, http.StatusOK)
+	}
+
+	if w := serveRoute(router, other, "POST", "/api/logout", `{"allSessions": true}`); w.Code != http.StatusOK {
+		t.Fatalf("logout of all sessions: status %d, body %s", w.Code, w.Body)
+	}
+	if w := serveRoute(router, other, "GET", "/api/categories", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("access token after logging out all sessions: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	if w := refresh(h, pair.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token after logout: status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TOTP parameters (RFC 6238 defaults understood by all authenticator apps)
+const (
+	totpPeriod = 30 // seconds per time step
+	totpDigits = 6
+	totpSkew   = 1 // accepted time steps before and after the current one
+	totpIssuer = "AlgoVault"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret returns a random 160-bit secret encoded as base32
+func generateTOTPSecret() (string, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(secret), nil
+}
+
+// totpCode computes the code for a time step as described in RFC 4226 section 5.3
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%modulo)
+}
+
+// verifyTOTP returns the time step a code is valid for, or -1 if it is not valid
+func verifyTOTP(secret, code string, now time.Time) int64 {
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil || len(code) != totpDigits {
+		return -1
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step
+		}
+	}
+	return -1
+}
+
+// normalizeRecoveryCode strips the formatting users may type around a code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// generateRecoveryCodes replaces a user's recovery codes with a fresh set
+func (d *Database) generateRecoveryCodes(userID string) ([]string, error) {
+	query := d.convertPlaceholders("DELETE FROM recovery_codes WHERE user_id = ?")
+	if _, err := d.DB.Exec(query, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	query = d.convertPlaceholders("INSERT INTO recovery_codes (id, user_id, code_hash, created_at) VALUES (?, ?, ?, ?)")
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := hex.EncodeToString(raw)
+		if _, err := d.DB.Exec(query, generateID(), userID, hashToken(code), time.Now()); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code. Each TOTP time step and each recovery code can only be used once.
+func (d *Database) checkSecondFactor(userID, code string) (bool, error) {
+	var secret string
+	var lastStep int64
+	query := d.convertPlaceholders("SELECT totp_secret, totp_last_step FROM users WHERE id = ?")
+	if err := d.DB.QueryRow(query, userID).Scan(&secret, &lastStep); err != nil {
+		return false, err
+	}
+
+	code = strings.TrimSpace(code)
+	if step := verifyTOTP(secret, code, time.Now()); step > lastStep {
+		query = d.convertPlaceholders("UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?")
+		result, err := d.DB.Exec(query, step, userID, step)
+		if err != nil {
+			return false, err
+		}
+		n, _ := result.RowsAffected()
+		return n == 1, nil
+	}
+
+	query = d.convertPlaceholders("UPDATE recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL")
+	result, err := d.DB.Exec(query, time.Now(), userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+}
+
+// roleRequiresTwoFactor reports whether an admin made 2FA mandatory for a role
+func (d *Database) roleRequiresTwoFactor(role string) (bool, error) {
+	var required int
+	query := d.convertPlaceholders("SELECT require_2fa FROM role_policies WHERE role = ?")
+	err := d.DB.QueryRow(query, role).Scan(&required)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return required == 1, err
+}
+
+// issueTwoFactorChallenge signs the token Login hands out when a second
+// factor is still missing. It can only be exchanged at /api/login/2fa.
+func (h *Handlers) issueTwoFactorChallenge(userID string) (string, error) {
+	var tokenVersion int
+	query := h.DB.convertPlaceholders("SELECT token_version FROM users WHERE id = ?")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&tokenVersion); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"typ":    "2fa",
+		"tv":     tokenVersion,
+		"iat":    now.Unix(),
+		"exp":    now.Add(twoFactorChallengeTTL).Unix(),
+	})
+	return token.SignedString([]byte(h.JWTSecret))
+}
+
+// parseTwoFactorChallenge returns the user a challenge token was issued to
+func (h *Handlers) parseTwoFactorChallenge(tokenString string) (string, int, bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(h.JWTSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return "", 0, false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", 0, false
+	}
+	userID, _ := claims["userID"].(string)
+	typ, _ := claims["typ"].(string)
+	tv, ok := claims["tv"].(float64)
+	if userID == "" || typ != "2fa" || !ok {
+		return "", 0, false
+	}
+	return userID, int(tv), true
+}
+
+// LoginTwoFactor completes a login by exchanging a challenge token and a
+// TOTP or recovery code for a token pair
+func (h *Handlers) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "Challenge token and code are required")
+		return
+	}
+
+	userID, tokenVersion, ok := h.parseTwoFactorChallenge(req.ChallengeToken)
+	if !ok {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge")
+		return
+	}
+
+	limiterKey := "2fa:" + userID
+	if wait := h.Limiter.loginBlocked(r, limiterKey); wait > 0 {
+		respondTooManyRequests(w, wait, "Too many failed login attempts. Please try again later.")
+		return
+	}
+
+	user, err := h.getUserByID(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	var currentVersion int
+	if user != nil {
+		query := h.DB.convertPlaceholders("SELECT token_version FROM users WHERE id = ?")
+		if err := h.DB.DB.QueryRow(query, userID).Scan(&currentVersion); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+	}
+	if user == nil || currentVersion != tokenVersion || !user.TwoFactorEnabled {
+		respondWithError(w, http.StatusUnauthorized, "Invalid or expired challenge")
+		return
+	}
+	if user.DisabledAt != nil {
+		respondWithError(w, http.StatusForbidden, "Account is disabled")
+		return
+	}
+
+	valid, err := h.DB.checkSecondFactor(userID, req.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !valid {
+		h.Limiter.loginFailed(r, limiterKey)
+		h.auditAs(r, user.ID, user.Email, AuditLoginFailed, "user", user.ID, "", nil, map[string]string{"reason": "invalid authentication code", "method": "2fa"})
+		respondWithError(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+	h.Limiter.loginSucceeded(limiterKey)
+
+	tokens, err := h.issueTokens(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+	h.auditAs(r, user.ID, user.Email, AuditLogin, "user", user.ID, "", nil, map[string]string{"method": "2fa"})
+
+	respondWithJSON(w, http.StatusOK, loginResponse(tokens, user))
+}
+
+// GetTwoFactorStatus reports whether the caller has 2FA enabled and whether their role requires it
+func (h *Handlers) GetTwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	user, err := h.getUserByID(userID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	required, err := h.DB.roleRequiresTwoFactor(user.Role)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	var remaining int
+	query := h.DB.convertPlaceholders("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&remaining); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled":                user.TwoFactorEnabled,
+		"required":               required,
+		"recoveryCodesRemaining": remaining,
+	})
+}
+
+// SetupTwoFactor creates a new TOTP secret for the caller. It only takes
+// effect once confirmed with EnableTwoFactor.
+func (h *Handlers) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	user, err := h.getUserByID(userID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if user.TwoFactorEnabled {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error generating secret")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, secret, userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error saving secret")
+		return
+	}
+
+	label := url.PathEscape(totpIssuer + ":" + user.Email)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	respondWithJSON(w, http.StatusOK, map[string]string{
+		"secret":     secret,
+		"otpauthUrl": "otpauth://totp/" + label + "?" + params.Encode(),
+	})
+}
+
+// EnableTwoFactor confirms the pending secret with a code from the
+// authenticator and returns recovery codes. Every other session is signed out.
+func (h *Handlers) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	userID := getUserID(r)
+
+	var secret string
+	var enabledAt sql.NullTime
+	query := h.DB.convertPlaceholders("SELECT totp_secret, totp_enabled_at FROM users WHERE id = ?")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&secret, &enabledAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if enabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	if secret == "" {
+		respondWithError(w, http.StatusBadRequest, "Start two-factor setup first")
+		return
+	}
+
+	step := verifyTOTP(secret, strings.TrimSpace(req.Code), time.Now())
+	if step < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid authentication code")
+		return
+	}
+
+	query = h.DB.convertPlaceholders("UPDATE users SET totp_enabled_at = ?, totp_last_step = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, time.Now(), step, userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error enabling two-factor authentication")
+		return
+	}
+
+	codes, err := h.DB.generateRecoveryCodes(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error generating recovery codes")
+		return
+	}
+
+	// Sessions that never passed a second factor must not outlive enrollment
+	if err := h.DB.revokeAllSessions(userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error revoking sessions")
+		return
+	}
+	tokens, err := h.issueTokens(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error generating token")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{
+		"recoveryCodes": codes,
+		"token":         tokens.Token,
+		"refreshToken":  tokens.RefreshToken,
+		"expiresIn":     tokens.ExpiresIn,
+	})
+}
+
+// DisableTwoFactor turns 2FA off after checking the password and a current code
+func (h *Handlers) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" || req.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "Password and code are required")
+		return
+	}
+
+	userID := getUserID(r)
+
+	var passwordHash string
+	var enabledAt sql.NullTime
+	query := h.DB.convertPlaceholders("SELECT password, totp_enabled_at FROM users WHERE id = ?")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&passwordHash, &enabledAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !enabledAt.Valid {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+
+	required, err := h.DB.roleRequiresTwoFactor(getUserRole(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if required {
+		respondWithError(w, http.StatusBadRequest, "Your role requires two-factor authentication")
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)); err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Password is incorrect")
+		return
+	}
+	valid, err := h.DB.checkSecondFactor(userID, req.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !valid {
+		respondWithError(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+
+	if err := h.DB.clearTwoFactor(userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error disabling two-factor authentication")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes after checking a current code
+func (h *Handlers) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		respondWithError(w, http.StatusBadRequest, "Code is required")
+		return
+	}
+
+	userID := getUserID(r)
+
+	user, err := h.getUserByID(userID)
+	if err != nil || user == nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !user.TwoFactorEnabled {
+		respondWithError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+
+	valid, err := h.DB.checkSecondFactor(userID, req.Code)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if !valid {
+		respondWithError(w, http.StatusUnauthorized, "Invalid authentication code")
+		return
+	}
+
+	codes, err := h.DB.generateRecoveryCodes(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error generating recovery codes")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]interface{}{"recoveryCodes": codes})
+}
+
+// clearTwoFactor removes a user's TOTP secret and recovery codes
+func (d *Database) clearTwoFactor(userID string) error {
+	query := d.convertPlaceholders("UPDATE users SET totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0 WHERE id = ?")
+	if _, err := d.DB.Exec(query, userID); err != nil {
+		return err
+	}
+	query = d.convertPlaceholders("DELETE FROM recovery_codes WHERE user_id = ?")
+	_, err := d.DB.Exec(query, userID)
+	return err
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors
+const rfc6238Secret = "12345678901234567890"
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	// The RFC lists 8-digit codes; 6-digit codes are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode([]byte(rfc6238Secret), tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := base32NoPadding.EncodeToString([]byte(rfc6238Secret))
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	code := func(step int64) string { return totpCode([]byte(rfc6238Secret), step) }
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		want   int64
+	}{
+		{"current step", secret, code(step), step},
+		{"previous step", secret, code(step - 1), step - 1},
+		{"next step", secret, code(step + 1), step + 1},
+		{"too old", secret, code(step - 2), -1},
+		{"too new", secret, code(step + 2), -1},
+		{"lowercase padded secret", strings.ToLower(base32NoPadding.WithPadding('=').EncodeToString([]byte(rfc6238Secret))), code(step), step},
+		{"wrong length", secret, code(step)[:5], -1},
+		{"invalid secret", "not base32!", code(step), -1},
+	}
+	for _, tt := range tests {
+		if got := verifyTOTP(tt.secret, tt.code, now); got != tt.want {
+			t.Errorf("%s: verifyTOTP = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := base32NoPadding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Errorf("secret %q decodes to %d bytes, %v; want 20", secret, len(key), err)
+	}
+	other, _ := generateTOTPSecret()
+	if other == secret {
+		t.Error("two generated secrets are equal")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	for _, input := range []string{"abcde-12345", " ABCDE-12345 ", "abcde 12345", "ABCDE12345"} {
+		if got := normalizeRecoveryCode(input); got != "abcde12345" {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want abcde12345", input, got)
+		}
+	}
+}
+
+func TestCheckSecondFactor(t *testing.T) {
+	h := newTestHandlers(t)
+	userID := createTestUser(t, h, "twofactor@example.com")
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := h.DB.convertPlaceholders("UPDATE users SET totp_secret = ?, totp_enabled_at = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, secret, time.Now(), userID); err != nil {
+		t.Fatal(err)
+	}
+	key, _ := base32NoPadding.DecodeString(secret)
+	code := totpCode(key, time.Now().Unix()/totpPeriod)
+
+	if ok, err := h.DB.checkSecondFactor(userID, code); !ok || err != nil {
+		t.Fatalf("current TOTP code: ok = %v, err = %v", ok, err)
+	}
+	if ok, _ := h.DB.checkSecondFactor(userID, code); ok {
+		t.Error("a TOTP code was accepted twice")
+	}
+	if ok, _ := h.DB.checkSecondFactor(userID, "000000"); ok && code != "000000" {
+		t.Error("a wrong TOTP code was accepted")
+	}
+
+	codes, err := h.DB.generateRecoveryCodes(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+	if ok, err := h.DB.checkSecondFactor(userID, " "+strings.ToUpper(codes[0])+" "); !ok || err != nil {
+		t.Fatalf("recovery code: ok = %v, err = %v", ok, err)
+	}
+	if ok, _ := h.DB.checkSecondFactor(userID, codes[0]); ok {
+		t.Error("a recovery code was accepted twice")
+	}
+
+	// A new set replaces the old one
+	if _, err := h.DB.generateRecoveryCodes(userID); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := h.DB.checkSecondFactor(userID, codes[1]); ok {
+		t.Error("a replaced recovery code was accepted")
+	}
+}
+
+func TestTwoFactorChallenge(t *testing.T) {
+	h := newTestHandlers(t)
+	userID := createTestUser(t, h, "challenge@example.com")
+
+	challenge, err := h.issueTwoFactorChallenge(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, tokenVersion, ok := h.parseTwoFactorChallenge(challenge)
+	if !ok || got != userID || tokenVersion != 0 {
+		t.Errorf("parseTwoFactorChallenge = %q, %d, %v; want %q, 0, true", got, tokenVersion, ok, userID)
+	}
+
+	// Access tokens and tokens signed with another secret are not challenges
+	tokens, err := h.issueTokens(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := h.parseTwoFactorChallenge(tokens.Token); ok {
+		t.Error("an access token was accepted as a challenge")
+	}
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userID": userID,
+		"typ":    "2fa",
+		"tv":     0,
+		"exp":    time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("another-secret"))
+	if _, _, ok := h.parseTwoFactorChallenge(forged); ok {
+		t.Error("a challenge signed with another secret was accepted")
+	}
+}
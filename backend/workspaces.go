@@ -0,0 +1,378 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Workspace membership roles, from least to most privileged
+const (
+	WorkspaceRoleViewer = "viewer"
+	WorkspaceRoleEditor = "editor"
+	WorkspaceRoleOwner  = "owner"
+)
+
+var workspaceRoleRank = map[string]int{
+	WorkspaceRoleViewer: 1,
+	WorkspaceRoleEditor: 2,
+	WorkspaceRoleOwner:  3,
+}
+
+// isValidWorkspaceRole checks if a role can be assigned to a workspace member
+func isValidWorkspaceRole(role string) bool {
+	_, ok := workspaceRoleRank[role]
+	return ok
+}
+
+// activeWorkspace returns the caller's active workspace and their role in it.
+// If the stored active workspace is no longer accessible, the caller is moved
+// to the oldest workspace they still belong to.
+func (h *Handlers) activeWorkspace(r *http.Request) (string, string, error) {
+	userID := getUserID(r)
+
+	var workspaceID, role string
+	query := h.DB.convertPlaceholders(`
+		SELECT m.workspace_id, m.role
+		FROM users u
+		JOIN workspace_members m ON m.workspace_id = u.active_workspace_id AND m.user_id = u.id
+		WHERE u.id = ?
+	`)
+	err := h.DB.DB.QueryRow(query, userID).Scan(&workspaceID, &role)
+	if err != sql.ErrNoRows {
+		return workspaceID, role, err
+	}
+
+	query = h.DB.convertPlaceholders("SELECT workspace_id, role FROM workspace_members WHERE user_id = ? ORDER BY created_at ASC LIMIT 1")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&workspaceID, &role); err != nil {
+		return "", "", err
+	}
+
+	query = h.DB.convertPlaceholders("UPDATE users SET active_workspace_id = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, workspaceID, userID); err != nil {
+		return "", "", err
+	}
+
+	return workspaceID, role, nil
+}
+
+// requireWorkspaceRole resolves the caller's active workspace and checks that
+// their membership role is at least minRole. On failure it writes the error
+// response and returns false.
+func (h *Handlers) requireWorkspaceRole(w http.ResponseWriter, r *http.Request, minRole string) (string, bool) {
+	workspaceID, role, err := h.activeWorkspace(r)
+	if err == sql.ErrNoRows {
+		respondWithError(w, http.StatusForbidden, "You are not a member of any workspace")
+		return "", false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return "", false
+	}
+
+	if workspaceRoleRank[role] < workspaceRoleRank[minRole] {
+		respondWithError(w, http.StatusForbidden, "Your workspace role does not allow this action")
+		return "", false
+	}
+
+	return workspaceID, true
+}
+
+// workspaceRole returns the user's role in a workspace, or "" if they are not a member
+func (h *Handlers) workspaceRole(workspaceID, userID string) (string, error) {
+	var role string
+	query := h.DB.convertPlaceholders("SELECT role FROM workspace_members WHERE workspace_id = ? AND user_id = ?")
+	err := h.DB.DB.QueryRow(query, workspaceID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// countWorkspaceOwners returns the number of owners a workspace has
+func (h *Handlers) countWorkspaceOwners(workspaceID string) (int, error) {
+	var count int
+	query := h.DB.convertPlaceholders("SELECT COUNT(*) FROM workspace_members WHERE workspace_id = ? AND role = ?")
+	err := h.DB.DB.QueryRow(query, workspaceID, WorkspaceRoleOwner).Scan(&count)
+	return count, err
+}
+
+// Workspace handlers
+
+// GetWorkspaces lists every workspace the caller belongs to
+func (h *Handlers) GetWorkspaces(w http.ResponseWriter, r *http.Request) {
+	userID := getUserID(r)
+
+	activeID, _, err := h.activeWorkspace(r)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+
+	query := h.DB.convertPlaceholders(`
+		SELECT ws.id, ws.name, ws.owner_id, ws.is_personal, m.role, ws.created_at, ws.updated_at
+		FROM workspaces ws
+		JOIN workspace_members m ON m.workspace_id = ws.id
+		WHERE m.user_id = ?
+		ORDER BY ws.created_at ASC
+	`)
+	rows, err := h.DB.DB.Query(query, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	var workspaces []Workspace
+	for rows.Next() {
+		var ws Workspace
+		var isPersonal int
+		if err := rows.Scan(&ws.ID, &ws.Name, &ws.OwnerID, &isPersonal, &ws.Role, &ws.CreatedAt, &ws.UpdatedAt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning workspace")
+			return
+		}
+		ws.IsPersonal = isPersonal == 1
+		ws.Active = ws.ID == activeID
+		workspaces = append(workspaces, ws)
+	}
+
+	respondWithJSON(w, http.StatusOK, workspaces)
+}
+
+// CreateWorkspace creates a shared workspace owned by the caller
+func (h *Handlers) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondWithError(w, http.StatusBadRequest, "Workspace name is required")
+		return
+	}
+
+	ws := Workspace{
+		ID:        generateID(),
+		Name:      req.Name,
+		OwnerID:   getUserID(r),
+		Role:      WorkspaceRoleOwner,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	// A workspace without its owner could never be reached
+	tx, err := h.DB.DB.Begin()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer tx.Rollback()
+
+	query := h.DB.convertPlaceholders("INSERT INTO workspaces (id, name, owner_id, is_personal, created_at, updated_at) VALUES (?, ?, ?, 0, ?, ?)")
+	if _, err := tx.Exec(query, ws.ID, ws.Name, ws.OwnerID, ws.CreatedAt, ws.UpdatedAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating workspace")
+		return
+	}
+
+	query = h.DB.convertPlaceholders("INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES (?, ?, ?, ?)")
+	if _, err := tx.Exec(query, ws.ID, ws.OwnerID, WorkspaceRoleOwner, ws.CreatedAt); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating workspace")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error creating workspace")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, ws)
+}
+
+// GetWorkspaceMembers lists the members of a workspace the caller belongs to
+func (h *Handlers) GetWorkspaceMembers(w http.ResponseWriter, r *http.Request) {
+	workspaceID := mux.Vars(r)["id"]
+
+	role, err := h.workspaceRole(workspaceID, getUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if role == "" {
+		respondWithError(w, http.StatusNotFound, "Workspace not found")
+		return
+	}
+
+	query := h.DB.convertPlaceholders(`
+		SELECT m.workspace_id, m.user_id, u.email, u.name, m.role, m.created_at
+		FROM workspace_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = ?
+		ORDER BY m.created_at ASC
+	`)
+	rows, err := h.DB.DB.Query(query, workspaceID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	defer rows.Close()
+
+	var members []WorkspaceMember
+	for rows.Next() {
+		var m WorkspaceMember
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Email, &m.Name, &m.Role, &m.CreatedAt); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Error scanning member")
+			return
+		}
+		members = append(members, m)
+	}
+
+	respondWithJSON(w, http.StatusOK, members)
+}
+
+// UpdateWorkspaceMember changes a member's role
+func (h *Handlers) UpdateWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+	memberID := vars["userId"]
+
+	role, err := h.workspaceRole(workspaceID, getUserID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if role == "" {
+		respondWithError(w, http.StatusNotFound, "Workspace not found")
+		return
+	}
+	if role != WorkspaceRoleOwner {
+		respondWithError(w, http.StatusForbidden, "Only workspace owners can change roles")
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !isValidWorkspaceRole(req.Role) {
+		respondWithError(w, http.StatusBadRequest, "Role must be owner, editor or viewer")
+		return
+	}
+
+	currentRole, err := h.workspaceRole(workspaceID, memberID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if currentRole == "" {
+		respondWithError(w, http.StatusNotFound, "Member not found")
+		return
+	}
+
+	// A workspace must always keep at least one owner
+	if currentRole == WorkspaceRoleOwner && req.Role != WorkspaceRoleOwner {
+		owners, err := h.countWorkspaceOwners(workspaceID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if owners <= 1 {
+			respondWithError(w, http.StatusBadRequest, "A workspace must have at least one owner")
+			return
+		}
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE workspace_members SET role = ? WHERE workspace_id = ? AND user_id = ?")
+	if _, err := h.DB.DB.Exec(query, req.Role, workspaceID, memberID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error updating member")
+		return
+	}
+	h.audit(r, AuditWorkspaceRoleChange, "user", memberID, workspaceID, map[string]string{"role": currentRole}, map[string]string{"role": req.Role})
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Member role updated", "role": req.Role})
+}
+
+// RemoveWorkspaceMember removes a member. Owners can remove anyone and any
+// member can remove themselves.
+func (h *Handlers) RemoveWorkspaceMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	workspaceID := vars["id"]
+	memberID := vars["userId"]
+	userID := getUserID(r)
+
+	role, err := h.workspaceRole(workspaceID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if role == "" {
+		respondWithError(w, http.StatusNotFound, "Workspace not found")
+		return
+	}
+	if role != WorkspaceRoleOwner && memberID != userID {
+		respondWithError(w, http.StatusForbidden, "Only workspace owners can remove members")
+		return
+	}
+
+	currentRole, err := h.workspaceRole(workspaceID, memberID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if currentRole == "" {
+		respondWithError(w, http.StatusNotFound, "Member not found")
+		return
+	}
+	if currentRole == WorkspaceRoleOwner {
+		owners, err := h.countWorkspaceOwners(workspaceID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Database error")
+			return
+		}
+		if owners <= 1 {
+			respondWithError(w, http.StatusBadRequest, "A workspace must have at least one owner")
+			return
+		}
+	}
+
+	query := h.DB.convertPlaceholders("DELETE FROM workspace_members WHERE workspace_id = ? AND user_id = ?")
+	if _, err := h.DB.DB.Exec(query, workspaceID, memberID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error removing member")
+		return
+	}
+	h.audit(r, AuditMemberRemove, "user", memberID, workspaceID, map[string]string{"role": currentRole}, nil)
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Member removed"})
+}
+
+// SwitchWorkspace makes a workspace the caller belongs to their active workspace
+func (h *Handlers) SwitchWorkspace(w http.ResponseWriter, r *http.Request) {
+	workspaceID := mux.Vars(r)["id"]
+	userID := getUserID(r)
+
+	role, err := h.workspaceRole(workspaceID, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Database error")
+		return
+	}
+	if role == "" {
+		respondWithError(w, http.StatusNotFound, "Workspace not found")
+		return
+	}
+
+	query := h.DB.convertPlaceholders("UPDATE users SET active_workspace_id = ? WHERE id = ?")
+	if _, err := h.DB.DB.Exec(query, workspaceID, userID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Error switching workspace")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, map[string]string{"message": "Active workspace switched", "workspaceId": workspaceID, "role": role})
+}
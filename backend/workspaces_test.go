@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// personalWorkspaceID returns the ID of a user's personal workspace
+func personalWorkspaceID(t *testing.T, h *Handlers, userID string) string {
+	t.Helper()
+	var workspaceID string
+	query := h.DB.convertPlaceholders("SELECT id FROM workspaces WHERE owner_id = ? AND is_personal = 1")
+	if err := h.DB.DB.QueryRow(query, userID).Scan(&workspaceID); err != nil {
+		t.Fatalf("personal workspace of %s: %v", userID, err)
+	}
+	return workspaceID
+}
+
+// addTestMember adds a user to a workspace, as accepting an invite would
+func addTestMember(t *testing.T, h *Handlers, workspaceID, userID, role string) {
+	t.Helper()
+	query := h.DB.convertPlaceholders("INSERT INTO workspace_members (workspace_id, user_id, role, created_at) VALUES (?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, workspaceID, userID, role, time.Now()); err != nil {
+		t.Fatalf("add member: %v", err)
+	}
+}
+
+func TestWorkspaceRolesLimitMembers(t *testing.T) {
+	h := newTestHandlers(t)
+	owner := createTestAccount(t, h, "owner@example.com")
+	member := createTestAccount(t, h, "member@example.com")
+	outsider := createTestAccount(t, h, "outsider@example.com")
+	workspaceID := personalWorkspaceID(t, h, owner)
+	categoryID, _, problemID := createTestContent(t, h, owner)
+
+	if w := serveAs(h.SwitchWorkspace, outsider, http.MethodPost, map[string]string{"id": workspaceID}, nil); w.Code != http.StatusNotFound {
+		t.Errorf("switching to a workspace the user is not a member of: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := serveAs(h.GetWorkspaceMembers, outsider, http.MethodGet, map[string]string{"id": workspaceID}, nil); w.Code != http.StatusNotFound {
+		t.Errorf("listing members of a workspace the user is not a member of: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	addTestMember(t, h, workspaceID, member, WorkspaceRoleViewer)
+	if w := serveAs(h.SwitchWorkspace, member, http.MethodPost, map[string]string{"id": workspaceID}, nil); w.Code != http.StatusOK {
+		t.Fatalf("switching to a shared workspace: status %d, body %s", w.Code, w.Body)
+	}
+
+	problem := map[string]string{"id": problemID}
+	if w := serveAs(h.GetProblem, member, http.MethodGet, problem, nil); w.Code != http.StatusOK {
+		t.Errorf("viewer reading a problem: status %d, want %d", w.Code, http.StatusOK)
+	}
+	viewerDenied := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		vars    map[string]string
+		body    interface{}
+	}{
+		{"update problem", h.UpdateProblem, http.MethodPut, problem, map[string]string{"title": "Changed"}},
+		{"delete problem", h.DeleteProblem, http.MethodDelete, problem, nil},
+		{"create category", h.CreateCategory, http.MethodPost, nil, map[string]string{"name": "Planted"}},
+		{"delete category", h.DeleteCategory, http.MethodDelete, map[string]string{"id": categoryID}, nil},
+		{"clear data", h.ClearAllData, http.MethodPost, nil, nil},
+	}
+	for _, tt := range viewerDenied {
+		if w := serveAs(tt.handler, member, tt.method, tt.vars, tt.body); w.Code != http.StatusForbidden {
+			t.Errorf("viewer %s: status %d, want %d", tt.name, w.Code, http.StatusForbidden)
+		}
+	}
+
+	// Editors can change content but not membership
+	if w := serveAs(h.UpdateWorkspaceMember, owner, http.MethodPut, map[string]string{"id": workspaceID, "userId": member}, map[string]string{"role": WorkspaceRoleEditor}); w.Code != http.StatusOK {
+		t.Fatalf("owner promoting a viewer: status %d, body %s", w.Code, w.Body)
+	}
+	if w := serveAs(h.UpdateProblem, member, http.MethodPut, problem, map[string]string{"title": "Changed"}); w.Code != http.StatusOK {
+		t.Errorf("editor updating a problem: status %d, body %s", w.Code, w.Body)
+	}
+	if w := serveAs(h.UpdateWorkspaceMember, member, http.MethodPut, map[string]string{"id": workspaceID, "userId": member}, map[string]string{"role": WorkspaceRoleOwner}); w.Code != http.StatusForbidden {
+		t.Errorf("editor promoting themselves: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := serveAs(h.ClearAllData, member, http.MethodPost, nil, nil); w.Code != http.StatusForbidden {
+		t.Errorf("editor clearing the workspace: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	// A removed member falls back to their own workspace
+	if w := serveAs(h.RemoveWorkspaceMember, owner, http.MethodDelete, map[string]string{"id": workspaceID, "userId": member}, nil); w.Code != http.StatusOK {
+		t.Fatalf("owner removing a member: status %d, body %s", w.Code, w.Body)
+	}
+	if w := serveAs(h.GetProblem, member, http.MethodGet, problem, nil); w.Code != http.StatusNotFound {
+		t.Errorf("removed member reading a problem: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestDemoUserOnlyBelongsToItsOwnWorkspace(t *testing.T) {
+	h := newTestHandlers(t)
+	owner := createTestAccount(t, h, "owner@example.com")
+	var demoID string
+	if err := h.DB.DB.QueryRow("SELECT id FROM users WHERE email = 'demo@algovault.com'").Scan(&demoID); err != nil {
+		t.Fatalf("demo user: %v", err)
+	}
+
+	// Older versions made the demo user a viewer of the first user's workspace
+	addTestMember(t, h, personalWorkspaceID(t, h, owner), demoID, WorkspaceRoleViewer)
+	if err := h.DB.migrate(false); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	rows, err := h.DB.DB.Query("SELECT w.owner_id FROM workspace_members m JOIN workspaces w ON w.id = m.workspace_id WHERE m.user_id = ?", demoID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	memberships := 0
+	for rows.Next() {
+		var ownerID string
+		if err := rows.Scan(&ownerID); err != nil {
+			t.Fatal(err)
+		}
+		if ownerID != demoID {
+			t.Errorf("demo user is a member of a workspace owned by %s", ownerID)
+		}
+		memberships++
+	}
+	if memberships != 1 {
+		t.Errorf("demo user belongs to %d workspaces, want its own one", memberships)
+	}
+}
+
+func TestInvitesMustBeAccepted(t *testing.T) {
+	h := newTestHandlers(t)
+	owner := createTestAccount(t, h, "owner@example.com")
+	invitee := createTestAccount(t, h, "invitee@example.com")
+	other := createTestAccount(t, h, "other@example.com")
+	workspaceID := personalWorkspaceID(t, h, owner)
+
+	w := serveAs(h.InviteWorkspaceMember, owner, http.MethodPost, map[string]string{"id": workspaceID}, map[string]string{"email": " Invitee@Example.com", "role": WorkspaceRoleEditor})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("invite: status %d, body %s", w.Code, w.Body)
+	}
+	var invite WorkspaceInvite
+	if err := json.NewDecoder(w.Body).Decode(&invite); err != nil {
+		t.Fatal(err)
+	}
+	if role, err := h.workspaceRole(workspaceID, invitee); err != nil || role != "" {
+		t.Errorf("invitee has role %q before accepting, err = %v", role, err)
+	}
+	if w := serveAs(h.InviteWorkspaceMember, invitee, http.MethodPost, map[string]string{"id": workspaceID}, map[string]string{"email": "other@example.com"}); w.Code != http.StatusNotFound {
+		t.Errorf("non-member inviting: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	// Invites are only shown to a verified owner of the address
+	accept := map[string]string{"id": invite.ID}
+	if w := serveAs(h.AcceptInvite, invitee, http.MethodPost, accept, nil); w.Code != http.StatusForbidden {
+		t.Errorf("accepting with an unverified email: status %d, want %d", w.Code, http.StatusForbidden)
+	}
+	query := h.DB.convertPlaceholders("UPDATE users SET email_verified_at = ? WHERE id IN (?, ?)")
+	if _, err := h.DB.DB.Exec(query, time.Now(), invitee, other); err != nil {
+		t.Fatal(err)
+	}
+
+	var listed []WorkspaceInvite
+	if err := json.NewDecoder(serveAs(h.GetMyInvites, other, http.MethodGet, nil, nil).Body).Decode(&listed); err != nil || len(listed) != 0 {
+		t.Errorf("another user sees invites %v, err = %v", listed, err)
+	}
+	if w := serveAs(h.AcceptInvite, other, http.MethodPost, accept, nil); w.Code != http.StatusNotFound {
+		t.Errorf("another user accepting the invite: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	if w := serveAs(h.AcceptInvite, invitee, http.MethodPost, accept, nil); w.Code != http.StatusOK {
+		t.Fatalf("accept: status %d, body %s", w.Code, w.Body)
+	}
+	if role, err := h.workspaceRole(workspaceID, invitee); err != nil || role != WorkspaceRoleEditor {
+		t.Errorf("invitee has role %q after accepting, err = %v; want %q", role, err, WorkspaceRoleEditor)
+	}
+	if w := serveAs(h.AcceptInvite, invitee, http.MethodPost, accept, nil); w.Code != http.StatusNotFound {
+		t.Errorf("accepting twice: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestInterviewsAreClosedToFormerMembers(t *testing.T) {
+	h := newTestHandlers(t)
+	owner := createTestAccount(t, h, "owner@example.com")
+	member := createTestAccount(t, h, "member@example.com")
+	workspaceID := personalWorkspaceID(t, h, owner)
+	addTestMember(t, h, workspaceID, member, WorkspaceRoleEditor)
+
+	now := time.Now()
+	query := h.DB.convertPlaceholders("INSERT INTO interview_sessions (id, user_id, workspace_id, duration_minutes, started_at, ends_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if _, err := h.DB.DB.Exec(query, "session", member, workspaceID, 45, now, now.Add(45*time.Minute), now); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{"id": "session"}
+	if w := serveAs(h.GetInterview, member, "GET", vars, nil); w.Code != http.StatusOK {
+		t.Fatalf("member reading their interview: status %d, body %s", w.Code, w.Body)
+	}
+
+	query = h.DB.convertPlaceholders("DELETE FROM workspace_members WHERE workspace_id = ? AND user_id = ?")
+	if _, err := h.DB.DB.Exec(query, workspaceID, member); err != nil {
+		t.Fatal(err)
+	}
+	answer := map[string]string{"problem_id": "problem", "code": "x", "language": "python"}
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"get":    serveAs(h.GetInterview, member, "GET", vars, nil),
+		"submit": serveAs(h.SubmitInterviewAnswer, member, "POST", vars, answer),
+		"finish": serveAs(h.FinishInterview, member, "POST", vars, nil),
+	} {
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s after leaving the workspace: status %d, want %d", name, w.Code, http.StatusNotFound)
+		}
+	}
+}
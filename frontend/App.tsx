@@ -8,6 +8,8 @@ import CategoryDetail from './pages/CategoryDetail';
 import PatternDetail from './pages/PatternDetail';
 import ProblemDetail from './pages/ProblemDetail';
 import LearningTopicDetail from './pages/LearningTopicDetail';
+import VerifyEmail from './pages/VerifyEmail';
+import ResetPassword from './pages/ResetPassword';
 import Sidebar from './components/Sidebar';
 import { ChevronLeft, LogOut, Code2, Bell, Search, User as UserIcon } from 'lucide-react';
 
@@ -24,6 +26,9 @@ const App: React.FC = () => {
     return null;
   });
   const [token, setToken] = useState<string | null>(localStorage.getItem('token'));
+  // Emailed links open /verify-email and /reset-password directly
+  const [path, setPath] = useState(window.location.pathname);
+  const [verificationNotice, setVerificationNotice] = useState('');
   const [viewState, setViewState] = useState<ViewState>(ViewState.CATEGORIES);
 
   const [selectedCategory, setSelectedCategory] = useState<Category | null>(null);
@@ -38,7 +43,39 @@ const App: React.FC = () => {
     localStorage.setItem('user', JSON.stringify(u));
   };
 
+  // A password reset signs the user out everywhere, so the stored session is dropped
+  const leaveEmailLink = (signedOut: boolean) => {
+    window.history.replaceState({}, '', '/');
+    setPath('/');
+    if (signedOut) {
+      localStorage.removeItem('token');
+      localStorage.removeItem('refreshToken');
+      localStorage.removeItem('user');
+      setToken(null);
+      setUser(null);
+      return;
+    }
+    const storedUser = localStorage.getItem('user');
+    if (storedUser) {
+      try {
+        setUser(JSON.parse(storedUser));
+      } catch {
+        setUser(null);
+      }
+    }
+  };
+
+  const handleResendVerification = async () => {
+    try {
+      const result = await api.resendVerificationEmail();
+      setVerificationNotice(result.message);
+    } catch (err: any) {
+      setVerificationNotice(err.message || 'Could not send the verification email');
+    }
+  };
+
   const handleLogout = () => {
+    api.logout();
     setUser(null);
     setToken(null);
     localStorage.removeItem('token');
@@ -78,6 +115,14 @@ const App: React.FC = () => {
     setSelectedProblem(null);
   };
 
+  const emailToken = new URLSearchParams(window.location.search).get('token') || '';
+  if (path === '/verify-email') {
+    return <VerifyEmail token={emailToken} onDone={() => leaveEmailLink(false)} />;
+  }
+  if (path === '/reset-password') {
+    return <ResetPassword token={emailToken} onDone={() => leaveEmailLink(true)} />;
+  }
+
   if (!user) {
     return <Login onLogin={handleLogin} />;
   }
@@ -142,6 +187,18 @@ const App: React.FC = () => {
           </div>
         </header>
 
+        {user.emailVerified === false && (
+          <div className="px-8 py-2 bg-amber-500/10 border-b border-amber-500/20 text-amber-300 text-sm flex items-center justify-between gap-4 shrink-0">
+            <span>{verificationNotice || 'Verify your email address to start editing. Check your inbox for the link.'}</span>
+            <button
+              onClick={handleResendVerification}
+              className="text-xs font-semibold text-amber-200 hover:text-white whitespace-nowrap"
+            >
+              Resend email
+            </button>
+          </div>
+        )}
+
         {/* Scrollable Content Area */}
         <main className="flex-1 overflow-y-auto p-8 custom-scrollbar">
           <div className="max-w-6xl mx-auto">
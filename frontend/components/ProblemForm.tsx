@@ -1,5 +1,5 @@
 import React, { useState } from 'react';
-import { Problem, Solution } from '../types';
+import { Problem, Solution, TestCaseInput } from '../types';
 import { X, Sparkles, Loader2, Globe } from 'lucide-react';
 import { LANGUAGES } from '../constants';
 import { api } from '../services/apiService';
@@ -23,6 +23,7 @@ const ProblemForm: React.FC<ProblemFormProps> = ({ problem, patternId, onSave, o
   const [explanation, setExplanation] = useState(problem?.explanation || '');
   const [notes, setNotes] = useState(problem?.notes || '');
   const [solutions, setSolutions] = useState<Solution[]>(problem?.solutions || []);
+  const [testCases, setTestCases] = useState<TestCaseInput[]>([]);
   const [loading, setLoading] = useState(false);
   const [aiQuery, setAiQuery] = useState('');
   const [isGenerating, setIsGenerating] = useState(false);
@@ -60,6 +61,7 @@ const ProblemForm: React.FC<ProblemFormProps> = ({ problem, patternId, onSave, o
       setSampleOutput(fetched.sampleOutput);
       setExplanation(fetched.explanation);
       setNotes(fetched.notes);
+      setTestCases(fetched.testCases || []);
       setShowExternalModal(false);
 
       setExternalId('');
@@ -117,6 +119,8 @@ const ProblemForm: React.FC<ProblemFormProps> = ({ problem, patternId, onSave, o
         explanation,
         notes,
         solutions,
+        // Imported test cases are saved with a new problem; existing ones are edited separately
+        ...(!problem && testCases.length > 0 ? { testCases } : {}),
       });
       onClose();
     } catch (error) {
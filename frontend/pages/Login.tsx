@@ -1,8 +1,8 @@
 
-import React, { useState } from 'react';
+import React, { useEffect, useState } from 'react';
 import { api } from '../services/apiService';
-import { User } from '../types';
-import { Code2, Mail, Lock, ArrowRight, Loader2 } from 'lucide-react';
+import { LoginResult, User } from '../types';
+import { Code2, Mail, Lock, ArrowRight, Loader2, ShieldCheck } from 'lucide-react';
 
 interface LoginProps {
   onLogin: (user: User, token: string) => void;
@@ -13,15 +13,68 @@ const Login: React.FC<LoginProps> = ({ onLogin }) => {
   const [password, setPassword] = useState('');
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState('');
+  const [ssoEnabled, setSsoEnabled] = useState(false);
+  const [forgotPassword, setForgotPassword] = useState(false);
+  const [notice, setNotice] = useState('');
+  const [challengeToken, setChallengeToken] = useState('');
+  const [code, setCode] = useState('');
+
+  // Accounts with two-factor authentication continue to the code step
+  const finishLogin = (result: LoginResult) => {
+    if ('twoFactorRequired' in result) {
+      setChallengeToken(result.challengeToken);
+      setCode('');
+      return;
+    }
+    onLogin(result.user, result.token);
+  };
+
+  useEffect(() => {
+    api.getOIDCConfig().then(config => setSsoEnabled(config.enabled)).catch(() => setSsoEnabled(false));
+
+    // Returning from the identity provider
+    const params = new URLSearchParams(window.location.search);
+    const ssoCode = params.get('oidc_code');
+    const ssoError = params.get('oidc_error');
+    if (ssoCode || ssoError) {
+      window.history.replaceState({}, '', window.location.pathname);
+    }
+    if (ssoError) {
+      setError(ssoError);
+    }
+    if (ssoCode) {
+      setLoading(true);
+      api.oidcExchange(ssoCode)
+        .then(finishLogin)
+        .catch((err: any) => setError(err.message || 'Single sign-on failed. Please try again.'))
+        .finally(() => setLoading(false));
+    }
+  }, []);
+
+  const handleForgotPassword = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setLoading(true);
+    setError('');
+
+    try {
+      const result = await api.forgotPassword(email);
+      setNotice(result.message);
+      setForgotPassword(false);
+    } catch (err: any) {
+      setError(err.message || 'Could not send a reset link. Please try again.');
+    } finally {
+      setLoading(false);
+    }
+  };
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
     setLoading(true);
     setError('');
+    setNotice('');
     
     try {
-      const result = await api.login(email, password);
-      onLogin(result.user, result.token);
+      finishLogin(await api.login(email, password));
     } catch (err: any) {
       setError(err.message || 'Invalid credentials. Please try again.');
     } finally {
@@ -29,6 +82,31 @@ const Login: React.FC<LoginProps> = ({ onLogin }) => {
     }
   };
 
+  const handleTwoFactor = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setLoading(true);
+    setError('');
+
+    try {
+      const result = await api.loginTwoFactor(challengeToken, code.trim());
+      onLogin(result.user, result.token);
+    } catch (err: any) {
+      setError(err.message || 'Invalid authentication code. Please try again.');
+      // The challenge expires after a few minutes; start over from the password
+      if (err.message === 'Invalid or expired challenge') {
+        setChallengeToken('');
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const cancelTwoFactor = () => {
+    setChallengeToken('');
+    setCode('');
+    setError('');
+  };
+
   return (
     <div className="min-h-screen bg-slate-950 flex flex-col items-center justify-center p-4">
       <div className="w-full max-w-md bg-slate-900 border border-slate-800 rounded-2xl shadow-2xl p-8">
@@ -40,58 +118,163 @@ const Login: React.FC<LoginProps> = ({ onLogin }) => {
           <p className="text-slate-400 text-center">Your companion for technical interview mastery.</p>
         </div>
 
-        <form onSubmit={handleSubmit} className="space-y-6">
-          <div className="space-y-2">
-            <label className="text-sm font-medium text-slate-300">Email Address</label>
-            <div className="relative">
-              <Mail className="absolute left-3 top-3 text-slate-500" size={20} />
-              <input 
-                type="email"
-                value={email}
-                onChange={(e) => setEmail(e.target.value)}
-                required
-                className="w-full bg-slate-800 border border-slate-700 rounded-lg pl-10 pr-4 py-2.5 focus:outline-none focus:ring-2 focus:ring-indigo-500 text-white transition-all"
-                placeholder="you@example.com"
-              />
-            </div>
+        {notice && (
+          <div className="mb-6 p-3 bg-emerald-500/10 border border-emerald-500/20 rounded-lg text-emerald-400 text-sm">
+            {notice}
           </div>
+        )}
 
-          <div className="space-y-2">
-            <label className="text-sm font-medium text-slate-300">Password</label>
-            <div className="relative">
-              <Lock className="absolute left-3 top-3 text-slate-500" size={20} />
-              <input 
-                type="password"
-                value={password}
-                onChange={(e) => setPassword(e.target.value)}
-                required
-                className="w-full bg-slate-800 border border-slate-700 rounded-lg pl-10 pr-4 py-2.5 focus:outline-none focus:ring-2 focus:ring-indigo-500 text-white transition-all"
-                placeholder="••••••••"
-              />
+        {challengeToken ? (
+          <form onSubmit={handleTwoFactor} className="space-y-6">
+            <div className="space-y-2">
+              <label className="text-sm font-medium text-slate-300">Authentication Code</label>
+              <div className="relative">
+                <ShieldCheck className="absolute left-3 top-3 text-slate-500" size={20} />
+                <input
+                  type="text"
+                  value={code}
+                  onChange={(e) => setCode(e.target.value)}
+                  required
+                  autoFocus
+                  autoComplete="one-time-code"
+                  className="w-full bg-slate-800 border border-slate-700 rounded-lg pl-10 pr-4 py-2.5 focus:outline-none focus:ring-2 focus:ring-indigo-500 text-white font-mono tracking-widest transition-all"
+                  placeholder="123456"
+                />
+              </div>
+              <p className="text-xs text-slate-500">Enter the code from your authenticator app, or one of your recovery codes.</p>
             </div>
-          </div>
 
-          {error && (
-            <div className="p-3 bg-red-500/10 border border-red-500/20 rounded-lg text-red-400 text-sm">
-              {error}
+            {error && (
+              <div className="p-3 bg-red-500/10 border border-red-500/20 rounded-lg text-red-400 text-sm">
+                {error}
+              </div>
+            )}
+
+            <button
+              type="submit"
+              disabled={loading}
+              className="w-full bg-indigo-600 hover:bg-indigo-500 text-white font-semibold py-3 rounded-lg flex items-center justify-center gap-2 transition-all active:scale-95 disabled:opacity-50"
+            >
+              {loading ? <Loader2 size={20} className="animate-spin" /> : 'Verify'}
+            </button>
+
+            <button
+              type="button"
+              onClick={cancelTwoFactor}
+              className="w-full text-sm text-slate-400 hover:text-white"
+            >
+              Back to sign in
+            </button>
+          </form>
+        ) : forgotPassword ? (
+          <form onSubmit={handleForgotPassword} className="space-y-6">
+            <div className="space-y-2">
+              <label className="text-sm font-medium text-slate-300">Email Address</label>
+              <div className="relative">
+                <Mail className="absolute left-3 top-3 text-slate-500" size={20} />
+                <input
+                  type="email"
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                  required
+                  className="w-full bg-slate-800 border border-slate-700 rounded-lg pl-10 pr-4 py-2.5 focus:outline-none focus:ring-2 focus:ring-indigo-500 text-white transition-all"
+                  placeholder="you@example.com"
+                />
+              </div>
             </div>
-          )}
 
-          <button 
-            type="submit" 
-            disabled={loading}
-            className="w-full bg-indigo-600 hover:bg-indigo-500 text-white font-semibold py-3 rounded-lg flex items-center justify-center gap-2 transition-all active:scale-95 disabled:opacity-50"
-          >
-            {loading ? (
-              <Loader2 size={20} className="animate-spin" />
-            ) : (
-              <>
-                Sign In
-                <ArrowRight size={20} />
-              </>
+            {error && (
+              <div className="p-3 bg-red-500/10 border border-red-500/20 rounded-lg text-red-400 text-sm">
+                {error}
+              </div>
+            )}
+
+            <button
+              type="submit"
+              disabled={loading}
+              className="w-full bg-indigo-600 hover:bg-indigo-500 text-white font-semibold py-3 rounded-lg flex items-center justify-center gap-2 transition-all active:scale-95 disabled:opacity-50"
+            >
+              {loading ? <Loader2 size={20} className="animate-spin" /> : 'Email Me a Reset Link'}
+            </button>
+
+            <button
+              type="button"
+              onClick={() => { setForgotPassword(false); setError(''); }}
+              className="w-full text-sm text-slate-400 hover:text-white"
+            >
+              Back to sign in
+            </button>
+          </form>
+        ) : (
+          <form onSubmit={handleSubmit} className="space-y-6">
+            <div className="space-y-2">
+              <label className="text-sm font-medium text-slate-300">Email Address</label>
+              <div className="relative">
+                <Mail className="absolute left-3 top-3 text-slate-500" size={20} />
+                <input 
+                  type="email"
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                  required
+                  className="w-full bg-slate-800 border border-slate-700 rounded-lg pl-10 pr-4 py-2.5 focus:outline-none focus:ring-2 focus:ring-indigo-500 text-white transition-all"
+                  placeholder="you@example.com"
+                />
+              </div>
+            </div>
+
+            <div className="space-y-2">
+              <label className="text-sm font-medium text-slate-300">Password</label>
+              <div className="relative">
+                <Lock className="absolute left-3 top-3 text-slate-500" size={20} />
+                <input 
+                  type="password"
+                  value={password}
+                  onChange={(e) => setPassword(e.target.value)}
+                  required
+                  className="w-full bg-slate-800 border border-slate-700 rounded-lg pl-10 pr-4 py-2.5 focus:outline-none focus:ring-2 focus:ring-indigo-500 text-white transition-all"
+                  placeholder="••••••••"
+                />
+              </div>
+              <button
+                type="button"
+                onClick={() => { setForgotPassword(true); setError(''); setNotice(''); }}
+                className="text-xs text-indigo-400 hover:text-indigo-300"
+              >
+                Forgot password?
+              </button>
+            </div>
+
+            {error && (
+              <div className="p-3 bg-red-500/10 border border-red-500/20 rounded-lg text-red-400 text-sm">
+                {error}
+              </div>
             )}
-          </button>
-        </form>
+
+            <button 
+              type="submit" 
+              disabled={loading}
+              className="w-full bg-indigo-600 hover:bg-indigo-500 text-white font-semibold py-3 rounded-lg flex items-center justify-center gap-2 transition-all active:scale-95 disabled:opacity-50"
+            >
+              {loading ? (
+                <Loader2 size={20} className="animate-spin" />
+        ) : (
+                <>
+                  Sign In
+                  <ArrowRight size={20} />
+                </>
+              )}
+            </button>
+          </form>
+        )}
+
+        {ssoEnabled && (
+          <a
+            href={api.oidcLoginUrl}
+            className="mt-4 w-full border border-slate-700 hover:bg-slate-800 text-slate-200 font-semibold py-3 rounded-lg flex items-center justify-center gap-2 transition-all"
+          >
+            Sign in with SSO
+          </a>
+        )}
 
         <div className="mt-6 p-4 bg-indigo-500/10 border border-indigo-500/20 rounded-lg">
           <p className="text-xs font-semibold text-indigo-400 uppercase tracking-wider mb-2">Demo Account</p>
@@ -0,0 +1,120 @@
+import React, { useState } from 'react';
+import { api } from '../services/apiService';
+import { Code2, Lock, ArrowRight, CheckCircle2, Loader2 } from 'lucide-react';
+
+interface ResetPasswordProps {
+  token: string;
+  onDone: () => void;
+}
+
+// ResetPassword is opened from the link in the password reset email
+const ResetPassword: React.FC<ResetPasswordProps> = ({ token, onDone }) => {
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [loading, setLoading] = useState(false);
+  const [message, setMessage] = useState('');
+  const [error, setError] = useState(token ? '' : 'This reset link is missing its token.');
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (password !== confirmPassword) {
+      setError('Passwords do not match.');
+      return;
+    }
+    setLoading(true);
+    setError('');
+
+    try {
+      const result = await api.resetPassword(token, password);
+      setMessage(result.message);
+    } catch (err: any) {
+      setError(err.message || 'Could not reset your password.');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  return (
+    <div className="min-h-screen bg-slate-950 flex flex-col items-center justify-center p-4">
+      <div className="w-full max-w-md bg-slate-900 border border-slate-800 rounded-2xl shadow-2xl p-8">
+        <div className="flex flex-col items-center mb-8">
+          <div className="bg-indigo-600/20 p-4 rounded-xl mb-4">
+            <Code2 size={40} className="text-indigo-500" />
+          </div>
+          <h1 className="text-3xl font-bold text-white mb-2">Reset Password</h1>
+          <p className="text-slate-400 text-center">Choose a new password. You will be signed out everywhere.</p>
+        </div>
+
+        {message ? (
+          <>
+            <div className="p-3 bg-emerald-500/10 border border-emerald-500/20 rounded-lg text-emerald-400 text-sm flex items-center gap-2">
+              <CheckCircle2 size={18} />
+              {message}
+            </div>
+            <button
+              onClick={onDone}
+              className="mt-6 w-full bg-indigo-600 hover:bg-indigo-500 text-white font-semibold py-3 rounded-lg transition-all active:scale-95"
+            >
+              Go to Sign In
+            </button>
+          </>
+        ) : (
+          <form onSubmit={handleSubmit} className="space-y-6">
+            <div className="space-y-2">
+              <label className="text-sm font-medium text-slate-300">New Password</label>
+              <div className="relative">
+                <Lock className="absolute left-3 top-3 text-slate-500" size={20} />
+                <input
+                  type="password"
+                  value={password}
+                  onChange={(e) => setPassword(e.target.value)}
+                  required
+                  className="w-full bg-slate-800 border border-slate-700 rounded-lg pl-10 pr-4 py-2.5 focus:outline-none focus:ring-2 focus:ring-indigo-500 text-white transition-all"
+                  placeholder="••••••••"
+                />
+              </div>
+            </div>
+
+            <div className="space-y-2">
+              <label className="text-sm font-medium text-slate-300">Confirm Password</label>
+              <div className="relative">
+                <Lock className="absolute left-3 top-3 text-slate-500" size={20} />
+                <input
+                  type="password"
+                  value={confirmPassword}
+                  onChange={(e) => setConfirmPassword(e.target.value)}
+                  required
+                  className="w-full bg-slate-800 border border-slate-700 rounded-lg pl-10 pr-4 py-2.5 focus:outline-none focus:ring-2 focus:ring-indigo-500 text-white transition-all"
+                  placeholder="••••••••"
+                />
+              </div>
+            </div>
+
+            {error && (
+              <div className="p-3 bg-red-500/10 border border-red-500/20 rounded-lg text-red-400 text-sm">
+                {error}
+              </div>
+            )}
+
+            <button
+              type="submit"
+              disabled={loading || !token}
+              className="w-full bg-indigo-600 hover:bg-indigo-500 text-white font-semibold py-3 rounded-lg flex items-center justify-center gap-2 transition-all active:scale-95 disabled:opacity-50"
+            >
+              {loading ? (
+                <Loader2 size={20} className="animate-spin" />
+              ) : (
+                <>
+                  Set New Password
+                  <ArrowRight size={20} />
+                </>
+              )}
+            </button>
+          </form>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default ResetPassword;
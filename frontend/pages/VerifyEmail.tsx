@@ -0,0 +1,81 @@
+import React, { useEffect, useState } from 'react';
+import { api } from '../services/apiService';
+import { Code2, CheckCircle2, Loader2 } from 'lucide-react';
+
+interface VerifyEmailProps {
+  token: string;
+  onDone: () => void;
+}
+
+// VerifyEmail is opened from the link in the verification email
+const VerifyEmail: React.FC<VerifyEmailProps> = ({ token, onDone }) => {
+  const [loading, setLoading] = useState(true);
+  const [message, setMessage] = useState('');
+  const [error, setError] = useState('');
+
+  useEffect(() => {
+    if (!token) {
+      setError('This verification link is missing its token.');
+      setLoading(false);
+      return;
+    }
+    api.verifyEmail(token)
+      .then(result => {
+        setMessage(result.message);
+        // A signed in user keeps their stored profile; mark it verified too
+        const storedUser = localStorage.getItem('user');
+        if (storedUser) {
+          try {
+            localStorage.setItem('user', JSON.stringify({ ...JSON.parse(storedUser), emailVerified: true }));
+          } catch {
+            // Leave an unreadable profile alone; it is replaced at the next sign in
+          }
+        }
+      })
+      .catch((err: any) => setError(err.message || 'Could not verify your email.'))
+      .finally(() => setLoading(false));
+  }, [token]);
+
+  return (
+    <div className="min-h-screen bg-slate-950 flex flex-col items-center justify-center p-4">
+      <div className="w-full max-w-md bg-slate-900 border border-slate-800 rounded-2xl shadow-2xl p-8">
+        <div className="flex flex-col items-center mb-8">
+          <div className="bg-indigo-600/20 p-4 rounded-xl mb-4">
+            <Code2 size={40} className="text-indigo-500" />
+          </div>
+          <h1 className="text-3xl font-bold text-white mb-2">Verify Email</h1>
+        </div>
+
+        {loading && (
+          <div className="flex justify-center text-slate-400">
+            <Loader2 size={24} className="animate-spin" />
+          </div>
+        )}
+
+        {message && (
+          <div className="p-3 bg-emerald-500/10 border border-emerald-500/20 rounded-lg text-emerald-400 text-sm flex items-center gap-2">
+            <CheckCircle2 size={18} />
+            {message}
+          </div>
+        )}
+
+        {error && (
+          <div className="p-3 bg-red-500/10 border border-red-500/20 rounded-lg text-red-400 text-sm">
+            {error}
+          </div>
+        )}
+
+        {!loading && (
+          <button
+            onClick={onDone}
+            className="mt-6 w-full bg-indigo-600 hover:bg-indigo-500 text-white font-semibold py-3 rounded-lg transition-all active:scale-95"
+          >
+            Continue to AlgoVault
+          </button>
+        )}
+      </div>
+    </div>
+  );
+};
+
+export default VerifyEmail;
@@ -1,5 +1,5 @@
 
-import { Category, Pattern, Problem, User } from '../types';
+import { AuthSession, Category, Language, LoginResult, Pattern, Problem, Solution, TestCaseInput } from '../types';
 
 // Use environment variable for API URL, fallback to localhost for development
 const API_BASE_URL = import.meta.env.VITE_API_BASE_URL
@@ -14,11 +14,57 @@ const getAuthHeaders = () => {
   };
 };
 
+// Shared so concurrent 401s trigger a single refresh; refresh tokens are single use
+let refreshInFlight: Promise<boolean> | null = null;
+
+const refreshAccessToken = (): Promise<boolean> => {
+  if (!refreshInFlight) {
+    refreshInFlight = (async () => {
+      const refreshToken = localStorage.getItem('refreshToken');
+      if (!refreshToken) return false;
+      try {
+        const response = await fetch(`${API_BASE_URL}/token/refresh`, {
+          method: 'POST',
+          headers: { 'Content-Type': 'application/json' },
+          body: JSON.stringify({ refreshToken }),
+        });
+        if (!response.ok) return false;
+        const data = await response.json();
+        localStorage.setItem('token', data.token);
+        localStorage.setItem('refreshToken', data.refreshToken);
+        return true;
+      } catch {
+        return false;
+      }
+    })().finally(() => {
+      refreshInFlight = null;
+    });
+  }
+  return refreshInFlight;
+};
+
+// authFetch retries a request once with a new access token when the current one has expired
+const authFetch = async (input: string, init: RequestInit = {}): Promise<Response> => {
+  const response = await fetch(input, { ...init, headers: getAuthHeaders() });
+  if (response.status !== 401 || !(await refreshAccessToken())) {
+    return response;
+  }
+  return fetch(input, { ...init, headers: getAuthHeaders() });
+};
+
+const storeSession = <T extends { refreshToken?: string }>(data: T): T => {
+  if (data.refreshToken) {
+    localStorage.setItem('refreshToken', data.refreshToken);
+  }
+  return data;
+};
+
 const handleResponse = async (response: Response) => {
   if (response.status === 401) {
     // If we're on the login page, don't trigger a reload loop
     if (!window.location.pathname.includes('login')) {
       localStorage.removeItem('token');
+      localStorage.removeItem('refreshToken');
       window.location.reload();
     }
     // Try to get error message from response
@@ -36,18 +82,39 @@ const handleResponse = async (response: Response) => {
   return response.json();
 };
 
+// handleSignInResponse is used by the sign-in steps, where a 401 means bad
+// credentials or an expired challenge rather than an expired session
+const handleSignInResponse = async (response: Response) => {
+  if (!response.ok) {
+    const error = await response.json().catch(() => ({}));
+    throw new Error(error.error || `API Request failed with status ${response.status}`);
+  }
+  return response.json();
+};
+
 export const api = {
   // Auth
-  login: async (email: string, password: string): Promise<{ token: string, user: User }> => {
+  // Accounts with two-factor authentication get a challenge to complete with loginTwoFactor
+  login: async (email: string, password: string): Promise<LoginResult> => {
     const response = await fetch(`${API_BASE_URL}/login`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
       body: JSON.stringify({ email, password }),
     });
-    return handleResponse(response);
+    return storeSession(await handleSignInResponse(response));
   },
 
-  register: async (email: string, password: string, name: string): Promise<{ token: string, user: User }> => {
+  loginTwoFactor: async (challengeToken: string, code: string): Promise<AuthSession> => {
+    const response = await fetch(`${API_BASE_URL}/login/2fa`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ challengeToken, code }),
+    });
+    return storeSession(await handleSignInResponse(response));
+  },
+
+  // Registration answers the same for taken emails, so the user signs in afterwards
+  register: async (email: string, password: string, name: string): Promise<{ message: string }> => {
     const response = await fetch(`${API_BASE_URL}/register`, {
       method: 'POST',
       headers: { 'Content-Type': 'application/json' },
@@ -56,16 +123,79 @@ export const api = {
     return handleResponse(response);
   },
 
+  getOIDCConfig: async (): Promise<{ enabled: boolean }> => {
+    const response = await fetch(`${API_BASE_URL}/oidc/config`);
+    return handleResponse(response);
+  },
+
+  // The browser is sent here to start single sign-on; the provider redirects back with ?oidc_code=
+  oidcLoginUrl: `${API_BASE_URL}/oidc/login`,
+
+  oidcExchange: async (code: string): Promise<LoginResult> => {
+    const response = await fetch(`${API_BASE_URL}/oidc/exchange`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ code }),
+    });
+    return storeSession(await handleSignInResponse(response));
+  },
+
+  // Links emailed by the backend land on /verify-email and /reset-password with ?token=
+  verifyEmail: async (token: string): Promise<{ message: string }> => {
+    const response = await fetch(`${API_BASE_URL}/email/verify`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ token }),
+    });
+    return handleResponse(response);
+  },
+
+  resendVerificationEmail: async (): Promise<{ message: string }> => {
+    const response = await authFetch(`${API_BASE_URL}/email/verify/resend`, {
+      method: 'POST',
+      headers: getAuthHeaders(),
+    });
+    return handleResponse(response);
+  },
+
+  forgotPassword: async (email: string): Promise<{ message: string }> => {
+    const response = await fetch(`${API_BASE_URL}/password/forgot`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ email }),
+    });
+    return handleResponse(response);
+  },
+
+  resetPassword: async (token: string, newPassword: string): Promise<{ message: string }> => {
+    const response = await fetch(`${API_BASE_URL}/password/reset`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ token, newPassword }),
+    });
+    return handleResponse(response);
+  },
+
+  logout: async (): Promise<void> => {
+    const refreshToken = localStorage.getItem('refreshToken');
+    localStorage.removeItem('refreshToken');
+    await fetch(`${API_BASE_URL}/logout`, {
+      method: 'POST',
+      headers: getAuthHeaders(),
+      body: JSON.stringify({ refreshToken }),
+    }).catch(() => undefined);
+  },
+
   // Categories
   getCategories: async (): Promise<Category[]> => {
-    const response = await fetch(`${API_BASE_URL}/categories`, {
+    const response = await authFetch(`${API_BASE_URL}/categories`, {
       headers: getAuthHeaders(),
     });
     return handleResponse(response);
   },
 
   createCategory: async (category: Partial<Category>): Promise<Category> => {
-    const response = await fetch(`${API_BASE_URL}/categories`, {
+    const response = await authFetch(`${API_BASE_URL}/categories`, {
       method: 'POST',
       headers: getAuthHeaders(),
       body: JSON.stringify(category),
@@ -74,7 +204,7 @@ export const api = {
   },
 
   updateCategory: async (id: string, category: Partial<Category>): Promise<Category> => {
-    const response = await fetch(`${API_BASE_URL}/categories/${id}`, {
+    const response = await authFetch(`${API_BASE_URL}/categories/${id}`, {
       method: 'PUT',
       headers: getAuthHeaders(),
       body: JSON.stringify(category),
@@ -83,7 +213,7 @@ export const api = {
   },
 
   deleteCategory: async (id: string): Promise<void> => {
-    const response = await fetch(`${API_BASE_URL}/categories/${id}`, {
+    const response = await authFetch(`${API_BASE_URL}/categories/${id}`, {
       method: 'DELETE',
       headers: getAuthHeaders(),
     });
@@ -92,14 +222,14 @@ export const api = {
 
   // Patterns
   getPatterns: async (categoryId: string): Promise<Pattern[]> => {
-    const response = await fetch(`${API_BASE_URL}/categories/${categoryId}/patterns`, {
+    const response = await authFetch(`${API_BASE_URL}/categories/${categoryId}/patterns`, {
       headers: getAuthHeaders(),
     });
     return handleResponse(response);
   },
 
   createPattern: async (categoryId: string, pattern: Partial<Pattern>): Promise<Pattern> => {
-    const response = await fetch(`${API_BASE_URL}/categories/${categoryId}/patterns`, {
+    const response = await authFetch(`${API_BASE_URL}/categories/${categoryId}/patterns`, {
       method: 'POST',
       headers: getAuthHeaders(),
       body: JSON.stringify(pattern),
@@ -108,7 +238,7 @@ export const api = {
   },
 
   updatePattern: async (id: string, pattern: Partial<Pattern>): Promise<Pattern> => {
-    const response = await fetch(`${API_BASE_URL}/patterns/${id}`, {
+    const response = await authFetch(`${API_BASE_URL}/patterns/${id}`, {
       method: 'PUT',
       headers: getAuthHeaders(),
       body: JSON.stringify(pattern),
@@ -117,7 +247,7 @@ export const api = {
   },
 
   deletePattern: async (id: string): Promise<void> => {
-    const response = await fetch(`${API_BASE_URL}/patterns/${id}`, {
+    const response = await authFetch(`${API_BASE_URL}/patterns/${id}`, {
       method: 'DELETE',
       headers: getAuthHeaders(),
     });
@@ -125,7 +255,7 @@ export const api = {
   },
 
   updatePatternTheory: async (id: string, theory: string): Promise<void> => {
-    const response = await fetch(`${API_BASE_URL}/patterns/${id}/theory`, {
+    const response = await authFetch(`${API_BASE_URL}/patterns/${id}/theory`, {
       method: 'PUT',
       headers: getAuthHeaders(),
       body: JSON.stringify({ theory }),
@@ -135,21 +265,21 @@ export const api = {
 
   // Problems
   getProblems: async (patternId: string): Promise<Problem[]> => {
-    const response = await fetch(`${API_BASE_URL}/patterns/${patternId}/problems`, {
+    const response = await authFetch(`${API_BASE_URL}/patterns/${patternId}/problems`, {
       headers: getAuthHeaders(),
     });
     return handleResponse(response);
   },
 
   getProblem: async (id: string): Promise<Problem> => {
-    const response = await fetch(`${API_BASE_URL}/problems/${id}`, {
+    const response = await authFetch(`${API_BASE_URL}/problems/${id}`, {
       headers: getAuthHeaders(),
     });
     return handleResponse(response);
   },
 
   createProblem: async (patternId: string, problem: Partial<Problem>): Promise<Problem> => {
-    const response = await fetch(`${API_BASE_URL}/patterns/${patternId}/problems`, {
+    const response = await authFetch(`${API_BASE_URL}/patterns/${patternId}/problems`, {
       method: 'POST',
       headers: getAuthHeaders(),
       body: JSON.stringify(problem),
@@ -158,7 +288,7 @@ export const api = {
   },
 
   updateProblem: async (id: string, problem: Partial<Problem>): Promise<Problem> => {
-    const response = await fetch(`${API_BASE_URL}/problems/${id}`, {
+    const response = await authFetch(`${API_BASE_URL}/problems/${id}`, {
       method: 'PUT',
       headers: getAuthHeaders(),
       body: JSON.stringify(problem),
@@ -167,7 +297,48 @@ export const api = {
   },
 
   deleteProblem: async (id: string): Promise<void> => {
-    const response = await fetch(`${API_BASE_URL}/problems/${id}`, {
+    const response = await authFetch(`${API_BASE_URL}/problems/${id}`, {
+      method: 'DELETE',
+      headers: getAuthHeaders(),
+    });
+    return handleResponse(response);
+  },
+
+  // Solutions
+  getLanguages: async (): Promise<Language[]> => {
+    const response = await authFetch(`${API_BASE_URL}/languages`, {
+      headers: getAuthHeaders(),
+    });
+    return handleResponse(response);
+  },
+
+  getSolutions: async (problemId: string): Promise<Solution[]> => {
+    const response = await authFetch(`${API_BASE_URL}/problems/${problemId}/solutions`, {
+      headers: getAuthHeaders(),
+    });
+    return handleResponse(response);
+  },
+
+  createSolution: async (problemId: string, language: Solution['language'], code: string): Promise<Solution> => {
+    const response = await authFetch(`${API_BASE_URL}/problems/${problemId}/solutions`, {
+      method: 'POST',
+      headers: getAuthHeaders(),
+      body: JSON.stringify({ language, code }),
+    });
+    return handleResponse(response);
+  },
+
+  updateSolution: async (problemId: string, language: Solution['language'], code: string): Promise<Solution> => {
+    const response = await authFetch(`${API_BASE_URL}/problems/${problemId}/solutions/${language}`, {
+      method: 'PUT',
+      headers: getAuthHeaders(),
+      body: JSON.stringify({ code }),
+    });
+    return handleResponse(response);
+  },
+
+  deleteSolution: async (problemId: string, language: Solution['language']): Promise<void> => {
+    const response = await authFetch(`${API_BASE_URL}/problems/${problemId}/solutions/${language}`, {
       method: 'DELETE',
       headers: getAuthHeaders(),
     });
@@ -187,7 +358,7 @@ export const api = {
     explanation: string;
     notes: string;
   }> => {
-    const response = await fetch(`${API_BASE_URL}/ai/generate-problem`, {
+    const response = await authFetch(`${API_BASE_URL}/ai/generate-problem`, {
       method: 'POST',
       headers: getAuthHeaders(),
       body: JSON.stringify({ query }),
@@ -196,7 +367,7 @@ export const api = {
   },
 
   generateCategoryDescription: async (name: string, prompt?: string): Promise<{ description: string }> => {
-    const response = await fetch(`${API_BASE_URL}/ai/generate-category-description`, {
+    const response = await authFetch(`${API_BASE_URL}/ai/generate-category-description`, {
       method: 'POST',
       headers: getAuthHeaders(),
       body: JSON.stringify({ name, prompt: prompt || '' }),
@@ -205,7 +376,7 @@ export const api = {
   },
 
   generatePatternContent: async (name: string, categoryName: string, contentType: 'description' | 'theory', prompt?: string): Promise<{ content: string }> => {
-    const response = await fetch(`${API_BASE_URL}/ai/generate-pattern-content`, {
+    const response = await authFetch(`${API_BASE_URL}/ai/generate-pattern-content`, {
       method: 'POST',
       headers: getAuthHeaders(),
       body: JSON.stringify({ name, categoryName, contentType, prompt: prompt || '' }),
@@ -224,8 +395,9 @@ export const api = {
     sampleOutput: string;
     explanation: string;
     notes: string;
+    testCases?: TestCaseInput[];
   }> => {
-    const response = await fetch(`${API_BASE_URL}/external/fetch-problem/${problemId}`, {
+    const response = await authFetch(`${API_BASE_URL}/external/fetch-problem/${problemId}`, {
       headers: getAuthHeaders(),
     });
     return handleResponse(response);
@@ -233,28 +405,28 @@ export const api = {
 
   // Learning Resources
   getLearningTopics: async (): Promise<any[]> => {
-    const response = await fetch(`${API_BASE_URL}/learning/topics`, {
+    const response = await authFetch(`${API_BASE_URL}/learning/topics`, {
       headers: getAuthHeaders(),
     });
     return handleResponse(response);
   },
 
   getLearningTopicBySlug: async (slug: string): Promise<any> => {
-    const response = await fetch(`${API_BASE_URL}/learning/topics/${slug}`, {
+    const response = await authFetch(`${API_BASE_URL}/learning/topics/${slug}`, {
       headers: getAuthHeaders(),
     });
     return handleResponse(response);
   },
 
   getLearningResources: async (topicId: string): Promise<any[]> => {
-    const response = await fetch(`${API_BASE_URL}/learning/topics/${topicId}/resources`, {
+    const response = await authFetch(`${API_BASE_URL}/learning/topics/${topicId}/resources`, {
       headers: getAuthHeaders(),
     });
     return handleResponse(response);
   },
 
   getRoadmap: async (topicId: string): Promise<any[]> => {
-    const response = await fetch(`${API_BASE_URL}/learning/topics/${topicId}/roadmap`, {
+    const response = await authFetch(`${API_BASE_URL}/learning/topics/${topicId}/roadmap`, {
       headers: getAuthHeaders(),
     });
     return handleResponse(response);
@@ -269,7 +441,7 @@ export const api = {
       problemsCreated: number;
     };
   }> => {
-    const response = await fetch(`${API_BASE_URL}/external/fetch-all`, {
+    const response = await authFetch(`${API_BASE_URL}/external/fetch-all`, {
       method: 'POST',
       headers: getAuthHeaders(),
     });
@@ -277,7 +449,7 @@ export const api = {
   },
 
   clearAllData: async (): Promise<{ message: string }> => {
-    const response = await fetch(`${API_BASE_URL}/external/clear-all`, {
+    const response = await authFetch(`${API_BASE_URL}/external/clear-all`, {
       method: 'POST',
       headers: getAuthHeaders(),
     });
@@ -5,6 +5,8 @@ export interface Category {
   icon: string;
   description: string;
   patternCount?: number;
+  problemCount?: number;
+  solvedCount?: number;
 }
 
 export interface Pattern {
@@ -15,12 +17,220 @@ export interface Pattern {
   description: string;
   theory?: string; // Markdown content
   problemCount?: number;
+  solvedCount?: number;
+}
+
+export interface ProblemProgress {
+  status: 'unsolved' | 'attempted' | 'solved' | 'mastered';
+  attemptCount: number;
+  confidence: number; // 1-5, 0 when not rated
+  firstSolvedAt?: string;
+  lastSolvedAt?: string;
+  easeFactor: number;
+  intervalDays: number;
+  repetitions: number;
+  dueAt?: string;
+  lastReviewedAt?: string;
+  updatedAt?: string;
+}
+
+export interface Attempt {
+  id: string;
+  problemId: string;
+  language: string;
+  code: string;
+  outcome: 'solved' | 'partial' | 'failed' | 'gave_up';
+  reflection: string;
+  startedAt: string;
+  endedAt: string;
+  durationSeconds: number;
+  createdAt: string;
+}
+
+export interface Language {
+  id: Solution['language'];
+  name: string;
+  extension: string;
+  runnable: boolean; // Whether the server can run it
 }
 
 export interface Solution {
   id: string;
   language: 'cpp' | 'go' | 'python' | 'java' | 'javascript';
   code: string;
+  measuredTimeComplexity?: string;
+  measuredSpaceComplexity?: string;
+  benchmarkedAt?: string;
+}
+
+export interface RunResult {
+  status: 'ok' | 'compile_error' | 'runtime_error' | 'time_limit' | 'memory_limit';
+  stdout: string;
+  stderr: string;
+  outputTruncated?: boolean;
+  exitCode: number;
+  signal?: string;
+  timeMs: number;
+  cpuTimeMs: number;
+  memoryKb: number;
+}
+
+export interface TestCaseInput {
+  input: string;
+  expectedOutput: string;
+  hidden: boolean; // Input and expected output are blank for non-editors
+  explanation: string; // Markdown
+}
+
+export interface TestCase extends TestCaseInput {
+  id: string;
+  problemId: string;
+  position: number;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface ProblemChecker {
+  problemId: string;
+  mode: 'exact' | 'whitespace' | 'unordered' | 'float' | 'custom';
+  epsilon?: number; // float mode only
+  language?: string; // custom mode only
+  code?: string; // custom mode only
+  updatedAt?: string;
+}
+
+export interface StressConfig {
+  problemId: string;
+  generatorLanguage: string;
+  generatorCode: string; // Reads "<seed> <size>" and prints one input
+  bruteForceLanguage: string;
+  bruteForceCode: string;
+  updatedAt?: string;
+}
+
+export interface StressFailure {
+  seed: number;
+  size: number;
+  originalSize: number;
+  verdict: 'WA' | 'TLE' | 'RE' | 'MLE' | 'CF';
+  input: string;
+  expectedOutput: string;
+  actualOutput: string;
+  stderr?: string;
+  checkerMessage?: string;
+}
+
+export interface StressResult {
+  status: 'passed' | 'failed' | 'program_error' | 'timed_out';
+  checker: ProblemChecker['mode'];
+  seed: number;
+  iterations: number;
+  maxSize: number;
+  completed: number;
+  compile?: RunResult;
+  failure?: StressFailure;
+  programError?: {
+    program: 'generator' | 'bruteForce';
+    seed?: number;
+    size?: number;
+    input?: string;
+    result: RunResult;
+  };
+}
+
+export interface BenchmarkPoint {
+  size: number;
+  status: RunResult['status'];
+  timeMs: number;
+  cpuTimeMs: number;
+  memoryKb: number;
+}
+
+export interface SolutionBenchmark {
+  id: string;
+  problemId: string;
+  language: Solution['language'];
+  userId: string;
+  status: 'running' | 'completed' | 'failed';
+  minSize: number;
+  maxSize: number;
+  repeats: number;
+  points: BenchmarkPoint[];
+  timeComplexity?: string;
+  spaceComplexity?: string;
+  error?: string;
+  startedAt: string;
+  finishedAt?: string;
+}
+
+export type JudgeVerdict = 'AC' | 'WA' | 'TLE' | 'RE' | 'MLE' | 'CE' | 'CF';
+
+export interface JudgeCaseResult {
+  testCaseId: string;
+  position: number;
+  hidden: boolean;
+  verdict: Exclude<JudgeVerdict, 'CE'>;
+  timeMs: number;
+  cpuTimeMs: number;
+  memoryKb: number;
+  exitCode: number;
+  input?: string; // Left out for hidden cases unless the caller is an editor
+  expectedOutput?: string;
+  actualOutput?: string;
+  stderr?: string;
+  checkerMessage?: string;
+}
+
+export interface JudgeResult {
+  verdict: JudgeVerdict;
+  checker: ProblemChecker['mode'];
+  passed: number;
+  total: number;
+  maxTimeMs: number;
+  maxMemoryKb: number;
+  compile?: RunResult;
+  cases: JudgeCaseResult[];
+}
+
+export interface Revision {
+  id: string;
+  targetType: 'solution' | 'problem' | 'pattern' | 'approach';
+  targetId: string;
+  field: string; // Language of a solution or approach, problem field or theory
+  number: number;
+  content?: string; // Left out of listings
+  authorId: string;
+  authorEmail: string;
+  restoredFrom?: number;
+  createdAt: string;
+}
+
+export interface RevisionDiff {
+  from: number;
+  to: number;
+  diff: string; // Unified diff, empty when the revisions are equal
+}
+
+export interface ApproachSolution {
+  id: string;
+  approachId: string;
+  language: Solution['language'];
+  code: string;
+}
+
+export interface ApproachInput {
+  name: string;
+  intuition: string; // Markdown
+  timeComplexity: string;
+  spaceComplexity: string;
+  solutions: Pick<ApproachSolution, 'language' | 'code'>[];
+}
+
+export interface Approach extends Omit<ApproachInput, 'solutions'> {
+  id: string;
+  problemId: string;
+  position: number;
+  solutions: ApproachSolution[];
 }
 
 export interface Problem {
@@ -36,7 +246,82 @@ export interface Problem {
   sampleOutput: string; // Markdown
   explanation: string; // Markdown
   solutions: Solution[];
+  approaches?: Approach[];
   notes: string;
+  progress?: ProblemProgress;
+  testCases?: TestCaseInput[]; // Only sent when creating a problem
+}
+
+export interface InterviewSubmission {
+  id: string;
+  problemId: string;
+  language: string;
+  code: string;
+  outcome: 'solved' | 'partial' | 'failed';
+  elapsedSeconds: number;
+  submittedAt: string;
+}
+
+export interface InterviewProblem {
+  position: number;
+  problem: Problem; // solutions are only included once the session is over
+  submissions: InterviewSubmission[];
+  result?: {
+    outcome: 'solved' | 'partial' | 'failed' | 'unanswered';
+    points: number;
+    maxPoints: number;
+  };
+}
+
+export interface InterviewSession {
+  id: string;
+  workspaceId: string;
+  durationMinutes: number;
+  startedAt: string;
+  endsAt: string;
+  finishedAt?: string;
+  serverTime: string;
+  remainingSeconds: number;
+  active: boolean;
+  problemCount: number;
+  problems?: InterviewProblem[];
+  summary?: {
+    score: number; // 0-100
+    points: number;
+    maxPoints: number;
+    solved: number;
+    partial: number;
+    failed: number;
+    unanswered: number;
+    timeUsedSeconds: number;
+  };
+}
+
+export interface ProblemListItem {
+  problemId: string;
+  title: string;
+  difficulty: 'Easy' | 'Medium' | 'Hard';
+  patternId: string;
+  patternName: string;
+  position: number;
+  day?: number; // 1-based day of a study plan
+  date?: string; // YYYY-MM-DD, when the list has a start date
+  status: ProblemProgress['status'];
+  addedAt: string;
+}
+
+export interface ProblemList {
+  id: string;
+  workspaceId: string;
+  name: string;
+  description: string;
+  startDate?: string; // YYYY-MM-DD; lists with a start date are study plans
+  itemCount: number;
+  solvedCount: number;
+  progressPercent: number;
+  items?: ProblemListItem[];
+  createdAt: string;
+  updatedAt: string;
 }
 
 export interface User {
@@ -44,8 +329,26 @@ export interface User {
   email: string;
   name: string;
   role?: string; // 'admin' or 'demo'
+  emailVerified?: boolean; // Unverified accounts can only read
+  twoFactorEnabled?: boolean;
+  mustChangePassword?: boolean;
 }
 
+export interface AuthSession {
+  token: string;
+  refreshToken: string;
+  user: User;
+}
+
+// Returned instead of a session when the account has two-factor authentication
+export interface TwoFactorChallenge {
+  twoFactorRequired: true;
+  challengeToken: string;
+  expiresIn: number;
+}
+
+export type LoginResult = AuthSession | TwoFactorChallenge;
+
 export interface LearningTopic {
   id: string;
   name: string;